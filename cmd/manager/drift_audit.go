@@ -0,0 +1,27 @@
+package main
+
+import (
+	"github.com/klenkes74/aws-egressip-operator/pkg/controller"
+	"github.com/klenkes74/aws-egressip-operator/pkg/observability"
+	"github.com/klenkes74/aws-egressip-operator/pkg/openshift"
+	"os"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// setupDriftAudit -- adds the periodic drift audit of the egress IPs unless DRIFT_AUDIT_PERIOD is 0.
+func setupDriftAudit(mgr manager.Manager) {
+	period := openshift.DriftAuditPeriod()
+	if period == 0 {
+		log.Info("The drift audit is disabled.")
+		return
+	}
+
+	handler := openshift.NewEgressIPHandler(controller.CloudProvider(), *openshift.NewOcpClient(mgr.GetClient()))
+	auditor := openshift.NewDriftAuditor(*handler, openshift.DriftPolicyFromEnvironment(), period,
+		*observability.NewAlarmStore())
+
+	if err := mgr.Add(auditor); err != nil {
+		log.Error(err, "Can't add the drift audit")
+		os.Exit(11)
+	}
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"github.com/klenkes74/aws-egressip-operator/pkg/openshift"
+	"os"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// setupIPAnnotationCleanup -- adds the one-time removal of the stale IP-to-namespace annotations of the HostSubnets.
+func setupIPAnnotationCleanup(mgr manager.Manager) {
+	cleanup := openshift.NewIPAnnotationCleanup(*openshift.NewOcpClient(mgr.GetClient()))
+
+	if err := mgr.Add(cleanup); err != nil {
+		log.Error(err, "Can't add the cleanup of the ip annotations")
+		os.Exit(13)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"k8s.io/client-go/rest"
 	"os"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"time"
 
 	"runtime"
@@ -34,6 +35,8 @@ var log = logger.Log
 var (
 	metricsHost       = "0.0.0.0"
 	metricsPort int32 = 8081
+
+	healthProbePort int32 = 8082
 )
 
 func main() {
@@ -45,6 +48,10 @@ func main() {
 	mgr := createManager(cfg, namespace)
 	registerComponents(mgr)
 	setupControllers(mgr)
+	setupPreflight(mgr)
+	setupDriftAudit(mgr)
+	setupOrphanCollector(mgr)
+	setupIPAnnotationCleanup(mgr)
 	_ = serveCRMetrics(cfg, namespace)
 	startManager(mgr)
 }
@@ -105,15 +112,21 @@ func createManager(cfg *rest.Config, namespace string) manager.Manager {
 		"metricsBindAddress", metricsBindAddress,
 	)
 	mgr, err := manager.New(cfg, manager.Options{
-		Namespace:          namespace,
-		MetricsBindAddress: metricsBindAddress,
-		Host:               metricsHost,
-		Port:               int(metricsPort),
+		Namespace:              namespace,
+		MetricsBindAddress:     metricsBindAddress,
+		HealthProbeBindAddress: fmt.Sprintf("%s:%d", metricsHost, healthProbePort),
+		Host:                   metricsHost,
+		Port:                   int(metricsPort),
 	})
 	if err != nil {
 		log.Error(err, "Can't create manager")
 		os.Exit(4)
 	}
+
+	if err := mgr.AddHealthzCheck("ping", healthz.Ping); err != nil {
+		log.Error(err, "Can't add the health check")
+		os.Exit(4)
+	}
 	return mgr
 }
 
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"github.com/klenkes74/aws-egressip-operator/pkg/controller"
+	"github.com/klenkes74/aws-egressip-operator/pkg/openshift"
+	"os"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// setupOrphanCollector -- adds the periodic collection of orphaned secondary IPs unless ORPHAN_IP_GC is "off".
+func setupOrphanCollector(mgr manager.Manager) {
+	mode := openshift.OrphanCollectorModeFromEnvironment()
+	if mode == openshift.OrphanCollectorOff {
+		log.Info("The orphaned ip collector is disabled.")
+		return
+	}
+
+	handler := openshift.NewEgressIPHandler(controller.CloudProvider(), *openshift.NewOcpClient(mgr.GetClient()))
+	collector := openshift.NewOrphanCollector(*handler, mode, openshift.OrphanCollectorPeriod(),
+		openshift.OrphanGracePeriod(), openshift.OrphanExclusionsFromEnvironment())
+
+	if err := mgr.Add(collector); err != nil {
+		log.Error(err, "Can't add the orphaned ip collector")
+		os.Exit(12)
+	}
+}
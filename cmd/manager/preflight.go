@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/klenkes74/aws-egressip-operator/pkg/cloudprovider"
+	"github.com/klenkes74/aws-egressip-operator/pkg/controller"
+	"net/http"
+	"os"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sync"
+	"time"
+)
+
+const (
+	preflightTimeout     = 2 * time.Minute  // limit of a single preflight run
+	preflightRetryPeriod = 30 * time.Second // time between the runs until the preflight passed
+)
+
+// preflight -- runs the preflight of the cloud provider until it passes. The operator is not ready before.
+type preflight struct {
+	checker cloudprovider.PreflightChecker
+
+	mutex sync.RWMutex
+	err   error // the result of the last run
+}
+
+func setupPreflight(mgr manager.Manager) {
+	checker, ok := controller.CloudProvider().(cloudprovider.PreflightChecker)
+	if !ok {
+		log.Info("The cloud provider has no preflight.")
+		return
+	}
+
+	p := &preflight{
+		checker: checker,
+		err:     errors.New("preflight has not run yet"),
+	}
+
+	if err := mgr.Add(p); err != nil {
+		log.Error(err, "Can't add the preflight")
+		os.Exit(10)
+	}
+
+	if err := mgr.AddReadyzCheck("preflight", p.ReadyCheck); err != nil {
+		log.Error(err, "Can't add the preflight readiness check")
+		os.Exit(10)
+	}
+}
+
+// Start runs the preflight and repeats it until it passed.
+func (p *preflight) Start(stop <-chan struct{}) error {
+	for {
+		if p.run() {
+			return nil
+		}
+
+		log.Info("Preflight failed. Retrying ...", "period", preflightRetryPeriod)
+		timer := time.NewTimer(preflightRetryPeriod)
+		select {
+		case <-stop:
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+	}
+}
+
+// run -- runs the preflight once and logs the report. Returns if it passed.
+func (p *preflight) run() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), preflightTimeout)
+	defer cancel()
+
+	report := p.checker.Preflight(ctx)
+	for _, check := range report.Checks {
+		if check.Status == cloudprovider.PreflightFailed {
+			log.Error(errors.New(check.Message), "Preflight check failed", "check", check.Name)
+		} else {
+			log.Info("Preflight check", "check", check.Name, "status", check.Status, "message", check.Message)
+		}
+	}
+
+	err := report.Error()
+
+	p.mutex.Lock()
+	p.err = err
+	p.mutex.Unlock()
+
+	if err == nil {
+		log.Info("Preflight passed.", "checks", len(report.Checks))
+	}
+	return err == nil
+}
+
+// ReadyCheck reports the failed checks until the preflight passed. It is a healthz.Checker.
+func (p *preflight) ReadyCheck(_ *http.Request) error {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return p.err
+}
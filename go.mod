@@ -19,6 +19,7 @@ require (
 	k8s.io/apimachinery v0.18.0-rc.1
 	k8s.io/client-go v12.0.0+incompatible
 	sigs.k8s.io/controller-runtime v0.5.2
+	sigs.k8s.io/yaml v1.2.0
 
 )
 
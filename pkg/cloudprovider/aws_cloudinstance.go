@@ -1,6 +1,7 @@
 package cloudprovider
 
 import (
+	"context"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"net"
 )
@@ -9,20 +10,20 @@ var _ CloudInstance = &AwsInstance{}
 
 // AwsInstance The single AWS instance information
 type AwsInstance struct {
-	provider *AwsCloudProvider
 	instance ec2.Instance
+	capacity int // the IPv4 limit per network interface of the instance type -- 0 if unknown
 
 	tags map[string]string
-
-	networkInterface string
 }
 
-// New creates a new AWS CloudInstance
-func (a AwsInstance) New(provider *AwsCloudProvider, data ec2.Instance) *CloudInstance {
+// New creates a new AWS CloudInstance. The network limits of the instance type are read with the provider.
+func (a AwsInstance) New(ctx context.Context, provider *AwsCloudProvider, data ec2.Instance) *CloudInstance {
 	instance := &AwsInstance{
-		provider: provider,
 		instance: data,
 	}
+	if provider != nil {
+		instance.capacity = provider.instanceTypeLimits(ctx, &data).ipsPerInterface
+	}
 
 	result := CloudInstance(instance)
 	log.Info("created cloud instance",
@@ -74,9 +75,24 @@ func (a AwsInstance) initializeTags() {
 	}
 }
 
-// NetworkInterface returns the network interface id of the cloud instance
+// NetworkInterface returns the id of the primary network interface (device index 0) of the cloud instance
 func (a AwsInstance) NetworkInterface() string {
-	return a.networkInterface
+	for _, networkInterface := range a.NetworkInterfaces() {
+		if networkInterface.DeviceIndex() == 0 {
+			return networkInterface.ID()
+		}
+	}
+
+	return ""
+}
+
+// NetworkInterfaces returns all network interfaces attached to the cloud instance
+func (a AwsInstance) NetworkInterfaces() []CloudNetworkInterface {
+	result := make([]CloudNetworkInterface, len(a.instance.NetworkInterfaces))
+	for i, networkInterface := range a.instance.NetworkInterfaces {
+		result[i] = &AwsNetworkInterface{data: networkInterface, capacity: a.capacity}
+	}
+	return result
 }
 
 // PrimaryIP returns the primary ip of the cloud instance
@@ -85,14 +101,11 @@ func (a AwsInstance) PrimaryIP() *net.IP {
 	return &result
 }
 
-// SecondaryIps returns the secondary IPs of the cloud instance
+// SecondaryIps returns the secondary IPs of all network interfaces of the cloud instance
 func (a AwsInstance) SecondaryIps() []*net.IP {
 	result := make([]*net.IP, 0)
-	if len(a.instance.NetworkInterfaces[0].PrivateIpAddresses) > 1 {
-		for _, ip := range a.instance.NetworkInterfaces[0].PrivateIpAddresses[1:len(a.instance.NetworkInterfaces[0].PrivateIpAddresses)] {
-			netIP := net.ParseIP(*ip.PrivateIpAddress)
-			result = append(result, &netIP)
-		}
+	for _, networkInterface := range a.NetworkInterfaces() {
+		result = append(result, networkInterface.SecondaryIps()...)
 	}
 	return result
 }
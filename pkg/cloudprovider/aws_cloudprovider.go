@@ -1,37 +1,34 @@
 package cloudprovider
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/hashicorp/go-multierror"
 	"github.com/klenkes74/aws-egressip-operator/pkg/logger"
 	"github.com/patrickmn/go-cache"
 	"net"
-	"os"
+	"net/http"
 	"strings"
 	"time"
 )
 
-const defaultAwsRegion = "eu-central-1" // AWS in Frankfurt/Main, Germany is our default
-const defaultClusterName = "hugo"
+//goland:noinspection SpellCheckingInspection
+const defaultEgressNodeSelector = "k8s.io/cluster-autoscaler/enabled=true,ClusterNode=WorkerNode"
+const defaultEgressSubnetSelector = ""  // all subnets tagged with the cluster tag (owned or shared)
+const defaultElasticIPPoolSelector = "" // no pool -- Elastic IPs are allocated
 
-var log = logger.Log.WithName("Aws-cloud")
-
-// The singleton cloud provider. It will be lazy loaded.
-var provider *AwsCloudProvider
+const clusterTagPrefix = "kubernetes.io/cluster/"
+const defaultClusterTagValue = "owned"
 
-// AwsProvider returns the singleton provider object
-func AwsProvider() *AwsCloudProvider {
-	if provider == nil {
-		provider = &AwsCloudProvider{}
-	}
-
-	return provider
-}
+var log = logger.Log.WithName("Aws-cloud")
 
 var _ CloudProvider = &AwsCloudProvider{}
+var _ EgressNodeLister = &AwsCloudProvider{}
+var _ RecordingIPAssigner = &AwsCloudProvider{}
 
 // AwsCloudProvider implements the generic CloudProvider.
 type AwsCloudProvider struct {
@@ -39,107 +36,54 @@ type AwsCloudProvider struct {
 
 	Aws AwsClient
 
-	instances           *cache.Cache
-	instancesByHostname map[string]string
-	instancesBySubnet   map[string][]string
-	subnets             *cache.Cache
+	inventory     *awsInventory
+	resyncPeriod  time.Duration // period of the full resync of the inventory
+	instanceTypes *cache.Cache
 
-	ClusterName string // name of the cluster -- will be the AWS tag key="kubernetes.io/cluster/<ClusterName>", value="owned"
+	ClusterName     string // name of the cluster -- will be the AWS tag key="kubernetes.io/cluster/<ClusterName>"
+	ClusterTagValue string // value of the cluster tag the operator tags its resources with -- "owned" if empty
 
-	initialized bool // if the general part of this provider is initialized
-}
+	NodeSelector   *TagSelector // selects the instances egress IPs may be assigned to
+	SubnetSelector *TagSelector // selects the subnets egress IPs are taken from
 
-// SetAwsClient -- Injector to get a special AwsClient (e.g. a mocked one) for special purposes ...
-func (a *AwsCloudProvider) SetAwsClient(client *AwsClient, region string, clusterName string) {
-	a.Aws = *client
-	a.ClusterName = clusterName
-	a.Region = region
+	Placement PlacementStrategy // decides which network interface new IPs are assigned to
 
-	a.initialized = false
-}
+	ElasticIPPoolSelector *TagSelector // selects the Elastic IPs of the pool -- empty allocates new Elastic IPs
 
-// initializeProvider -- initialized the AWS client and the region.
-func (a *AwsCloudProvider) initializeProvider() error {
-	var err error
-
-	if a.initialized {
-		return nil
-	}
-
-	if a.Region == "" {
-		a.Region, err = a.readEnvironment("AWS_REGION", defaultAwsRegion)
-		if err != nil {
-			return err
-		}
-	}
-
-	if a.ClusterName == "" {
-		a.ClusterName, err = a.readEnvironment("CLUSTER_NAME", defaultClusterName)
-		if err != nil {
-			return err
-		}
-	}
+	initialized bool // if the provider has been created by NewAwsCloudProvider
+}
 
-	if a.Aws == nil {
-		a.Aws, err = CreateAwsClient(a.Region)
-		if err != nil {
-			return err
-		}
+// HealthCheck reports an error while the AWS client rejects calls since AWS failed persistently.
+func (a *AwsCloudProvider) HealthCheck(req *http.Request) error {
+	if checker, ok := a.Aws.(HealthChecker); ok {
+		return checker.HealthCheck(req)
 	}
 
-	a.instances = cache.New(time.Minute, 10*time.Minute)
-	a.subnets = cache.New(time.Minute, 10*time.Minute)
-	a.instancesByHostname = make(map[string]string)
-	a.instancesBySubnet = make(map[string][]string)
-
-	a.initialized = true
-	log.Info("Initialized AWS Cloud Provider.",
-		"Cluster Name", a.ClusterName,
-		"AWS Region", a.Region,
-	)
 	return nil
 }
 
-func (a *AwsCloudProvider) readEnvironment(key ...string) (string, error) {
-	result, found := os.LookupEnv(key[0])
-	if !found {
-		if len(key) >= 2 {
-			log.V(4).Info("ENVIRONMENT does not contain entry for key. Using provided default",
-				"key", key[0],
-				"default", key[1],
-				"value", key[1],
-			)
-
-			return key[1], nil
-		}
-
-		err := errors.New("the ENVIRONMENT contains no entry " + key[0])
-
-		return "", err
+// ClusterTag returns the AWS tag and value the cluster marks all AWS resources with. The lookups match the tag key
+// only, so resources tagged "owned" and "shared" are found. The value is used to tag the resources created by the
+// operator.
+func (a *AwsCloudProvider) ClusterTag() (string, string) {
+	if a.ClusterTagValue == "" {
+		return clusterTagPrefix + a.ClusterName, defaultClusterTagValue
 	}
 
-	log.V(4).Info("Read system environment.",
-		"key", key,
-		"value", result,
-	)
-	return result, nil
-}
-
-// ClusterTag returns the AWS tag and value the cluster
-// marks all AWS resources with.
-func (a *AwsCloudProvider) ClusterTag() (string, string) {
-	return "kubernetes.io/cluster/" + a.ClusterName, "owned"
+	return clusterTagPrefix + a.ClusterName, a.ClusterTagValue
 }
 
 // Instance -- loads an EC2 instance by its ID
-func (a *AwsCloudProvider) Instance(instanceID string) (*CloudInstance, error) {
-	_ = a.initializeProvider()
+func (a *AwsCloudProvider) Instance(ctx context.Context, instanceID string) (*CloudInstance, error) {
+	if err := a.checkInitialized(); err != nil {
+		return nil, err
+	}
 
 	log.Info("looking for Aws instance",
 		"instance-id", instanceID,
 	)
 
-	instance, err := a.instance(instanceID)
+	instance, err := a.instance(ctx, instanceID)
 	if err != nil {
 		return nil, err
 	}
@@ -148,19 +92,22 @@ func (a *AwsCloudProvider) Instance(instanceID string) (*CloudInstance, error) {
 		"hostname", instance.PrivateDnsName,
 	)
 
-	return AwsInstance.New(AwsInstance{}, a, *instance), nil
+	return AwsInstance.New(AwsInstance{}, ctx, a, *instance), nil
 }
 
 // InstanceByHostName returns the instance for the given hostname
-func (a *AwsCloudProvider) InstanceByHostName(hostname string) (*CloudInstance, error) {
-	_ = a.initializeProvider()
+func (a *AwsCloudProvider) InstanceByHostName(ctx context.Context, hostname string) (*CloudInstance, error) {
+	if err := a.checkInitialized(); err != nil {
+		return nil, err
+	}
 
-	if a.instancesByHostname[hostname] != "" {
-		result, err := a.instance(a.instancesByHostname[hostname])
+	instanceID := a.inventory.current().instancesByHostname[hostname]
+	if instanceID != "" {
+		result, err := a.instance(ctx, instanceID)
 		if err != nil {
 			return nil, err
 		}
-		return AwsInstance.New(AwsInstance{}, a, *result), nil
+		return AwsInstance.New(AwsInstance{}, ctx, a, *result), nil
 	}
 
 	filter := ec2.DescribeInstancesInput{
@@ -172,17 +119,39 @@ func (a *AwsCloudProvider) InstanceByHostName(hostname string) (*CloudInstance,
 		},
 	}
 
-	instance, err := a.loadInstanceFromAws(filter)
+	instance, err := a.loadInstanceFromAws(ctx, filter)
 	if err != nil {
 		return nil, err
 	}
-	return AwsInstance.New(AwsInstance{}, a, *instance), nil
+	return AwsInstance.New(AwsInstance{}, ctx, a, *instance), nil
 }
 
-func (a *AwsCloudProvider) instance(instanceID string) (*ec2.Instance, error) {
-	cached, found := a.instances.Get(instanceID)
-	if found {
-		return cached.(*ec2.Instance), nil
+// EgressNodes returns the running instances of the cluster selected by the NodeSelector. The inventory is resynced
+// first if it is stale.
+func (a *AwsCloudProvider) EgressNodes(ctx context.Context) ([]*CloudInstance, error) {
+	if err := a.checkInitialized(); err != nil {
+		return nil, err
+	}
+
+	snapshot, err := a.freshInventory(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*CloudInstance, 0, len(snapshot.instanceList))
+	for _, instance := range snapshot.instanceList {
+		if a.isEgressNode(instance) {
+			result = append(result, AwsInstance.New(AwsInstance{}, ctx, a, *instance))
+		}
+	}
+
+	return result, nil
+}
+
+func (a *AwsCloudProvider) instance(ctx context.Context, instanceID string) (*ec2.Instance, error) {
+	cached := a.inventory.current().instances[instanceID]
+	if cached != nil {
+		return cached, nil
 	}
 
 	filter := ec2.DescribeInstancesInput{
@@ -198,11 +167,11 @@ func (a *AwsCloudProvider) instance(instanceID string) (*ec2.Instance, error) {
 		},
 	}
 
-	return a.loadInstanceFromAws(filter)
+	return a.loadInstanceFromAws(ctx, filter)
 }
 
-func (a *AwsCloudProvider) loadInstanceFromAws(filter ec2.DescribeInstancesInput) (*ec2.Instance, error) {
-	instances, err := a.loadInstancesFromAws(filter)
+func (a *AwsCloudProvider) loadInstanceFromAws(ctx context.Context, filter ec2.DescribeInstancesInput) (*ec2.Instance, error) {
+	instances, err := a.loadInstancesFromAws(ctx, filter)
 	if err != nil {
 		return nil, err
 	}
@@ -212,22 +181,21 @@ func (a *AwsCloudProvider) loadInstanceFromAws(filter ec2.DescribeInstancesInput
 			"instance-id", instances[0].InstanceId,
 		)
 	} else {
-		return nil, errors.New("no instance found")
+		return nil, &NotFoundError{Resource: "instance", Key: "the filter"}
 	}
 
 	return instances[0], nil
 }
 
-func (a *AwsCloudProvider) loadAllInstancesFromAws() ([]*ec2.Instance, error) {
+// allInstancesFilter -- the filter for all running instances of the cluster. The egress nodes are selected with the
+// NodeSelector afterwards, so every lookup path uses the same selection.
+func (a *AwsCloudProvider) allInstancesFilter() ec2.DescribeInstancesInput {
 	key, _ := a.ClusterTag()
 
 	filter := a.allClusterTagFilter(key)
-	//goland:noinspection SpellCheckingInspection
-	filter = append(filter, &ec2.Filter{Name: aws.String("tag:k8s.io/cluster-autoscaler/enabled"), Values: aws.StringSlice([]string{"true"})})
-	filter = append(filter, &ec2.Filter{Name: aws.String("tag:ClusterNode"), Values: aws.StringSlice([]string{"WorkerNode"})})
 	filter = append(filter, &ec2.Filter{Name: aws.String("instance-state-name"), Values: aws.StringSlice([]string{"running"})})
 
-	return a.loadInstancesFromAws(ec2.DescribeInstancesInput{Filters: filter})
+	return ec2.DescribeInstancesInput{Filters: filter}
 }
 
 func (a *AwsCloudProvider) allClusterTagFilter(key string) []*ec2.Filter {
@@ -239,56 +207,59 @@ func (a *AwsCloudProvider) allClusterTagFilter(key string) []*ec2.Filter {
 	}
 }
 
-func (a *AwsCloudProvider) loadInstancesFromAws(filter ec2.DescribeInstancesInput) ([]*ec2.Instance, error) {
-	instances, err := a.Aws.DescribeInstances(&filter)
+// loadInstancesFromAws -- loads all instances matching the filter and adds them to the inventory.
+func (a *AwsCloudProvider) loadInstancesFromAws(ctx context.Context, filter ec2.DescribeInstancesInput) ([]*ec2.Instance, error) {
+	result, err := a.describeInstances(ctx, filter)
 	if err != nil {
 		return nil, err
 	}
 
-	var result []*ec2.Instance
-	if len(instances.Reservations) > 0 {
-		result = make([]*ec2.Instance, len(instances.Reservations))
-		for i, reservation := range instances.Reservations {
-			result[i] = reservation.Instances[0]
+	if len(result) == 0 {
+		return nil, &NotFoundError{Resource: "instance", Key: "the filter"}
+	}
 
-			_, found := a.instances.Get(*result[i].InstanceId)
-			if !found {
-				a.initializeInstanceInformation(result[i])
-			}
-		}
-	} else {
-		return nil, errors.New("no instance found")
+	for _, instance := range result {
+		log.Info("loaded instance into inventory",
+			"instance-id", instance.InstanceId,
+			"instance-name", instance.PrivateDnsName,
+			"instance-ip", instance.PrivateIpAddress,
+			"eni-count", len(instance.NetworkInterfaces),
+			"subnet-id", instance.SubnetId,
+		)
 	}
+	a.inventory.upsert(result...)
 
 	return result, nil
 }
 
-func (a *AwsCloudProvider) initializeInstanceInformation(instance *ec2.Instance) {
-	a.instances.Set(*instance.InstanceId, instance, cache.DefaultExpiration)
+// describeInstances -- reads all instances matching the filter from AWS. All pages of the result and all instances of
+// every reservation are read.
+func (a *AwsCloudProvider) describeInstances(ctx context.Context, filter ec2.DescribeInstancesInput) ([]*ec2.Instance, error) {
+	result := make([]*ec2.Instance, 0)
 
-	log.Info("initializing instance",
-		"instance-id", instance.InstanceId,
-		"instance-name", instance.PrivateDnsName,
-		"instance-ip", instance.PrivateIpAddress,
-		"eni-count", len(instance.NetworkInterfaces),
-		"subnet-id", instance.SubnetId,
-	)
+	var nextToken *string
+	for {
+		page := filter
+		page.NextToken = nextToken
 
-	if len(*instance.PrivateDnsName) > 0 {
-		a.instancesByHostname[*instance.PrivateDnsName] = *instance.InstanceId
-	}
+		instances, err := a.Aws.DescribeInstances(ctx, &page)
+		if err != nil {
+			return nil, err
+		}
 
-	if len(instance.NetworkInterfaces) >= 1 {
-		networkInterface := instance.NetworkInterfaces[0]
+		for _, reservation := range instances.Reservations {
+			result = append(result, reservation.Instances...)
+		}
 
-		if a.instancesBySubnet[*networkInterface.SubnetId] == nil {
-			a.instancesBySubnet[*networkInterface.SubnetId] = make([]string, 0)
+		nextToken = instances.NextToken
+		if nextToken == nil || *nextToken == "" {
+			return result, nil
 		}
-		a.instancesBySubnet[*networkInterface.SubnetId] = append(a.instancesBySubnet[*networkInterface.SubnetId], *instance.InstanceId)
 	}
 }
 
-func (a *AwsCloudProvider) loadSubnetsFromAws() error {
+// describeSubnets -- reads all subnets of the cluster from AWS.
+func (a *AwsCloudProvider) describeSubnets(ctx context.Context) ([]*ec2.Subnet, error) {
 	key, _ := a.ClusterTag()
 	var filter = ec2.DescribeSubnetsInput{
 		Filters: a.allClusterTagFilter(key),
@@ -297,41 +268,64 @@ func (a *AwsCloudProvider) loadSubnetsFromAws() error {
 		"filter", filter,
 	)
 
-	subnets, err := a.Aws.DescribeSubnets(&filter)
-	if err != nil {
-		return err
-	}
+	result := make([]*ec2.Subnet, 0)
 
-	for _, subnet := range subnets.Subnets {
-		a.subnets.Set(*subnet.SubnetId, subnet, cache.DefaultExpiration)
-	}
+	var nextToken *string
+	for {
+		page := filter
+		page.NextToken = nextToken
 
-	return nil
+		subnets, err := a.Aws.DescribeSubnets(ctx, &page)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, subnets.Subnets...)
+
+		nextToken = subnets.NextToken
+		if nextToken == nil || *nextToken == "" {
+			return result, nil
+		}
+	}
 }
 
-// addRandomIPToInterface -- adds an additional IP to the given interface.
+// addRandomIPToInterface -- adds an additional IP of the address family to the given interface.
 //
 // AWS will assign a free IP address to the given Interface.
-func (a *AwsCloudProvider) addRandomIPToInterface(interfaceID string) (*net.IP, error) {
-	addressRequest := ec2.AssignPrivateIpAddressesInput{
-		NetworkInterfaceId:             aws.String(interfaceID),
-		SecondaryPrivateIpAddressCount: aws.Int64(int64(1)),
-	}
-	addressResponse, err := a.Aws.AssignPrivateIPAddresses(&addressRequest)
-	if err != nil {
-		return nil, err
-	}
+func (a *AwsCloudProvider) addRandomIPToInterface(ctx context.Context, interfaceID string, family IPFamily) (*net.IP, error) {
+	var assigned []string
+
+	if family == IPv6 {
+		addressResponse, err := a.Aws.AssignIPv6Addresses(ctx, &ec2.AssignIpv6AddressesInput{
+			NetworkInterfaceId: aws.String(interfaceID),
+			Ipv6AddressCount:   aws.Int64(int64(1)),
+		})
+		if err != nil {
+			return nil, err
+		}
 
-	if len(addressResponse.AssignedPrivateIpAddresses) != 1 {
-		ips := make([]string, len(addressResponse.AssignedPrivateIpAddresses))
-		for i, ipAddress := range addressResponse.AssignedPrivateIpAddresses {
-			ips[i] = ipAddress.String()
+		assigned = aws.StringValueSlice(addressResponse.AssignedIpv6Addresses)
+	} else {
+		addressResponse, err := a.Aws.AssignPrivateIPAddresses(ctx, &ec2.AssignPrivateIpAddressesInput{
+			NetworkInterfaceId:             aws.String(interfaceID),
+			SecondaryPrivateIpAddressCount: aws.Int64(int64(1)),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, ipAddress := range addressResponse.AssignedPrivateIpAddresses {
+			assigned = append(assigned, aws.StringValue(ipAddress.PrivateIpAddress))
 		}
+	}
+
+	if len(assigned) != 1 {
 		return nil, fmt.Errorf("there has been no or too much IP address assigned to the eni '%s': [%s]",
-			interfaceID, strings.Join(ips, ","))
+			interfaceID, strings.Join(assigned, ","))
 	}
 
-	ip := net.ParseIP(*addressResponse.AssignedPrivateIpAddresses[0].PrivateIpAddress)
+	ip := net.ParseIP(assigned[0])
+	a.inventory.assignIP(interfaceID, ip)
 	log.Info("Assigned IP to eni",
 		"eni", interfaceID,
 		"ip-address", ip.String())
@@ -340,15 +334,24 @@ func (a *AwsCloudProvider) addRandomIPToInterface(interfaceID string) (*net.IP,
 }
 
 // addSpecifiedIPToInterface -- Adds the specified IP to the given interface.
-func (a *AwsCloudProvider) addSpecifiedIPToInterface(interfaceID string, ip net.IP) error {
-	addressRequest := ec2.AssignPrivateIpAddressesInput{
-		NetworkInterfaceId: aws.String(interfaceID),
-		PrivateIpAddresses: aws.StringSlice([]string{ip.String()}),
+func (a *AwsCloudProvider) addSpecifiedIPToInterface(ctx context.Context, interfaceID string, ip net.IP) error {
+	var err error
+
+	if FamilyOf(ip) == IPv6 {
+		_, err = a.Aws.AssignIPv6Addresses(ctx, &ec2.AssignIpv6AddressesInput{
+			NetworkInterfaceId: aws.String(interfaceID),
+			Ipv6Addresses:      aws.StringSlice([]string{ip.String()}),
+		})
+	} else {
+		_, err = a.Aws.AssignPrivateIPAddresses(ctx, &ec2.AssignPrivateIpAddressesInput{
+			NetworkInterfaceId: aws.String(interfaceID),
+			PrivateIpAddresses: aws.StringSlice([]string{ip.String()}),
+		})
 	}
-	_, err := a.Aws.AssignPrivateIPAddresses(&addressRequest)
 	if err != nil {
 		return err
 	}
+	a.inventory.assignIP(interfaceID, ip)
 
 	log.Info("Assigned IP to eni",
 		"eni", interfaceID,
@@ -358,8 +361,10 @@ func (a *AwsCloudProvider) addSpecifiedIPToInterface(interfaceID string, ip net.
 }
 
 // AddSpecifiedIPs adds the given IPs to the cloud.
-func (a *AwsCloudProvider) AddSpecifiedIPs(ips []*net.IP) ([]string, error) {
-	_ = a.initializeProvider()
+func (a *AwsCloudProvider) AddSpecifiedIPs(ctx context.Context, request IPRequest, ips []*net.IP) ([]string, error) {
+	if err := a.checkInitialized(); err != nil {
+		return nil, err
+	}
 
 	result := make([]string, len(ips))
 	assignmentErrors := make([]error, 0)
@@ -369,7 +374,7 @@ func (a *AwsCloudProvider) AddSpecifiedIPs(ips []*net.IP) ([]string, error) {
 	}
 
 	for i, ip := range ips {
-		instanceID, err := a.addSpecifiedIP(ip)
+		instanceID, err := a.addSpecifiedIP(ctx, request, ip)
 		if err != nil {
 			assignmentErrors = append(assignmentErrors, err)
 		}
@@ -395,10 +400,10 @@ func (a *AwsCloudProvider) AddSpecifiedIPs(ips []*net.IP) ([]string, error) {
 	return result, nil
 }
 
-// Adds a specified IP to the cluster. It will look for a matching subnet and then add the IP to the instance with
-// least IPs attached.
-func (a *AwsCloudProvider) addSpecifiedIP(ip *net.IP) (string, error) {
-	subnet, err := a.findSubnetForIP(ip)
+// Adds a specified IP to the cluster. It will look for a matching subnet and then add the IP to the network interface
+// chosen by the placement strategy.
+func (a *AwsCloudProvider) addSpecifiedIP(ctx context.Context, request IPRequest, ip *net.IP) (string, error) {
+	subnet, err := a.findSubnetForIP(ctx, ip)
 	if err != nil {
 		log.Error(err, "no matching subnet found",
 			"ip", ip,
@@ -406,52 +411,48 @@ func (a *AwsCloudProvider) addSpecifiedIP(ip *net.IP) (string, error) {
 		return "", fmt.Errorf("can not find a matching subnet for ip '%s'", ip.String())
 	}
 
-	instance, err := a.instanceWithLeastNumberOfIps(*subnet.SubnetId)
-	if err != nil {
-		return "", err
-	}
-
-	err = a.addSpecifiedIPToInterface(*instance.NetworkInterfaces[0].NetworkInterfaceId, *ip)
+	instanceID, err := a.assignToInterfaceInSubnet(ctx, request, *subnet.SubnetId, FamilyOf(*ip), func(interfaceID string) error {
+		return a.addSpecifiedIPToInterface(ctx, interfaceID, *ip)
+	})
 	if err != nil {
 		return "", err
 	}
 
 	log.Info(fmt.Sprintf("added specified ip '%s' to instance '%s'",
-		ip.String(), *instance.InstanceId))
+		ip.String(), instanceID))
 
-	return *instance.InstanceId, nil
+	return instanceID, nil
 }
 
-func (a *AwsCloudProvider) findSubnetForIP(ip *net.IP) (*ec2.Subnet, error) {
+// findSubnetForIP -- returns the egress subnet containing the IP. IPv6 addresses are matched against the associated
+// IPv6 CIDR blocks of the subnets.
+func (a *AwsCloudProvider) findSubnetForIP(ctx context.Context, ip *net.IP) (*ec2.Subnet, error) {
 	var result *ec2.Subnet
 
-	if a.subnets == nil || a.subnets.ItemCount() < 1 || len(a.subnets.Items()) < 1 {
-		log.Info("initializing subnets from AWS")
-		err := a.loadSubnetsFromAws()
-		if err != nil {
-			return nil, err
-		}
+	snapshot, err := a.freshInventory(ctx)
+	if err != nil {
+		return nil, err
 	}
 
 	log.Info("checking subnets from AWS",
-		"subnet-count-item-count", a.subnets.ItemCount(),
-		"subnet-count-len", len(a.subnets.Items()),
+		"subnet-count", len(snapshot.subnetList),
 	)
 
-	for _, item := range a.subnets.Items() {
-		subnet := item.Object.(*ec2.Subnet)
+	family := FamilyOf(*ip)
+	for _, subnet := range snapshot.subnetList {
 
 		log.Info("checking subnet for ip",
 			"subnet-id", subnet.SubnetId,
 			"cidr", subnet.CidrBlock,
+			"ipv6-cidrs", subnetCidrs(subnet, IPv6),
 			"availability-zone", subnet.AvailabilityZoneId,
 			"free-ips", subnet.AvailableIpAddressCount,
 		)
 
 		if result == nil {
-			_, cidr, err := net.ParseCIDR(*subnet.CidrBlock)
-			if err == nil {
-				if cidr.Contains(*ip) {
+			for _, cidrBlock := range subnetCidrs(subnet, family) {
+				_, cidr, err := net.ParseCIDR(cidrBlock)
+				if err == nil && cidr.Contains(*ip) {
 					result = subnet
 				}
 			}
@@ -465,60 +466,120 @@ func (a *AwsCloudProvider) findSubnetForIP(ip *net.IP) (*ec2.Subnet, error) {
 	return result, nil
 }
 
-// AddRandomIPs adds a random IP addresses to any machine of the given machine set. It will add one ip address in every
-// subnet used by the machine set.
+// subnetCidrs -- returns the CIDR blocks of the subnet for the address family. Only IPv6 CIDR blocks in state
+// "associated" are returned.
+func subnetCidrs(subnet *ec2.Subnet, family IPFamily) []string {
+	result := make([]string, 0)
+
+	if family == IPv4 {
+		if subnet.CidrBlock != nil {
+			result = append(result, *subnet.CidrBlock)
+		}
+		return result
+	}
+
+	for _, association := range subnet.Ipv6CidrBlockAssociationSet {
+		if association.Ipv6CidrBlock == nil {
+			continue
+		}
+		if association.Ipv6CidrBlockState != nil && association.Ipv6CidrBlockState.State != nil &&
+			*association.Ipv6CidrBlockState.State != ec2.SubnetCidrBlockStateCodeAssociated {
+			continue
+		}
+
+		result = append(result, *association.Ipv6CidrBlock)
+	}
+	return result
+}
+
+// AddRandomIPs adds a random IP addresses to any machine of the given machine set. It will add one ip address of every
+// requested address family in every subnet of the availability zones selected by the request, in the preferred order
+// of the zones. Subnets without an IPv6 CIDR are skipped for IPv6.
 // It will return either the instances and the new assigned IPs or an error.
-func (a *AwsCloudProvider) AddRandomIPs() ([]string, []*net.IP, error) {
-	_ = a.initializeProvider()
+func (a *AwsCloudProvider) AddRandomIPs(ctx context.Context, request IPRequest) ([]string, []*net.IP, error) {
+	return a.addRandomIPs(ctx, request, nil)
+}
 
-	err := a.loadSubnetsFromAws()
-	if err != nil {
+// AddRandomIPsRecorded adds the random IPs like AddRandomIPs and records every IP before the next one is assigned.
+func (a *AwsCloudProvider) AddRandomIPsRecorded(ctx context.Context, request IPRequest, record IPRecorder) ([]string, []*net.IP, error) {
+	return a.addRandomIPs(ctx, request, record)
+}
+
+// addRandomIPs -- adds the random IPs and records each if there is a recorder. No IPs are assigned after the recorder
+// failed.
+func (a *AwsCloudProvider) addRandomIPs(ctx context.Context, request IPRequest, record IPRecorder) ([]string, []*net.IP, error) {
+	if err := a.checkInitialized(); err != nil {
 		return nil, nil, err
 	}
 
-	log.Info("adding random ips to the infrastructure",
-		"no-of-subnets", a.subnets.ItemCount(),
-	)
-
-	_, err = a.loadAllInstancesFromAws() // need to have all available instances in our cache.
+	snapshot, err := a.freshInventory(ctx)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	instanceIds := make([]string, a.subnets.ItemCount())
-	ips := make([]*net.IP, a.subnets.ItemCount())
-	assignmentErrors := make([]error, a.subnets.ItemCount())
+	subnetList, err := subnetsOfSelectedZones(request, snapshot.subnetList)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	i := 0
-	for subnetID, item := range a.subnets.Items() {
-		subnet := item.Object.(*ec2.Subnet)
+	log.Info("adding random ips to the infrastructure",
+		"no-of-subnets", len(subnetList),
+		"ip-families", request.IPFamilies(),
+		"zones", request.Zones,
+		"zone-count", request.ZoneCount,
+	)
 
-		log.Info(fmt.Sprintf("need ip in subnet '%s' for availability zone '%s'",
-			subnetID, *subnet.AvailabilityZone))
+	instanceIds := make([]string, 0, len(subnetList))
+	ips := make([]*net.IP, 0, len(subnetList))
+	assignmentErrors := make([]error, 0, len(subnetList))
+
+families:
+	for _, family := range request.IPFamilies() {
+		for _, subnet := range subnetList {
+			subnetID := *subnet.SubnetId
+
+			if len(subnetCidrs(subnet, family)) == 0 {
+				log.Info("subnet has no cidr for ip family - skipping it",
+					"subnet-id", subnetID,
+					"ip-family", family,
+				)
+				continue
+			}
 
-		instance, err := a.instanceWithLeastNumberOfIps(subnetID)
+			log.Info(fmt.Sprintf("need %s ip in subnet '%s' for availability zone '%s'",
+				family, subnetID, *subnet.AvailabilityZone))
+
+			var ip *net.IP
+			instanceID, err := a.assignToInterfaceInSubnet(ctx, request, subnetID, family, func(interfaceID string) error {
+				var err error
+				ip, err = a.addRandomIPToInterface(ctx, interfaceID, family)
+				return err
+			})
+
+			unrecorded := false
+			if err == nil && record != nil {
+				if err = record(instanceID, ip); err != nil {
+					err = fmt.Errorf("can not record random ip '%s' of instance '%s': %v", ip, instanceID, err)
+					unrecorded = true
+				}
+			}
 
-		if err != nil {
-			assignmentErrors[i] = err
-		} else {
-			instanceIds[i] = *instance.InstanceId
+			instanceIds = append(instanceIds, instanceID)
+			ips = append(ips, ip)
+			assignmentErrors = append(assignmentErrors, err)
 
-			ips[i], err = a.addRandomIPToInterface(*instance.NetworkInterfaces[0].NetworkInterfaceId)
 			if err != nil {
-				assignmentErrors[i] = err
+				log.Error(err, fmt.Sprintf("error while adding random ip '%s' to instance '%s'", ip, instanceID))
+				if unrecorded {
+					break families
+				}
+			} else {
+				log.Info(fmt.Sprintf("added random ip '%s' to instance '%s'", ip, instanceID))
 			}
 		}
-
-		if err != nil {
-			log.Error(err, fmt.Sprintf("error while adding random ip '%s' to instance '%s'", ips[i], instance))
-		} else {
-			log.Info(fmt.Sprintf("added random ip '%s' to instance '%s'", ips[i], *instance.InstanceId))
-		}
-
-		i++
 	}
 
-	i = 0
+	i := 0
 	for _, err2 := range assignmentErrors {
 		if err2 != nil {
 			err = multierror.Append(err, err2)
@@ -537,90 +598,377 @@ func (a *AwsCloudProvider) AddRandomIPs() ([]string, []*net.IP, error) {
 	return instanceIds, ips, err
 }
 
-// cycles through all instances within a subnet to find the instance with the least IPs assigned.
-func (a *AwsCloudProvider) instanceWithLeastNumberOfIps(subnetID string) (*ec2.Instance, error) {
-	var result *ec2.Instance
+// subnetsOfSelectedZones -- returns the subnets of the availability zones selected by the request, ordered by the
+// preferred order of the zones.
+func subnetsOfSelectedZones(request IPRequest, subnets []*ec2.Subnet) ([]*ec2.Subnet, error) {
+	available := make([]string, 0, len(subnets))
+	for _, subnet := range subnets {
+		available = append(available, aws.StringValue(subnet.AvailabilityZone))
+	}
 
-	instanceIds := a.instancesBySubnet[subnetID]
-	if len(instanceIds) > 0 {
-		for _, id := range instanceIds {
-			if result != nil && len(result.NetworkInterfaces[0].PrivateIpAddresses) <= 2 {
-				break // That's good enough. We will use this one ...
-			}
+	zones, err := request.SelectZones(available)
+	if err != nil {
+		return nil, err
+	}
 
-			instance, err := a.instance(id)
-			if err == nil {
-				for _, tag := range instance.Tags {
-					if *tag.Key == "ClusterNode" && *tag.Value == "WorkerNode" {
-						if result == nil {
-							result = instance
-						} else {
-							if len(result.NetworkInterfaces[0].PrivateIpAddresses) > len(instance.NetworkInterfaces[0].PrivateIpAddresses) {
-								result = instance
-							}
-						}
-					}
-				}
+	result := make([]*ec2.Subnet, 0, len(subnets))
+	for _, zone := range zones {
+		for _, subnet := range subnets {
+			if aws.StringValue(subnet.AvailabilityZone) == zone {
+				result = append(result, subnet)
 			}
 		}
-	} else {
-		_, err := a.loadAllInstancesFromAws()
+	}
+
+	return result, nil
+}
+
+// assignToInterfaceInSubnet -- runs the assignment of an IP of the address family against the network interfaces of
+// the subnet in the order of the placement strategy. If AWS reports an interface to be full, the next one is tried.
+// The interfaces of the excluded instances are skipped. The id of the instance the interface is attached to will be
+// returned.
+func (a *AwsCloudProvider) assignToInterfaceInSubnet(ctx context.Context, request IPRequest, subnetID string, family IPFamily, assign func(interfaceID string) error, excludedInstances ...string) (string, error) {
+	candidates, err := a.placementCandidates(ctx, subnetID, family)
+	if err != nil {
+		return "", err
+	}
+	candidates = withoutInstances(candidates, excludedInstances)
+	if len(candidates) == 0 {
+		return "", &NoEgressNodeError{Network: subnetID}
+	}
+
+	for _, candidate := range a.Placement.Order(request, subnetID, candidates) {
+		err = assign(candidate.InterfaceID)
+		if err == nil || !isInterfaceFull(err) {
+			return candidate.InstanceID, err
+		}
+
+		log.Info("network interface has no free capacity, trying the next one",
+			"instance-id", candidate.InstanceID,
+			"eni", candidate.InterfaceID,
+			"subnet-id", subnetID,
+		)
+	}
+
+	return "", &CapacityExhaustedError{Network: subnetID}
+}
+
+// withoutInstances -- removes the candidates of the excluded instances.
+func withoutInstances(candidates []PlacementCandidate, excludedInstances []string) []PlacementCandidate {
+	if len(excludedInstances) == 0 {
+		return candidates
+	}
+
+	result := make([]PlacementCandidate, 0, len(candidates))
+	for _, candidate := range candidates {
+		if !isExcluded(candidate.InstanceID, excludedInstances) {
+			result = append(result, candidate)
+		}
+	}
+	return result
+}
+
+// isExcluded -- checks if the instance is one of the excluded instances.
+func isExcluded(instanceID string, excludedInstances []string) bool {
+	for _, excluded := range excludedInstances {
+		if instanceID == excluded {
+			return true
+		}
+	}
+	return false
+}
+
+// isInterfaceFull -- checks if AWS rejected the assignment since the ENI reached the IP limit of the instance type.
+func isInterfaceFull(err error) bool {
+	if awsErr, ok := err.(awserr.Error); ok {
+		return awsErr.Code() == "PrivateIpAddressLimitExceeded"
+	}
+
+	return false
+}
+
+// placementCandidates -- collects the network interfaces of the egress nodes within a subnet that are able to take
+// another IP of the address family. Interfaces already carrying the maximum number of IPs of the instance type are
+// skipped, as are all interfaces of instances carrying the maximum number of IPv4 addresses of the instance type
+// (ENIs times IPv4 addresses per ENI). If all interfaces of the subnet are full, a CapacityExhaustedError is returned,
+// without egress nodes a NoEgressNodeError.
+func (a *AwsCloudProvider) placementCandidates(ctx context.Context, subnetID string, family IPFamily) ([]PlacementCandidate, error) {
+	result := make([]PlacementCandidate, 0)
+	full := 0
+
+	snapshot := a.inventory.current()
+	if len(snapshot.interfacesBySubnet[subnetID]) == 0 {
+		err := a.Resync(ctx)
 		if err != nil {
-			return nil, fmt.Errorf("can not load instanced from AWS for reading instances in subnet '%s'", subnetID)
+			return nil, fmt.Errorf("can't load instances from AWS for subnet '%s': %w", subnetID, err)
+		}
+		snapshot = a.inventory.current()
+	}
+
+	for _, id := range snapshot.interfacesBySubnet[subnetID] {
+		instance := snapshot.instances[snapshot.instanceByInterface[id]]
+		if !a.isEgressNode(instance) {
+			continue
 		}
-		instanceIds := a.instancesBySubnet[subnetID]
-		if len(instanceIds) > 0 {
-			return a.instanceWithLeastNumberOfIps(subnetID)
+
+		networkInterface := snapshot.networkInterfaces[id]
+		limits := a.instanceTypeLimits(ctx, instance)
+		count, limit := len(networkInterface.PrivateIpAddresses), limits.ipsPerInterface
+		if family == IPv6 {
+			count, limit = len(networkInterface.Ipv6Addresses), limits.ipv6PerInterface
 		}
 
-		result = nil
+		if limits.ipv6Unsupported && family == IPv6 {
+			log.V(4).Info("instance type does not support IPv6",
+				"instance-id", instance.InstanceId,
+				"instance-type", instance.InstanceType,
+			)
+			continue
+		}
+		if family == IPv4 && limits.instanceFull(instance) {
+			log.V(4).Info("instance carries the maximum number of ips of its instance type",
+				"instance-id", instance.InstanceId,
+				"eni", id,
+				"max-enis", limits.networkInterfaces,
+				"max-ips-per-eni", limits.ipsPerInterface,
+			)
+			full++
+			continue
+		}
+		if limit > 0 && count >= limit {
+			log.V(4).Info("network interface is full",
+				"instance-id", instance.InstanceId,
+				"eni", id,
+				"ip-family", family,
+				"limit", limit,
+			)
+			full++
+			continue
+		}
+
+		candidate := PlacementCandidate{
+			InstanceID:  *instance.InstanceId,
+			InterfaceID: id,
+			IPCount:     count,
+			IPCapacity:  limit,
+		}
+		if instance.InstanceType != nil {
+			candidate.InstanceType = *instance.InstanceType
+		}
+		result = append(result, candidate)
 	}
 
-	if result == nil {
-		return nil, fmt.Errorf("no instances in subnet '%s'", subnetID)
+	if len(result) == 0 && full > 0 {
+		return nil, &CapacityExhaustedError{Network: subnetID}
+	}
+	if len(result) == 0 {
+		return nil, &NoEgressNodeError{Network: subnetID}
 	}
 
 	return result, nil
 }
 
-// RemoveIP removes the IP from the AWS account
-func (a *AwsCloudProvider) RemoveIP(ip *net.IP) (string, error) {
-	networkInterface, err := a.findNetworkInterfaceForIP(ip)
+// instanceTypeLimit contains the network limits of an instance type.
+type instanceTypeLimit struct {
+	networkInterfaces int  // maximum number of ENIs of the instance type -- 0 if unknown
+	ipsPerInterface   int  // maximum number of IPv4 addresses per ENI -- 0 if unknown
+	ipv6PerInterface  int  // maximum number of IPv6 addresses per ENI -- 0 if unknown
+	ipv6Unsupported   bool // the instance type is known to not support IPv6
+}
+
+// instanceFull -- checks if the ENIs of the instance carry the maximum number of IPv4 addresses of the instance type
+// together. The ENIs outside of the egress subnets count, too. An instance with unknown limits is never full.
+func (l instanceTypeLimit) instanceFull(instance *ec2.Instance) bool {
+	if l.networkInterfaces <= 0 || l.ipsPerInterface <= 0 {
+		return false
+	}
+
+	count := 0
+	for _, networkInterface := range instance.NetworkInterfaces {
+		count += len(networkInterface.PrivateIpAddresses)
+	}
+
+	return count >= l.networkInterfaces*l.ipsPerInterface
+}
+
+// instanceTypeLimits -- returns the network limits of the instance type of the given instance. The limits are cached
+// since they don't change. If the limits can't be read from AWS, unknown limits are returned and the instance is
+// treated like before (AWS will reject the assignment if the interface is full).
+func (a *AwsCloudProvider) instanceTypeLimits(ctx context.Context, instance *ec2.Instance) instanceTypeLimit {
+	if instance.InstanceType == nil || *instance.InstanceType == "" {
+		return instanceTypeLimit{}
+	}
+	instanceType := *instance.InstanceType
+
+	cached, found := a.instanceTypes.Get(instanceType)
+	if found {
+		return cached.(instanceTypeLimit)
+	}
+
+	output, err := a.Aws.DescribeInstanceTypes(ctx, &ec2.DescribeInstanceTypesInput{
+		InstanceTypes: aws.StringSlice([]string{instanceType}),
+	})
 	if err != nil {
-		return "", err
+		log.Error(err, "can not read network limits of instance type",
+			"instance-type", instanceType,
+		)
+		return instanceTypeLimit{}
+	}
+
+	result := instanceTypeLimit{}
+	for _, info := range output.InstanceTypes {
+		if info.InstanceType == nil || *info.InstanceType != instanceType || info.NetworkInfo == nil {
+			continue
+		}
+
+		if info.NetworkInfo.MaximumNetworkInterfaces != nil {
+			result.networkInterfaces = int(*info.NetworkInfo.MaximumNetworkInterfaces)
+		}
+		if info.NetworkInfo.Ipv4AddressesPerInterface != nil {
+			result.ipsPerInterface = int(*info.NetworkInfo.Ipv4AddressesPerInterface)
+		}
+		if info.NetworkInfo.Ipv6AddressesPerInterface != nil {
+			result.ipv6PerInterface = int(*info.NetworkInfo.Ipv6AddressesPerInterface)
+		}
+		if info.NetworkInfo.Ipv6Supported != nil {
+			result.ipv6Unsupported = !*info.NetworkInfo.Ipv6Supported
+		}
 	}
 
-	return a.unAssignIPFromNetworkInterface(networkInterface, ip)
+	log.Info("read network limits of instance type",
+		"instance-type", instanceType,
+		"max-enis", result.networkInterfaces,
+		"max-ips-per-eni", result.ipsPerInterface,
+		"max-ipv6-per-eni", result.ipv6PerInterface,
+	)
+	a.instanceTypes.Set(instanceType, result, cache.DefaultExpiration)
+	return result
+}
+
+// isEgressNode -- checks if the instance is selected by the NodeSelector.
+func (a *AwsCloudProvider) isEgressNode(instance *ec2.Instance) bool {
+	return a.NodeSelector.Matches(ec2TagMap(instance.Tags))
 }
 
-func (a *AwsCloudProvider) findNetworkInterfaceForIP(ip *net.IP) (*ec2.NetworkInterface, error) {
-	input := ec2.DescribeNetworkInterfacesInput{
-		Filters: a.createEc2Filter("addresses.private-ip-address", []string{ip.String()}),
+// isEgressNodeOfCluster -- checks if the instance is an egress node of the cluster in any state. The inventory knows
+// the running instances only, the others (e.g. stopped ones) are read from AWS and have to carry the cluster tag.
+func (a *AwsCloudProvider) isEgressNodeOfCluster(ctx context.Context, snapshot *inventorySnapshot, instanceID string) (bool, error) {
+	if instance := snapshot.instances[instanceID]; instance != nil {
+		return a.isEgressNode(instance), nil
 	}
 
-	output, err := a.Aws.DescribeNetworkInterfaces(&input)
+	instances, err := a.describeInstances(ctx, ec2.DescribeInstancesInput{
+		Filters: a.createEc2Filter("instance-id", []string{instanceID}),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	key, _ := a.ClusterTag()
+	for _, instance := range instances {
+		if _, tagged := ec2TagMap(instance.Tags)[key]; tagged && a.isEgressNode(instance) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// isEgressSubnet -- checks if the subnet is selected by the SubnetSelector.
+func (a *AwsCloudProvider) isEgressSubnet(subnet *ec2.Subnet) bool {
+	return a.SubnetSelector.Matches(ec2TagMap(subnet.Tags))
+}
+
+func ec2TagMap(tags []*ec2.Tag) map[string]string {
+	result := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		if tag.Key != nil && tag.Value != nil {
+			result[*tag.Key] = *tag.Value
+		}
+	}
+	return result
+}
+
+// RemoveIP removes the IP from the AWS account. An Elastic IP associated with it is released or returned to the pool.
+func (a *AwsCloudProvider) RemoveIP(ctx context.Context, ip *net.IP) (string, error) {
+	if err := a.checkInitialized(); err != nil {
+		return "", err
+	}
+
+	networkInterface, err := a.findNetworkInterfaceForIP(ctx, ip)
+	if err != nil {
+		return "", err
+	}
+
+	err = a.removeElasticIPs(ctx, ip)
+	if err != nil {
+		log.Error(err, "could not remove the elastic ip associated with the ip - it may need to be released manually",
+			"ip", ip,
+		)
+	}
+
+	return a.unAssignIPFromNetworkInterface(ctx, networkInterface, ip)
+}
+
+func (a *AwsCloudProvider) findNetworkInterfaceForIP(ctx context.Context, ip *net.IP) (*ec2.NetworkInterface, error) {
+	networkInterfaces, err := a.loadNetworkInterfacesFromAws(ctx, a.networkInterfaceOfIPFilter(ip))
 	if err != nil {
 		return nil, err
 	}
 
-	if len(output.NetworkInterfaces) != 1 {
-		return nil, fmt.Errorf("found no network interface for ip '%s'", ip.String())
+	if len(networkInterfaces) != 1 {
+		return nil, &NotFoundError{Resource: "network interface", Key: fmt.Sprintf("ip '%s'", ip.String())}
 	}
 
-	if output.NetworkInterfaces[0].Attachment != nil {
+	if networkInterfaces[0].Attachment != nil {
 		log.Info("found network interface",
-			"network-interface-id", output.NetworkInterfaces[0].NetworkInterfaceId,
-			"instance-id", output.NetworkInterfaces[0].Attachment.InstanceId,
+			"network-interface-id", networkInterfaces[0].NetworkInterfaceId,
+			"instance-id", networkInterfaces[0].Attachment.InstanceId,
 			"ip", ip,
 		)
 	} else {
-		return nil, fmt.Errorf("found no attached network interface for ip '%s'", ip.String())
+		return nil, &NotFoundError{Resource: "attached network interface", Key: fmt.Sprintf("ip '%s'", ip.String())}
 	}
 
-	return output.NetworkInterfaces[0], nil
+	return networkInterfaces[0], nil
 }
 
-func (a *AwsCloudProvider) unAssignIPFromNetworkInterface(networkInterface *ec2.NetworkInterface, ip *net.IP) (string, error) {
+// networkInterfaceOfIPFilter -- the filter for the network interfaces the IPv4 or IPv6 address is assigned to.
+func (a *AwsCloudProvider) networkInterfaceOfIPFilter(ip *net.IP) ec2.DescribeNetworkInterfacesInput {
+	filterName := "addresses.private-ip-address"
+	if FamilyOf(*ip) == IPv6 {
+		filterName = "ipv6-addresses.ipv6-address"
+	}
+
+	return ec2.DescribeNetworkInterfacesInput{
+		Filters: a.createEc2Filter(filterName, []string{ip.String()}),
+	}
+}
+
+// loadNetworkInterfacesFromAws -- loads all network interfaces matching the filter. AWS may return empty pages with a
+// NextToken when filtering, so all pages are read.
+func (a *AwsCloudProvider) loadNetworkInterfacesFromAws(ctx context.Context, filter ec2.DescribeNetworkInterfacesInput) ([]*ec2.NetworkInterface, error) {
+	result := make([]*ec2.NetworkInterface, 0)
+
+	var nextToken *string
+	for {
+		page := filter
+		page.NextToken = nextToken
+
+		output, err := a.Aws.DescribeNetworkInterfaces(ctx, &page)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, output.NetworkInterfaces...)
+
+		nextToken = output.NextToken
+		if nextToken == nil || *nextToken == "" {
+			return result, nil
+		}
+	}
+}
+
+func (a *AwsCloudProvider) unAssignIPFromNetworkInterface(ctx context.Context, networkInterface *ec2.NetworkInterface, ip *net.IP) (string, error) {
 	if networkInterface.Attachment != nil {
 		instanceID := *networkInterface.Attachment.InstanceId
 
@@ -628,14 +976,22 @@ func (a *AwsCloudProvider) unAssignIPFromNetworkInterface(networkInterface *ec2.
 			"network-interface-id", networkInterface.NetworkInterfaceId,
 			"instance-id", instanceID,
 		)
-		unAssign := ec2.UnassignPrivateIpAddressesInput{
-			NetworkInterfaceId: networkInterface.NetworkInterfaceId,
-			PrivateIpAddresses: aws.StringSlice([]string{ip.String()}),
+		var err error
+		if FamilyOf(*ip) == IPv6 {
+			_, err = a.Aws.UnassignIPv6Addresses(ctx, &ec2.UnassignIpv6AddressesInput{
+				NetworkInterfaceId: networkInterface.NetworkInterfaceId,
+				Ipv6Addresses:      aws.StringSlice([]string{ip.String()}),
+			})
+		} else {
+			_, err = a.Aws.UnassignPrivateIPAddresses(ctx, &ec2.UnassignPrivateIpAddressesInput{
+				NetworkInterfaceId: networkInterface.NetworkInterfaceId,
+				PrivateIpAddresses: aws.StringSlice([]string{ip.String()}),
+			})
 		}
-		_, err := a.Aws.UnassignPrivateIPAddresses(&unAssign)
 		if err != nil {
 			return "", err
 		}
+		a.inventory.unassignIP(aws.StringValue(networkInterface.NetworkInterfaceId), *ip)
 
 		return instanceID, nil
 	}
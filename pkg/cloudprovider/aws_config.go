@@ -0,0 +1,232 @@
+package cloudprovider
+
+import (
+	"errors"
+	"fmt"
+	"github.com/hashicorp/go-multierror"
+	"github.com/patrickmn/go-cache"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ErrProviderNotInitialized is returned by an AwsCloudProvider not created by NewAwsCloudProvider.
+var ErrProviderNotInitialized = errors.New("the AWS cloud provider has not been created by NewAwsCloudProvider")
+
+// AWS regions look like "eu-central-1" or "us-gov-west-1".
+var awsRegionPattern = regexp.MustCompile(`^[a-z]{2}(-gov|-iso[a-z]?)?-[a-z]+-[0-9]+$`)
+
+// AWS limits the length of tag keys.
+const maxAwsTagKeyLength = 128
+
+// AwsConfig is the validated configuration of the AwsCloudProvider.
+type AwsConfig struct {
+	Region          string // the AWS region of the cluster -- required
+	ClusterName     string // the name of the cluster in the cluster tag -- required
+	ClusterTagValue string // the value of the cluster tag of the resources created by the operator -- owned or shared
+
+	NodeSelector          *TagSelector
+	SubnetSelector        *TagSelector
+	ElasticIPPoolSelector *TagSelector
+	Placement             PlacementStrategy
+
+	ResyncPeriod time.Duration     // period of the full resync of the inventory
+	Resilience   ResilienceOptions // options of the client created by NewAwsCloudProvider
+}
+
+// DefaultAwsConfig returns the configuration of the cluster in the region with the defaults of all other values.
+func DefaultAwsConfig(region string, clusterName string) AwsConfig {
+	nodeSelector, _ := ParseTagSelector(defaultEgressNodeSelector)
+	subnetSelector, _ := ParseTagSelector(defaultEgressSubnetSelector)
+	poolSelector, _ := ParseTagSelector(defaultElasticIPPoolSelector)
+	placement, _ := NewPlacementStrategy(defaultPlacementStrategy)
+
+	return AwsConfig{
+		Region:                region,
+		ClusterName:           clusterName,
+		ClusterTagValue:       defaultClusterTagValue,
+		NodeSelector:          nodeSelector,
+		SubnetSelector:        subnetSelector,
+		ElasticIPPoolSelector: poolSelector,
+		Placement:             placement,
+		ResyncPeriod:          defaultInventoryResyncPeriod,
+		Resilience:            DefaultResilienceOptions(),
+	}
+}
+
+// AwsConfigFromEnvironment reads the configuration from the environment. CLUSTER_NAME and AWS_REGION are required,
+// all other values have defaults. All missing or invalid values are reported together.
+func AwsConfigFromEnvironment() (AwsConfig, error) {
+	var result error
+
+	config := AwsConfig{}
+
+	var err error
+	if config.Region, err = readEnvironment("AWS_REGION"); err != nil {
+		result = multierror.Append(result, err)
+	}
+	if config.ClusterName, err = readEnvironment("CLUSTER_NAME"); err != nil {
+		result = multierror.Append(result, err)
+	}
+	config.ClusterTagValue, _ = readEnvironment("CLUSTER_TAG_VALUE", defaultClusterTagValue)
+
+	if config.NodeSelector, err = readSelector("EGRESS_NODE_SELECTOR", defaultEgressNodeSelector); err != nil {
+		result = multierror.Append(result, fmt.Errorf("EGRESS_NODE_SELECTOR: %v", err))
+	}
+	if config.SubnetSelector, err = readSelector("EGRESS_SUBNET_SELECTOR", defaultEgressSubnetSelector); err != nil {
+		result = multierror.Append(result, fmt.Errorf("EGRESS_SUBNET_SELECTOR: %v", err))
+	}
+	if config.ElasticIPPoolSelector, err = readSelector("ELASTIC_IP_POOL_SELECTOR", defaultElasticIPPoolSelector); err != nil {
+		result = multierror.Append(result, fmt.Errorf("ELASTIC_IP_POOL_SELECTOR: %v", err))
+	}
+
+	name, _ := readEnvironment("PLACEMENT_STRATEGY", defaultPlacementStrategy)
+	if config.Placement, err = NewPlacementStrategy(name); err != nil {
+		result = multierror.Append(result, fmt.Errorf("PLACEMENT_STRATEGY: %v", err))
+	}
+
+	period, _ := readEnvironment("INVENTORY_RESYNC_PERIOD", defaultInventoryResyncPeriod.String())
+	if config.ResyncPeriod, err = time.ParseDuration(period); err != nil || config.ResyncPeriod <= 0 {
+		result = multierror.Append(result, fmt.Errorf("INVENTORY_RESYNC_PERIOD '%s' is no valid positive duration", period))
+	}
+
+	if config.Resilience, err = resilienceOptionsFromEnvironment(); err != nil {
+		result = multierror.Append(result, err)
+	}
+
+	if result != nil {
+		return config, result
+	}
+
+	return config, config.Validate()
+}
+
+// Validate checks the configuration. All invalid values are reported together.
+func (c AwsConfig) Validate() error {
+	var result error
+
+	switch {
+	case c.Region == "":
+		result = multierror.Append(result, errors.New("the AWS region is missing"))
+	case !awsRegionPattern.MatchString(c.Region):
+		result = multierror.Append(result, fmt.Errorf("'%s' is no valid AWS region", c.Region))
+	}
+
+	switch {
+	case c.ClusterName == "":
+		result = multierror.Append(result, errors.New("the cluster name is missing"))
+	case strings.ContainsAny(c.ClusterName, " \t\n,="):
+		result = multierror.Append(result, fmt.Errorf("the cluster name '%s' contains invalid characters", c.ClusterName))
+	case len(clusterTagPrefix+c.ClusterName) > maxAwsTagKeyLength:
+		result = multierror.Append(result, fmt.Errorf("the cluster name '%s' is too long for an AWS tag", c.ClusterName))
+	}
+
+	if c.ClusterTagValue != "owned" && c.ClusterTagValue != "shared" {
+		result = multierror.Append(result, fmt.Errorf("the cluster tag value '%s' is neither 'owned' nor 'shared'",
+			c.ClusterTagValue))
+	}
+
+	if c.NodeSelector == nil || c.SubnetSelector == nil || c.ElasticIPPoolSelector == nil {
+		result = multierror.Append(result, errors.New("the node, subnet and Elastic IP pool selectors are required"))
+	}
+	if c.Placement == nil {
+		result = multierror.Append(result, errors.New("the placement strategy is missing"))
+	}
+	if c.ResyncPeriod <= 0 {
+		result = multierror.Append(result, fmt.Errorf("the inventory resync period %s is not positive", c.ResyncPeriod))
+	}
+
+	if c.Resilience.MaxRetries < 0 || c.Resilience.RateLimit <= 0 || c.Resilience.Burst < 1 || c.Resilience.Timeout < 0 {
+		result = multierror.Append(result, fmt.Errorf("invalid AWS api resilience options %+v", c.Resilience))
+	}
+
+	return result
+}
+
+// NewAwsCloudProvider creates the provider for the validated configuration. Without a client, a ResilientAwsClient
+// for the region is created.
+func NewAwsCloudProvider(config AwsConfig, client AwsClient) (*AwsCloudProvider, error) {
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid AWS configuration: %v", err)
+	}
+
+	if client == nil {
+		awsClient, err := CreateAwsClient(config.Region)
+		if err != nil {
+			return nil, err
+		}
+
+		client = NewResilientAwsClient(awsClient, config.Resilience)
+	}
+
+	result := &AwsCloudProvider{
+		Region:                config.Region,
+		Aws:                   client,
+		ClusterName:           config.ClusterName,
+		ClusterTagValue:       config.ClusterTagValue,
+		NodeSelector:          config.NodeSelector,
+		SubnetSelector:        config.SubnetSelector,
+		ElasticIPPoolSelector: config.ElasticIPPoolSelector,
+		Placement:             config.Placement,
+		resyncPeriod:          config.ResyncPeriod,
+		inventory:             newAwsInventory(),
+		instanceTypes:         cache.New(24*time.Hour, time.Hour), // the limits of instance types don't change
+		initialized:           true,
+	}
+
+	log.Info("Initialized AWS Cloud Provider.",
+		"Cluster Name", result.ClusterName,
+		"Cluster Tag Value", result.ClusterTagValue,
+		"AWS Region", result.Region,
+		"Inventory Resync Period", result.resyncPeriod,
+		"Egress Node Selector", result.NodeSelector.String(),
+		"Egress Subnet Selector", result.SubnetSelector.String(),
+		"Placement Strategy", result.Placement.Name(),
+		"Elastic IP Pool Selector", result.ElasticIPPoolSelector.String(),
+	)
+	return result, nil
+}
+
+// checkInitialized -- guards the methods of the provider against running with a half-initialized provider.
+func (a *AwsCloudProvider) checkInitialized() error {
+	if !a.initialized {
+		return ErrProviderNotInitialized
+	}
+
+	return nil
+}
+
+func readSelector(key string, defaultSelector string) (*TagSelector, error) {
+	selector, err := readEnvironment(key, defaultSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseTagSelector(selector)
+}
+
+// readEnvironment -- reads the environment variable key[0]. The optional key[1] is the default, without default the
+// variable is required.
+func readEnvironment(key ...string) (string, error) {
+	result, found := os.LookupEnv(key[0])
+	if !found {
+		if len(key) >= 2 {
+			log.V(4).Info("ENVIRONMENT does not contain entry for key. Using provided default",
+				"key", key[0],
+				"default", key[1],
+				"value", key[1],
+			)
+
+			return key[1], nil
+		}
+
+		return "", errors.New("the ENVIRONMENT contains no entry " + key[0])
+	}
+
+	log.V(4).Info("Read system environment.",
+		"key", key,
+		"value", result,
+	)
+	return result, nil
+}
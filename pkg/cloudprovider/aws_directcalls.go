@@ -1,21 +1,35 @@
 package cloudprovider
 
 import (
+	"context"
 	"errors"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ec2"
 )
 
-// AwsClient -- abstracts the direct calls to ec2 SDK since we need to mock them out for enabling testings.
+// AwsClient -- abstracts the direct calls to ec2 SDK since we need to mock them out for enabling testings. The calls
+// are cancelled when the context is done.
 type AwsClient interface {
-	AssignPrivateIPAddresses(request *ec2.AssignPrivateIpAddressesInput) (*ec2.AssignPrivateIpAddressesOutput, error)
-	UnassignPrivateIPAddresses(request *ec2.UnassignPrivateIpAddressesInput) (*ec2.UnassignPrivateIpAddressesOutput, error)
+	AssignPrivateIPAddresses(ctx context.Context, request *ec2.AssignPrivateIpAddressesInput) (*ec2.AssignPrivateIpAddressesOutput, error)
+	UnassignPrivateIPAddresses(ctx context.Context, request *ec2.UnassignPrivateIpAddressesInput) (*ec2.UnassignPrivateIpAddressesOutput, error)
+	AssignIPv6Addresses(ctx context.Context, request *ec2.AssignIpv6AddressesInput) (*ec2.AssignIpv6AddressesOutput, error)
+	UnassignIPv6Addresses(ctx context.Context, request *ec2.UnassignIpv6AddressesInput) (*ec2.UnassignIpv6AddressesOutput, error)
 
-	DescribeInstances(request *ec2.DescribeInstancesInput) (*ec2.DescribeInstancesOutput, error)
-	DescribeNetworkInterfaces(request *ec2.DescribeNetworkInterfacesInput) (*ec2.DescribeNetworkInterfacesOutput, error)
+	DescribeInstances(ctx context.Context, request *ec2.DescribeInstancesInput) (*ec2.DescribeInstancesOutput, error)
+	DescribeNetworkInterfaces(ctx context.Context, request *ec2.DescribeNetworkInterfacesInput) (*ec2.DescribeNetworkInterfacesOutput, error)
 
-	DescribeSubnets(request *ec2.DescribeSubnetsInput) (*ec2.DescribeSubnetsOutput, error)
+	DescribeSubnets(ctx context.Context, request *ec2.DescribeSubnetsInput) (*ec2.DescribeSubnetsOutput, error)
+
+	DescribeInstanceTypes(ctx context.Context, request *ec2.DescribeInstanceTypesInput) (*ec2.DescribeInstanceTypesOutput, error)
+
+	AllocateAddress(ctx context.Context, request *ec2.AllocateAddressInput) (*ec2.AllocateAddressOutput, error)
+	ReleaseAddress(ctx context.Context, request *ec2.ReleaseAddressInput) (*ec2.ReleaseAddressOutput, error)
+	AssociateAddress(ctx context.Context, request *ec2.AssociateAddressInput) (*ec2.AssociateAddressOutput, error)
+	DisassociateAddress(ctx context.Context, request *ec2.DisassociateAddressInput) (*ec2.DisassociateAddressOutput, error)
+	DescribeAddresses(ctx context.Context, request *ec2.DescribeAddressesInput) (*ec2.DescribeAddressesOutput, error)
+
+	CreateTags(ctx context.Context, request *ec2.CreateTagsInput) (*ec2.CreateTagsOutput, error)
 
 	GetRegion() string
 }
@@ -65,26 +79,71 @@ func (a *AwsClientImpl) createAwsEc2Client() (*ec2.EC2, error) {
 }
 
 // AssignPrivateIPAddresses -- Assigns IP addresses to an instance.
-func (a AwsClientImpl) AssignPrivateIPAddresses(request *ec2.AssignPrivateIpAddressesInput) (*ec2.AssignPrivateIpAddressesOutput, error) {
-	return a.ec2Client.AssignPrivateIpAddresses(request)
+func (a AwsClientImpl) AssignPrivateIPAddresses(ctx context.Context, request *ec2.AssignPrivateIpAddressesInput) (*ec2.AssignPrivateIpAddressesOutput, error) {
+	return a.ec2Client.AssignPrivateIpAddressesWithContext(ctx, request)
 }
 
 // UnassignPrivateIPAddresses -- Removes the IP addresses from an instance.
-func (a AwsClientImpl) UnassignPrivateIPAddresses(request *ec2.UnassignPrivateIpAddressesInput) (*ec2.UnassignPrivateIpAddressesOutput, error) {
-	return a.ec2Client.UnassignPrivateIpAddresses(request)
+func (a AwsClientImpl) UnassignPrivateIPAddresses(ctx context.Context, request *ec2.UnassignPrivateIpAddressesInput) (*ec2.UnassignPrivateIpAddressesOutput, error) {
+	return a.ec2Client.UnassignPrivateIpAddressesWithContext(ctx, request)
+}
+
+// AssignIPv6Addresses -- Assigns IPv6 addresses to a network interface.
+func (a AwsClientImpl) AssignIPv6Addresses(ctx context.Context, request *ec2.AssignIpv6AddressesInput) (*ec2.AssignIpv6AddressesOutput, error) {
+	return a.ec2Client.AssignIpv6AddressesWithContext(ctx, request)
+}
+
+// UnassignIPv6Addresses -- Removes the IPv6 addresses from a network interface.
+func (a AwsClientImpl) UnassignIPv6Addresses(ctx context.Context, request *ec2.UnassignIpv6AddressesInput) (*ec2.UnassignIpv6AddressesOutput, error) {
+	return a.ec2Client.UnassignIpv6AddressesWithContext(ctx, request)
 }
 
 // DescribeInstances -- Retrieves all information for a specific instance or all instances matching the request.
-func (a AwsClientImpl) DescribeInstances(request *ec2.DescribeInstancesInput) (*ec2.DescribeInstancesOutput, error) {
-	return a.ec2Client.DescribeInstances(request)
+func (a AwsClientImpl) DescribeInstances(ctx context.Context, request *ec2.DescribeInstancesInput) (*ec2.DescribeInstancesOutput, error) {
+	return a.ec2Client.DescribeInstancesWithContext(ctx, request)
 }
 
 // DescribeNetworkInterfaces -- Retrieves all information for the network interface(s) matching the request.
-func (a AwsClientImpl) DescribeNetworkInterfaces(request *ec2.DescribeNetworkInterfacesInput) (*ec2.DescribeNetworkInterfacesOutput, error) {
-	return a.ec2Client.DescribeNetworkInterfaces(request)
+func (a AwsClientImpl) DescribeNetworkInterfaces(ctx context.Context, request *ec2.DescribeNetworkInterfacesInput) (*ec2.DescribeNetworkInterfacesOutput, error) {
+	return a.ec2Client.DescribeNetworkInterfacesWithContext(ctx, request)
 }
 
 // DescribeSubnets -- Describes the subnet(s) matching the request.
-func (a AwsClientImpl) DescribeSubnets(request *ec2.DescribeSubnetsInput) (*ec2.DescribeSubnetsOutput, error) {
-	return a.ec2Client.DescribeSubnets(request)
+func (a AwsClientImpl) DescribeSubnets(ctx context.Context, request *ec2.DescribeSubnetsInput) (*ec2.DescribeSubnetsOutput, error) {
+	return a.ec2Client.DescribeSubnetsWithContext(ctx, request)
+}
+
+// DescribeInstanceTypes -- Describes the instance type(s) matching the request (including their network limits).
+func (a AwsClientImpl) DescribeInstanceTypes(ctx context.Context, request *ec2.DescribeInstanceTypesInput) (*ec2.DescribeInstanceTypesOutput, error) {
+	return a.ec2Client.DescribeInstanceTypesWithContext(ctx, request)
+}
+
+// AllocateAddress -- Allocates a new Elastic IP.
+func (a AwsClientImpl) AllocateAddress(ctx context.Context, request *ec2.AllocateAddressInput) (*ec2.AllocateAddressOutput, error) {
+	return a.ec2Client.AllocateAddressWithContext(ctx, request)
+}
+
+// ReleaseAddress -- Releases an Elastic IP.
+func (a AwsClientImpl) ReleaseAddress(ctx context.Context, request *ec2.ReleaseAddressInput) (*ec2.ReleaseAddressOutput, error) {
+	return a.ec2Client.ReleaseAddressWithContext(ctx, request)
+}
+
+// AssociateAddress -- Associates an Elastic IP with a private IP of a network interface.
+func (a AwsClientImpl) AssociateAddress(ctx context.Context, request *ec2.AssociateAddressInput) (*ec2.AssociateAddressOutput, error) {
+	return a.ec2Client.AssociateAddressWithContext(ctx, request)
+}
+
+// DisassociateAddress -- Removes the association of an Elastic IP.
+func (a AwsClientImpl) DisassociateAddress(ctx context.Context, request *ec2.DisassociateAddressInput) (*ec2.DisassociateAddressOutput, error) {
+	return a.ec2Client.DisassociateAddressWithContext(ctx, request)
+}
+
+// DescribeAddresses -- Describes the Elastic IP(s) matching the request.
+func (a AwsClientImpl) DescribeAddresses(ctx context.Context, request *ec2.DescribeAddressesInput) (*ec2.DescribeAddressesOutput, error) {
+	return a.ec2Client.DescribeAddressesWithContext(ctx, request)
+}
+
+// CreateTags -- Adds or overwrites tags of AWS resources.
+func (a AwsClientImpl) CreateTags(ctx context.Context, request *ec2.CreateTagsInput) (*ec2.CreateTagsOutput, error) {
+	return a.ec2Client.CreateTagsWithContext(ctx, request)
 }
@@ -0,0 +1,210 @@
+package cloudprovider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"net"
+)
+
+// The tags the operator marks the Elastic IPs with it allocated itself. Only these are released again, Elastic IPs
+// of the pool are just disassociated.
+const (
+	elasticIPAllocatedTag = "aws-egressip-operator/allocated"
+	elasticIPNamespaceTag = "aws-egressip-operator/namespace"
+)
+
+// AssociatePublicIP associates an Elastic IP with the (already assigned) private IP. The Elastic IP is taken from the
+// pool selected by the ElasticIPPoolSelector. Without a pool a new Elastic IP is allocated and tagged with the cluster
+// and the namespace of the request.
+func (a *AwsCloudProvider) AssociatePublicIP(ctx context.Context, request IPRequest, ip *net.IP) (*net.IP, error) {
+	if err := a.checkInitialized(); err != nil {
+		return nil, err
+	}
+
+	if FamilyOf(*ip) != IPv4 {
+		return nil, fmt.Errorf("can not associate an elastic ip with the IPv6 address '%s'", ip.String())
+	}
+
+	networkInterface, err := a.findNetworkInterfaceForIP(ctx, ip)
+	if err != nil {
+		return nil, err
+	}
+
+	associated, err := a.elasticIPsForIP(ctx, ip)
+	if err != nil {
+		return nil, err
+	}
+	if len(associated) > 0 {
+		result := net.ParseIP(*associated[0].PublicIp)
+		log.Info("elastic ip is already associated with ip",
+			"ip", ip,
+			"elastic-ip", result,
+		)
+		return &result, nil
+	}
+
+	var address *ec2.Address
+	allocated := !a.hasElasticIPPool()
+	if allocated {
+		address, err = a.allocateElasticIP(ctx, request)
+	} else {
+		address, err = a.elasticIPFromPool(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = a.Aws.AssociateAddress(ctx, &ec2.AssociateAddressInput{
+		AllocationId:       address.AllocationId,
+		NetworkInterfaceId: networkInterface.NetworkInterfaceId,
+		PrivateIpAddress:   aws.String(ip.String()),
+		AllowReassociation: aws.Bool(false),
+	})
+	if err != nil {
+		if allocated {
+			// the cleanup must not be cancelled together with the request
+			a.releaseElasticIP(context.Background(), address)
+		}
+		return nil, err
+	}
+
+	result := net.ParseIP(*address.PublicIp)
+	log.Info("associated elastic ip with ip",
+		"ip", ip,
+		"elastic-ip", result,
+		"allocation-id", address.AllocationId,
+		"eni", networkInterface.NetworkInterfaceId,
+		"namespace", request.Namespace,
+	)
+	return &result, nil
+}
+
+func (a *AwsCloudProvider) hasElasticIPPool() bool {
+	return a.ElasticIPPoolSelector.String() != ""
+}
+
+// allocateElasticIP -- allocates a new Elastic IP and tags it as allocated by the operator.
+func (a *AwsCloudProvider) allocateElasticIP(ctx context.Context, request IPRequest) (*ec2.Address, error) {
+	output, err := a.Aws.AllocateAddress(ctx, &ec2.AllocateAddressInput{
+		Domain: aws.String(ec2.DomainTypeVpc),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ec2.Address{
+		AllocationId: output.AllocationId,
+		PublicIp:     output.PublicIp,
+	}
+
+	key, value := a.ClusterTag()
+	_, err = a.Aws.CreateTags(ctx, &ec2.CreateTagsInput{
+		Resources: []*string{output.AllocationId},
+		Tags: []*ec2.Tag{
+			{Key: aws.String(key), Value: aws.String(value)},
+			{Key: aws.String(elasticIPAllocatedTag), Value: aws.String("true")},
+			{Key: aws.String(elasticIPNamespaceTag), Value: aws.String(request.Namespace)},
+		},
+	})
+	if err != nil {
+		a.releaseElasticIP(context.Background(), result)
+		return nil, err
+	}
+
+	log.Info("allocated elastic ip",
+		"elastic-ip", output.PublicIp,
+		"allocation-id", output.AllocationId,
+		"namespace", request.Namespace,
+	)
+	return result, nil
+}
+
+// elasticIPFromPool -- returns an unassociated Elastic IP selected by the ElasticIPPoolSelector.
+func (a *AwsCloudProvider) elasticIPFromPool(ctx context.Context) (*ec2.Address, error) {
+	output, err := a.Aws.DescribeAddresses(ctx, &ec2.DescribeAddressesInput{
+		Filters: a.createEc2Filter("domain", []string{ec2.DomainTypeVpc}),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, address := range output.Addresses {
+		if address.AssociationId == nil && a.ElasticIPPoolSelector.Matches(ec2TagMap(address.Tags)) {
+			return address, nil
+		}
+	}
+
+	return nil, &CapacityExhaustedError{Network: "elastic-ip-pool"}
+}
+
+// elasticIPsForIP -- returns the Elastic IPs associated with the private IP.
+func (a *AwsCloudProvider) elasticIPsForIP(ctx context.Context, ip *net.IP) ([]*ec2.Address, error) {
+	output, err := a.Aws.DescribeAddresses(ctx, &ec2.DescribeAddressesInput{
+		Filters: a.createEc2Filter("private-ip-address", []string{ip.String()}),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return output.Addresses, nil
+}
+
+// removeElasticIPs -- disassociates the Elastic IPs of the private IP. Elastic IPs allocated by the operator are
+// released, the ones of the pool are kept.
+func (a *AwsCloudProvider) removeElasticIPs(ctx context.Context, ip *net.IP) error {
+	if FamilyOf(*ip) != IPv4 {
+		return nil
+	}
+
+	addresses, err := a.elasticIPsForIP(ctx, ip)
+	if err != nil {
+		return err
+	}
+
+	for _, address := range addresses {
+		if address.AssociationId != nil {
+			_, err = a.Aws.DisassociateAddress(ctx, &ec2.DisassociateAddressInput{
+				AssociationId: address.AssociationId,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if ec2TagMap(address.Tags)[elasticIPAllocatedTag] == "true" {
+			if !a.releaseElasticIP(ctx, address) {
+				return errors.New("could not release elastic ip " + aws.StringValue(address.PublicIp))
+			}
+		} else {
+			log.Info("returned elastic ip to the pool",
+				"ip", ip,
+				"elastic-ip", address.PublicIp,
+			)
+		}
+	}
+
+	return nil
+}
+
+// releaseElasticIP -- releases the Elastic IP. Failures are logged since the caller can't do anything about them.
+func (a *AwsCloudProvider) releaseElasticIP(ctx context.Context, address *ec2.Address) bool {
+	_, err := a.Aws.ReleaseAddress(ctx, &ec2.ReleaseAddressInput{
+		AllocationId: address.AllocationId,
+	})
+	if err != nil {
+		log.Error(err, "could not release elastic ip",
+			"elastic-ip", address.PublicIp,
+			"allocation-id", address.AllocationId,
+		)
+		return false
+	}
+
+	log.Info("released elastic ip",
+		"elastic-ip", address.PublicIp,
+		"allocation-id", address.AllocationId,
+	)
+	return true
+}
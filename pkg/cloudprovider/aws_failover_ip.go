@@ -0,0 +1,85 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/hashicorp/go-multierror"
+	"net"
+)
+
+// FailoverIP assigns a new IP of the address family of the IP in an egress subnet of another availability zone. It is
+// used for IPs whose subnet has no egress node left. The zones are tried in the order of IPRequest.FailoverZones until
+// one of them has an egress node able to take the IP. Returns the instance and the new IP.
+func (a *AwsCloudProvider) FailoverIP(ctx context.Context, request IPRequest, ip *net.IP) (string, *net.IP, error) {
+	if err := a.checkInitialized(); err != nil {
+		return "", nil, err
+	}
+
+	snapshot, err := a.freshInventory(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+
+	failed, _ := egressSubnetOfIP(snapshot, ip)
+	if failed == nil {
+		return "", nil, &InvalidIPError{IP: ip.String(), Reason: "is in no egress subnet of the cluster"}
+	}
+	failedZone := aws.StringValue(failed.AvailabilityZone)
+	family := FamilyOf(*ip)
+
+	var failoverErrors error
+	for _, subnet := range failoverSubnets(request, snapshot.subnetList, failedZone) {
+		subnetID := aws.StringValue(subnet.SubnetId)
+		if len(subnetCidrs(subnet, family)) == 0 {
+			continue
+		}
+
+		var replacement *net.IP
+		instanceID, err := a.assignToInterfaceInSubnet(ctx, request, subnetID, family, func(interfaceID string) error {
+			var err error
+			replacement, err = a.addRandomIPToInterface(ctx, interfaceID, family)
+			return err
+		})
+		if err == nil {
+			log.Info(fmt.Sprintf("failed over ip '%s' of zone '%s' to ip '%s' on instance '%s' in zone '%s'",
+				ip.String(), failedZone, replacement.String(), instanceID, aws.StringValue(subnet.AvailabilityZone)))
+			return instanceID, replacement, nil
+		}
+		if !IsNoEgressNode(err) && !IsCapacityExhausted(err) {
+			return "", nil, err
+		}
+
+		log.Info("zone can't take the failover ip - trying the next one",
+			"ip", ip,
+			"subnet-id", subnetID,
+			"cause", err.Error(),
+		)
+		failoverErrors = multierror.Append(failoverErrors, err)
+	}
+
+	if failoverErrors == nil {
+		return "", nil, fmt.Errorf("no zone but '%s' has an egress subnet for %s ips", failedZone, family)
+	}
+	return "", nil, failoverErrors
+}
+
+// failoverSubnets -- returns the egress subnets outside the failed zone in the order of IPRequest.FailoverZones.
+func failoverSubnets(request IPRequest, subnets []*ec2.Subnet, failedZone string) []*ec2.Subnet {
+	available := make([]string, 0, len(subnets))
+	for _, subnet := range subnets {
+		available = append(available, aws.StringValue(subnet.AvailabilityZone))
+	}
+
+	result := make([]*ec2.Subnet, 0, len(subnets))
+	for _, zone := range request.FailoverZones(available, failedZone) {
+		for _, subnet := range subnets {
+			if aws.StringValue(subnet.AvailabilityZone) == zone {
+				result = append(result, subnet)
+			}
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,436 @@
+package cloudprovider
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"net"
+	"sync"
+	"time"
+)
+
+const defaultInventoryResyncPeriod = time.Minute
+
+// awsInventory -- the goroutine-safe view of the instances, subnets and ENIs of the cluster. The data is kept in an
+// immutable snapshot which is replaced as a whole. Readers work on a consistent snapshot without further locking. Only
+// one full resync runs at a time, IP changes recorded while it reads AWS are applied again on top of its result.
+type awsInventory struct {
+	mutex    sync.RWMutex
+	snapshot *inventorySnapshot
+
+	resyncMutex sync.Mutex // held during a full resync
+	ipChanges   []ipChange // IP changes recorded since the running full resync started -- nil if none is running
+}
+
+// ipChange -- changes the IPs of a copy of the network interface. Returns true if it changed the interface.
+type ipChange func(interfaceID string, networkInterface *ec2.InstanceNetworkInterface) bool
+
+// inventorySnapshot -- a consistent view of the AWS resources of the cluster. Never modify a snapshot after creation.
+type inventorySnapshot struct {
+	instanceList []*ec2.Instance // all instances in the order AWS returned them
+
+	instances           map[string]*ec2.Instance // instance id -> instance
+	instancesByHostname map[string]string        // private dns name -> instance id
+
+	networkInterfaces   map[string]*ec2.InstanceNetworkInterface // eni id -> eni
+	instanceByInterface map[string]string                        // eni id -> instance id
+	interfacesBySubnet  map[string][]string                      // subnet id -> eni ids
+
+	subnetList []*ec2.Subnet
+	subnets    map[string]*ec2.Subnet // subnet id -> subnet
+
+	loaded time.Time // time of the last full resync -- zero if there never was one
+}
+
+func newAwsInventory() *awsInventory {
+	return &awsInventory{
+		snapshot: newInventorySnapshot(nil, nil, time.Time{}),
+	}
+}
+
+// current -- returns the current snapshot.
+func (i *awsInventory) current() *inventorySnapshot {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	return i.snapshot
+}
+
+// beginResync -- starts recording the IP changes to apply them on top of the result of the full resync. The caller
+// holds the resyncMutex.
+func (i *awsInventory) beginResync() {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.ipChanges = make([]ipChange, 0)
+}
+
+// endResync -- stops recording the IP changes. A failed resync drops them, they are contained in the current snapshot.
+func (i *awsInventory) endResync() {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.ipChanges = nil
+}
+
+// replace -- replaces the inventory with the result of a full resync. The IP changes recorded since the resync started
+// are applied again, AWS may have been read before they were done. Instances not contained in the new data (e.g.
+// terminated ones) are evicted.
+func (i *awsInventory) replace(instances []*ec2.Instance, subnets []*ec2.Subnet) *inventorySnapshot {
+	next := newInventorySnapshot(instances, subnets, time.Now())
+
+	i.mutex.Lock()
+	for _, change := range i.ipChanges {
+		next = next.changeIPs(change)
+	}
+	i.ipChanges = nil
+	previous := i.snapshot
+	i.snapshot = next
+	i.mutex.Unlock()
+
+	for id := range previous.instances {
+		if next.instances[id] == nil {
+			log.Info("evicted instance from inventory",
+				"instance-id", id,
+				"hostname", previous.instances[id].PrivateDnsName,
+			)
+		}
+	}
+
+	return next
+}
+
+// upsert -- adds the instances to the inventory or replaces the already known data of them.
+func (i *awsInventory) upsert(instances ...*ec2.Instance) {
+	if len(instances) == 0 {
+		return
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	current := i.snapshot
+	instanceList := make([]*ec2.Instance, 0, len(current.instanceList)+len(instances))
+	replaced := make(map[string]bool, len(instances))
+	for _, known := range current.instanceList {
+		for _, instance := range instances {
+			if *instance.InstanceId == *known.InstanceId {
+				known = instance
+				replaced[*instance.InstanceId] = true
+			}
+		}
+		instanceList = append(instanceList, known)
+	}
+	for _, instance := range instances {
+		if !replaced[*instance.InstanceId] {
+			instanceList = append(instanceList, instance)
+		}
+	}
+
+	i.snapshot = newInventorySnapshot(instanceList, current.subnetList, current.loaded)
+}
+
+// evict -- removes the instances (e.g. terminated ones) from the inventory before the next full resync.
+func (i *awsInventory) evict(instanceIDs ...string) {
+	if len(instanceIDs) == 0 {
+		return
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	current := i.snapshot
+	instanceList := make([]*ec2.Instance, 0, len(current.instanceList))
+	for _, known := range current.instanceList {
+		if isExcluded(*known.InstanceId, instanceIDs) {
+			log.Info("evicted instance from inventory",
+				"instance-id", *known.InstanceId,
+				"hostname", known.PrivateDnsName,
+			)
+			continue
+		}
+		instanceList = append(instanceList, known)
+	}
+
+	i.snapshot = newInventorySnapshot(instanceList, current.subnetList, current.loaded)
+}
+
+// assignIP -- records the IP as assigned to the network interface. The IP is removed from the other interfaces of the
+// inventory, so a reassignment moves it. Interfaces not known to the inventory are ignored, the next resync reads them.
+func (i *awsInventory) assignIP(interfaceID string, ip net.IP) {
+	i.changeIPs(func(id string, networkInterface *ec2.InstanceNetworkInterface) bool {
+		if id == interfaceID {
+			return addInterfaceIP(networkInterface, ip)
+		}
+		return removeInterfaceIP(networkInterface, ip)
+	})
+}
+
+// unassignIP -- records the IP as unassigned from the network interface.
+func (i *awsInventory) unassignIP(interfaceID string, ip net.IP) {
+	i.changeIPs(func(id string, networkInterface *ec2.InstanceNetworkInterface) bool {
+		return id == interfaceID && removeInterfaceIP(networkInterface, ip)
+	})
+}
+
+// changeIPs -- applies the change to the inventory. It is recorded if a full resync is running.
+func (i *awsInventory) changeIPs(change ipChange) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	if i.ipChanges != nil {
+		i.ipChanges = append(i.ipChanges, change)
+	}
+	i.snapshot = i.snapshot.changeIPs(change)
+}
+
+// changeIPs -- runs the change on copies of all network interfaces of the snapshot and returns a new snapshot with the
+// changed instances replaced by copies. Returns the snapshot itself if nothing changed.
+func (s *inventorySnapshot) changeIPs(change ipChange) *inventorySnapshot {
+	instanceList := make([]*ec2.Instance, 0, len(s.instanceList))
+	changed := false
+	for _, known := range s.instanceList {
+		networkInterfaces := make([]*ec2.InstanceNetworkInterface, len(known.NetworkInterfaces))
+		instanceChanged := false
+		for j, networkInterface := range known.NetworkInterfaces {
+			networkInterfaces[j] = networkInterface
+			if networkInterface.NetworkInterfaceId == nil {
+				continue
+			}
+
+			copied := *networkInterface
+			if change(*networkInterface.NetworkInterfaceId, &copied) {
+				networkInterfaces[j] = &copied
+				instanceChanged = true
+			}
+		}
+
+		if instanceChanged {
+			copied := *known
+			copied.NetworkInterfaces = networkInterfaces
+			known = &copied
+			changed = true
+		}
+		instanceList = append(instanceList, known)
+	}
+
+	if !changed {
+		return s
+	}
+	return newInventorySnapshot(instanceList, s.subnetList, s.loaded)
+}
+
+// addInterfaceIP -- adds the IP as secondary address to the interface unless it carries it already. The address lists
+// are copied, the interface is a copy of the snapshot data.
+func addInterfaceIP(networkInterface *ec2.InstanceNetworkInterface, ip net.IP) bool {
+	if interfaceHasIP(networkInterface, ip) {
+		return false
+	}
+
+	if FamilyOf(ip) == IPv6 {
+		addresses := make([]*ec2.InstanceIpv6Address, 0, len(networkInterface.Ipv6Addresses)+1)
+		addresses = append(addresses, networkInterface.Ipv6Addresses...)
+		networkInterface.Ipv6Addresses = append(addresses, &ec2.InstanceIpv6Address{Ipv6Address: aws.String(ip.String())})
+		return true
+	}
+
+	addresses := make([]*ec2.InstancePrivateIpAddress, 0, len(networkInterface.PrivateIpAddresses)+1)
+	addresses = append(addresses, networkInterface.PrivateIpAddresses...)
+	networkInterface.PrivateIpAddresses = append(addresses, &ec2.InstancePrivateIpAddress{
+		PrivateIpAddress: aws.String(ip.String()),
+		Primary:          aws.Bool(false),
+	})
+	return true
+}
+
+// removeInterfaceIP -- removes the secondary address from the interface. The primary address is never removed.
+func removeInterfaceIP(networkInterface *ec2.InstanceNetworkInterface, ip net.IP) bool {
+	if !interfaceHasIP(networkInterface, ip) {
+		return false
+	}
+
+	ipv6Addresses := make([]*ec2.InstanceIpv6Address, 0, len(networkInterface.Ipv6Addresses))
+	for _, address := range networkInterface.Ipv6Addresses {
+		if !ip.Equal(net.ParseIP(aws.StringValue(address.Ipv6Address))) {
+			ipv6Addresses = append(ipv6Addresses, address)
+		}
+	}
+	networkInterface.Ipv6Addresses = ipv6Addresses
+
+	privateAddresses := make([]*ec2.InstancePrivateIpAddress, 0, len(networkInterface.PrivateIpAddresses))
+	for j, address := range networkInterface.PrivateIpAddresses {
+		if isPrimaryAddress(j, address) || !ip.Equal(net.ParseIP(aws.StringValue(address.PrivateIpAddress))) {
+			privateAddresses = append(privateAddresses, address)
+		}
+	}
+	networkInterface.PrivateIpAddresses = privateAddresses
+
+	return true
+}
+
+// interfaceHasIP -- checks if the interface carries the IP as private IPv4 or IPv6 address.
+func interfaceHasIP(networkInterface *ec2.InstanceNetworkInterface, ip net.IP) bool {
+	for _, address := range networkInterface.PrivateIpAddresses {
+		if ip.Equal(net.ParseIP(aws.StringValue(address.PrivateIpAddress))) {
+			return true
+		}
+	}
+	for _, address := range networkInterface.Ipv6Addresses {
+		if ip.Equal(net.ParseIP(aws.StringValue(address.Ipv6Address))) {
+			return true
+		}
+	}
+	return false
+}
+
+// newInventorySnapshot -- builds the lookup tables of a snapshot.
+func newInventorySnapshot(instances []*ec2.Instance, subnets []*ec2.Subnet, loaded time.Time) *inventorySnapshot {
+	result := &inventorySnapshot{
+		instanceList:        instances,
+		instances:           make(map[string]*ec2.Instance, len(instances)),
+		instancesByHostname: make(map[string]string, len(instances)),
+		networkInterfaces:   make(map[string]*ec2.InstanceNetworkInterface),
+		instanceByInterface: make(map[string]string),
+		interfacesBySubnet:  make(map[string][]string),
+		subnetList:          subnets,
+		subnets:             make(map[string]*ec2.Subnet, len(subnets)),
+		loaded:              loaded,
+	}
+
+	for _, instance := range instances {
+		result.instances[*instance.InstanceId] = instance
+
+		if instance.PrivateDnsName != nil && len(*instance.PrivateDnsName) > 0 {
+			result.instancesByHostname[*instance.PrivateDnsName] = *instance.InstanceId
+		}
+
+		for _, networkInterface := range instance.NetworkInterfaces {
+			if networkInterface.NetworkInterfaceId == nil {
+				continue
+			}
+			id := *networkInterface.NetworkInterfaceId
+
+			result.networkInterfaces[id] = networkInterface
+			result.instanceByInterface[id] = *instance.InstanceId
+			if networkInterface.SubnetId != nil {
+				result.interfacesBySubnet[*networkInterface.SubnetId] = append(result.interfacesBySubnet[*networkInterface.SubnetId], id)
+			}
+		}
+	}
+
+	for _, subnet := range subnets {
+		result.subnets[*subnet.SubnetId] = subnet
+	}
+
+	return result
+}
+
+// isStale -- checks if the last full resync is older than the given period.
+func (s *inventorySnapshot) isStale(period time.Duration) bool {
+	return s.loaded.IsZero() || time.Since(s.loaded) > period
+}
+
+// Resync -- reads all instances (including their ENIs) and the egress subnets of the cluster from AWS and replaces
+// the inventory. Subnets not selected by the SubnetSelector are not kept. A call waits for a running resync to end.
+func (a *AwsCloudProvider) Resync(ctx context.Context) error {
+	if err := a.checkInitialized(); err != nil {
+		return err
+	}
+
+	a.inventory.resyncMutex.Lock()
+	defer a.inventory.resyncMutex.Unlock()
+
+	return a.resync(ctx)
+}
+
+// resync -- the full resync. The caller holds the resyncMutex of the inventory.
+func (a *AwsCloudProvider) resync(ctx context.Context) error {
+	a.inventory.beginResync()
+	defer a.inventory.endResync()
+
+	instances, err := a.describeInstances(ctx, a.allInstancesFilter())
+	if err != nil {
+		return err
+	}
+
+	allSubnets, err := a.describeSubnets(ctx)
+	if err != nil {
+		return err
+	}
+
+	subnets := make([]*ec2.Subnet, 0, len(allSubnets))
+	for _, subnet := range allSubnets {
+		if a.isEgressSubnet(subnet) {
+			subnets = append(subnets, subnet)
+		}
+	}
+
+	snapshot := a.inventory.replace(instances, subnets)
+	log.V(4).Info("resynced inventory",
+		"instances", len(snapshot.instances),
+		"network-interfaces", len(snapshot.networkInterfaces),
+		"subnets", len(snapshot.subnets),
+	)
+	return nil
+}
+
+// Start -- runs the periodic full resync of the inventory until the stop channel is closed. It implements the
+// manager.Runnable of the controller-runtime so it can be added to the operator manager. A running resync is cancelled
+// on stop.
+func (a *AwsCloudProvider) Start(stop <-chan struct{}) error {
+	if err := a.checkInitialized(); err != nil {
+		return err
+	}
+
+	ctx, cancel := contextOfStop(stop)
+	defer cancel()
+
+	log.Info("starting periodic inventory resync",
+		"period", a.resyncPeriod,
+	)
+
+	ticker := time.NewTicker(a.resyncPeriod)
+	defer ticker.Stop()
+
+	for {
+		if err := a.Resync(ctx); err != nil {
+			log.Error(err, "inventory resync failed")
+		}
+
+		select {
+		case <-stop:
+			log.Info("stopped periodic inventory resync")
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// freshInventory -- returns the current inventory. If the last full resync is older than the resync period, the
+// inventory is resynced first. Concurrent callers share the resync, they wait for it and use its result.
+func (a *AwsCloudProvider) freshInventory(ctx context.Context) (*inventorySnapshot, error) {
+	snapshot := a.inventory.current()
+	if !snapshot.isStale(a.resyncPeriod) {
+		return snapshot, nil
+	}
+
+	if err := a.checkInitialized(); err != nil {
+		return nil, err
+	}
+
+	a.inventory.resyncMutex.Lock()
+	defer a.inventory.resyncMutex.Unlock()
+
+	// another caller may have resynced the inventory while this one waited.
+	snapshot = a.inventory.current()
+	if !snapshot.isStale(a.resyncPeriod) {
+		return snapshot, nil
+	}
+
+	err := a.resync(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.inventory.current(), nil
+}
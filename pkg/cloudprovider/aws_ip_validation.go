@@ -0,0 +1,161 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/hashicorp/go-multierror"
+	"math/big"
+	"net"
+)
+
+var _ IPValidator = &AwsCloudProvider{}
+
+// AWS reserves the first four addresses and the last address of every subnet.
+const awsReservedAddressesAtStart = 4
+
+// ValidateSpecifiedIPs checks the specified IPs of a namespace before they are assigned: every IP has to be in an
+// egress subnet of the cluster, must not be reserved by AWS and must not be used by a network interface outside the
+// egress nodes. A namespace gets at most one IP of every address family per availability zone.
+func (a *AwsCloudProvider) ValidateSpecifiedIPs(ctx context.Context, request IPRequest, ips []*net.IP) error {
+	if err := a.checkInitialized(); err != nil {
+		return err
+	}
+
+	snapshot, err := a.freshInventory(ctx)
+	if err != nil {
+		return err
+	}
+
+	var result error
+	zones := make(map[IPFamily]map[string]string) // family -> zone -> ip
+
+	for _, ip := range ips {
+		if ip == nil {
+			result = multierror.Append(result, &InvalidIPError{IP: "<nil>", Reason: "is no ip address"})
+			continue
+		}
+
+		subnet, cidr := egressSubnetOfIP(snapshot, ip)
+		if subnet == nil {
+			result = multierror.Append(result, &InvalidIPError{IP: ip.String(), Reason: "is in no egress subnet of the cluster"})
+			continue
+		}
+
+		if isReservedAddress(cidr, *ip) {
+			result = multierror.Append(result, &InvalidIPError{
+				IP:     ip.String(),
+				Reason: fmt.Sprintf("is reserved by AWS in subnet '%s'", aws.StringValue(subnet.SubnetId)),
+			})
+			continue
+		}
+
+		family := FamilyOf(*ip)
+		zone := aws.StringValue(subnet.AvailabilityZone)
+		if zones[family] == nil {
+			zones[family] = make(map[string]string)
+		}
+		if other, found := zones[family][zone]; found {
+			result = multierror.Append(result, &InvalidIPError{
+				IP:     ip.String(),
+				Reason: fmt.Sprintf("is in zone '%s' like '%s' -- only one ip per zone is used", zone, other),
+			})
+			continue
+		}
+		zones[family][zone] = ip.String()
+
+		err := a.validateOwnerOfIP(ctx, snapshot, ip)
+		if err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+
+	if result != nil {
+		log.Info("specified ips are invalid",
+			"namespace", request.Namespace,
+			"ips", ips,
+			"error", result.Error(),
+		)
+	}
+	return result
+}
+
+// validateOwnerOfIP -- checks that the IP is unused or a secondary IP of an egress node of the cluster, stopped nodes
+// included.
+func (a *AwsCloudProvider) validateOwnerOfIP(ctx context.Context, snapshot *inventorySnapshot, ip *net.IP) error {
+	networkInterfaces, err := a.loadNetworkInterfacesFromAws(ctx, a.networkInterfaceOfIPFilter(ip))
+	if err != nil {
+		return err
+	}
+
+	for _, networkInterface := range networkInterfaces {
+		id := aws.StringValue(networkInterface.NetworkInterfaceId)
+
+		if isPrimaryInterfaceAddress(networkInterface, *ip) {
+			return &InvalidIPError{IP: ip.String(), Reason: fmt.Sprintf("is the primary address of network interface '%s'", id)}
+		}
+
+		if networkInterface.Attachment == nil {
+			return &InvalidIPError{IP: ip.String(), Reason: fmt.Sprintf("is used by the detached network interface '%s'", id)}
+		}
+
+		egressNode, err := a.isEgressNodeOfCluster(ctx, snapshot, aws.StringValue(networkInterface.Attachment.InstanceId))
+		if err != nil {
+			return err
+		}
+		if !egressNode {
+			return &InvalidIPError{
+				IP:     ip.String(),
+				Reason: fmt.Sprintf("is used by network interface '%s' outside the egress nodes of the cluster", id),
+			}
+		}
+	}
+
+	return nil
+}
+
+// egressSubnetOfIP -- returns the egress subnet of the inventory containing the IP and the matching CIDR.
+func egressSubnetOfIP(snapshot *inventorySnapshot, ip *net.IP) (*ec2.Subnet, *net.IPNet) {
+	family := FamilyOf(*ip)
+
+	for _, subnet := range snapshot.subnetList {
+		for _, cidrBlock := range subnetCidrs(subnet, family) {
+			_, cidr, err := net.ParseCIDR(cidrBlock)
+			if err == nil && cidr.Contains(*ip) {
+				return subnet, cidr
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// isReservedAddress -- checks if the IP is one of the addresses AWS reserves in the CIDR.
+func isReservedAddress(cidr *net.IPNet, ip net.IP) bool {
+	network := cidr.IP
+	if v4 := ip.To4(); v4 != nil && len(network) == net.IPv4len {
+		ip = v4
+	} else {
+		ip = ip.To16()
+		network = network.To16()
+	}
+
+	offset := new(big.Int).Sub(new(big.Int).SetBytes(ip), new(big.Int).SetBytes(network))
+
+	ones, bits := cidr.Mask.Size()
+	last := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), uint(bits-ones)), big.NewInt(1))
+
+	return offset.Cmp(big.NewInt(awsReservedAddressesAtStart)) < 0 || offset.Cmp(last) == 0
+}
+
+// isPrimaryInterfaceAddress -- checks if the IP is the primary private IPv4 address of the network interface.
+func isPrimaryInterfaceAddress(networkInterface *ec2.NetworkInterface, ip net.IP) bool {
+	for _, address := range networkInterface.PrivateIpAddresses {
+		if aws.BoolValue(address.Primary) && ip.Equal(net.ParseIP(aws.StringValue(address.PrivateIpAddress))) {
+			return true
+		}
+	}
+
+	return ip.Equal(net.ParseIP(aws.StringValue(networkInterface.PrivateIpAddress)))
+}
@@ -0,0 +1,111 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"net"
+)
+
+// MoveIP moves the IP to a network interface of another egress node in its subnet chosen by the placement strategy.
+// IPv4 addresses are moved in a single step (AssignPrivateIpAddresses with AllowReassignment), so the IP is never
+// unassigned and an associated Elastic IP moves with it. AWS can't reassign IPv6 addresses, they are unassigned and
+// assigned again (and put back if the assignment fails). An IP not assigned at all is just assigned. The IP may be
+// taken from any egress node of the cluster, stopped ones included. Returns the id of the instance now carrying the IP.
+func (a *AwsCloudProvider) MoveIP(ctx context.Context, request IPRequest, ip *net.IP) (string, error) {
+	if err := a.checkInitialized(); err != nil {
+		return "", err
+	}
+
+	subnet, err := a.findSubnetForIP(ctx, ip)
+	if err != nil {
+		log.Error(err, "no matching subnet found",
+			"ip", ip,
+		)
+		return "", fmt.Errorf("can not find a matching subnet for ip '%s'", ip.String())
+	}
+
+	current, err := a.findNetworkInterfaceForIP(ctx, ip)
+	if err != nil && !IsNotFound(err) {
+		return "", err
+	}
+	if current == nil {
+		log.Info("ip is not assigned - assigning it", "ip", ip)
+		return a.addSpecifiedIP(ctx, request, ip)
+	}
+
+	currentInstance := aws.StringValue(current.Attachment.InstanceId)
+	egressNode, err := a.isEgressNodeOfCluster(ctx, a.inventory.current(), currentInstance)
+	if err != nil {
+		return "", err
+	}
+	if !egressNode {
+		// reassigning would take the IP away from its owner.
+		return "", &InvalidIPError{
+			IP: ip.String(),
+			Reason: fmt.Sprintf("is used by network interface '%s' outside the egress nodes of the cluster",
+				aws.StringValue(current.NetworkInterfaceId)),
+		}
+	}
+
+	family := FamilyOf(*ip)
+
+	if family == IPv6 {
+		_, err = a.unAssignIPFromNetworkInterface(ctx, current, ip)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	instanceID, err := a.assignToInterfaceInSubnet(ctx, request, *subnet.SubnetId, family, func(interfaceID string) error {
+		if family == IPv6 {
+			return a.addSpecifiedIPToInterface(ctx, interfaceID, *ip)
+		}
+		return a.reassignIPToInterface(ctx, interfaceID, *ip)
+	}, currentInstance)
+	if err != nil {
+		if family == IPv6 {
+			a.restoreIPv6(ctx, current, ip)
+		}
+		return "", err
+	}
+
+	log.Info("moved ip",
+		"ip", ip,
+		"from-instance", currentInstance,
+		"to-instance", instanceID,
+	)
+	return instanceID, nil
+}
+
+// reassignIPToInterface -- assigns the private IPv4 address to the interface, taking it away from the interface
+// carrying it.
+func (a *AwsCloudProvider) reassignIPToInterface(ctx context.Context, interfaceID string, ip net.IP) error {
+	_, err := a.Aws.AssignPrivateIPAddresses(ctx, &ec2.AssignPrivateIpAddressesInput{
+		NetworkInterfaceId: aws.String(interfaceID),
+		PrivateIpAddresses: aws.StringSlice([]string{ip.String()}),
+		AllowReassignment:  aws.Bool(true),
+	})
+	if err != nil {
+		return err
+	}
+	a.inventory.assignIP(interfaceID, ip)
+
+	log.Info("Reassigned IP to eni",
+		"eni", interfaceID,
+		"ip-address", ip.String())
+
+	return nil
+}
+
+// restoreIPv6 -- puts the unassigned IPv6 address back on the interface it has been taken from.
+func (a *AwsCloudProvider) restoreIPv6(ctx context.Context, networkInterface *ec2.NetworkInterface, ip *net.IP) {
+	err := a.addSpecifiedIPToInterface(ctx, aws.StringValue(networkInterface.NetworkInterfaceId), *ip)
+	if err != nil {
+		log.Error(err, "could not put the ip back on the network interface - it is unassigned now",
+			"ip", ip,
+			"eni", aws.StringValue(networkInterface.NetworkInterfaceId),
+		)
+	}
+}
@@ -17,6 +17,7 @@ type AwsNetwork struct {
 	arn                        string       // ID of the AWS Subnet
 	availabilityZone           string       // AWS availability zone this subnet is attached to
 	cidr                       *net.IPNet   // CIDR of the subnet
+	ipv6Cidrs                  []*net.IPNet // associated IPv6 CIDRs of the subnet
 	instancesInSubnet          *cache.Cache // Cache containing all instances with interfaces in this subnet
 	availableIPCount           int64        // Number of free IP addresses of this subnet
 	defaultForAvailabilityZone bool         // This is the default subnet for the availability zone
@@ -39,6 +40,14 @@ func CreateNetwork(provider *AwsCloudProvider, subnet *ec2.Subnet) (*AwsNetwork,
 		return nil, err
 	}
 
+	for _, cidrBlock := range subnetCidrs(subnet, IPv6) {
+		cidr, err := result.convertToIPNet(&cidrBlock)
+		if err != nil {
+			return nil, err
+		}
+		result.ipv6Cidrs = append(result.ipv6Cidrs, cidr)
+	}
+
 	result.instancesInSubnet = cache.New(time.Minute, 5*time.Minute)
 
 	return result, nil
@@ -54,8 +63,17 @@ func (n *AwsNetwork) convertToIPNet(cidr *string) (*net.IPNet, error) {
 	return result, nil
 }
 
-// IsIPInNetwork checks if the given IP is from the network.
+// IsIPInNetwork checks if the given IP is from the network. IPv6 addresses are checked against the IPv6 CIDRs.
 func (n *AwsNetwork) IsIPInNetwork(ip *net.IP) bool {
+	if FamilyOf(*ip) == IPv6 {
+		for _, cidr := range n.ipv6Cidrs {
+			if cidr.Contains(*ip) {
+				return true
+			}
+		}
+		return false
+	}
+
 	return n.cidr.Contains(*ip)
 }
 
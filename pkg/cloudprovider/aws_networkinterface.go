@@ -0,0 +1,85 @@
+package cloudprovider
+
+import (
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"net"
+)
+
+var _ CloudNetworkInterface = &AwsNetworkInterface{}
+
+// AwsNetworkInterface is an ENI attached to an AwsInstance.
+type AwsNetworkInterface struct {
+	data     *ec2.InstanceNetworkInterface
+	capacity int
+}
+
+// ID returns the id of the ENI
+func (n *AwsNetworkInterface) ID() string {
+	return *n.data.NetworkInterfaceId
+}
+
+// Network returns the id of the subnet the ENI is attached to
+func (n *AwsNetworkInterface) Network() string {
+	if n.data.SubnetId == nil {
+		return ""
+	}
+
+	return *n.data.SubnetId
+}
+
+// DeviceIndex returns the device index of the ENI on its instance
+func (n *AwsNetworkInterface) DeviceIndex() int {
+	if n.data.Attachment == nil || n.data.Attachment.DeviceIndex == nil {
+		return 0
+	}
+
+	return int(*n.data.Attachment.DeviceIndex)
+}
+
+// PrimaryIP returns the primary private IP of the ENI
+func (n *AwsNetworkInterface) PrimaryIP() *net.IP {
+	if n.data.PrivateIpAddress == nil {
+		return nil
+	}
+
+	result := net.ParseIP(*n.data.PrivateIpAddress)
+	return &result
+}
+
+// SecondaryIps returns the secondary private IPv4 and all IPv6 addresses of the ENI
+func (n *AwsNetworkInterface) SecondaryIps() []*net.IP {
+	result := make([]*net.IP, 0)
+	for i, ip := range n.data.PrivateIpAddresses {
+		if isPrimaryAddress(i, ip) {
+			continue
+		}
+
+		netIP := net.ParseIP(*ip.PrivateIpAddress)
+		result = append(result, &netIP)
+	}
+	for _, ip := range n.data.Ipv6Addresses {
+		netIP := net.ParseIP(*ip.Ipv6Address)
+		result = append(result, &netIP)
+	}
+	return result
+}
+
+// IPCount returns the number of private IPv4 addresses assigned to the ENI
+func (n *AwsNetworkInterface) IPCount() int {
+	return len(n.data.PrivateIpAddresses)
+}
+
+// IPCapacity returns the number of private IPv4 addresses the ENI can carry by its instance type. 0 if unknown.
+func (n *AwsNetworkInterface) IPCapacity() int {
+	return n.capacity
+}
+
+// isPrimaryAddress checks the primary flag of the address. AWS lists the primary address first, so the index is used
+// when the flag is missing.
+func isPrimaryAddress(index int, ip *ec2.InstancePrivateIpAddress) bool {
+	if ip.Primary != nil {
+		return *ip.Primary
+	}
+
+	return index == 0
+}
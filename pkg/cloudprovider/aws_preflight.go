@@ -0,0 +1,199 @@
+package cloudprovider
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+var _ PreflightChecker = &AwsCloudProvider{}
+
+// Resource ids used for the dry runs. AWS checks the permissions of a dry run before the resources, so they don't
+// need to exist.
+const (
+	preflightAllocationID  = "eipalloc-00000000000000000"
+	preflightAssociationID = "eipassoc-00000000000000000"
+	preflightInterfaceID   = "eni-00000000000000000"
+)
+
+// Preflight checks the configuration of the provider, that region, cluster and subnets can be found in AWS and that
+// the operator is allowed to run the EC2 actions it needs. The actions are called with DryRun, so nothing is changed.
+func (a *AwsCloudProvider) Preflight(ctx context.Context) PreflightReport {
+	report := PreflightReport{}
+
+	if err := a.checkInitialized(); err != nil {
+		report.add("configuration", PreflightFailed, "%v", err)
+		return report
+	}
+	report.add("configuration", PreflightPassed, "cluster '%s' in region '%s'", a.ClusterName, a.Region)
+
+	a.preflightDiscovery(ctx, &report)
+	a.preflightPermissions(ctx, &report)
+
+	return report
+}
+
+// preflightDiscovery -- checks that the region is reachable and the tagged subnets and instances of the cluster exist.
+func (a *AwsCloudProvider) preflightDiscovery(ctx context.Context, report *PreflightReport) {
+	key, _ := a.ClusterTag()
+
+	subnets, err := a.describeSubnets(ctx)
+	if err != nil {
+		report.add("region", PreflightFailed, "can't read the subnets in region '%s': %v", a.Region, err)
+		report.add("subnets", PreflightUnverified, "the region could not be checked")
+	} else {
+		report.add("region", PreflightPassed, "EC2 is reachable in region '%s'", a.Region)
+
+		selected := 0
+		for _, subnet := range subnets {
+			if a.isEgressSubnet(subnet) {
+				selected++
+			}
+		}
+
+		switch {
+		case len(subnets) == 0:
+			report.add("subnets", PreflightFailed, "no subnet is tagged with '%s' in region '%s'", key, a.Region)
+		case selected == 0:
+			report.add("subnets", PreflightFailed, "none of the %d subnets of the cluster matches the subnet selector '%s'",
+				len(subnets), a.SubnetSelector.String())
+		default:
+			report.add("subnets", PreflightPassed, "%d of %d subnets of the cluster are used for egress IPs",
+				selected, len(subnets))
+		}
+	}
+
+	instances, err := a.describeInstances(ctx, a.allInstancesFilter())
+	if err != nil {
+		report.add("cluster", PreflightFailed, "can't read the instances of the cluster: %v", err)
+		return
+	}
+
+	egressNodes := 0
+	for _, instance := range instances {
+		if a.isEgressNode(instance) {
+			egressNodes++
+		}
+	}
+
+	switch {
+	case len(instances) == 0:
+		report.add("cluster", PreflightFailed, "no running instance is tagged with '%s' -- check the cluster name", key)
+	case egressNodes == 0:
+		report.add("cluster", PreflightFailed, "none of the %d instances of the cluster matches the node selector '%s'",
+			len(instances), a.NodeSelector.String())
+	default:
+		report.add("cluster", PreflightPassed, "%d of %d instances of the cluster are egress nodes",
+			egressNodes, len(instances))
+	}
+}
+
+// preflightPermissions -- calls every EC2 action the operator needs with DryRun.
+func (a *AwsCloudProvider) preflightPermissions(ctx context.Context, report *PreflightReport) {
+	key, value := a.ClusterTag()
+	filter := a.allInstancesFilter()
+
+	dryRun := func(action string, call func() error) {
+		status, message := dryRunResult(action, call())
+		report.add("ec2:"+action, status, "%s", message)
+	}
+
+	dryRun("DescribeInstances", func() error {
+		_, err := a.Aws.DescribeInstances(ctx, &ec2.DescribeInstancesInput{DryRun: aws.Bool(true), Filters: filter.Filters})
+		return err
+	})
+	dryRun("DescribeInstanceTypes", func() error {
+		_, err := a.Aws.DescribeInstanceTypes(ctx, &ec2.DescribeInstanceTypesInput{DryRun: aws.Bool(true)})
+		return err
+	})
+	dryRun("DescribeSubnets", func() error {
+		_, err := a.Aws.DescribeSubnets(ctx, &ec2.DescribeSubnetsInput{DryRun: aws.Bool(true)})
+		return err
+	})
+	dryRun("DescribeNetworkInterfaces", func() error {
+		_, err := a.Aws.DescribeNetworkInterfaces(ctx, &ec2.DescribeNetworkInterfacesInput{DryRun: aws.Bool(true)})
+		return err
+	})
+	dryRun("DescribeAddresses", func() error {
+		_, err := a.Aws.DescribeAddresses(ctx, &ec2.DescribeAddressesInput{DryRun: aws.Bool(true)})
+		return err
+	})
+
+	if a.hasElasticIPPool() {
+		report.add("ec2:AllocateAddress", PreflightUnverified, "not needed -- Elastic IPs are taken from the pool")
+	} else {
+		dryRun("AllocateAddress", func() error {
+			_, err := a.Aws.AllocateAddress(ctx, &ec2.AllocateAddressInput{
+				DryRun: aws.Bool(true),
+				Domain: aws.String(ec2.DomainTypeVpc),
+			})
+			return err
+		})
+	}
+	dryRun("ReleaseAddress", func() error {
+		_, err := a.Aws.ReleaseAddress(ctx, &ec2.ReleaseAddressInput{
+			DryRun:       aws.Bool(true),
+			AllocationId: aws.String(preflightAllocationID),
+		})
+		return err
+	})
+	dryRun("AssociateAddress", func() error {
+		_, err := a.Aws.AssociateAddress(ctx, &ec2.AssociateAddressInput{
+			DryRun:             aws.Bool(true),
+			AllocationId:       aws.String(preflightAllocationID),
+			NetworkInterfaceId: aws.String(preflightInterfaceID),
+		})
+		return err
+	})
+	dryRun("DisassociateAddress", func() error {
+		_, err := a.Aws.DisassociateAddress(ctx, &ec2.DisassociateAddressInput{
+			DryRun:        aws.Bool(true),
+			AssociationId: aws.String(preflightAssociationID),
+		})
+		return err
+	})
+	dryRun("CreateTags", func() error {
+		_, err := a.Aws.CreateTags(ctx, &ec2.CreateTagsInput{
+			DryRun:    aws.Bool(true),
+			Resources: aws.StringSlice([]string{preflightAllocationID}),
+			Tags:      []*ec2.Tag{{Key: aws.String(key), Value: aws.String(value)}},
+		})
+		return err
+	})
+
+	// EC2 offers no dry run for these actions. Missing permissions show up with the first egress IP.
+	for _, action := range []string{
+		"AssignPrivateIpAddresses", "UnassignPrivateIpAddresses", "AssignIpv6Addresses", "UnassignIpv6Addresses",
+	} {
+		report.add("ec2:"+action, PreflightUnverified, "EC2 offers no dry run for this action")
+	}
+}
+
+// dryRunResult -- evaluates the answer to a dry run. AWS answers a permitted dry run with the error DryRunOperation.
+// Missing permissions and unavailable AWS fail the check, other errors (e.g. a rejected resource id) leave it
+// unverified. Errors not classified by the client yet are classified here.
+func dryRunResult(action string, err error) (PreflightStatus, string) {
+	if err == nil {
+		return PreflightPassed, "permitted"
+	}
+
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == "DryRunOperation" {
+		return PreflightPassed, "permitted"
+	}
+
+	err = classifyAwsError(action, err)
+	if IsPermissionDenied(err) {
+		return PreflightFailed, "not permitted: " + err.Error()
+	}
+
+	answered := findError(err, func(err error) bool {
+		_, ok := err.(awserr.Error)
+		return ok
+	})
+	if !answered || IsRetryable(err) {
+		return PreflightFailed, "could not be checked: " + err.Error()
+	}
+
+	return PreflightUnverified, "could not be checked: " + err.Error()
+}
@@ -0,0 +1,135 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"net"
+)
+
+// InstanceGone checks AWS (not the inventory) for the instance of the host. An instance that is shutting down, has been
+// terminated or is not known anymore is gone, AWS frees its secondary IPs on its own. A gone instance is evicted from
+// the inventory, so no IPs are placed on it.
+func (a *AwsCloudProvider) InstanceGone(ctx context.Context, hostname string) (bool, error) {
+	if err := a.checkInitialized(); err != nil {
+		return false, err
+	}
+
+	instances, err := a.describeInstances(ctx, ec2.DescribeInstancesInput{
+		Filters: a.createEc2Filter("private-dns-name", []string{hostname}),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	ids := make([]string, 0, len(instances))
+	for _, instance := range instances {
+		if !isTerminated(instance) {
+			return false, nil
+		}
+		ids = append(ids, aws.StringValue(instance.InstanceId))
+	}
+
+	if snapshot := a.inventory.current(); snapshot.instancesByHostname[hostname] != "" {
+		ids = append(ids, snapshot.instancesByHostname[hostname])
+	}
+	a.inventory.evict(ids...)
+
+	log.Info("instance of host is gone",
+		"hostname", hostname,
+		"instance-ids", ids,
+	)
+	return true, nil
+}
+
+// isTerminated -- checks if the instance is shutting down or has been terminated.
+func isTerminated(instance *ec2.Instance) bool {
+	if instance.State == nil {
+		return false
+	}
+
+	state := aws.StringValue(instance.State.Name)
+	return state == ec2.InstanceStateNameShuttingDown || state == ec2.InstanceStateNameTerminated
+}
+
+// ReclaimIP assigns the IP freed by a gone instance to the network interface of an egress node in its subnet chosen by
+// the placement strategy. If the IP has been taken by a network interface outside the egress nodes in the meantime, a
+// new IP of the same subnet is assigned instead. An IP already carried by an egress node stays there. Returns the
+// instance and the IP assigned.
+func (a *AwsCloudProvider) ReclaimIP(ctx context.Context, request IPRequest, ip *net.IP) (string, *net.IP, error) {
+	if err := a.checkInitialized(); err != nil {
+		return "", nil, err
+	}
+
+	snapshot, err := a.freshInventory(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+
+	subnet, _ := egressSubnetOfIP(snapshot, ip)
+	if subnet == nil {
+		return "", nil, &InvalidIPError{IP: ip.String(), Reason: "is in no egress subnet of the cluster"}
+	}
+	subnetID := aws.StringValue(subnet.SubnetId)
+	family := FamilyOf(*ip)
+
+	err = a.validateOwnerOfIP(ctx, snapshot, ip)
+	if err == nil {
+		var instanceID string
+		instanceID, err = a.reassignFreedIP(ctx, request, subnetID, ip)
+		if err == nil {
+			return instanceID, ip, nil
+		}
+		if !IsConflict(err) {
+			return "", nil, err
+		}
+	} else if !IsInvalidIP(err) {
+		return "", nil, err
+	}
+
+	log.Info("ip has been taken in the meantime - assigning a new ip of the subnet",
+		"ip", ip,
+		"subnet-id", subnetID,
+		"cause", err.Error(),
+	)
+
+	var replacement *net.IP
+	instanceID, err := a.assignToInterfaceInSubnet(ctx, request, subnetID, family, func(interfaceID string) error {
+		var err error
+		replacement, err = a.addRandomIPToInterface(ctx, interfaceID, family)
+		return err
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	log.Info(fmt.Sprintf("replaced ip '%s' by '%s' on instance '%s'", ip.String(), replacement.String(), instanceID))
+	return instanceID, replacement, nil
+}
+
+// reassignFreedIP -- assigns the unused IP to the network interface of an egress node in the subnet. An IP already
+// carried by an egress node is kept there. AWS reports an IP taken in the meantime as conflict.
+func (a *AwsCloudProvider) reassignFreedIP(ctx context.Context, request IPRequest, subnetID string, ip *net.IP) (string, error) {
+	current, err := a.findNetworkInterfaceForIP(ctx, ip)
+	if err == nil {
+		log.Info("ip is already carried by an egress node",
+			"ip", ip,
+			"eni", aws.StringValue(current.NetworkInterfaceId),
+		)
+		return aws.StringValue(current.Attachment.InstanceId), nil
+	}
+	if !IsNotFound(err) {
+		return "", err
+	}
+
+	instanceID, err := a.assignToInterfaceInSubnet(ctx, request, subnetID, FamilyOf(*ip), func(interfaceID string) error {
+		return a.addSpecifiedIPToInterface(ctx, interfaceID, *ip)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	log.Info(fmt.Sprintf("reclaimed ip '%s' on instance '%s'", ip.String(), instanceID))
+	return instanceID, nil
+}
@@ -0,0 +1,429 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/prometheus/client_golang/prometheus"
+	"math/rand"
+	"net/http"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The error codes of EC2 reporting throttling or a temporary failure of AWS.
+var retryableAwsErrorCodes = map[string]bool{
+	"RequestLimitExceeded": true,
+	"Throttling":           true,
+	"ThrottlingException":  true,
+	"InternalError":        true,
+	"InternalFailure":      true,
+	"ServiceUnavailable":   true,
+	"Unavailable":          true,
+}
+
+var (
+	awsClientMetrics    sync.Once
+	awsCircuitState     prometheus.Gauge
+	awsRetries          *prometheus.CounterVec
+	awsRateLimitedCalls prometheus.Counter
+)
+
+// ResilienceOptions configures the retries, the rate limiter and the circuit breaker of the ResilientAwsClient.
+type ResilienceOptions struct {
+	MaxRetries int           // retries of a throttled or failed call -- 0 disables retries
+	BaseDelay  time.Duration // upper limit of the first backoff, doubled with every retry
+	MaxDelay   time.Duration // upper limit of a single backoff
+	Timeout    time.Duration // upper limit of a single call -- 0 disables the timeout
+
+	RateLimit float64 // calls per second shared by all controllers
+	Burst     int     // calls allowed in a burst
+
+	FailureThreshold int           // consecutive failed calls opening the circuit breaker
+	OpenDuration     time.Duration // time the circuit breaker rejects calls before a trial call is let through
+}
+
+// DefaultResilienceOptions returns the defaults of the ResilientAwsClient.
+func DefaultResilienceOptions() ResilienceOptions {
+	return ResilienceOptions{
+		MaxRetries:       5,
+		BaseDelay:        200 * time.Millisecond,
+		MaxDelay:         20 * time.Second,
+		Timeout:          30 * time.Second,
+		RateLimit:        5,
+		Burst:            10,
+		FailureThreshold: 5,
+		OpenDuration:     30 * time.Second,
+	}
+}
+
+var _ AwsClient = &ResilientAwsClient{}
+
+// ResilientAwsClient decorates an AwsClient. Throttled calls and temporary failures (5xx) are retried with exponential
+// backoff and full jitter. All calls pass a token bucket rate limiter. A circuit breaker rejects calls while AWS fails
+// persistently. Client errors (e.g. invalid parameters) are returned directly. Errors are classified (see
+// ClassifiedError) where possible.
+type ResilientAwsClient struct {
+	client  AwsClient
+	options ResilienceOptions
+
+	limiter *tokenBucket
+	breaker *circuitBreaker
+}
+
+// NewResilientAwsClient wraps the client.
+func NewResilientAwsClient(client AwsClient, options ResilienceOptions) *ResilientAwsClient {
+	awsClientMetrics.Do(registerAwsClientMetrics)
+	awsCircuitState.Set(float64(CircuitClosed))
+
+	return &ResilientAwsClient{
+		client:  client,
+		options: options,
+		limiter: newTokenBucket(options.RateLimit, options.Burst),
+		breaker: newCircuitBreaker(options.FailureThreshold, options.OpenDuration, func(state CircuitState) {
+			awsCircuitState.Set(float64(state))
+			log.Info("aws circuit breaker changed state", "state", state.String())
+		}),
+	}
+}
+
+// resilienceOptionsFromEnvironment -- reads the options from AWS_API_MAX_RETRIES, AWS_API_RATE_LIMIT, AWS_API_BURST
+// and AWS_API_TIMEOUT.
+func resilienceOptionsFromEnvironment() (ResilienceOptions, error) {
+	result := DefaultResilienceOptions()
+
+	value, err := readEnvironment("AWS_API_MAX_RETRIES", strconv.Itoa(result.MaxRetries))
+	if err == nil {
+		result.MaxRetries, err = strconv.Atoi(value)
+	}
+	if err != nil || result.MaxRetries < 0 {
+		return result, fmt.Errorf("AWS_API_MAX_RETRIES '%s' is no valid number", value)
+	}
+
+	value, err = readEnvironment("AWS_API_RATE_LIMIT", strconv.FormatFloat(result.RateLimit, 'f', -1, 64))
+	if err == nil {
+		result.RateLimit, err = strconv.ParseFloat(value, 64)
+	}
+	if err != nil || result.RateLimit <= 0 {
+		return result, fmt.Errorf("AWS_API_RATE_LIMIT '%s' is no valid positive number", value)
+	}
+
+	value, err = readEnvironment("AWS_API_BURST", strconv.Itoa(result.Burst))
+	if err == nil {
+		result.Burst, err = strconv.Atoi(value)
+	}
+	if err != nil || result.Burst < 1 {
+		return result, fmt.Errorf("AWS_API_BURST '%s' is no valid positive number", value)
+	}
+
+	value, err = readEnvironment("AWS_API_TIMEOUT", result.Timeout.String())
+	if err == nil {
+		result.Timeout, err = time.ParseDuration(value)
+	}
+	if err != nil || result.Timeout < 0 {
+		return result, fmt.Errorf("AWS_API_TIMEOUT '%s' is no valid duration", value)
+	}
+
+	return result, nil
+}
+
+func registerAwsClientMetrics() {
+	awsCircuitState = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "egressip",
+			Name:      "aws_circuit_breaker_state",
+			Help:      "State of the circuit breaker of the AWS api (0 closed, 1 half-open, 2 open)",
+		},
+	)
+	awsRetries = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "egressip",
+			Name:      "aws_api_retries_total",
+			Help:      "Retries of throttled or failed AWS api calls",
+		},
+		[]string{"operation"},
+	)
+	awsRateLimitedCalls = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "egressip",
+			Name:      "aws_api_calls_total",
+			Help:      "AWS api calls passing the client side rate limiter",
+		},
+	)
+
+	for _, collector := range []prometheus.Collector{awsCircuitState, awsRetries, awsRateLimitedCalls} {
+		err := metrics.Registry.Register(collector)
+		if err != nil {
+			log.Error(err, "Can't register the aws client metric")
+		}
+	}
+}
+
+// CircuitState returns the state of the circuit breaker.
+func (r *ResilientAwsClient) CircuitState() CircuitState {
+	return r.breaker.current()
+}
+
+// HealthCheck reports an error while the circuit breaker is open. It is a healthz.Checker.
+func (r *ResilientAwsClient) HealthCheck(_ *http.Request) error {
+	if state := r.breaker.current(); state != CircuitClosed {
+		return fmt.Errorf("aws circuit breaker is %s", state)
+	}
+
+	return nil
+}
+
+// call -- runs the call with rate limiting, retries and the circuit breaker. Every attempt is limited by the timeout
+// of the options. When the context of the caller is done, waiting and retrying stop and the error of the context is
+// returned.
+func (r *ResilientAwsClient) call(ctx context.Context, operation string, call func(ctx context.Context) error) error {
+	var err error
+
+	for attempt := 0; ; attempt++ {
+		if rejected := r.breaker.allow(); rejected != nil {
+			return rejected
+		}
+
+		if err := r.limiter.wait(ctx); err != nil {
+			r.breaker.release()
+			return err
+		}
+		awsRateLimitedCalls.Inc()
+
+		var timedOut bool
+		timedOut, err = r.attempt(ctx, call)
+		if err != nil && ctx.Err() != nil {
+			// the caller gave up -- this tells nothing about the health of AWS
+			r.breaker.release()
+			return ctx.Err()
+		}
+
+		retryable := timedOut || isRetryableAwsError(err)
+		r.breaker.record(!retryable)
+
+		if !retryable || attempt >= r.options.MaxRetries {
+			if timedOut {
+				return &UnavailableError{Operation: operation, Err: err}
+			}
+			return classifyAwsError(operation, err)
+		}
+
+		delay := r.backoff(attempt)
+		awsRetries.WithLabelValues(operation).Inc()
+		log.Info("aws api call failed temporarily - retrying",
+			"operation", operation,
+			"attempt", attempt+1,
+			"delay", delay,
+			"error", err.Error(),
+		)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// attempt -- runs a single call limited by the timeout of the options. Reports if the call hit the timeout.
+func (r *ResilientAwsClient) attempt(ctx context.Context, call func(ctx context.Context) error) (bool, error) {
+	if r.options.Timeout <= 0 {
+		return false, call(ctx)
+	}
+
+	attemptCtx, cancel := context.WithTimeout(ctx, r.options.Timeout)
+	defer cancel()
+
+	err := call(attemptCtx)
+	return err != nil && attemptCtx.Err() == context.DeadlineExceeded, err
+}
+
+// backoff -- exponential backoff with full jitter: a random delay up to BaseDelay * 2^attempt, at most MaxDelay.
+func (r *ResilientAwsClient) backoff(attempt int) time.Duration {
+	limit := r.options.BaseDelay << uint(attempt)
+	if limit > r.options.MaxDelay || limit <= 0 {
+		limit = r.options.MaxDelay
+	}
+	if limit <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(limit)))
+}
+
+// isRetryableAwsError -- checks if the error reports throttling or a temporary failure of AWS.
+func isRetryableAwsError(err error) bool {
+	if isServerError(err) {
+		return true
+	}
+
+	if awsErr, ok := err.(awserr.Error); ok {
+		return retryableAwsErrorCodes[awsErr.Code()]
+	}
+
+	return false
+}
+
+// GetRegion -- returns the region of the wrapped client.
+func (r *ResilientAwsClient) GetRegion() string {
+	return r.client.GetRegion()
+}
+
+// AssignPrivateIPAddresses -- Assigns IP addresses to an instance.
+func (r *ResilientAwsClient) AssignPrivateIPAddresses(ctx context.Context, request *ec2.AssignPrivateIpAddressesInput) (*ec2.AssignPrivateIpAddressesOutput, error) {
+	var result *ec2.AssignPrivateIpAddressesOutput
+	err := r.call(ctx, "AssignPrivateIPAddresses", func(ctx context.Context) error {
+		var err error
+		result, err = r.client.AssignPrivateIPAddresses(ctx, request)
+		return err
+	})
+	return result, err
+}
+
+// UnassignPrivateIPAddresses -- Removes the IP addresses from an instance.
+func (r *ResilientAwsClient) UnassignPrivateIPAddresses(ctx context.Context, request *ec2.UnassignPrivateIpAddressesInput) (*ec2.UnassignPrivateIpAddressesOutput, error) {
+	var result *ec2.UnassignPrivateIpAddressesOutput
+	err := r.call(ctx, "UnassignPrivateIPAddresses", func(ctx context.Context) error {
+		var err error
+		result, err = r.client.UnassignPrivateIPAddresses(ctx, request)
+		return err
+	})
+	return result, err
+}
+
+// AssignIPv6Addresses -- Assigns IPv6 addresses to a network interface.
+func (r *ResilientAwsClient) AssignIPv6Addresses(ctx context.Context, request *ec2.AssignIpv6AddressesInput) (*ec2.AssignIpv6AddressesOutput, error) {
+	var result *ec2.AssignIpv6AddressesOutput
+	err := r.call(ctx, "AssignIPv6Addresses", func(ctx context.Context) error {
+		var err error
+		result, err = r.client.AssignIPv6Addresses(ctx, request)
+		return err
+	})
+	return result, err
+}
+
+// UnassignIPv6Addresses -- Removes the IPv6 addresses from a network interface.
+func (r *ResilientAwsClient) UnassignIPv6Addresses(ctx context.Context, request *ec2.UnassignIpv6AddressesInput) (*ec2.UnassignIpv6AddressesOutput, error) {
+	var result *ec2.UnassignIpv6AddressesOutput
+	err := r.call(ctx, "UnassignIPv6Addresses", func(ctx context.Context) error {
+		var err error
+		result, err = r.client.UnassignIPv6Addresses(ctx, request)
+		return err
+	})
+	return result, err
+}
+
+// DescribeInstances -- Retrieves all information for a specific instance or all instances matching the request.
+func (r *ResilientAwsClient) DescribeInstances(ctx context.Context, request *ec2.DescribeInstancesInput) (*ec2.DescribeInstancesOutput, error) {
+	var result *ec2.DescribeInstancesOutput
+	err := r.call(ctx, "DescribeInstances", func(ctx context.Context) error {
+		var err error
+		result, err = r.client.DescribeInstances(ctx, request)
+		return err
+	})
+	return result, err
+}
+
+// DescribeNetworkInterfaces -- Retrieves all information for the network interface(s) matching the request.
+func (r *ResilientAwsClient) DescribeNetworkInterfaces(ctx context.Context, request *ec2.DescribeNetworkInterfacesInput) (*ec2.DescribeNetworkInterfacesOutput, error) {
+	var result *ec2.DescribeNetworkInterfacesOutput
+	err := r.call(ctx, "DescribeNetworkInterfaces", func(ctx context.Context) error {
+		var err error
+		result, err = r.client.DescribeNetworkInterfaces(ctx, request)
+		return err
+	})
+	return result, err
+}
+
+// DescribeSubnets -- Describes the subnet(s) matching the request.
+func (r *ResilientAwsClient) DescribeSubnets(ctx context.Context, request *ec2.DescribeSubnetsInput) (*ec2.DescribeSubnetsOutput, error) {
+	var result *ec2.DescribeSubnetsOutput
+	err := r.call(ctx, "DescribeSubnets", func(ctx context.Context) error {
+		var err error
+		result, err = r.client.DescribeSubnets(ctx, request)
+		return err
+	})
+	return result, err
+}
+
+// DescribeInstanceTypes -- Describes the instance type(s) matching the request (including their network limits).
+func (r *ResilientAwsClient) DescribeInstanceTypes(ctx context.Context, request *ec2.DescribeInstanceTypesInput) (*ec2.DescribeInstanceTypesOutput, error) {
+	var result *ec2.DescribeInstanceTypesOutput
+	err := r.call(ctx, "DescribeInstanceTypes", func(ctx context.Context) error {
+		var err error
+		result, err = r.client.DescribeInstanceTypes(ctx, request)
+		return err
+	})
+	return result, err
+}
+
+// AllocateAddress -- Allocates a new Elastic IP.
+func (r *ResilientAwsClient) AllocateAddress(ctx context.Context, request *ec2.AllocateAddressInput) (*ec2.AllocateAddressOutput, error) {
+	var result *ec2.AllocateAddressOutput
+	err := r.call(ctx, "AllocateAddress", func(ctx context.Context) error {
+		var err error
+		result, err = r.client.AllocateAddress(ctx, request)
+		return err
+	})
+	return result, err
+}
+
+// ReleaseAddress -- Releases an Elastic IP.
+func (r *ResilientAwsClient) ReleaseAddress(ctx context.Context, request *ec2.ReleaseAddressInput) (*ec2.ReleaseAddressOutput, error) {
+	var result *ec2.ReleaseAddressOutput
+	err := r.call(ctx, "ReleaseAddress", func(ctx context.Context) error {
+		var err error
+		result, err = r.client.ReleaseAddress(ctx, request)
+		return err
+	})
+	return result, err
+}
+
+// AssociateAddress -- Associates an Elastic IP with a private IP of a network interface.
+func (r *ResilientAwsClient) AssociateAddress(ctx context.Context, request *ec2.AssociateAddressInput) (*ec2.AssociateAddressOutput, error) {
+	var result *ec2.AssociateAddressOutput
+	err := r.call(ctx, "AssociateAddress", func(ctx context.Context) error {
+		var err error
+		result, err = r.client.AssociateAddress(ctx, request)
+		return err
+	})
+	return result, err
+}
+
+// DisassociateAddress -- Removes the association of an Elastic IP.
+func (r *ResilientAwsClient) DisassociateAddress(ctx context.Context, request *ec2.DisassociateAddressInput) (*ec2.DisassociateAddressOutput, error) {
+	var result *ec2.DisassociateAddressOutput
+	err := r.call(ctx, "DisassociateAddress", func(ctx context.Context) error {
+		var err error
+		result, err = r.client.DisassociateAddress(ctx, request)
+		return err
+	})
+	return result, err
+}
+
+// DescribeAddresses -- Describes the Elastic IP(s) matching the request.
+func (r *ResilientAwsClient) DescribeAddresses(ctx context.Context, request *ec2.DescribeAddressesInput) (*ec2.DescribeAddressesOutput, error) {
+	var result *ec2.DescribeAddressesOutput
+	err := r.call(ctx, "DescribeAddresses", func(ctx context.Context) error {
+		var err error
+		result, err = r.client.DescribeAddresses(ctx, request)
+		return err
+	})
+	return result, err
+}
+
+// CreateTags -- Adds or overwrites tags of AWS resources.
+func (r *ResilientAwsClient) CreateTags(ctx context.Context, request *ec2.CreateTagsInput) (*ec2.CreateTagsOutput, error) {
+	var result *ec2.CreateTagsOutput
+	err := r.call(ctx, "CreateTags", func(ctx context.Context) error {
+		var err error
+		result, err = r.client.CreateTags(ctx, request)
+		return err
+	})
+	return result, err
+}
@@ -1,37 +1,136 @@
 package cloudprovider
 
 import (
+	"context"
+	"fmt"
 	"net"
+	"net/http"
 	"os"
 )
 
 // CreateCloudProvider - Creates a matching cloud provider. The switch is done by reading the environment variable
-// CLOUD_PROVIDER with a default to AWS.
-func CreateCloudProvider() *CloudProvider {
-	provider, _ := os.LookupEnv("CLOUD_PROVIDER") // TODO rlichti 2020-06-03 document this switch
+// CLOUD_PROVIDER with a default to AWS. CLOUD_PROVIDER=MOCK selects the in-memory simulated cloud. With WARM_POOL_SIZE
+// set the provider is wrapped in a warm pool. An error is returned if the configuration of the provider is missing or
+// invalid.
+func CreateCloudProvider() (*CloudProvider, error) {
+	provider, _ := os.LookupEnv("CLOUD_PROVIDER")
 
+	var result CloudProvider
 	switch provider {
 	case "MOCK":
-		panic("No mock provider implemented!")
-	case "AWS":
+		mock, err := MockProvider()
+		if err != nil {
+			return nil, err
+		}
+		result = CloudProvider(mock)
 	default:
-		result := CloudProvider(AwsProvider())
-		return &result
+		config, err := AwsConfigFromEnvironment()
+		if err != nil {
+			return nil, fmt.Errorf("invalid AWS configuration: %v", err)
+		}
+
+		aws, err := NewAwsCloudProvider(config, nil)
+		if err != nil {
+			return nil, err
+		}
+		result = CloudProvider(aws)
 	}
 
-	panic("can't come to here, the default should be returned by switch case!")
+	result = WarmPoolFromEnvironment(result)
+	return &result, nil
 }
 
 // The CloudProvider interface hides the different cloud providers. Currently only AWS is implemented though.
+// All calls to the cloud are cancelled when the context is done.
 type CloudProvider interface {
 	ClusterTag() (string, string)
 
-	Instance(instanceID string) (*CloudInstance, error)
-	InstanceByHostName(hostname string) (*CloudInstance, error)
+	Instance(ctx context.Context, instanceID string) (*CloudInstance, error)
+	InstanceByHostName(ctx context.Context, hostname string) (*CloudInstance, error)
+
+	AddSpecifiedIPs(ctx context.Context, request IPRequest, ips []*net.IP) ([]string, error)
+	AddRandomIPs(ctx context.Context, request IPRequest) ([]string, []*net.IP, error)
+	RemoveIP(ctx context.Context, ip *net.IP) (string, error)
+	// MoveIP moves the IP to another instance chosen by the placement strategy without unassigning it first and returns
+	// the instance now carrying it.
+	MoveIP(ctx context.Context, request IPRequest, ip *net.IP) (string, error)
+
+	// InstanceGone checks if the instance of the host has been terminated or does not exist anymore. The cloud freed
+	// its IPs then.
+	InstanceGone(ctx context.Context, hostname string) (bool, error)
+	// ReclaimIP assigns the IP freed by a gone instance to another instance of its network. If the IP has been taken in
+	// the meantime, a new IP of the same network is assigned. Returns the instance and the assigned IP.
+	ReclaimIP(ctx context.Context, request IPRequest, ip *net.IP) (string, *net.IP, error)
+	// FailoverIP assigns a new IP of the same address family in another failure zone for an IP whose network has no
+	// egress node left. Returns the instance and the assigned IP.
+	FailoverIP(ctx context.Context, request IPRequest, ip *net.IP) (string, *net.IP, error)
+
+	// AssociatePublicIP associates a public IP with the assigned private IP and returns it. RemoveIP releases it.
+	AssociatePublicIP(ctx context.Context, request IPRequest, ip *net.IP) (*net.IP, error)
+}
+
+// HealthChecker is implemented by cloud providers (and clients) able to report their health. The signature matches
+// healthz.Checker of controller-runtime.
+type HealthChecker interface {
+	HealthCheck(req *http.Request) error
+}
+
+// IPValidator is implemented by cloud providers able to check specified IPs before they are assigned. Unusable IPs are
+// reported as InvalidIPError (combined in a multierror), failures of the cloud as other errors.
+type IPValidator interface {
+	ValidateSpecifiedIPs(ctx context.Context, request IPRequest, ips []*net.IP) error
+}
+
+// RecordingIPAssigner is implemented by cloud providers able to report every random IP right after it has been assigned
+// and before the next one is. If the recorder fails, the IP is returned as assigned together with the error and no
+// further IPs are assigned.
+type RecordingIPAssigner interface {
+	AddRandomIPsRecorded(ctx context.Context, request IPRequest, record IPRecorder) ([]string, []*net.IP, error)
+}
+
+// IPRecorder records the IP assigned to the instance.
+type IPRecorder func(instanceID string, ip *net.IP) error
+
+// InventorySyncer is implemented by cloud providers caching the state of the cloud. Resync replaces the cache with a
+// fresh read of the cloud.
+type InventorySyncer interface {
+	Resync(ctx context.Context) error
+}
+
+// EgressNodeLister is implemented by cloud providers able to list the instances egress IPs may be assigned to.
+type EgressNodeLister interface {
+	EgressNodes(ctx context.Context) ([]*CloudInstance, error)
+}
 
-	AddSpecifiedIPs(ips []*net.IP) ([]string, error)
-	AddRandomIPs() ([]string, []*net.IP, error)
-	RemoveIP(ip *net.IP) (string, error)
+// contextOfStop -- returns a context that is cancelled when the stop channel of a manager.Runnable is closed.
+func contextOfStop(stop <-chan struct{}) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// IPRequest describes what the IPs to add are requested for. The placement strategy may use it to decide where the
+// IPs are placed.
+type IPRequest struct {
+	Namespace string     // the namespace the IPs are requested for -- empty if the IPs belong to several namespaces
+	Families  []IPFamily // the address families of random IPs, one IP per family and network -- empty means IPv4
+	Zones     []string   // the failure zones of random IPs in preferred order -- empty means all zones
+	ZoneCount int        // the number of failure zones getting a random IP -- 0 means all (selected) zones
+}
+
+// IPFamilies returns the address families random IPs are requested for.
+func (r IPRequest) IPFamilies() []IPFamily {
+	if len(r.Families) == 0 {
+		return []IPFamily{IPv4}
+	}
+
+	return r.Families
 }
 
 // CloudInstance is a single computing instance in the cloud.
@@ -44,10 +143,24 @@ type CloudInstance interface {
 	FailureZone() string   // Failure zone this instance is located in
 
 	Tags() *map[string]string // The tags of this instance
-	NetworkInterface() string // The ids of the network interfaces of this instance
+	NetworkInterface() string // The id of the primary network interface of this instance
+
+	NetworkInterfaces() []CloudNetworkInterface // All network interfaces attached to this instance
 
 	PrimaryIP() *net.IP      // primary IP of this instance
-	SecondaryIps() []*net.IP // secondary IPs of this instance
+	SecondaryIps() []*net.IP // secondary IPv4 and all IPv6 addresses of all network interfaces of this instance
+}
+
+// CloudNetworkInterface is a single network interface attached to a CloudInstance.
+type CloudNetworkInterface interface {
+	ID() string       // Id of this network interface
+	Network() string  // Name of the network (subnet) this interface is attached to
+	DeviceIndex() int // Index of the interface on the instance -- 0 is the primary interface
+
+	PrimaryIP() *net.IP      // primary IP of this network interface
+	SecondaryIps() []*net.IP // secondary IPv4 and all IPv6 addresses of this network interface
+	IPCount() int            // number of IPv4 addresses (primary and secondary) assigned to this network interface
+	IPCapacity() int         // maximum number of IPv4 addresses this network interface can carry -- 0 if unknown
 }
 
 // CloudNetwork is a defined network within the cloud.
@@ -0,0 +1,284 @@
+package cloudprovider
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/hashicorp/go-multierror"
+	"strings"
+)
+
+// ClassifiedError is an error of the cloud provider knowing if repeating the operation later may succeed.
+type ClassifiedError interface {
+	error
+	Retryable() bool // repeating the operation later may succeed -- false for permanent errors
+}
+
+var (
+	_ ClassifiedError = &NotFoundError{}
+	_ ClassifiedError = &CapacityExhaustedError{}
+	_ ClassifiedError = &NoEgressNodeError{}
+	_ ClassifiedError = &ThrottledError{}
+	_ ClassifiedError = &UnavailableError{}
+	_ ClassifiedError = &PermissionDeniedError{}
+	_ ClassifiedError = &ConflictError{}
+	_ ClassifiedError = &InvalidIPError{}
+)
+
+// NotFoundError is returned when a resource (instance, network interface, IP, ...) does not exist (anymore).
+type NotFoundError struct {
+	Resource string // the kind of the missing resource (e.g. "network interface")
+	Key      string // what has been searched for (e.g. "ip '10.0.0.1'")
+	Err      error  // the error of the cloud -- nil if the resource was not found by the provider itself
+}
+
+func (e *NotFoundError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("found no %s for %s: %v", e.Resource, e.Key, e.Err)
+	}
+	return fmt.Sprintf("found no %s for %s", e.Resource, e.Key)
+}
+
+// Unwrap returns the error of the cloud.
+func (e *NotFoundError) Unwrap() error { return e.Err }
+
+// Retryable -- a missing resource won't appear by repeating the operation.
+func (e *NotFoundError) Retryable() bool { return false }
+
+// CapacityExhaustedError is returned when no network interface within a network can take another IP.
+type CapacityExhaustedError struct {
+	Network string // the network (subnet) without free capacity
+}
+
+func (e *CapacityExhaustedError) Error() string {
+	return fmt.Sprintf("capacity exhausted: no network interface in subnet '%s' can take another ip", e.Network)
+}
+
+// Retryable -- the capacity only grows by adding nodes or interfaces.
+func (e *CapacityExhaustedError) Retryable() bool { return false }
+
+// NoEgressNodeError is returned when no egress node is left within a network to take an IP (e.g. all nodes of the
+// availability zone are gone).
+type NoEgressNodeError struct {
+	Network string // the network (subnet) without egress nodes
+}
+
+func (e *NoEgressNodeError) Error() string {
+	return fmt.Sprintf("no egress node left in subnet '%s'", e.Network)
+}
+
+// Retryable -- the nodes have to be added or recover first.
+func (e *NoEgressNodeError) Retryable() bool { return false }
+
+// ThrottledError is returned when the cloud throttled the operation and the retries are used up.
+type ThrottledError struct {
+	Operation string
+	Err       error
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("%s has been throttled: %v", e.Operation, e.Err)
+}
+
+// Unwrap returns the error of the cloud.
+func (e *ThrottledError) Unwrap() error { return e.Err }
+
+// Retryable -- throttling ends.
+func (e *ThrottledError) Retryable() bool { return true }
+
+// UnavailableError is returned when the cloud failed temporarily (e.g. 5xx responses or an open circuit breaker).
+type UnavailableError struct {
+	Operation string
+	Err       error
+}
+
+func (e *UnavailableError) Error() string {
+	if e.Operation == "" {
+		return fmt.Sprintf("cloud api unavailable: %v", e.Err)
+	}
+	return fmt.Sprintf("cloud api unavailable for %s: %v", e.Operation, e.Err)
+}
+
+// Unwrap returns the error of the cloud.
+func (e *UnavailableError) Unwrap() error { return e.Err }
+
+// Retryable -- the cloud recovers.
+func (e *UnavailableError) Retryable() bool { return true }
+
+// PermissionDeniedError is returned when the operator is not allowed to run the operation.
+type PermissionDeniedError struct {
+	Operation string
+	Err       error
+}
+
+func (e *PermissionDeniedError) Error() string {
+	return fmt.Sprintf("permission denied for %s: %v", e.Operation, e.Err)
+}
+
+// Unwrap returns the error of the cloud.
+func (e *PermissionDeniedError) Unwrap() error { return e.Err }
+
+// Retryable -- the permissions have to be fixed first.
+func (e *PermissionDeniedError) Retryable() bool { return false }
+
+// ConflictError is returned when the operation collides with the current state (e.g. an IP already in use).
+type ConflictError struct {
+	Operation string
+	Err       error
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("conflict in %s: %v", e.Operation, e.Err)
+}
+
+// Unwrap returns the error of the cloud.
+func (e *ConflictError) Unwrap() error { return e.Err }
+
+// Retryable -- the state may have changed on the next try.
+func (e *ConflictError) Retryable() bool { return true }
+
+// InvalidIPError is returned when a specified IP can't be used as egress IP of the namespace.
+type InvalidIPError struct {
+	IP     string
+	Reason string // why the IP can't be used (e.g. "is reserved by AWS")
+}
+
+func (e *InvalidIPError) Error() string {
+	return fmt.Sprintf("invalid egress ip '%s': %s", e.IP, e.Reason)
+}
+
+// Retryable -- the specified IPs have to be changed first.
+func (e *InvalidIPError) Retryable() bool { return false }
+
+// findError -- checks the error, the errors combined in a multierror and the wrapped errors.
+func findError(err error, matches func(err error) bool) bool {
+	for err != nil {
+		if matches(err) {
+			return true
+		}
+
+		switch e := err.(type) {
+		case *multierror.Error:
+			for _, wrapped := range e.Errors {
+				if findError(wrapped, matches) {
+					return true
+				}
+			}
+			return false
+		case interface{ Unwrap() error }:
+			err = e.Unwrap()
+		default:
+			return false
+		}
+	}
+
+	return false
+}
+
+// IsNotFound checks if the error (or one of the errors combined in it) reports a missing resource.
+func IsNotFound(err error) bool {
+	return findError(err, func(err error) bool {
+		_, ok := err.(*NotFoundError)
+		return ok
+	})
+}
+
+// IsCapacityExhausted checks if the error (or one of the errors combined in it) reports exhausted capacity.
+func IsCapacityExhausted(err error) bool {
+	return findError(err, func(err error) bool {
+		_, ok := err.(*CapacityExhaustedError)
+		return ok
+	})
+}
+
+// IsNoEgressNode checks if the error (or one of the errors combined in it) reports a network without egress nodes.
+func IsNoEgressNode(err error) bool {
+	return findError(err, func(err error) bool {
+		_, ok := err.(*NoEgressNodeError)
+		return ok
+	})
+}
+
+// IsThrottled checks if the error (or one of the errors combined in it) reports throttling.
+func IsThrottled(err error) bool {
+	return findError(err, func(err error) bool {
+		_, ok := err.(*ThrottledError)
+		return ok
+	})
+}
+
+// IsPermissionDenied checks if the error (or one of the errors combined in it) reports missing permissions.
+func IsPermissionDenied(err error) bool {
+	return findError(err, func(err error) bool {
+		_, ok := err.(*PermissionDeniedError)
+		return ok
+	})
+}
+
+// IsConflict checks if the error (or one of the errors combined in it) reports a conflict.
+func IsConflict(err error) bool {
+	return findError(err, func(err error) bool {
+		_, ok := err.(*ConflictError)
+		return ok
+	})
+}
+
+// IsInvalidIP checks if the error (or one of the errors combined in it) reports an invalid specified IP.
+func IsInvalidIP(err error) bool {
+	return findError(err, func(err error) bool {
+		_, ok := err.(*InvalidIPError)
+		return ok
+	})
+}
+
+// IsRetryable checks if repeating the operation may succeed. Combined errors are retryable if all of them are, errors
+// without classification are not.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if e, ok := err.(*multierror.Error); ok {
+		for _, wrapped := range e.Errors {
+			if !IsRetryable(wrapped) {
+				return false
+			}
+		}
+		return len(e.Errors) > 0
+	}
+
+	return findError(err, func(err error) bool {
+		classified, ok := err.(ClassifiedError)
+		return ok && classified.Retryable()
+	})
+}
+
+// classifyAwsError -- converts the error of an AWS call into a ClassifiedError. Errors that can't be classified (e.g.
+// PrivateIpAddressLimitExceeded, which is handled by the placement) are returned unchanged.
+func classifyAwsError(operation string, err error) error {
+	awsErr, ok := err.(awserr.Error)
+	if !ok {
+		return err
+	}
+
+	code := awsErr.Code()
+	switch {
+	case code == "RequestLimitExceeded" || strings.HasPrefix(code, "Throttling"):
+		return &ThrottledError{Operation: operation, Err: err}
+	case isServerError(err) || code == "InternalError" || code == "InternalFailure" ||
+		code == "ServiceUnavailable" || code == "Unavailable":
+		return &UnavailableError{Operation: operation, Err: err}
+	case code == "UnauthorizedOperation" || code == "AuthFailure" || strings.HasPrefix(code, "AccessDenied"):
+		return &PermissionDeniedError{Operation: operation, Err: err}
+	case strings.HasSuffix(code, ".NotFound"):
+		return &NotFoundError{Resource: strings.TrimSuffix(code, ".NotFound"), Key: operation, Err: err}
+	case strings.HasSuffix(code, ".InUse") || code == "Resource.AlreadyAssociated":
+		return &ConflictError{Operation: operation, Err: err}
+	}
+
+	return err
+}
+
+func isServerError(err error) bool {
+	failure, ok := err.(awserr.RequestFailure)
+	return ok && failure.StatusCode() >= 500
+}
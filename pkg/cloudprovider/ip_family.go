@@ -0,0 +1,64 @@
+package cloudprovider
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// IPFamily is the address family of an egress IP.
+type IPFamily string
+
+// The supported address families.
+const (
+	IPv4 IPFamily = "IPv4"
+	IPv6 IPFamily = "IPv6"
+)
+
+// FamilyOf returns the address family of the IP.
+func FamilyOf(ip net.IP) IPFamily {
+	if ip.To4() != nil {
+		return IPv4
+	}
+
+	return IPv6
+}
+
+// ParseIPFamilies parses a comma separated list of address families (e.g. "IPv4,IPv6"). The names are not case
+// sensitive. An empty list returns nil.
+func ParseIPFamilies(families string) ([]IPFamily, error) {
+	var result []IPFamily
+
+	for _, name := range strings.Split(families, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		var family IPFamily
+		switch {
+		case strings.EqualFold(name, string(IPv4)):
+			family = IPv4
+		case strings.EqualFold(name, string(IPv6)):
+			family = IPv6
+		default:
+			return nil, fmt.Errorf("unknown ip family '%s' (valid: %s, %s)", name, IPv4, IPv6)
+		}
+
+		if !containsFamily(result, family) {
+			result = append(result, family)
+		}
+	}
+
+	return result, nil
+}
+
+func containsFamily(families []IPFamily, family IPFamily) bool {
+	for _, f := range families {
+		if f == family {
+			return true
+		}
+	}
+
+	return false
+}
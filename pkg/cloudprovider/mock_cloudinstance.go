@@ -0,0 +1,142 @@
+package cloudprovider
+
+import (
+	"net"
+)
+
+var _ CloudInstance = &MockInstance{}
+var _ CloudNetworkInterface = &MockNetworkInterface{}
+
+// MockInstance is a snapshot of an instance of the simulated cloud.
+type MockInstance struct {
+	id       string
+	hostName string
+	region   string
+	zone     string
+
+	tags map[string]string
+
+	interfaces []*MockNetworkInterface
+}
+
+// MockNetworkInterface is a snapshot of a network interface of the simulated cloud.
+type MockNetworkInterface struct {
+	id          string
+	network     string
+	deviceIndex int
+
+	primaryIP    net.IP
+	secondaryIPs []net.IP
+	capacity     int
+}
+
+// ID returns the ID of the simulated instance
+func (m *MockInstance) ID() string {
+	return m.id
+}
+
+// URI returns the URI of the simulated instance
+func (m *MockInstance) URI() string {
+	return "mock://instance/" + m.id
+}
+
+// HostName returns the hostname of the simulated instance
+func (m *MockInstance) HostName() string {
+	return m.hostName
+}
+
+// FailureRegion returns the region of the simulated instance
+func (m *MockInstance) FailureRegion() string {
+	return m.region
+}
+
+// FailureZone returns the failure zone of the simulated instance
+func (m *MockInstance) FailureZone() string {
+	return m.zone
+}
+
+// Tags returns a map containing all Tags of the simulated instance
+func (m *MockInstance) Tags() *map[string]string {
+	return &m.tags
+}
+
+// NetworkInterface returns the id of the first network interface of the simulated instance
+func (m *MockInstance) NetworkInterface() string {
+	if len(m.interfaces) == 0 {
+		return ""
+	}
+
+	return m.interfaces[0].id
+}
+
+// NetworkInterfaces returns all network interfaces of the simulated instance
+func (m *MockInstance) NetworkInterfaces() []CloudNetworkInterface {
+	result := make([]CloudNetworkInterface, len(m.interfaces))
+	for i, networkInterface := range m.interfaces {
+		result[i] = networkInterface
+	}
+	return result
+}
+
+// PrimaryIP returns the primary ip of the simulated instance
+func (m *MockInstance) PrimaryIP() *net.IP {
+	if len(m.interfaces) == 0 {
+		return &net.IP{}
+	}
+
+	return m.interfaces[0].PrimaryIP()
+}
+
+// SecondaryIps returns the secondary IPs of all network interfaces of the simulated instance
+func (m *MockInstance) SecondaryIps() []*net.IP {
+	result := make([]*net.IP, 0)
+	for _, networkInterface := range m.interfaces {
+		result = append(result, networkInterface.SecondaryIps()...)
+	}
+	return result
+}
+
+// ID returns the ID of the simulated network interface
+func (m *MockNetworkInterface) ID() string {
+	return m.id
+}
+
+// Network returns the subnet of the simulated network interface
+func (m *MockNetworkInterface) Network() string {
+	return m.network
+}
+
+// DeviceIndex returns the index of the simulated network interface on its instance
+func (m *MockNetworkInterface) DeviceIndex() int {
+	return m.deviceIndex
+}
+
+// PrimaryIP returns the primary ip of the simulated network interface
+func (m *MockNetworkInterface) PrimaryIP() *net.IP {
+	return &m.primaryIP
+}
+
+// SecondaryIps returns the secondary IPv4 and IPv6 addresses of the simulated network interface
+func (m *MockNetworkInterface) SecondaryIps() []*net.IP {
+	result := make([]*net.IP, len(m.secondaryIPs))
+	for i := range m.secondaryIPs {
+		result[i] = &m.secondaryIPs[i]
+	}
+	return result
+}
+
+// IPCount returns the number of IPv4 addresses assigned to the simulated network interface
+func (m *MockNetworkInterface) IPCount() int {
+	result := 1
+	for _, ip := range m.secondaryIPs {
+		if FamilyOf(ip) == IPv4 {
+			result++
+		}
+	}
+	return result
+}
+
+// IPCapacity returns the maximum number of IPv4 addresses of the simulated network interface
+func (m *MockNetworkInterface) IPCapacity() int {
+	return m.capacity
+}
@@ -0,0 +1,823 @@
+package cloudprovider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hashicorp/go-multierror"
+	"github.com/klenkes74/aws-egressip-operator/pkg/logger"
+	"io/ioutil"
+	"net"
+	"os"
+	"sigs.k8s.io/yaml"
+	"sort"
+	"sync"
+)
+
+const defaultMockIPsPerInterface = 10 // matches the per ENI limit of the common m5.large instances
+
+// The public IPs of the simulated cloud are taken from TEST-NET-3 (RFC 5737).
+var mockPublicIPs = &net.IPNet{IP: net.IPv4(203, 0, 113, 0).To4(), Mask: net.CIDRMask(24, 32)}
+
+var mockLog = logger.Log.WithName("Mock-cloud")
+
+// MockConfig -- the seed of the simulated cloud. It is read from the YAML file named in the environment variable
+// MOCK_CLOUD_CONFIG.
+type MockConfig struct {
+	ClusterName     string               `json:"clusterName"`
+	Region          string               `json:"region"`
+	IPsPerInterface int                  `json:"ipsPerInterface"` // default IP limit of an ENI (primary IP included)
+	Placement       string               `json:"placement"`       // name of the placement strategy, default least-loaded
+	Subnets         []MockSubnetConfig   `json:"subnets"`
+	Instances       []MockInstanceConfig `json:"instances"`
+}
+
+// MockSubnetConfig -- a single subnet of the simulated cloud.
+type MockSubnetConfig struct {
+	ID       string `json:"id"`
+	CIDR     string `json:"cidr"`
+	IPv6CIDR string `json:"ipv6Cidr"` // optional IPv6 CIDR of the subnet
+	Zone     string `json:"zone"`
+}
+
+// MockInstanceConfig -- a single instance of the simulated cloud.
+type MockInstanceConfig struct {
+	ID         string                `json:"id"`
+	HostName   string                `json:"hostname"`
+	Zone       string                `json:"zone"`
+	Tags       map[string]string     `json:"tags"`
+	Interfaces []MockInterfaceConfig `json:"interfaces"`
+}
+
+// MockInterfaceConfig -- a network interface attached to an instance of the simulated cloud.
+type MockInterfaceConfig struct {
+	ID           string   `json:"id"`
+	Subnet       string   `json:"subnet"`
+	PrimaryIP    string   `json:"primaryIP"`
+	SecondaryIPs []string `json:"secondaryIPs"` // IPv4 and IPv6 addresses
+	MaxIPs       int      `json:"maxIPs"`       // IP limit per address family of this ENI (primary IP included), 0 uses the default
+}
+
+// The singleton mock provider. It will be created on first use.
+var (
+	mockProvider     *MockCloudProvider
+	mockProviderErr  error
+	mockProviderOnce sync.Once
+)
+
+// MockProvider returns the singleton simulated cloud provider. It is seeded from the YAML file named in the
+// environment variable MOCK_CLOUD_CONFIG. Without that file the cloud is empty. An invalid configuration is returned as
+// error on every call.
+func MockProvider() (*MockCloudProvider, error) {
+	mockProviderOnce.Do(func() {
+		config := &MockConfig{}
+
+		fileName, found := os.LookupEnv("MOCK_CLOUD_CONFIG")
+		if found {
+			config, mockProviderErr = LoadMockConfig(fileName)
+			if mockProviderErr != nil {
+				mockProviderErr = fmt.Errorf("can not read the mock cloud configuration '%s': %w", fileName, mockProviderErr)
+				return
+			}
+		}
+
+		mockProvider, mockProviderErr = NewMockCloudProvider(config)
+		if mockProviderErr != nil {
+			mockProviderErr = fmt.Errorf("can not create the mock cloud: %w", mockProviderErr)
+		}
+	})
+
+	return mockProvider, mockProviderErr
+}
+
+// LoadMockConfig -- reads the seed of the simulated cloud from a YAML file.
+func LoadMockConfig(fileName string) (*MockConfig, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseMockConfig(data)
+}
+
+// ParseMockConfig -- parses the YAML seed of the simulated cloud.
+func ParseMockConfig(data []byte) (*MockConfig, error) {
+	result := &MockConfig{}
+
+	err := yaml.Unmarshal(data, result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+var _ CloudProvider = &MockCloudProvider{}
+var _ EgressNodeLister = &MockCloudProvider{}
+
+// MockCloudProvider is an in-memory simulation of a cloud. It keeps instances, subnets, network interfaces and their
+// secondary IPs and enforces the IP limits of the network interfaces. It is used to run the operator without any
+// cloud account. Changes requested with a done context are rejected with the error of the context.
+type MockCloudProvider struct {
+	mutex sync.Mutex
+
+	clusterName string
+	region      string
+	placement   PlacementStrategy
+
+	subnets    map[string]*mockSubnet
+	instances  map[string]*mockInstance
+	interfaces map[string]*mockInterface
+	publicIPs  map[string]net.IP // private IP -> associated public IP
+}
+
+type mockSubnet struct {
+	id       string
+	zone     string
+	cidr     *net.IPNet
+	ipv6Cidr *net.IPNet
+}
+
+// cidrFor returns the CIDR of the subnet for the address family -- nil if the subnet has none.
+func (s *mockSubnet) cidrFor(family IPFamily) *net.IPNet {
+	if family == IPv6 {
+		return s.ipv6Cidr
+	}
+
+	return s.cidr
+}
+
+func (s *mockSubnet) contains(ip net.IP) bool {
+	cidr := s.cidrFor(FamilyOf(ip))
+	return cidr != nil && cidr.Contains(ip)
+}
+
+type mockInstance struct {
+	id         string
+	hostName   string
+	zone       string
+	tags       map[string]string
+	interfaces []*mockInterface
+}
+
+type mockInterface struct {
+	id         string
+	subnetID   string
+	instanceID string
+	primary    net.IP
+	secondary  []net.IP
+	maxIPs     int
+}
+
+// ipCount returns the number of IPs of the address family assigned to the interface. The primary IP is an IPv4 one.
+func (i *mockInterface) ipCount(family IPFamily) int {
+	result := 0
+	if family == IPv4 {
+		result++
+	}
+
+	for _, ip := range i.secondary {
+		if FamilyOf(ip) == family {
+			result++
+		}
+	}
+	return result
+}
+
+// NewMockCloudProvider -- creates the simulated cloud from the given seed.
+func NewMockCloudProvider(config *MockConfig) (*MockCloudProvider, error) {
+	placement, err := NewPlacementStrategy(config.Placement)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &MockCloudProvider{
+		placement:   placement,
+		clusterName: config.ClusterName,
+		region:      config.Region,
+		subnets:     make(map[string]*mockSubnet, len(config.Subnets)),
+		instances:   make(map[string]*mockInstance, len(config.Instances)),
+		interfaces:  make(map[string]*mockInterface),
+		publicIPs:   make(map[string]net.IP),
+	}
+
+	ipsPerInterface := config.IPsPerInterface
+	if ipsPerInterface <= 0 {
+		ipsPerInterface = defaultMockIPsPerInterface
+	}
+
+	for _, s := range config.Subnets {
+		_, cidr, err := net.ParseCIDR(s.CIDR)
+		if err != nil {
+			return nil, fmt.Errorf("subnet '%s' has an invalid cidr '%s': %v", s.ID, s.CIDR, err)
+		}
+
+		subnet := &mockSubnet{id: s.ID, zone: s.Zone, cidr: cidr}
+		if s.IPv6CIDR != "" {
+			_, subnet.ipv6Cidr, err = net.ParseCIDR(s.IPv6CIDR)
+			if err != nil {
+				return nil, fmt.Errorf("subnet '%s' has an invalid ipv6 cidr '%s': %v", s.ID, s.IPv6CIDR, err)
+			}
+		}
+
+		result.subnets[s.ID] = subnet
+	}
+
+	for _, i := range config.Instances {
+		instance := &mockInstance{
+			id:         i.ID,
+			hostName:   i.HostName,
+			zone:       i.Zone,
+			tags:       i.Tags,
+			interfaces: make([]*mockInterface, 0, len(i.Interfaces)),
+		}
+
+		for _, c := range i.Interfaces {
+			networkInterface, err := result.createInterface(instance, c, ipsPerInterface)
+			if err != nil {
+				return nil, err
+			}
+
+			instance.interfaces = append(instance.interfaces, networkInterface)
+			result.interfaces[networkInterface.id] = networkInterface
+		}
+
+		result.instances[instance.id] = instance
+	}
+
+	mockLog.Info("Initialized Mock Cloud Provider.",
+		"Cluster Name", result.clusterName,
+		"Region", result.region,
+		"Placement Strategy", result.placement.Name(),
+		"subnets", len(result.subnets),
+		"instances", len(result.instances),
+	)
+	return result, nil
+}
+
+func (m *MockCloudProvider) createInterface(instance *mockInstance, c MockInterfaceConfig, ipsPerInterface int) (*mockInterface, error) {
+	subnet := m.subnets[c.Subnet]
+	if subnet == nil {
+		return nil, fmt.Errorf("interface '%s' of instance '%s' references unknown subnet '%s'", c.ID, instance.id, c.Subnet)
+	}
+
+	result := &mockInterface{
+		id:         c.ID,
+		subnetID:   c.Subnet,
+		instanceID: instance.id,
+		primary:    net.ParseIP(c.PrimaryIP),
+		secondary:  make([]net.IP, 0, len(c.SecondaryIPs)),
+		maxIPs:     c.MaxIPs,
+	}
+	if result.maxIPs <= 0 {
+		result.maxIPs = ipsPerInterface
+	}
+
+	if result.primary == nil || FamilyOf(result.primary) != IPv4 || !subnet.contains(result.primary) {
+		return nil, fmt.Errorf("interface '%s' has the primary ip '%s' outside of subnet '%s'", c.ID, c.PrimaryIP, c.Subnet)
+	}
+
+	for _, ipString := range c.SecondaryIPs {
+		ip := net.ParseIP(ipString)
+		if ip == nil || !subnet.contains(ip) {
+			return nil, fmt.Errorf("interface '%s' has the secondary ip '%s' outside of subnet '%s'", c.ID, ipString, c.Subnet)
+		}
+
+		result.secondary = append(result.secondary, ip)
+	}
+
+	if result.ipCount(IPv4) > result.maxIPs || result.ipCount(IPv6) > result.maxIPs {
+		return nil, fmt.Errorf("interface '%s' carries more than %d ips", c.ID, result.maxIPs)
+	}
+
+	return result, nil
+}
+
+// ClusterTag returns the tag and value the cluster marks all resources with.
+func (m *MockCloudProvider) ClusterTag() (string, string) {
+	return "kubernetes.io/cluster/" + m.clusterName, "owned"
+}
+
+// Instance -- returns the simulated instance with the given ID.
+func (m *MockCloudProvider) Instance(_ context.Context, instanceID string) (*CloudInstance, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	instance := m.instances[instanceID]
+	if instance == nil {
+		return nil, &NotFoundError{Resource: "instance", Key: fmt.Sprintf("id '%s'", instanceID)}
+	}
+
+	return m.cloudInstance(instance), nil
+}
+
+// InstanceByHostName -- returns the simulated instance with the given hostname.
+func (m *MockCloudProvider) InstanceByHostName(_ context.Context, hostname string) (*CloudInstance, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, instance := range m.instances {
+		if instance.hostName == hostname {
+			return m.cloudInstance(instance), nil
+		}
+	}
+
+	return nil, &NotFoundError{Resource: "instance", Key: fmt.Sprintf("hostname '%s'", hostname)}
+}
+
+// EgressNodes -- returns all simulated instances sorted by their ID.
+func (m *MockCloudProvider) EgressNodes(_ context.Context) ([]*CloudInstance, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	ids := make([]string, 0, len(m.instances))
+	for id := range m.instances {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	result := make([]*CloudInstance, len(ids))
+	for i, id := range ids {
+		result[i] = m.cloudInstance(m.instances[id])
+	}
+
+	return result, nil
+}
+
+// cloudInstance creates a copy of the instance data so the caller is not affected by later changes.
+func (m *MockCloudProvider) cloudInstance(instance *mockInstance) *CloudInstance {
+	data := MockInstance{
+		id:       instance.id,
+		hostName: instance.hostName,
+		region:   m.region,
+		zone:     instance.zone,
+		tags:     make(map[string]string, len(instance.tags)),
+	}
+
+	for key, value := range instance.tags {
+		data.tags[key] = value
+	}
+
+	data.interfaces = make([]*MockNetworkInterface, len(instance.interfaces))
+	for i, networkInterface := range instance.interfaces {
+		data.interfaces[i] = &MockNetworkInterface{
+			id:          networkInterface.id,
+			network:     networkInterface.subnetID,
+			deviceIndex: i,
+			primaryIP:   networkInterface.primary,
+			capacity:    networkInterface.maxIPs,
+			secondaryIPs: append(make([]net.IP, 0, len(networkInterface.secondary)),
+				networkInterface.secondary...),
+		}
+	}
+
+	result := CloudInstance(&data)
+	return &result
+}
+
+// AddSpecifiedIPs adds the given IPs to the network interfaces chosen by the placement strategy within the matching
+// subnets.
+func (m *MockCloudProvider) AddSpecifiedIPs(ctx context.Context, request IPRequest, ips []*net.IP) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if len(ips) == 0 {
+		return nil, errors.New("no ips specified")
+	}
+
+	result := make([]string, len(ips))
+	var err error
+
+	for i, ip := range ips {
+		instanceID, err2 := m.addSpecifiedIP(request, ip)
+		if err2 != nil {
+			err = multierror.Append(err, err2)
+		}
+
+		result[i] = instanceID
+	}
+
+	mockLog.Info("added specific ips",
+		"instances", result,
+		"ips", ips,
+		"errors", err,
+	)
+	return result, err
+}
+
+func (m *MockCloudProvider) addSpecifiedIP(request IPRequest, ip *net.IP) (string, error) {
+	subnet := m.subnetForIP(*ip)
+	if subnet == nil {
+		return "", fmt.Errorf("can not find a matching subnet for ip '%s'", ip.String())
+	}
+
+	if m.isIPInUse(*ip) {
+		return "", &ConflictError{Operation: "assigning ip", Err: fmt.Errorf("ip '%s' is already assigned", ip.String())}
+	}
+
+	networkInterface, err := m.placeInterface(request, subnet.id, FamilyOf(*ip))
+	if err != nil {
+		return "", err
+	}
+
+	networkInterface.secondary = append(networkInterface.secondary, *ip)
+
+	return networkInterface.instanceID, nil
+}
+
+// AddRandomIPs adds a free IP of every requested address family and subnet of the selected zones to the network
+// interface chosen by the placement strategy within that subnet. Subnets without an IPv6 CIDR are skipped for IPv6.
+func (m *MockCloudProvider) AddRandomIPs(ctx context.Context, request IPRequest) ([]string, []*net.IP, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	subnetIDs, err := m.subnetsOfSelectedZones(request)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	instanceIDs := make([]string, 0, len(subnetIDs))
+	ips := make([]*net.IP, 0, len(subnetIDs))
+
+	for _, family := range request.IPFamilies() {
+		for _, subnetID := range subnetIDs {
+			subnet := m.subnets[subnetID]
+			if subnet.cidrFor(family) == nil {
+				continue
+			}
+
+			networkInterface, err2 := m.placeInterface(request, subnetID, family)
+			if err2 != nil {
+				err = multierror.Append(err, err2)
+				instanceIDs = append(instanceIDs, "")
+				ips = append(ips, nil)
+				continue
+			}
+
+			ip, err2 := m.freeIP(subnet, family)
+			if err2 != nil {
+				err = multierror.Append(err, err2)
+				instanceIDs = append(instanceIDs, "")
+				ips = append(ips, nil)
+				continue
+			}
+
+			networkInterface.secondary = append(networkInterface.secondary, ip)
+
+			instanceIDs = append(instanceIDs, networkInterface.instanceID)
+			ips = append(ips, &ip)
+		}
+	}
+
+	mockLog.Info("added random ips",
+		"instances", instanceIDs,
+		"ips", ips,
+		"error", err,
+	)
+	return instanceIDs, ips, err
+}
+
+// subnetsOfSelectedZones returns the ids of the subnets in the zones selected by the request. The subnets are ordered
+// by the preferred order of the zones and their id.
+func (m *MockCloudProvider) subnetsOfSelectedZones(request IPRequest) ([]string, error) {
+	subnetIDs := make([]string, 0, len(m.subnets))
+	available := make([]string, 0, len(m.subnets))
+	for id, subnet := range m.subnets {
+		subnetIDs = append(subnetIDs, id)
+		available = append(available, subnet.zone)
+	}
+	sort.Strings(subnetIDs)
+
+	zones, err := request.SelectZones(available)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]string, 0, len(subnetIDs))
+	for _, zone := range zones {
+		for _, id := range subnetIDs {
+			if m.subnets[id].zone == zone {
+				result = append(result, id)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// RemoveIP removes the secondary IP from the network interface carrying it.
+func (m *MockCloudProvider) RemoveIP(ctx context.Context, ip *net.IP) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, networkInterface := range m.interfaces {
+		for i, secondary := range networkInterface.secondary {
+			if secondary.Equal(*ip) {
+				networkInterface.secondary = append(networkInterface.secondary[:i], networkInterface.secondary[i+1:]...)
+				delete(m.publicIPs, ip.String())
+
+				mockLog.Info("removed ip", "ip", ip.String(), "eni", networkInterface.id)
+				return networkInterface.instanceID, nil
+			}
+		}
+	}
+
+	return "", &NotFoundError{Resource: "network interface", Key: fmt.Sprintf("ip '%s'", ip.String())}
+}
+
+// MoveIP moves the secondary IP to the network interface of another instance the placement strategy chooses within
+// its subnet. The public IP associated with it stays associated. An unassigned IP is just assigned.
+func (m *MockCloudProvider) MoveIP(ctx context.Context, request IPRequest, ip *net.IP) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	subnet := m.subnetForIP(*ip)
+	if subnet == nil {
+		return "", fmt.Errorf("can not find a matching subnet for ip '%s'", ip.String())
+	}
+
+	for _, current := range m.interfaces {
+		for i, secondary := range current.secondary {
+			if !secondary.Equal(*ip) {
+				continue
+			}
+
+			target, err := m.placeInterface(request, subnet.id, FamilyOf(*ip), current.instanceID)
+			if err != nil {
+				return "", err
+			}
+
+			current.secondary = append(current.secondary[:i], current.secondary[i+1:]...)
+			target.secondary = append(target.secondary, *ip)
+
+			mockLog.Info("moved ip", "ip", ip.String(), "from-eni", current.id, "to-eni", target.id)
+			return target.instanceID, nil
+		}
+	}
+
+	return m.addSpecifiedIP(request, ip)
+}
+
+// InstanceGone checks if there is no simulated instance with the given hostname.
+func (m *MockCloudProvider) InstanceGone(ctx context.Context, hostname string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, instance := range m.instances {
+		if instance.hostName == hostname {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// ReclaimIP assigns the freed IP to the network interface the placement strategy chooses within its subnet. An IP
+// already assigned stays where it is. All interfaces of the simulated cloud belong to the cluster, so the IP is never
+// taken by others.
+func (m *MockCloudProvider) ReclaimIP(ctx context.Context, request IPRequest, ip *net.IP) (string, *net.IP, error) {
+	if err := ctx.Err(); err != nil {
+		return "", nil, err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, networkInterface := range m.interfaces {
+		for _, secondary := range networkInterface.secondary {
+			if secondary.Equal(*ip) {
+				return networkInterface.instanceID, ip, nil
+			}
+		}
+	}
+
+	instanceID, err := m.addSpecifiedIP(request, ip)
+	if err != nil {
+		return "", nil, err
+	}
+	return instanceID, ip, nil
+}
+
+// FailoverIP adds a free IP of the address family of the IP to the network interface the placement strategy chooses
+// within the subnets of the other zones. The zones are tried in the order of IPRequest.FailoverZones.
+func (m *MockCloudProvider) FailoverIP(ctx context.Context, request IPRequest, ip *net.IP) (string, *net.IP, error) {
+	if err := ctx.Err(); err != nil {
+		return "", nil, err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	failed := m.subnetForIP(*ip)
+	if failed == nil {
+		return "", nil, fmt.Errorf("can not find a matching subnet for ip '%s'", ip.String())
+	}
+	family := FamilyOf(*ip)
+
+	subnetIDs := make([]string, 0, len(m.subnets))
+	available := make([]string, 0, len(m.subnets))
+	for id, subnet := range m.subnets {
+		subnetIDs = append(subnetIDs, id)
+		available = append(available, subnet.zone)
+	}
+	sort.Strings(subnetIDs)
+
+	var err error
+	for _, zone := range request.FailoverZones(available, failed.zone) {
+		for _, id := range subnetIDs {
+			subnet := m.subnets[id]
+			if subnet.zone != zone || subnet.cidrFor(family) == nil {
+				continue
+			}
+
+			networkInterface, err2 := m.placeInterface(request, id, family)
+			if err2 != nil {
+				err = multierror.Append(err, err2)
+				continue
+			}
+
+			replacement, err2 := m.freeIP(subnet, family)
+			if err2 != nil {
+				err = multierror.Append(err, err2)
+				continue
+			}
+			networkInterface.secondary = append(networkInterface.secondary, replacement)
+
+			mockLog.Info("failed over ip", "ip", ip.String(), "replacement", replacement.String(), "eni", networkInterface.id)
+			return networkInterface.instanceID, &replacement, nil
+		}
+	}
+
+	if err == nil {
+		err = fmt.Errorf("no zone but '%s' has a subnet for %s ips", failed.zone, family)
+	}
+	return "", nil, err
+}
+
+// AssociatePublicIP associates a free public IP with the assigned private IP.
+func (m *MockCloudProvider) AssociatePublicIP(ctx context.Context, request IPRequest, ip *net.IP) (*net.IP, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if FamilyOf(*ip) != IPv4 {
+		return nil, fmt.Errorf("can not associate a public ip with the IPv6 address '%s'", ip.String())
+	}
+
+	assigned := false
+	for _, networkInterface := range m.interfaces {
+		for _, secondary := range networkInterface.secondary {
+			assigned = assigned || secondary.Equal(*ip)
+		}
+	}
+	if !assigned {
+		return nil, &NotFoundError{Resource: "network interface", Key: fmt.Sprintf("ip '%s'", ip.String())}
+	}
+
+	if public, found := m.publicIPs[ip.String()]; found {
+		return &public, nil
+	}
+
+	for offset := uint64(1); offset < 255; offset++ {
+		public := addToIP(mockPublicIPs.IP.To16(), offset)
+
+		inUse := false
+		for _, used := range m.publicIPs {
+			inUse = inUse || used.Equal(public)
+		}
+		if !inUse {
+			m.publicIPs[ip.String()] = public
+
+			mockLog.Info("associated public ip", "ip", ip.String(), "public-ip", public.String(), "namespace", request.Namespace)
+			return &public, nil
+		}
+	}
+
+	return nil, &CapacityExhaustedError{Network: mockPublicIPs.String()}
+}
+
+// placeInterface returns the network interface within the subnet the placement strategy chooses from all interfaces
+// still able to take another IP of the address family.
+func (m *MockCloudProvider) placeInterface(request IPRequest, subnetID string, family IPFamily, excludedInstances ...string) (*mockInterface, error) {
+	candidates := make([]PlacementCandidate, 0)
+	full := 0
+
+	for _, networkInterface := range m.interfaces {
+		if networkInterface.subnetID != subnetID {
+			continue
+		}
+		if isExcluded(networkInterface.instanceID, excludedInstances) {
+			continue
+		}
+
+		if networkInterface.ipCount(family) >= networkInterface.maxIPs {
+			full++
+			continue
+		}
+
+		candidates = append(candidates, PlacementCandidate{
+			InstanceID:  networkInterface.instanceID,
+			InterfaceID: networkInterface.id,
+			IPCount:     networkInterface.ipCount(family),
+			IPCapacity:  networkInterface.maxIPs,
+		})
+	}
+
+	if len(candidates) == 0 && full > 0 {
+		return nil, &CapacityExhaustedError{Network: subnetID}
+	}
+	if len(candidates) == 0 {
+		return nil, &NoEgressNodeError{Network: subnetID}
+	}
+
+	return m.interfaces[m.placement.Order(request, subnetID, candidates)[0].InterfaceID], nil
+}
+
+func (m *MockCloudProvider) subnetForIP(ip net.IP) *mockSubnet {
+	for _, subnet := range m.subnets {
+		if subnet.contains(ip) {
+			return subnet
+		}
+	}
+
+	return nil
+}
+
+func (m *MockCloudProvider) isIPInUse(ip net.IP) bool {
+	for _, networkInterface := range m.interfaces {
+		if networkInterface.primary.Equal(ip) {
+			return true
+		}
+
+		for _, secondary := range networkInterface.secondary {
+			if secondary.Equal(ip) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// freeIP returns the first unused address of the address family in the subnet. Like AWS the first four addresses and
+// the last address of the subnet are reserved. Large (IPv6) subnets are only searched within their first 2^32
+// addresses.
+func (m *MockCloudProvider) freeIP(subnet *mockSubnet, family IPFamily) (net.IP, error) {
+	cidr := subnet.cidrFor(family)
+	if cidr == nil {
+		return nil, fmt.Errorf("subnet '%s' has no %s cidr", subnet.id, family)
+	}
+
+	ones, bits := cidr.Mask.Size()
+	hostBits := bits - ones
+	if hostBits > 32 {
+		hostBits = 32
+	}
+	size := uint64(1) << uint(hostBits)
+
+	for offset := uint64(4); offset+1 < size; offset++ {
+		ip := addToIP(cidr.IP.To16(), offset)
+
+		if !m.isIPInUse(ip) {
+			return ip, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no free %s ip left in subnet '%s'", family, subnet.id)
+}
+
+// addToIP returns a new IP with the given offset added to the base address.
+func addToIP(base net.IP, offset uint64) net.IP {
+	result := make(net.IP, len(base))
+	copy(result, base)
+
+	for i := len(result) - 1; i >= 0 && offset > 0; i-- {
+		sum := uint64(result[i]) + (offset & 0xff)
+		result[i] = byte(sum)
+		offset = (offset >> 8) + (sum >> 8)
+	}
+
+	return result
+}
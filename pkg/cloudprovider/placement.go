@@ -0,0 +1,198 @@
+package cloudprovider
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+)
+
+// The names of the built-in placement strategies.
+const (
+	LeastLoadedPlacement   = "least-loaded"
+	RoundRobinPlacement    = "round-robin"
+	NamespaceHashPlacement = "namespace-hash"
+	WeightedPlacement      = "weighted"
+)
+
+const defaultPlacementStrategy = LeastLoadedPlacement
+
+// PlacementCandidate is a network interface that is able to take another IP.
+type PlacementCandidate struct {
+	InstanceID   string // the instance the network interface is attached to
+	InterfaceID  string // the network interface
+	InstanceType string // the instance type of the instance -- empty if unknown
+
+	IPCount    int // number of IPs currently assigned to the network interface
+	IPCapacity int // maximum number of IPs of the network interface -- 0 if unknown
+}
+
+// PlacementStrategy decides which network interface a new IP is assigned to.
+type PlacementStrategy interface {
+	// Name returns the name of the strategy.
+	Name() string
+
+	// Order returns the candidates of the network in the order they should be tried. The first candidate is used
+	// unless the cloud rejects the assignment -- then the next one is tried.
+	Order(request IPRequest, network string, candidates []PlacementCandidate) []PlacementCandidate
+}
+
+// NewPlacementStrategy creates the built-in strategy with the given name.
+func NewPlacementStrategy(name string) (PlacementStrategy, error) {
+	switch name {
+	case "", LeastLoadedPlacement:
+		return &LeastLoadedStrategy{}, nil
+	case RoundRobinPlacement:
+		return &RoundRobinStrategy{}, nil
+	case NamespaceHashPlacement:
+		return &NamespaceHashStrategy{}, nil
+	case WeightedPlacement:
+		return &WeightedStrategy{}, nil
+	}
+
+	return nil, fmt.Errorf("unknown placement strategy '%s' (valid: %s, %s, %s, %s)", name,
+		LeastLoadedPlacement, RoundRobinPlacement, NamespaceHashPlacement, WeightedPlacement)
+}
+
+// sortedCandidates returns a copy of the candidates sorted by instance and interface id, so all strategies start from
+// a stable order independent of the inventory.
+func sortedCandidates(candidates []PlacementCandidate) []PlacementCandidate {
+	result := append(make([]PlacementCandidate, 0, len(candidates)), candidates...)
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].InstanceID != result[j].InstanceID {
+			return result[i].InstanceID < result[j].InstanceID
+		}
+		return result[i].InterfaceID < result[j].InterfaceID
+	})
+	return result
+}
+
+var _ PlacementStrategy = &LeastLoadedStrategy{}
+
+// LeastLoadedStrategy prefers the network interface with the least IPs assigned.
+type LeastLoadedStrategy struct{}
+
+// Name returns the name of the strategy.
+func (s *LeastLoadedStrategy) Name() string {
+	return LeastLoadedPlacement
+}
+
+// Order sorts the candidates by the number of assigned IPs.
+func (s *LeastLoadedStrategy) Order(_ IPRequest, _ string, candidates []PlacementCandidate) []PlacementCandidate {
+	result := sortedCandidates(candidates)
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].IPCount < result[j].IPCount
+	})
+	return result
+}
+
+var _ PlacementStrategy = &RoundRobinStrategy{}
+
+// RoundRobinStrategy cycles through the network interfaces of every network.
+type RoundRobinStrategy struct {
+	mutex sync.Mutex
+	next  map[string]int // network -> index of the next candidate
+}
+
+// Name returns the name of the strategy.
+func (s *RoundRobinStrategy) Name() string {
+	return RoundRobinPlacement
+}
+
+// Order starts with the candidate after the one used last time for this network.
+func (s *RoundRobinStrategy) Order(_ IPRequest, network string, candidates []PlacementCandidate) []PlacementCandidate {
+	sorted := sortedCandidates(candidates)
+	if len(sorted) == 0 {
+		return sorted
+	}
+
+	s.mutex.Lock()
+	if s.next == nil {
+		s.next = make(map[string]int)
+	}
+	start := s.next[network] % len(sorted)
+	s.next[network] = start + 1
+	s.mutex.Unlock()
+
+	result := make([]PlacementCandidate, 0, len(sorted))
+	result = append(result, sorted[start:]...)
+	return append(result, sorted[:start]...)
+}
+
+var _ PlacementStrategy = &NamespaceHashStrategy{}
+
+// NamespaceHashStrategy places the IPs of a namespace on the same network interfaces as long as they are available.
+// It uses rendezvous hashing, so adding or removing nodes only moves the namespaces of the affected nodes. Requests
+// without a namespace are placed least-loaded.
+type NamespaceHashStrategy struct{}
+
+// Name returns the name of the strategy.
+func (s *NamespaceHashStrategy) Name() string {
+	return NamespaceHashPlacement
+}
+
+// Order sorts the candidates by their hash score for the namespace.
+func (s *NamespaceHashStrategy) Order(request IPRequest, network string, candidates []PlacementCandidate) []PlacementCandidate {
+	if request.Namespace == "" {
+		return (&LeastLoadedStrategy{}).Order(request, network, candidates)
+	}
+
+	result := sortedCandidates(candidates)
+	scores := make(map[string]uint64, len(result))
+	for _, candidate := range result {
+		scores[candidate.InterfaceID] = rendezvousScore(request.Namespace, candidate.InterfaceID)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return scores[result[i].InterfaceID] > scores[result[j].InterfaceID]
+	})
+	return result
+}
+
+func rendezvousScore(key string, candidate string) uint64 {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(key))
+	_, _ = hash.Write([]byte{0})
+	_, _ = hash.Write([]byte(candidate))
+	return hash.Sum64()
+}
+
+var _ PlacementStrategy = &WeightedStrategy{}
+
+// WeightedStrategy spreads the IPs relative to the size of the instances: an interface able to carry twice the IPs
+// gets twice the IPs. The IP capacity of the instance type is the weight. Candidates with unknown capacity are
+// weighted like the smallest known one.
+type WeightedStrategy struct{}
+
+// Name returns the name of the strategy.
+func (s *WeightedStrategy) Name() string {
+	return WeightedPlacement
+}
+
+// Order sorts the candidates by their relative load after the assignment.
+func (s *WeightedStrategy) Order(_ IPRequest, _ string, candidates []PlacementCandidate) []PlacementCandidate {
+	result := sortedCandidates(candidates)
+
+	smallest := 0
+	for _, candidate := range result {
+		if candidate.IPCapacity > 0 && (smallest == 0 || candidate.IPCapacity < smallest) {
+			smallest = candidate.IPCapacity
+		}
+	}
+	if smallest == 0 {
+		smallest = 1
+	}
+
+	load := func(candidate PlacementCandidate) float64 {
+		capacity := candidate.IPCapacity
+		if capacity <= 0 {
+			capacity = smallest
+		}
+		return float64(candidate.IPCount+1) / float64(capacity)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return load(result[i]) < load(result[j])
+	})
+	return result
+}
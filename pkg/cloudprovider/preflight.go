@@ -0,0 +1,69 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// The results of a single preflight check.
+const (
+	PreflightPassed     PreflightStatus = "passed"
+	PreflightFailed     PreflightStatus = "failed"
+	PreflightUnverified PreflightStatus = "unverified" // the check could not decide -- does not block the operator
+)
+
+// PreflightStatus is the result of a single preflight check.
+type PreflightStatus string
+
+// PreflightChecker is implemented by cloud providers able to check their configuration and permissions before the
+// operator starts working.
+type PreflightChecker interface {
+	Preflight(ctx context.Context) PreflightReport
+}
+
+// PreflightCheck is a single check of the startup report.
+type PreflightCheck struct {
+	Name    string // what has been checked (e.g. "ec2:DescribeInstances" or "region")
+	Status  PreflightStatus
+	Message string
+}
+
+// PreflightReport is the startup report of the cloud provider.
+type PreflightReport struct {
+	Checks []PreflightCheck
+}
+
+func (r *PreflightReport) add(name string, status PreflightStatus, message string, args ...interface{}) {
+	r.Checks = append(r.Checks, PreflightCheck{Name: name, Status: status, Message: fmt.Sprintf(message, args...)})
+}
+
+// Passed checks if no check of the report failed.
+func (r PreflightReport) Passed() bool {
+	return len(r.Failed()) == 0
+}
+
+// Failed returns the failed checks of the report.
+func (r PreflightReport) Failed() []PreflightCheck {
+	result := make([]PreflightCheck, 0)
+	for _, check := range r.Checks {
+		if check.Status == PreflightFailed {
+			result = append(result, check)
+		}
+	}
+	return result
+}
+
+// Error returns an error listing the failed checks -- nil if the report passed.
+func (r PreflightReport) Error() error {
+	failed := r.Failed()
+	if len(failed) == 0 {
+		return nil
+	}
+
+	messages := make([]string, len(failed))
+	for i, check := range failed {
+		messages[i] = check.Name + ": " + check.Message
+	}
+	return fmt.Errorf("preflight failed: %s", strings.Join(messages, "; "))
+}
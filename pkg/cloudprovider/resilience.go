@@ -0,0 +1,187 @@
+package cloudprovider
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without calling the cloud while the circuit breaker is open.
+var ErrCircuitOpen error = &UnavailableError{
+	Err: errors.New("circuit breaker is open: the cloud api failed repeatedly, calls are rejected for now"),
+}
+
+// The states of the circuit breaker. The values are exported as metric.
+const (
+	CircuitClosed   CircuitState = 0 // calls pass
+	CircuitHalfOpen CircuitState = 1 // a single trial call passes
+	CircuitOpen     CircuitState = 2 // calls are rejected
+)
+
+// CircuitState is the state of a circuit breaker.
+type CircuitState int
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "open"
+	}
+}
+
+// circuitBreaker -- opens after a number of consecutive failures and rejects calls for the open duration. After that a
+// single trial call is let through: its success closes the breaker, its failure opens it again.
+type circuitBreaker struct {
+	mutex sync.Mutex
+
+	failureThreshold int
+	openDuration     time.Duration
+
+	state    CircuitState
+	failures int       // consecutive failures
+	openedAt time.Time // time the breaker opened
+	trial    bool      // a trial call is running in half-open state
+
+	onChange func(state CircuitState)
+}
+
+func newCircuitBreaker(failureThreshold int, openDuration time.Duration, onChange func(state CircuitState)) *circuitBreaker {
+	return &circuitBreaker{
+		failureThreshold: failureThreshold,
+		openDuration:     openDuration,
+		onChange:         onChange,
+	}
+}
+
+// allow -- checks if a call may pass. Returns ErrCircuitOpen if not.
+func (b *circuitBreaker) allow() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.state == CircuitOpen && time.Since(b.openedAt) >= b.openDuration {
+		b.setState(CircuitHalfOpen)
+	}
+
+	switch b.state {
+	case CircuitOpen:
+		return ErrCircuitOpen
+	case CircuitHalfOpen:
+		if b.trial {
+			return ErrCircuitOpen
+		}
+		b.trial = true
+	}
+
+	return nil
+}
+
+// record -- records the outcome of a call that passed.
+func (b *circuitBreaker) record(success bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.trial = false
+
+	if success {
+		b.failures = 0
+		b.setState(CircuitClosed)
+		return
+	}
+
+	b.failures++
+	if b.state == CircuitHalfOpen || b.failures >= b.failureThreshold {
+		b.openedAt = time.Now()
+		b.setState(CircuitOpen)
+	}
+}
+
+// release -- ends a call that passed without an outcome (e.g. cancelled by the caller). The state is kept.
+func (b *circuitBreaker) release() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.trial = false
+}
+
+// current -- returns the state of the breaker.
+func (b *circuitBreaker) current() CircuitState {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.state
+}
+
+// setState -- the mutex needs to be held.
+func (b *circuitBreaker) setState(state CircuitState) {
+	if b.state == state {
+		return
+	}
+
+	b.state = state
+	if b.onChange != nil {
+		b.onChange(state)
+	}
+}
+
+// tokenBucket -- a rate limiter allowing bursts up to the size of the bucket. Tokens are refilled with the rate per
+// second.
+type tokenBucket struct {
+	mutex sync.Mutex
+
+	rate  float64 // tokens per second
+	burst float64 // size of the bucket
+
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// wait -- blocks until a token is available and takes it. Returns the error of the context if it is done before.
+func (t *tokenBucket) wait(ctx context.Context) error {
+	for {
+		delay := t.take()
+		if delay == 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// take -- takes a token if one is available. Otherwise the time until the next token is returned.
+func (t *tokenBucket) take() time.Duration {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+	t.tokens += now.Sub(t.last).Seconds() * t.rate
+	if t.tokens > t.burst {
+		t.tokens = t.burst
+	}
+	t.last = now
+
+	if t.tokens >= 1 {
+		t.tokens--
+		return 0
+	}
+
+	return time.Duration((1 - t.tokens) / t.rate * float64(time.Second))
+}
@@ -0,0 +1,165 @@
+package cloudprovider
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TagSelector selects cloud resources (instances, subnets) by their tags.
+//
+// The syntax is a list of alternatives separated by "||". Each alternative is a list of requirements separated by ",".
+// A resource matches if all requirements of at least one alternative match. A requirement is one of:
+//
+//	key            -- the tag exists
+//	!key           -- the tag does not exist
+//	key=v1|v2      -- the tag exists and has one of the values
+//	key!=v1|v2     -- the tag does not exist or has none of the values
+//
+// Example: "ClusterNode=WorkerNode,!egress-disabled || egress=true"
+//
+// An empty selector matches every resource.
+type TagSelector struct {
+	source       string
+	alternatives [][]tagRequirement
+}
+
+type tagOperator int
+
+const (
+	tagExists tagOperator = iota
+	tagNotExists
+	tagIn
+	tagNotIn
+)
+
+type tagRequirement struct {
+	key      string
+	operator tagOperator
+	values   []string
+}
+
+// ParseTagSelector parses the selector. See TagSelector for the syntax.
+func ParseTagSelector(selector string) (*TagSelector, error) {
+	result := &TagSelector{
+		source:       strings.TrimSpace(selector),
+		alternatives: make([][]tagRequirement, 0),
+	}
+
+	if result.source == "" {
+		return result, nil
+	}
+
+	for _, alternative := range strings.Split(result.source, "||") {
+		requirements := make([]tagRequirement, 0)
+
+		for _, term := range strings.Split(alternative, ",") {
+			requirement, err := parseTagRequirement(strings.TrimSpace(term))
+			if err != nil {
+				return nil, fmt.Errorf("invalid tag selector '%s': %v", selector, err)
+			}
+
+			requirements = append(requirements, requirement)
+		}
+
+		result.alternatives = append(result.alternatives, requirements)
+	}
+
+	return result, nil
+}
+
+func parseTagRequirement(term string) (tagRequirement, error) {
+	var result tagRequirement
+
+	switch {
+	case term == "":
+		return result, fmt.Errorf("empty requirement")
+	case strings.HasPrefix(term, "!"):
+		result = tagRequirement{key: strings.TrimSpace(term[1:]), operator: tagNotExists}
+		if strings.Contains(result.key, "=") {
+			return result, fmt.Errorf("requirement '%s' mixes negation and value", term)
+		}
+	case strings.Contains(term, "!="):
+		parts := strings.SplitN(term, "!=", 2)
+		result = tagRequirement{key: strings.TrimSpace(parts[0]), operator: tagNotIn, values: splitTagValues(parts[1])}
+	case strings.Contains(term, "="):
+		parts := strings.SplitN(term, "=", 2)
+		result = tagRequirement{key: strings.TrimSpace(parts[0]), operator: tagIn, values: splitTagValues(parts[1])}
+	default:
+		result = tagRequirement{key: term, operator: tagExists}
+	}
+
+	if result.key == "" {
+		return result, fmt.Errorf("requirement '%s' has no tag key", term)
+	}
+
+	return result, nil
+}
+
+func splitTagValues(values string) []string {
+	result := strings.Split(values, "|")
+	for i, value := range result {
+		result[i] = strings.TrimSpace(value)
+	}
+	return result
+}
+
+// Matches checks if the tags match the selector.
+func (s *TagSelector) Matches(tags map[string]string) bool {
+	if s == nil || len(s.alternatives) == 0 {
+		return true
+	}
+
+	for _, requirements := range s.alternatives {
+		if matchesAll(requirements, tags) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchesAll(requirements []tagRequirement, tags map[string]string) bool {
+	for _, requirement := range requirements {
+		if !requirement.matches(tags) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r tagRequirement) matches(tags map[string]string) bool {
+	value, found := tags[r.key]
+
+	switch r.operator {
+	case tagExists:
+		return found
+	case tagNotExists:
+		return !found
+	case tagIn:
+		return found && containsString(r.values, value)
+	case tagNotIn:
+		return !found || !containsString(r.values, value)
+	}
+
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// String returns the selector as it has been parsed.
+func (s *TagSelector) String() string {
+	if s == nil {
+		return ""
+	}
+
+	return s.source
+}
@@ -0,0 +1,471 @@
+package cloudprovider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/klenkes74/aws-egressip-operator/pkg/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	"net"
+	"net/http"
+	"os"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const defaultWarmPoolRefillPeriod = 30 * time.Second
+
+var warmPoolLog = logger.Log.WithName("Warm-pool")
+
+var (
+	warmPoolMetrics   sync.Once
+	warmPoolSize      prometheus.Gauge
+	warmPoolAvailable *prometheus.GaugeVec
+)
+
+var _ CloudProvider = &WarmPool{}
+var _ RecordingIPAssigner = &WarmPool{}
+
+// WarmPool keeps a number of unclaimed random IPv4 addresses in every subnet, already assigned to the nodes by the
+// wrapped cloud provider. AddRandomIPs hands them out without calling the cloud and the pool is refilled in the
+// background. Requests the pool can't serve completely (e.g. IPv6 or an empty pool) are passed to the wrapped cloud
+// provider, as are all other calls.
+type WarmPool struct {
+	CloudProvider
+
+	size         int           // number of unclaimed IPs kept per subnet
+	refillPeriod time.Duration // period of the background refill
+
+	mutex   sync.Mutex
+	ips     []warmIP          // the unclaimed IPs in the order they were added
+	subnets map[string]string // subnet id -> failure zone of all subnets the pool has filled
+
+	refillMutex sync.Mutex
+	refill      chan struct{} // triggers a refill after IPs have been claimed
+}
+
+// warmIP is an unclaimed IP of the pool.
+type warmIP struct {
+	instanceID string
+	ip         *net.IP
+	subnet     string
+}
+
+// WarmPoolFromEnvironment wraps the cloud provider in a warm pool if WARM_POOL_SIZE is set to a positive number. The
+// period of the background refill is read from WARM_POOL_REFILL_PERIOD.
+func WarmPoolFromEnvironment(cloud CloudProvider) CloudProvider {
+	value, found := os.LookupEnv("WARM_POOL_SIZE")
+	if !found {
+		return cloud
+	}
+
+	size, err := strconv.Atoi(value)
+	if err != nil || size < 0 {
+		warmPoolLog.Error(fmt.Errorf("WARM_POOL_SIZE '%s' is no valid number", value), "warm pool is disabled")
+		return cloud
+	}
+	if size == 0 {
+		return cloud
+	}
+
+	refillPeriod := defaultWarmPoolRefillPeriod
+	if value, found := os.LookupEnv("WARM_POOL_REFILL_PERIOD"); found {
+		refillPeriod, err = time.ParseDuration(value)
+		if err != nil || refillPeriod <= 0 {
+			warmPoolLog.Error(fmt.Errorf("WARM_POOL_REFILL_PERIOD '%s' is no valid positive duration", value),
+				"using default", "refill-period", defaultWarmPoolRefillPeriod)
+			refillPeriod = defaultWarmPoolRefillPeriod
+		}
+	}
+
+	return NewWarmPool(cloud, size, refillPeriod)
+}
+
+// NewWarmPool wraps the cloud provider in a pool keeping size unclaimed IPs per subnet. The pool is empty until the
+// first refill.
+func NewWarmPool(cloud CloudProvider, size int, refillPeriod time.Duration) *WarmPool {
+	warmPoolMetrics.Do(registerWarmPoolMetrics)
+	warmPoolSize.Set(float64(size))
+
+	return &WarmPool{
+		CloudProvider: cloud,
+		size:          size,
+		refillPeriod:  refillPeriod,
+		subnets:       make(map[string]string),
+		refill:        make(chan struct{}, 1),
+	}
+}
+
+func registerWarmPoolMetrics() {
+	warmPoolSize = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "egressip",
+			Name:      "warm_pool_size",
+			Help:      "Number of unclaimed egress ips the warm pool keeps per subnet",
+		},
+	)
+	warmPoolAvailable = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "egressip",
+			Name:      "warm_pool_available",
+			Help:      "Number of unclaimed egress ips in the warm pool",
+		},
+		[]string{"subnet", "zone"},
+	)
+
+	for _, collector := range []prometheus.Collector{warmPoolSize, warmPoolAvailable} {
+		err := metrics.Registry.Register(collector)
+		if err != nil {
+			warmPoolLog.Error(err, "Can't register the warm pool gauge")
+		}
+	}
+}
+
+// AddRandomIPs hands out unclaimed IPs of the pool -- one in every subnet of the zones selected by the request. If the
+// pool can't serve the request completely, the wrapped cloud provider adds the IPs.
+func (p *WarmPool) AddRandomIPs(ctx context.Context, request IPRequest) ([]string, []*net.IP, error) {
+	return p.addRandomIPs(ctx, request, nil)
+}
+
+// AddRandomIPsRecorded hands out the IPs like AddRandomIPs and records every IP. The IPs added by the wrapped cloud
+// provider are recorded one by one if it is able to.
+func (p *WarmPool) AddRandomIPsRecorded(ctx context.Context, request IPRequest, record IPRecorder) ([]string, []*net.IP, error) {
+	return p.addRandomIPs(ctx, request, record)
+}
+
+// addRandomIPs -- hands out the IPs and records them if there is a recorder. The claimed IPs are not protected by the
+// pool anymore, if one can't be recorded all of them are returned together with the error.
+func (p *WarmPool) addRandomIPs(ctx context.Context, request IPRequest, record IPRecorder) ([]string, []*net.IP, error) {
+	instanceIDs, ips, found := p.claim(request)
+	if !found {
+		warmPoolLog.Info("warm pool can't serve the request - adding the ips directly",
+			"namespace", request.Namespace,
+			"ip-families", request.IPFamilies(),
+		)
+		if assigner, ok := p.CloudProvider.(RecordingIPAssigner); ok && record != nil {
+			return assigner.AddRandomIPsRecorded(ctx, request, record)
+		}
+		return p.CloudProvider.AddRandomIPs(ctx, request)
+	}
+
+	select {
+	case p.refill <- struct{}{}:
+	default:
+	}
+
+	warmPoolLog.Info("claimed ips from the warm pool",
+		"namespace", request.Namespace,
+		"instances", instanceIDs,
+		"ips", ips,
+	)
+
+	if record == nil {
+		return instanceIDs, ips, nil
+	}
+	for i := range instanceIDs {
+		if err := record(instanceIDs[i], ips[i]); err != nil {
+			return instanceIDs, ips, fmt.Errorf("can not record claimed ip '%s' of instance '%s': %v", ips[i], instanceIDs[i], err)
+		}
+	}
+	return instanceIDs, ips, nil
+}
+
+// claim -- takes one IP of every subnet in the selected zones out of the pool. Nothing is taken if any is missing.
+func (p *WarmPool) claim(request IPRequest) ([]string, []*net.IP, bool) {
+	families := request.IPFamilies()
+	if len(families) != 1 || families[0] != IPv4 {
+		return nil, nil, false
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if len(p.subnets) == 0 {
+		return nil, nil, false
+	}
+
+	zones, err := request.SelectZones(p.zones())
+	if err != nil {
+		return nil, nil, false
+	}
+
+	claimed := make(map[int]bool)
+	instanceIDs := make([]string, 0, len(p.subnets))
+	ips := make([]*net.IP, 0, len(p.subnets))
+	for _, zone := range zones {
+		for _, subnet := range p.subnetsInZone(zone) {
+			index := p.unclaimedIn(subnet, claimed)
+			if index < 0 {
+				return nil, nil, false
+			}
+
+			claimed[index] = true
+			instanceIDs = append(instanceIDs, p.ips[index].instanceID)
+			ips = append(ips, p.ips[index].ip)
+		}
+	}
+
+	remaining := make([]warmIP, 0, len(p.ips))
+	for i, ip := range p.ips {
+		if !claimed[i] {
+			remaining = append(remaining, ip)
+		}
+	}
+	p.ips = remaining
+	p.updateMetrics()
+
+	return instanceIDs, ips, true
+}
+
+func (p *WarmPool) zones() []string {
+	result := make([]string, 0, len(p.subnets))
+	for _, zone := range p.subnets {
+		result = append(result, zone)
+	}
+	return result
+}
+
+func (p *WarmPool) subnetsInZone(zone string) []string {
+	result := make([]string, 0)
+	for subnet, z := range p.subnets {
+		if z == zone {
+			result = append(result, subnet)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func (p *WarmPool) unclaimedIn(subnet string, claimed map[int]bool) int {
+	for i, ip := range p.ips {
+		if ip.subnet == subnet && !claimed[i] {
+			return i
+		}
+	}
+	return -1
+}
+
+func (p *WarmPool) countIn(subnet string) int {
+	result := 0
+	for _, ip := range p.ips {
+		if ip.subnet == subnet {
+			result++
+		}
+	}
+	return result
+}
+
+// Unclaimed returns the IPs waiting in the pool. They are assigned to the nodes but not used by any namespace.
+func (p *WarmPool) Unclaimed() []*net.IP {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	result := make([]*net.IP, len(p.ips))
+	for i, ip := range p.ips {
+		result[i] = ip.ip
+	}
+	return result
+}
+
+// Refill adds random IPs until every subnet holds the configured number of unclaimed IPs. The first refill adds IPs in
+// all subnets, later ones only in the zones missing IPs.
+func (p *WarmPool) Refill(ctx context.Context) error {
+	p.refillMutex.Lock()
+	defer p.refillMutex.Unlock()
+
+	for round := 0; round < p.size; round++ {
+		request, needed := p.refillRequest()
+		if !needed {
+			break
+		}
+
+		instanceIDs, ips, err := p.CloudProvider.AddRandomIPs(ctx, request)
+		p.add(ctx, instanceIDs, ips)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	warmPoolLog.Info("refilled warm pool",
+		"size", p.size,
+		"unclaimed", len(p.Unclaimed()),
+	)
+	return nil
+}
+
+// refillRequest -- returns the request for the zones with subnets below the pool size.
+func (p *WarmPool) refillRequest() (IPRequest, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if len(p.subnets) == 0 {
+		return IPRequest{}, true
+	}
+
+	var zones []string
+	for subnet, zone := range p.subnets {
+		if p.countIn(subnet) < p.size && !containsZone(zones, zone) {
+			zones = append(zones, zone)
+		}
+	}
+	sort.Strings(zones)
+
+	return IPRequest{Zones: zones}, len(zones) > 0
+}
+
+// add -- puts the newly assigned IPs into the pool. The subnet of an IP is read from the network interface carrying it.
+func (p *WarmPool) add(ctx context.Context, instanceIDs []string, ips []*net.IP) {
+	for i, instanceID := range instanceIDs {
+		if ips[i] == nil {
+			continue
+		}
+
+		instance, err := p.CloudProvider.Instance(ctx, instanceID)
+		if err != nil {
+			warmPoolLog.Error(err, "can't read the instance of a new ip - leaving it out of the pool",
+				"instance-id", instanceID,
+				"ip", ips[i],
+			)
+			continue
+		}
+
+		subnet := subnetOfIP(*instance, ips[i])
+
+		p.mutex.Lock()
+		p.ips = append(p.ips, warmIP{instanceID: instanceID, ip: ips[i], subnet: subnet})
+		p.subnets[subnet] = (*instance).FailureZone()
+		p.mutex.Unlock()
+	}
+
+	p.mutex.Lock()
+	p.updateMetrics()
+	p.mutex.Unlock()
+}
+
+// subnetOfIP -- returns the network of the interface carrying the IP.
+func subnetOfIP(instance CloudInstance, ip *net.IP) string {
+	for _, networkInterface := range instance.NetworkInterfaces() {
+		for _, secondary := range networkInterface.SecondaryIps() {
+			if secondary.Equal(*ip) {
+				return networkInterface.Network()
+			}
+		}
+	}
+
+	return instance.FailureZone()
+}
+
+// updateMetrics -- the mutex needs to be held.
+func (p *WarmPool) updateMetrics() {
+	warmPoolAvailable.Reset()
+	for subnet, zone := range p.subnets {
+		warmPoolAvailable.WithLabelValues(subnet, zone).Set(float64(p.countIn(subnet)))
+	}
+}
+
+// HealthCheck reports the health of the wrapped cloud provider.
+func (p *WarmPool) HealthCheck(req *http.Request) error {
+	if checker, ok := p.CloudProvider.(HealthChecker); ok {
+		return checker.HealthCheck(req)
+	}
+
+	return nil
+}
+
+// Preflight runs the preflight of the wrapped cloud provider. Providers without preflight pass.
+func (p *WarmPool) Preflight(ctx context.Context) PreflightReport {
+	if checker, ok := p.CloudProvider.(PreflightChecker); ok {
+		return checker.Preflight(ctx)
+	}
+
+	return PreflightReport{}
+}
+
+// ValidateSpecifiedIPs runs the validation of the wrapped cloud provider. Providers without validation accept all IPs.
+func (p *WarmPool) ValidateSpecifiedIPs(ctx context.Context, request IPRequest, ips []*net.IP) error {
+	if validator, ok := p.CloudProvider.(IPValidator); ok {
+		return validator.ValidateSpecifiedIPs(ctx, request, ips)
+	}
+
+	return nil
+}
+
+// Resync resyncs the cache of the wrapped cloud provider. Providers without cache have nothing to resync.
+func (p *WarmPool) Resync(ctx context.Context) error {
+	if syncer, ok := p.CloudProvider.(InventorySyncer); ok {
+		return syncer.Resync(ctx)
+	}
+
+	return nil
+}
+
+// EgressNodes lists the egress nodes of the wrapped cloud provider. Providers without the list return an error.
+func (p *WarmPool) EgressNodes(ctx context.Context) ([]*CloudInstance, error) {
+	if lister, ok := p.CloudProvider.(EgressNodeLister); ok {
+		return lister.EgressNodes(ctx)
+	}
+
+	return nil, errors.New("the cloud provider can't list its egress nodes")
+}
+
+// Start refills the pool periodically and whenever IPs have been claimed. A wrapped cloud provider with background
+// work of its own is started, too. On stop a running refill is cancelled and the unclaimed IPs are removed from the
+// nodes.
+func (p *WarmPool) Start(stop <-chan struct{}) error {
+	if runnable, ok := p.CloudProvider.(interface{ Start(<-chan struct{}) error }); ok {
+		go func() {
+			if err := runnable.Start(stop); err != nil {
+				warmPoolLog.Error(err, "background work of the cloud provider failed")
+			}
+		}()
+	}
+
+	ctx, cancel := contextOfStop(stop)
+	defer cancel()
+
+	warmPoolLog.Info("starting warm pool",
+		"size", p.size,
+		"refill-period", p.refillPeriod,
+	)
+
+	ticker := time.NewTicker(p.refillPeriod)
+	defer ticker.Stop()
+
+	for {
+		if err := p.Refill(ctx); err != nil {
+			warmPoolLog.Error(err, "refilling the warm pool failed")
+		}
+
+		select {
+		case <-stop:
+			p.Drain(context.Background())
+			warmPoolLog.Info("stopped warm pool")
+			return nil
+		case <-ticker.C:
+		case <-p.refill:
+		}
+	}
+}
+
+// Drain removes all unclaimed IPs from the nodes and empties the pool.
+func (p *WarmPool) Drain(ctx context.Context) {
+	p.mutex.Lock()
+	drained := p.ips
+	p.ips = nil
+	p.updateMetrics()
+	p.mutex.Unlock()
+
+	for _, ip := range drained {
+		_, err := p.CloudProvider.RemoveIP(ctx, ip.ip)
+		if err != nil {
+			warmPoolLog.Error(err, "can't remove unclaimed ip of the warm pool",
+				"instance-id", ip.instanceID,
+				"ip", ip.ip,
+			)
+		}
+	}
+}
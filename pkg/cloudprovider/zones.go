@@ -0,0 +1,97 @@
+package cloudprovider
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ParseZones parses a comma separated list of failure zones (e.g. "eu-central-1a,eu-central-1b"). The order is kept
+// since it is the preferred order of the zones. Duplicates are dropped, an empty list returns nil.
+func ParseZones(zones string) []string {
+	var result []string
+
+	for _, zone := range strings.Split(zones, ",") {
+		zone = strings.TrimSpace(zone)
+		if zone == "" || containsZone(result, zone) {
+			continue
+		}
+
+		result = append(result, zone)
+	}
+
+	return result
+}
+
+// SelectZones returns the failure zones random IPs are added in. The zones of the request are used in their preferred
+// order, without zones all available zones are used in alphabetical order. A zone count limits the result to the first
+// zones. It is an error if a requested zone is not available or fewer zones than the zone count are available.
+func (r IPRequest) SelectZones(available []string) ([]string, error) {
+	sorted := make([]string, 0, len(available))
+	for _, zone := range available {
+		if !containsZone(sorted, zone) {
+			sorted = append(sorted, zone)
+		}
+	}
+	sort.Strings(sorted)
+
+	result := sorted
+	if len(r.Zones) > 0 {
+		result = make([]string, 0, len(r.Zones))
+		for _, zone := range r.Zones {
+			if !containsZone(sorted, zone) {
+				return nil, fmt.Errorf("zone '%s' is not available (available: %s)", zone, strings.Join(sorted, ", "))
+			}
+
+			result = append(result, zone)
+		}
+	}
+
+	if r.ZoneCount > 0 {
+		if r.ZoneCount > len(result) {
+			return nil, fmt.Errorf("%d zones requested but only %d are available (%s)",
+				r.ZoneCount, len(result), strings.Join(result, ", "))
+		}
+
+		result = result[:r.ZoneCount]
+	}
+
+	return result, nil
+}
+
+// FailoverZones returns the failure zones a replacement for an IP of the failed zone is added in. The zones of the
+// request come first in their preferred order, the other available zones follow in alphabetical order. The failed zone
+// is never returned.
+func (r IPRequest) FailoverZones(available []string, failed string) []string {
+	sorted := make([]string, 0, len(available))
+	for _, zone := range available {
+		if zone != failed && !containsZone(sorted, zone) {
+			sorted = append(sorted, zone)
+		}
+	}
+	sort.Strings(sorted)
+
+	result := make([]string, 0, len(sorted))
+	for _, zone := range r.Zones {
+		if containsZone(sorted, zone) && !containsZone(result, zone) {
+			result = append(result, zone)
+		}
+	}
+	for _, zone := range sorted {
+		if !containsZone(result, zone) {
+			result = append(result, zone)
+		}
+	}
+
+	return result
+}
+
+func containsZone(zones []string, zone string) bool {
+	for _, z := range zones {
+		if z == zone {
+			return true
+		}
+	}
+
+	return false
+}
@@ -7,20 +7,40 @@ import (
 
 var cloud *cloudprovider.CloudProvider
 
-func init() {
-	cloud = cloudprovider.CreateCloudProvider()
+// CloudProvider returns the cloud provider shared by all controllers. It is created by AddToManager.
+func CloudProvider() cloudprovider.CloudProvider {
+	return *cloud
 }
 
 // AddToManagerFuncs is a list of functions to add all Controllers to the Manager
 var AddToManagerFuncs []func(manager.Manager, *cloudprovider.CloudProvider) error
 
-// AddToManager adds all Controllers to the Manager
+// AddToManager creates the cloud provider and adds all Controllers to the Manager. A missing or invalid configuration
+// of the cloud provider is returned as error.
 func AddToManager(m manager.Manager) error {
+	var err error
+	if cloud, err = cloudprovider.CreateCloudProvider(); err != nil {
+		return err
+	}
 
 	for _, f := range AddToManagerFuncs {
 		if err := f(m, cloud); err != nil {
 			return err
 		}
 	}
+
+	// cloud providers with background work (e.g. the inventory resync of AWS) are run by the manager.
+	if runnable, ok := (*cloud).(manager.Runnable); ok {
+		if err := m.Add(runnable); err != nil {
+			return err
+		}
+	}
+
+	// the operator is not ready while the cloud provider rejects calls (e.g. the circuit breaker of AWS is open).
+	if checker, ok := (*cloud).(cloudprovider.HealthChecker); ok {
+		if err := m.AddReadyzCheck("cloud-provider", checker.HealthCheck); err != nil {
+			return err
+		}
+	}
 	return nil
 }
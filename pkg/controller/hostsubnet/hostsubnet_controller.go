@@ -2,6 +2,7 @@ package hostsubnet
 
 //goland:noinspection SpellCheckingInspection
 import (
+	"context"
 	"fmt"
 	"github.com/go-logr/logr"
 	"github.com/klenkes74/aws-egressip-operator/pkg/cloudprovider"
@@ -10,7 +11,6 @@ import (
 	"github.com/klenkes74/aws-egressip-operator/pkg/openshift"
 	corev1 "github.com/openshift/api/network/v1"
 	"github.com/redhat-cop/operator-utils/pkg/util"
-	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/types"
 	"net"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
@@ -20,6 +20,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
+	"time"
 )
 
 //goland:noinspection SpellCheckingInspection
@@ -39,6 +40,8 @@ type reconcileHostSubnet struct {
 	cloud    cloudprovider.CloudProvider
 	handler  openshift.EgressIPHandler
 	alarming observability.AlarmStore
+
+	timeout time.Duration // time limit of a single reconcile
 }
 
 // Add creates a new Namespace Controller and adds it to the Manager. The Manager will set fields on the Controller
@@ -55,6 +58,7 @@ func newReconciler(mgr manager.Manager, cloud *cloudprovider.CloudProvider) reco
 		cloud:          *cloud,
 		handler:        *openshift.NewEgressIPHandler(*cloud, *openshift.NewOcpClient(mgr.GetClient())),
 		alarming:       *observability.NewAlarmStore(),
+		timeout:        openshift.ReconcileTimeout(),
 	}
 }
 
@@ -95,7 +99,10 @@ func (r *reconcileHostSubnet) Reconcile(request reconcile.Request) (reconcile.Re
 	reqLogger := log.WithValues("instance", request.Name)
 	reqLogger.Info("Reconciling hostSubnet")
 
-	instance, done, err := r.loadHostSubnet(request.NamespacedName, reqLogger)
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	instance, done, err := r.loadHostSubnet(ctx, request.NamespacedName, reqLogger)
 	if done {
 		reqLogger.Info("stop reconcilation of hostSubnet")
 		return reconcile.Result{}, nil
@@ -106,20 +113,30 @@ func (r *reconcileHostSubnet) Reconcile(request reconcile.Request) (reconcile.Re
 		return reconcile.Result{}, err
 	}
 
+	// a redistribution left over by a stopped operator is rolled back before anything else is done.
+	recovered, err := r.handler.RecoverHostSubnetIntent(ctx, instance)
+	if err != nil {
+		reqLogger.Error(err, "could not roll back the leftover intent of the hostSubnet")
+		return reconcile.Result{}, err
+	}
+	if recovered {
+		reqLogger.Info("rolled back the leftover intent of the hostSubnet")
+	}
+
 	var changed bool
 
 	if !util.IsBeingDeleted(instance) {
-		changed, err = r.updateHostSubnet(instance, reqLogger, changed)
+		changed, err = r.updateHostSubnet(ctx, instance, reqLogger, changed)
 		if err != nil {
 			return reconcile.Result{}, err
 		}
 	} else {
-		changed, err = r.deleteHostSubnet(instance, reqLogger, changed)
+		owners := ipOwners(instance, r.handler.ReadIpsFromHostSubnet(instance))
+		changed, err = r.deleteHostSubnet(ctx, instance, reqLogger, changed)
 		if err != nil {
 			for _, ip := range instance.EgressIPs {
-				namespace := instance.GetAnnotations()[openshift.IPToNamespaceAnnotation+ip]
 				alarmIP := net.ParseIP(ip)
-				r.alarming.AddAlarm(namespace, []*net.IP{&alarmIP})
+				r.alarming.AddAlarm(owners[alarmIP.String()], []*net.IP{&alarmIP})
 			}
 
 			return reconcile.Result{}, err
@@ -127,7 +144,7 @@ func (r *reconcileHostSubnet) Reconcile(request reconcile.Request) (reconcile.Re
 	}
 
 	if changed {
-		err = r.handler.SaveHostSubnet(instance)
+		err = r.handler.SaveHostSubnet(ctx, instance)
 		if err != nil {
 			reqLogger.Error(err, "could not save hostSubnet")
 			return reconcile.Result{}, err
@@ -137,20 +154,21 @@ func (r *reconcileHostSubnet) Reconcile(request reconcile.Request) (reconcile.Re
 	return reconcile.Result{}, nil
 }
 
-func (r *reconcileHostSubnet) updateHostSubnet(instance *corev1.HostSubnet, reqLogger logr.Logger, changed bool) (bool, error) {
+func (r *reconcileHostSubnet) updateHostSubnet(ctx context.Context, instance *corev1.HostSubnet, reqLogger logr.Logger, changed bool) (bool, error) {
 	ips := r.handler.ReadIpsFromHostSubnet(instance)
 
 	changed = r.addFinalizer(instance, reqLogger) || changed
 
-	err := r.handler.CheckIPsForHost(instance, ips)
+	err := r.handler.CheckIPsForHost(ctx, instance, ips)
 	if err != nil {
 		reqLogger.Error(err, "problems with IPs. need to redistribute IPs")
-		_, err = r.handler.RedistributeIPsFromHost(instance)
+		owners := ipOwners(instance, ips)
+		_, err = r.redistributeIPs(ctx, instance, reqLogger)
 
 		if err != nil {
-			r.raiseAlarmForIPs(instance, ips)
+			r.raiseAlarmForIPs(owners, ips)
 		} else {
-			r.cancelAlarmforIPs(instance, ips)
+			r.cancelAlarmforIPs(owners, ips)
 		}
 
 		changed = true
@@ -159,11 +177,28 @@ func (r *reconcileHostSubnet) updateHostSubnet(instance *corev1.HostSubnet, reqL
 	return changed, err
 }
 
-func (r *reconcileHostSubnet) loadHostSubnet(name types.NamespacedName, reqLogger logr.Logger) (*corev1.HostSubnet, bool, error) {
+// redistributeIPs -- moves the IPs of the hostSubnet to other hosts. The IPs of a gone instance have been freed by the
+// cloud already, they are reclaimed instead.
+func (r *reconcileHostSubnet) redistributeIPs(ctx context.Context, instance *corev1.HostSubnet, reqLogger logr.Logger) (map[string]string, error) {
+	gone, err := r.handler.HostInstanceGone(ctx, instance)
+	if err != nil {
+		reqLogger.Error(err, "could not check the instance of the hostSubnet")
+		return nil, err
+	}
+
+	if gone {
+		reqLogger.Info("the instance of the hostSubnet is gone - reclaiming its ips")
+		return r.handler.ReclaimIPsFromTerminatedHost(ctx, instance)
+	}
+
+	return r.handler.RedistributeIPsFromHost(ctx, instance)
+}
+
+func (r *reconcileHostSubnet) loadHostSubnet(ctx context.Context, name types.NamespacedName, reqLogger logr.Logger) (*corev1.HostSubnet, bool, error) {
 	// Fetch the Namespace instance
-	instance, err := r.handler.LoadHostSubnet(name.Name)
+	instance, err := r.handler.LoadHostSubnet(ctx, name.Name)
 	if err != nil {
-		if errors.IsNotFound(err) {
+		if openshift.IsNotFound(err) {
 			reqLogger.Error(err, "can not find the object. Is already deleted. Don't requeue this request")
 			// Request object not found, could have been deleted after reconcile request.
 			// Owned objects are automatically garbage collected. For additional cleanup logic use finalizers.
@@ -184,7 +219,7 @@ func (r *reconcileHostSubnet) loadHostSubnet(name types.NamespacedName, reqLogge
 	return instance, false, nil
 }
 
-func (r *reconcileHostSubnet) deleteHostSubnet(instance *corev1.HostSubnet, reqLogger logr.Logger, changed bool) (bool, error) {
+func (r *reconcileHostSubnet) deleteHostSubnet(ctx context.Context, instance *corev1.HostSubnet, reqLogger logr.Logger, changed bool) (bool, error) {
 	ips := r.handler.ReadIpsFromHostSubnet(instance)
 
 	reqLogger.Info("reconciling deleted host subnet",
@@ -198,7 +233,8 @@ func (r *reconcileHostSubnet) deleteHostSubnet(instance *corev1.HostSubnet, reqL
 			"ips", ips,
 		)
 
-		distribution, err := r.handler.RedistributeIPsFromHost(instance)
+		owners := ipOwners(instance, ips)
+		distribution, err := r.redistributeIPs(ctx, instance, reqLogger)
 		if err != nil {
 			reqLogger.Error(err,
 				"redistribution of IPs failed. Egress networking will cease working for projects if the other hosts are also failing",
@@ -206,12 +242,12 @@ func (r *reconcileHostSubnet) deleteHostSubnet(instance *corev1.HostSubnet, reqL
 				"egress-ips", ips,
 			)
 
-			r.raiseAlarmForIPs(instance, ips)
+			r.raiseAlarmForIPs(owners, ips)
 
 			return changed, err
 		}
 
-		r.cancelAlarmforIPs(instance, ips)
+		r.cancelAlarmforIPs(owners, ips)
 		for ip, host := range distribution {
 			reqLogger.Info("redistributed IP",
 				"ip", ip,
@@ -248,16 +284,24 @@ func (r *reconcileHostSubnet) removeFinalizer(instance *corev1.HostSubnet, reqLo
 	return result
 }
 
-func (r *reconcileHostSubnet) raiseAlarmForIPs(instance *corev1.HostSubnet, ips []*net.IP) {
+// ipOwners -- returns the namespaces owning the IPs with key=ip. The redistribution removes the IP-to-namespace
+// annotations together with the IPs, so the owners are read before.
+func ipOwners(instance *corev1.HostSubnet, ips []*net.IP) map[string]string {
+	result := make(map[string]string, len(ips))
+	for _, ip := range ips {
+		result[ip.String()] = instance.GetAnnotations()[openshift.IPToNamespaceAnnotation+ip.String()]
+	}
+	return result
+}
+
+func (r *reconcileHostSubnet) raiseAlarmForIPs(owners map[string]string, ips []*net.IP) {
 	for _, ip := range ips {
-		namespace := instance.GetAnnotations()[openshift.IPToNamespaceAnnotation+ip.String()]
-		r.alarming.AddAlarm(namespace, []*net.IP{ip})
+		r.alarming.AddAlarm(owners[ip.String()], []*net.IP{ip})
 	}
 }
 
-func (r *reconcileHostSubnet) cancelAlarmforIPs(instance *corev1.HostSubnet, ips []*net.IP) {
+func (r *reconcileHostSubnet) cancelAlarmforIPs(owners map[string]string, ips []*net.IP) {
 	for _, ip := range ips {
-		namespace := instance.GetAnnotations()[openshift.IPToNamespaceAnnotation+ip.String()]
-		r.alarming.RemoveAlarmForIP(namespace, ip)
+		r.alarming.RemoveAlarmForIP(owners[ip.String()], ip)
 	}
 }
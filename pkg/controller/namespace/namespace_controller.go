@@ -1,8 +1,10 @@
 package namespace
 
 import (
+	"context"
 	"fmt"
 	"github.com/go-logr/logr"
+	"github.com/hashicorp/go-multierror"
 	"github.com/klenkes74/aws-egressip-operator/pkg/cloudprovider"
 	"github.com/klenkes74/aws-egressip-operator/pkg/logger"
 	"github.com/klenkes74/aws-egressip-operator/pkg/observability"
@@ -11,8 +13,9 @@ import (
 	"github.com/redhat-cop/egressip-ipam-operator/pkg/controller/egressipam"
 	"github.com/redhat-cop/operator-utils/pkg/util"
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/tools/record"
 	"net"
+	"reflect"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
@@ -21,11 +24,15 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 	"strings"
+	"time"
 )
 
 const controllerName = "namespace-controller"
 const finalizerName = "egressip-ipam-operator.redhat-cop.io/namespace-handler"
 
+// time until a namespace with IPs failed over to other zones is checked again for returning them.
+const failoverRecheckPeriod = 5 * time.Minute
+
 var log = logger.Log.WithName(controllerName)
 
 var _ reconcile.Reconciler = &reconcileNamespace{}
@@ -36,6 +43,8 @@ type reconcileNamespace struct {
 	cloud    *cloudprovider.CloudProvider
 	handler  openshift.EgressIPHandler
 	alarming observability.AlarmStore
+
+	timeout time.Duration // time limit of a single reconcile
 }
 
 // Add creates a new Namespace Controller and adds it to the Manager. The Manager will set fields on the Controller
@@ -53,6 +62,18 @@ func newReconciler(mgr manager.Manager, cloud *cloudprovider.CloudProvider) reco
 		cloud:          cloud,
 		handler:        *openshift.NewEgressIPHandler(*cloud, *openshift.NewOcpClient(mgr.GetClient())),
 		alarming:       *observability.NewAlarmStore(),
+		timeout:        openshift.ReconcileTimeout(),
+	}
+}
+
+// NewReconciler returns the reconciler of the namespaces working on the infrastructure with the given handler. The
+// events are sent to the recorder.
+func NewReconciler(handler openshift.EgressIPHandler, recorder record.EventRecorder) reconcile.Reconciler {
+	return &reconcileNamespace{
+		ReconcilerBase: util.NewReconcilerBase(nil, nil, nil, recorder),
+		handler:        handler,
+		alarming:       *observability.NewAlarmStore(),
+		timeout:        openshift.ReconcileTimeout(),
 	}
 }
 
@@ -101,12 +122,15 @@ func (r *reconcileNamespace) Reconcile(request reconcile.Request) (reconcile.Res
 	reqLogger := log.WithValues("namespace", request.Name)
 	reqLogger.Info("Reconciling Namespace")
 
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
 	// if the namespace needs to be saved at the end.
 	changed := false
 
-	namespace, err := r.handler.LoadNamespace(request.Name)
+	namespace, err := r.handler.LoadNamespace(ctx, request.Name)
 	if err != nil {
-		if errors.IsNotFound(err) {
+		if openshift.IsNotFound(err) {
 			// Request object not found, could have been deleted after reconcile request.
 			// Owned objects are automatically garbage collected. For additional cleanup logic use finalizers.
 			// Return and don't requeue
@@ -116,13 +140,37 @@ func (r *reconcileNamespace) Reconcile(request reconcile.Request) (reconcile.Res
 		return reconcile.Result{}, err
 	}
 
-	netnamespace, err := r.handler.LoadNetNameSpace(request.Name)
+	// an operation left over by a stopped operator is rolled back before anything else is done.
+	recovered, err := r.handler.RecoverNamespaceIntent(ctx, namespace)
+	if err != nil {
+		reqLogger.Error(err, "could not roll back the leftover intent of the namespace")
+		return reconcile.Result{}, err
+	}
+	if recovered {
+		reqLogger.Info("rolled back the leftover intent of the namespace")
+	}
+
+	result := reconcile.Result{}
+	if openshift.HasFailedOverIPs(namespace) && !util.IsBeingDeleted(namespace) {
+		namespace, result, err = r.returnFailedOverIPs(ctx, namespace, reqLogger)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+
+	netnamespace, err := r.handler.LoadNetNameSpace(ctx, request.Name)
 	if err != nil {
 		reqLogger.Error(err, "can not load NetNamespace to Namespace")
 		return reconcile.Result{}, err
 	}
 
-	changed, err = r.workOnUpdate(namespace, netnamespace, changed, reqLogger)
+	conditions := append([]corev1.NamespaceCondition(nil), namespace.Status.Conditions...)
+
+	changed, err = r.workOnUpdate(ctx, namespace, netnamespace, changed, reqLogger)
+	if cloudprovider.IsInvalidIP(err) {
+		// invalid specified IPs won't get valid by retrying. The namespace has to be corrected by the user.
+		return result, r.saveNamespaceStatus(ctx, namespace, conditions, reqLogger)
+	}
 	if err != nil {
 		reqLogger.Error(err, "did not successfully work on updated namespace")
 		return reconcile.Result{}, err
@@ -134,32 +182,71 @@ func (r *reconcileNamespace) Reconcile(request reconcile.Request) (reconcile.Res
 		return reconcile.Result{}, err
 	}
 
-	if changed {
+	// saving the namespace overwrites the status with the one stored in the api server.
+	status := namespace.Status
 
-		err = r.handler.SaveNamespace(namespace)
+	if changed {
+		// the namespace is saved last since it clears the intent of the operation.
+		err = r.handler.SaveNetNameSpace(ctx, netnamespace)
 		if err != nil {
-			reqLogger.Error(err, "could not save the namespace")
+			reqLogger.Error(err, "could not save the netnamespace")
 			return reconcile.Result{}, err
 		}
 
-		err = r.handler.SaveNetNameSpace(netnamespace)
+		err = r.handler.SaveNamespace(ctx, namespace)
 		if err != nil {
-			reqLogger.Error(err, "could not save the netnamespace. The data will be inconsistent")
+			reqLogger.Error(err, "could not save the namespace. The operation will be rolled back with the next reconcile")
 			return reconcile.Result{}, err
 		}
 	}
 
-	return reconcile.Result{}, nil
+	namespace.Status = status
+	return result, r.saveNamespaceStatus(ctx, namespace, conditions, reqLogger)
+}
+
+// returnFailedOverIPs -- moves the IPs failed over to other zones back to their zones and reloads the changed
+// namespace. While IPs are still failed over, the namespace is checked again after the failover recheck period.
+func (r *reconcileNamespace) returnFailedOverIPs(ctx context.Context, namespace *corev1.Namespace, reqLogger logr.Logger) (*corev1.Namespace, reconcile.Result, error) {
+	result := reconcile.Result{}
+
+	pending, err := r.handler.ReturnFailedOverIPs(ctx, namespace.Name)
+	if err != nil {
+		reqLogger.Error(err, "could not return all failed over ips to their zones")
+	}
+	if pending {
+		result.RequeueAfter = failoverRecheckPeriod
+	}
+
+	namespace, err = r.handler.LoadNamespace(ctx, namespace.Name)
+	if err != nil {
+		reqLogger.Error(err, "could not reload the namespace after returning the failed over ips")
+		return nil, result, err
+	}
+
+	return namespace, result, nil
+}
+
+// saveNamespaceStatus -- saves the status of the namespace if the conditions differ from the loaded ones.
+func (r *reconcileNamespace) saveNamespaceStatus(ctx context.Context, instance *corev1.Namespace, loaded []corev1.NamespaceCondition, reqLogger logr.Logger) error {
+	if reflect.DeepEqual(loaded, instance.Status.Conditions) {
+		return nil
+	}
+
+	err := r.handler.SaveNamespaceStatus(ctx, instance)
+	if err != nil {
+		reqLogger.Error(err, "could not save the status of the namespace")
+	}
+	return err
 }
 
-func (r *reconcileNamespace) workOnUpdate(instance *corev1.Namespace, netnamespace *ocpnetv1.NetNamespace, changed bool, reqLogger logr.Logger) (bool, error) {
+func (r *reconcileNamespace) workOnUpdate(ctx context.Context, instance *corev1.Namespace, netnamespace *ocpnetv1.NetNamespace, changed bool, reqLogger logr.Logger) (bool, error) {
 	if util.IsBeingDeleted(instance) {
 		// I have to do nothing ...
 		return changed, nil
 	}
 
 	ipString, found := instance.GetAnnotations()[egressipam.NamespaceAssociationAnnotation]
-	if found && len(ipString) >= 7 { // "1.1.1.1" is the shortes IP possible
+	if found && hasIPs(ipString) {
 		reqLogger.Info("IPs defined to use:",
 			"ips", ipString,
 		)
@@ -192,8 +279,25 @@ func (r *reconcileNamespace) workOnUpdate(instance *corev1.Namespace, netnamespa
 		reqLogger.Info("eggressIP to configure",
 			"ips", ipString,
 		)
-		ips, err := r.addIPs(instance, netnamespace)
+		ips, err := r.addIPs(ctx, instance, netnamespace)
+		if cloudprovider.IsInvalidIP(err) {
+			reqLogger.Info("the specified ips are invalid - waiting for the namespace to be corrected",
+				"error", err.Error(),
+			)
+			r.GetRecorder().Event(instance, corev1.EventTypeWarning, openshift.ReasonInvalidEgressIPs, err.Error())
+			openshift.SetEgressIPCondition(instance, corev1.ConditionFalse, openshift.ReasonInvalidEgressIPs, err.Error())
+
+			return changed, err
+		}
 		if err != nil {
+			// temporary failures (throttling, conflicts, ...) are retried by requeueing without raising an alarm.
+			if cloudprovider.IsRetryable(err) {
+				reqLogger.Info("temporary failure while adding ips - will retry",
+					"error", err.Error(),
+				)
+				return changed, err
+			}
+
 			r.alarming.AddAlarm(instance.Name, ips)
 
 			return changed, err
@@ -204,17 +308,33 @@ func (r *reconcileNamespace) workOnUpdate(instance *corev1.Namespace, netnamespa
 		r.alarming.RemoveAlarm(instance.Name)
 		reqLogger.Info("added ips",
 			"ips", ips)
+
+		message := fmt.Sprintf("egress ips '%s' assigned", r.ipsToString(ips))
+		r.GetRecorder().Event(instance, corev1.EventTypeNormal, openshift.ReasonEgressIPsAssigned, message)
+		openshift.SetEgressIPCondition(instance, corev1.ConditionTrue, openshift.ReasonEgressIPsAssigned, message)
 	}
 
 	return true, nil
 }
 
-// addIPs -- adds random new IPs to the cluster and returns the assigned IPs as result
-func (r *reconcileNamespace) addIPs(instance *corev1.Namespace, netnamespace *ocpnetv1.NetNamespace) ([]*net.IP, error) {
+// hasIPs -- checks if the annotation value lists at least one valid IPv4 or IPv6 address.
+func hasIPs(ipString string) bool {
+	ips, err := openshift.ParseIPList(ipString)
+	return err == nil && len(ips) > 0
+}
+
+// addIPs -- adds random new IPs to the cluster and returns the assigned IPs as result. If the handler keeps the IPs of
+// a partially failed assignment, they are saved on the namespace and NetNamespace before the error is returned.
+// Otherwise every retry would assign new IPs and leak the kept ones.
+func (r *reconcileNamespace) addIPs(ctx context.Context, instance *corev1.Namespace, netnamespace *ocpnetv1.NetNamespace) ([]*net.IP, error) {
 	// map[string]*net.IP
-	ips, err := r.handler.AddIPsToInfrastructure(instance)
+	ips, err := r.handler.AddIPsToInfrastructure(ctx, instance)
 	if err != nil {
-		return nil, err
+		ips = assignedIPs(ips)
+		if len(ips) > 0 {
+			err = r.saveKeptIPs(ctx, instance, netnamespace, ips, err)
+		}
+		return ips, err
 	}
 
 	r.addAnnotationToNamespace(instance, ips)
@@ -223,6 +343,40 @@ func (r *reconcileNamespace) addIPs(instance *corev1.Namespace, netnamespace *oc
 	return ips, nil
 }
 
+// saveKeptIPs -- annotates and saves the NetNamespace and the namespace with the IPs kept by a partially failed
+// assignment. Returns the error of the assignment combined with the errors of saving.
+func (r *reconcileNamespace) saveKeptIPs(ctx context.Context, instance *corev1.Namespace, netnamespace *ocpnetv1.NetNamespace, ips []*net.IP, err error) error {
+	log.Info("saving the ips kept by the partially failed assignment",
+		"namespace", instance.Name,
+		"ips", ips,
+	)
+
+	r.addAnnotationToNamespace(instance, ips)
+	r.addAnnotationToNetnamespace(netnamespace, ips)
+	r.addFinalizer(instance, log)
+
+	// the namespace is saved last like in the reconcile.
+	if err2 := r.handler.SaveNetNameSpace(ctx, netnamespace); err2 != nil {
+		return multierror.Append(err, err2)
+	}
+	if err2 := r.handler.SaveNamespace(ctx, instance); err2 != nil {
+		return multierror.Append(err, err2)
+	}
+
+	return err
+}
+
+// assignedIPs -- returns the IPs without the empty entries of failed assignments.
+func assignedIPs(ips []*net.IP) []*net.IP {
+	result := make([]*net.IP, 0, len(ips))
+	for _, ip := range ips {
+		if ip != nil {
+			result = append(result, ip)
+		}
+	}
+	return result
+}
+
 // addAnnotationToNamespace -- adds the IP list annotation to the namespace. The namespace needs to be saved after that.
 func (r *reconcileNamespace) addAnnotationToNamespace(instance *corev1.Namespace, ips []*net.IP) {
 	annotations := instance.GetAnnotations()
@@ -252,7 +406,8 @@ func (r *reconcileNamespace) removeAnnotationFromNamespace(instance *corev1.Name
 		newAnnotations := make(map[string]string, r.calculatenewAnnotationLength(found, found2, annotations))
 
 		for key, value := range annotations {
-			if key != egressipam.NamespaceAssociationAnnotation && key != egressipam.NamespaceAnnotation {
+			if key != egressipam.NamespaceAssociationAnnotation && key != egressipam.NamespaceAnnotation &&
+				key != openshift.PublicIPsAnnotation {
 				newAnnotations[key] = value
 			}
 		}
@@ -1,6 +1,7 @@
 package netnamespace
 
 import (
+	"context"
 	"fmt"
 	"github.com/go-logr/logr"
 	"github.com/klenkes74/aws-egressip-operator/pkg/cloudprovider"
@@ -10,7 +11,6 @@ import (
 	corev1 "github.com/openshift/api/network/v1"
 	"github.com/redhat-cop/egressip-ipam-operator/pkg/controller/egressipam"
 	"github.com/redhat-cop/operator-utils/pkg/util"
-	"k8s.io/apimachinery/pkg/api/errors"
 	"net"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/event"
@@ -20,6 +20,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 	"strings"
+	"time"
 )
 
 const controllerName = "netnamespace-controller"
@@ -35,6 +36,8 @@ type reconcileNetnamespace struct {
 	cloud    *cloudprovider.CloudProvider
 	handler  openshift.EgressIPHandler
 	alarming observability.AlarmStore
+
+	timeout time.Duration // time limit of a single reconcile
 }
 
 // Add creates a new Namespace Controller and adds it to the Manager. The Manager will set fields on the Controller
@@ -51,6 +54,7 @@ func newReconciler(mgr manager.Manager, cloud *cloudprovider.CloudProvider) reco
 		cloud:          cloud,
 		handler:        *openshift.NewEgressIPHandler(*cloud, *openshift.NewOcpClient(mgr.GetClient())),
 		alarming:       *observability.NewAlarmStore(),
+		timeout:        openshift.ReconcileTimeout(),
 	}
 }
 
@@ -96,10 +100,13 @@ func (r *reconcileNetnamespace) Reconcile(request reconcile.Request) (reconcile.
 	reqLogger := log.WithValues("netnamespace", request.Name)
 	reqLogger.Info("Reconciling Netnamespace")
 
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
 	// Fetch the Namespace instance
-	instance, err := r.handler.LoadNetNameSpace(request.Name)
+	instance, err := r.handler.LoadNetNameSpace(ctx, request.Name)
 	if err != nil {
-		if errors.IsNotFound(err) {
+		if openshift.IsNotFound(err) {
 			// Request object not found, could have been deleted after reconcile request.
 			// Owned objects are automatically garbage collected. For additional cleanup logic use finalizers.
 			// Return and don't requeue
@@ -112,13 +119,13 @@ func (r *reconcileNetnamespace) Reconcile(request reconcile.Request) (reconcile.
 	}
 
 	changed := false
-	changed, err = r.workOnUpdate(instance, changed, reqLogger)
+	changed, err = r.workOnUpdate(ctx, instance, changed, reqLogger)
 	if err != nil {
 		reqLogger.Error(err, "could not work on updated Netnamespace")
 		return reconcile.Result{}, err
 	}
 
-	changed, err = r.workOnDelete(instance, changed, reqLogger)
+	changed, err = r.workOnDelete(ctx, instance, changed, reqLogger)
 	if err != nil {
 		reqLogger.Error(err, "could not work on deleted Netnamespace")
 		return reconcile.Result{}, err
@@ -127,7 +134,7 @@ func (r *reconcileNetnamespace) Reconcile(request reconcile.Request) (reconcile.
 	if changed {
 		reqLogger.Info("saving the changed netnamespace")
 
-		err = r.handler.SaveNetNameSpace(instance)
+		err = r.handler.SaveNetNameSpace(ctx, instance)
 		if err != nil {
 			reqLogger.Error(err, "could not save the netnamespace")
 		}
@@ -138,7 +145,7 @@ func (r *reconcileNetnamespace) Reconcile(request reconcile.Request) (reconcile.
 	return reconcile.Result{}, nil
 }
 
-func (r *reconcileNetnamespace) workOnUpdate(instance *corev1.NetNamespace, changed bool, reqLogger logr.Logger) (bool, error) {
+func (r *reconcileNetnamespace) workOnUpdate(ctx context.Context, instance *corev1.NetNamespace, changed bool, reqLogger logr.Logger) (bool, error) {
 	if util.IsBeingDeleted(instance) { // the namespace is deleted and we need to clean up.
 		return false, nil
 	}
@@ -161,7 +168,7 @@ func (r *reconcileNetnamespace) workOnUpdate(instance *corev1.NetNamespace, chan
 	)
 
 	if len(instance.EgressIPs) > 0 {
-		err = r.removeIpsFromNetnamespace(instance)
+		err = r.removeIpsFromNetnamespace(ctx, instance)
 		if err != nil {
 			return changed, err
 		}
@@ -210,7 +217,7 @@ func (r *reconcileNetnamespace) matchingIPs(a []string, b []*net.IP) bool {
 	return len(resultSet) == len(a)
 }
 
-func (r *reconcileNetnamespace) workOnDelete(instance *corev1.NetNamespace, changed bool, reqLogger logr.Logger) (bool, error) {
+func (r *reconcileNetnamespace) workOnDelete(ctx context.Context, instance *corev1.NetNamespace, changed bool, reqLogger logr.Logger) (bool, error) {
 	if !util.IsBeingDeleted(instance) {
 		return changed, nil
 	}
@@ -219,7 +226,7 @@ func (r *reconcileNetnamespace) workOnDelete(instance *corev1.NetNamespace, chan
 
 	r.removeFinalizer(instance)
 
-	return true, r.removeIpsFromNetnamespace(instance)
+	return true, r.removeIpsFromNetnamespace(ctx, instance)
 }
 
 // add the specified IPs to the cluster to be usable as egress ips
@@ -247,12 +254,11 @@ func (r *reconcileNetnamespace) getAnnotatedIPs(instance *corev1.NetNamespace) [
 	var ips []*net.IP
 	ipstring, found := instance.GetAnnotations()[egressipam.NamespaceAssociationAnnotation]
 	if found && len(ipstring) > 0 {
-		ipStrings := strings.Split(ipstring, ",")
-		ips = make([]*net.IP, len(ipStrings))
-
-		for i, ip := range ipStrings {
-			ipStruct := net.ParseIP(ip)
-			ips[i] = &ipStruct
+		var err error
+		ips, err = openshift.ParseIPList(ipstring)
+		if err != nil {
+			log.Error(err, "ignoring invalid ip annotation", "netnamespace", instance.Name)
+			return nil
 		}
 	}
 	return ips
@@ -268,8 +274,8 @@ func (r *reconcileNetnamespace) addIPsToAnnotation(instance *corev1.NetNamespace
 	instance.SetAnnotations(annotations)
 }
 
-func (r *reconcileNetnamespace) removeIpsFromNetnamespace(instance *corev1.NetNamespace) error {
-	err := r.handler.RemoveIPsFromInfrastructure(instance)
+func (r *reconcileNetnamespace) removeIpsFromNetnamespace(ctx context.Context, instance *corev1.NetNamespace) error {
+	err := r.handler.RemoveIPsFromInfrastructure(ctx, instance)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,69 @@
+package observability
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sync"
+	"time"
+)
+
+var (
+	driftMetrics      sync.Once
+	driftFound        *prometheus.GaugeVec
+	driftRepairs      *prometheus.CounterVec
+	driftLastAuditRun prometheus.Gauge
+)
+
+func registerDriftMetrics() {
+	driftFound = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "egressip",
+			Name:      "drift",
+			Help:      "Mismatches of egress ips found by the last drift audit",
+		},
+		[]string{"kind"},
+	)
+	driftRepairs = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "egressip",
+			Name:      "drift_repairs_total",
+			Help:      "Repairs of egress ip mismatches found by the drift audit",
+		},
+		[]string{"kind", "result"},
+	)
+	driftLastAuditRun = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "egressip",
+			Name:      "drift_last_audit_timestamp_seconds",
+			Help:      "Time of the last drift audit",
+		},
+	)
+
+	for _, collector := range []prometheus.Collector{driftFound, driftRepairs, driftLastAuditRun} {
+		err := metrics.Registry.Register(collector)
+		if err != nil {
+			log.Error(err, "Can't register the drift metric")
+		}
+	}
+}
+
+// ReportDrift -- publishes the number of mismatches per kind found by a drift audit. Kinds not found are reported as 0.
+func ReportDrift(kinds []string, found map[string]int) {
+	driftMetrics.Do(registerDriftMetrics)
+
+	for _, kind := range kinds {
+		driftFound.WithLabelValues(kind).Set(float64(found[kind]))
+	}
+	driftLastAuditRun.Set(float64(time.Now().Unix()))
+}
+
+// CountDriftRepair -- counts a repair of a mismatch found by the drift audit.
+func CountDriftRepair(kind string, repaired bool) {
+	driftMetrics.Do(registerDriftMetrics)
+
+	result := "repaired"
+	if !repaired {
+		result = "failed"
+	}
+	driftRepairs.WithLabelValues(kind, result).Inc()
+}
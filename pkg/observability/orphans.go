@@ -0,0 +1,57 @@
+package observability
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sync"
+)
+
+var (
+	orphanMetrics  sync.Once
+	orphansFound   *prometheus.GaugeVec
+	orphansRemoved *prometheus.CounterVec
+)
+
+func registerOrphanMetrics() {
+	orphansFound = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "egressip",
+			Name:      "orphaned_ips",
+			Help:      "Secondary ips of egress nodes nothing in OpenShift references",
+		},
+		[]string{"state"},
+	)
+	orphansRemoved = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "egressip",
+			Name:      "orphaned_ips_removed_total",
+			Help:      "Removals of orphaned secondary ips",
+		},
+		[]string{"result"},
+	)
+
+	for _, collector := range []prometheus.Collector{orphansFound, orphansRemoved} {
+		err := metrics.Registry.Register(collector)
+		if err != nil {
+			log.Error(err, "Can't register the orphaned ip metric")
+		}
+	}
+}
+
+// ReportOrphanedIPs -- publishes the number of orphaned IPs still within their grace period (pending), past it (due)
+// and excluded from the collection.
+func ReportOrphanedIPs(pending int, due int, excluded int) {
+	orphanMetrics.Do(registerOrphanMetrics)
+
+	orphansFound.WithLabelValues("pending").Set(float64(pending))
+	orphansFound.WithLabelValues("due").Set(float64(due))
+	orphansFound.WithLabelValues("excluded").Set(float64(excluded))
+}
+
+// CountOrphanedIPRemovals -- counts the removed orphaned IPs and the failed removals.
+func CountOrphanedIPRemovals(removed int, failed int) {
+	orphanMetrics.Do(registerOrphanMetrics)
+
+	orphansRemoved.WithLabelValues("removed").Add(float64(removed))
+	orphansRemoved.WithLabelValues("failed").Add(float64(failed))
+}
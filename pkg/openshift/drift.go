@@ -0,0 +1,551 @@
+package openshift
+
+import (
+	"context"
+	"fmt"
+	"github.com/hashicorp/go-multierror"
+	"github.com/klenkes74/aws-egressip-operator/pkg/cloudprovider"
+	ocpnetv1 "github.com/openshift/api/network/v1"
+	"github.com/redhat-cop/egressip-ipam-operator/pkg/controller/egressipam"
+	corev1 "k8s.io/api/core/v1"
+	apiv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net"
+	"os"
+	"sort"
+	"strings"
+)
+
+// DriftKind -- the kind of mismatch between the egress IPs of the namespaces, NetNamespaces, HostSubnets and the cloud.
+type DriftKind string
+
+const (
+	// DriftMissingOnNetNamespace -- the namespace lists the IP, its NetNamespace does not carry it. Repaired by adding the
+	// IP to the NetNamespace.
+	DriftMissingOnNetNamespace DriftKind = "missing-on-netnamespace"
+	// DriftUnknownOnNetNamespace -- the NetNamespace carries an IP its namespace does not list. Repaired by removing the
+	// IP from the NetNamespace.
+	DriftUnknownOnNetNamespace DriftKind = "unknown-on-netnamespace"
+	// DriftMissingOnHostSubnet -- the namespace lists the IP, no HostSubnet carries it. Repaired by adding the IP to the
+	// HostSubnet of the instance carrying it in the cloud. Can't be repaired if no instance carries it.
+	DriftMissingOnHostSubnet DriftKind = "missing-on-hostsubnet"
+	// DriftWrongHostSubnet -- the IP of a namespace is carried by the HostSubnet of another host than the instance
+	// carrying it in the cloud. Repaired by moving the IP to the HostSubnet of that instance.
+	DriftWrongHostSubnet DriftKind = "wrong-hostsubnet"
+	// DriftWrongNamespaceAnnotation -- the IP annotation of the HostSubnet is missing or names another namespace than the
+	// one listing the IP. Repaired by annotating the namespace listing the IP.
+	DriftWrongNamespaceAnnotation DriftKind = "wrong-namespace-annotation"
+	// DriftMissingInCloud -- the HostSubnet carries the IP, no instance does in the cloud.
+	DriftMissingInCloud DriftKind = "missing-in-cloud"
+	// DriftOrphanedOnHostSubnet -- the HostSubnet carries an IP no namespace lists.
+	DriftOrphanedOnHostSubnet DriftKind = "orphaned-on-hostsubnet"
+	// DriftOrphanedInCloud -- an instance carries a secondary IP in the cloud no HostSubnet or namespace knows.
+	DriftOrphanedInCloud DriftKind = "orphaned-in-cloud"
+	// DriftDuplicateIP -- the IP is listed by several namespaces or carried by several HostSubnets.
+	DriftDuplicateIP DriftKind = "duplicate-ip"
+)
+
+// DriftKinds are all kinds of drift in the order they are reported and repaired.
+var DriftKinds = []DriftKind{
+	DriftUnknownOnNetNamespace,
+	DriftMissingOnNetNamespace,
+	DriftWrongHostSubnet,
+	DriftMissingOnHostSubnet,
+	DriftWrongNamespaceAnnotation,
+	DriftMissingInCloud,
+	DriftOrphanedOnHostSubnet,
+	DriftOrphanedInCloud,
+	DriftDuplicateIP,
+}
+
+// Drift is a single mismatch of an egress IP found by the audit.
+type Drift struct {
+	Kind       DriftKind
+	IP         string
+	Namespace  string // the namespace listing the IP (or owning the NetNamespace carrying it) -- empty if none does
+	HostSubnet string // the hostSubnet carrying the IP -- empty if none does
+	Instance   string // the instance carrying the IP in the cloud -- empty if none does
+	Message    string
+}
+
+// Repairable checks if the drift can be repaired automatically.
+func (d Drift) Repairable() bool {
+	switch d.Kind {
+	case DriftMissingOnNetNamespace, DriftUnknownOnNetNamespace, DriftWrongHostSubnet, DriftWrongNamespaceAnnotation:
+		return true
+	case DriftMissingOnHostSubnet:
+		return d.Instance != ""
+	default:
+		return false
+	}
+}
+
+// DriftPolicy -- the kinds of drift repaired automatically. All other drifts raise an alarm.
+type DriftPolicy map[DriftKind]bool
+
+// ParseDriftPolicy parses the comma separated list of drift kinds to repair. "all" repairs all kinds that can be
+// repaired, an empty value or "none" repairs nothing. Kinds that can't be repaired are an error.
+func ParseDriftPolicy(value string) (DriftPolicy, error) {
+	result := make(DriftPolicy)
+
+	for _, kind := range strings.Split(strings.ToLower(value), ",") {
+		kind = strings.TrimSpace(kind)
+		switch kind {
+		case "", "none":
+			continue
+		case "all":
+			for _, k := range repairableDriftKinds() {
+				result[k] = true
+			}
+			continue
+		}
+
+		if !containsDriftKind(repairableDriftKinds(), DriftKind(kind)) {
+			return DriftPolicy{}, fmt.Errorf("drift '%s' can't be repaired (valid: all, none, %s)",
+				kind, strings.Join(driftKindNames(repairableDriftKinds()), ", "))
+		}
+		result[DriftKind(kind)] = true
+	}
+
+	return result, nil
+}
+
+// DriftPolicyFromEnvironment reads the drift policy from the environment variable DRIFT_REPAIR. An invalid value is
+// logged and nothing is repaired.
+func DriftPolicyFromEnvironment() DriftPolicy {
+	value, _ := os.LookupEnv("DRIFT_REPAIR")
+
+	result, err := ParseDriftPolicy(value)
+	if err != nil {
+		log.Error(err, "invalid value of DRIFT_REPAIR - drifts raise alarms only")
+	}
+
+	return result
+}
+
+// Repairs checks if the drift is repaired automatically.
+func (p DriftPolicy) Repairs(drift Drift) bool {
+	return drift.Repairable() && p[drift.Kind]
+}
+
+func repairableDriftKinds() []DriftKind {
+	return []DriftKind{
+		DriftUnknownOnNetNamespace,
+		DriftMissingOnNetNamespace,
+		DriftWrongHostSubnet,
+		DriftMissingOnHostSubnet,
+		DriftWrongNamespaceAnnotation,
+	}
+}
+
+func containsDriftKind(kinds []DriftKind, kind DriftKind) bool {
+	for _, k := range kinds {
+		if k == kind {
+			return true
+		}
+	}
+
+	return false
+}
+
+func driftKindNames(kinds []DriftKind) []string {
+	result := make([]string, len(kinds))
+	for i, kind := range kinds {
+		result[i] = string(kind)
+	}
+	return result
+}
+
+// egressIPSources -- the egress IPs as known by the namespaces, NetNamespaces, HostSubnets and the cloud.
+type egressIPSources struct {
+	namespaces    map[string][]string // ip -> namespaces listing it
+	netNamespaces map[string]string   // ip -> NetNamespace carrying it
+	hostSubnets   map[string][]string // ip -> hostSubnets carrying it
+	annotations   map[string]string   // ip -> namespace annotated by the hostSubnet carrying it
+	annotated     map[string]bool     // IPs of the IP annotations of all hostSubnets
+	cloud         map[string]string   // ip -> hostSubnet of the instance carrying it
+	instances     map[string]string   // hostSubnet -> id of its instance
+	inFlight      map[string]bool     // IPs of operations in progress (recorded as intent)
+	foreign       map[string]bool     // IPs of NetNamespaces of namespaces not managed by the operator
+	complete      bool                // the instances of all hostSubnets have been read from the cloud
+}
+
+// AuditDrift compares the egress IPs listed by the namespaces, carried by the NetNamespaces, the HostSubnets (with
+// their IP annotations) and the instances in the cloud and returns the mismatches sorted by IP. A cloud provider
+// caching the state of the cloud is resynced first. Only namespaces carrying the annotations of the operator are
+// audited, IPs of the NetNamespaces of other namespaces are skipped like IPs of operations in progress and unclaimed
+// IPs of the warm pool. HostSubnets whose instance can't be read are left out of the comparison with the cloud and the
+// errors are returned together with the drifts found.
+func (h *ProdEgressIPHandler) AuditDrift(ctx context.Context) ([]Drift, error) {
+	sources, err := h.readEgressIPSources(ctx)
+	if sources == nil {
+		return nil, err
+	}
+
+	known := make(map[string]bool)
+	for _, m := range []map[string]string{sources.netNamespaces, sources.cloud} {
+		for ip := range m {
+			known[ip] = true
+		}
+	}
+	for _, m := range []map[string][]string{sources.namespaces, sources.hostSubnets} {
+		for ip := range m {
+			known[ip] = true
+		}
+	}
+
+	ips := make([]string, 0, len(known))
+	for ip := range known {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+
+	result := make([]Drift, 0)
+	for _, ip := range ips {
+		if !sources.inFlight[ip] && !sources.foreign[ip] {
+			result = append(result, sources.classify(ip)...)
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].IP != result[j].IP {
+			return result[i].IP < result[j].IP
+		}
+		return driftKindIndex(result[i].Kind) < driftKindIndex(result[j].Kind)
+	})
+
+	return result, err
+}
+
+// classify -- returns the drifts of a single IP.
+func (s *egressIPSources) classify(ip string) []Drift {
+	namespaces := s.namespaces[ip]
+	hostSubnets := s.hostSubnets[ip]
+	if len(namespaces) > 1 || len(hostSubnets) > 1 {
+		message := fmt.Sprintf("ip '%s' is listed by the namespaces %v and carried by the hostSubnets %v",
+			ip, namespaces, hostSubnets)
+		return []Drift{{Kind: DriftDuplicateIP, IP: ip, Message: message}}
+	}
+
+	namespace, hostSubnet := "", ""
+	if len(namespaces) == 1 {
+		namespace = namespaces[0]
+	}
+	if len(hostSubnets) == 1 {
+		hostSubnet = hostSubnets[0]
+	}
+	netNamespace, onNetNamespace := s.netNamespaces[ip]
+	cloudHost, inCloud := s.cloud[ip]
+	instance := s.instances[cloudHost]
+
+	result := make([]Drift, 0)
+	add := func(kind DriftKind, namespace string, format string, args ...interface{}) {
+		result = append(result, Drift{
+			Kind:       kind,
+			IP:         ip,
+			Namespace:  namespace,
+			HostSubnet: hostSubnet,
+			Instance:   instance,
+			Message:    fmt.Sprintf(format, args...),
+		})
+	}
+
+	if onNetNamespace && netNamespace != namespace {
+		add(DriftUnknownOnNetNamespace, netNamespace, "NetNamespace '%s' carries ip '%s' its namespace does not list",
+			netNamespace, ip)
+	}
+	if namespace != "" && netNamespace != namespace {
+		add(DriftMissingOnNetNamespace, namespace, "NetNamespace '%s' does not carry ip '%s' of its namespace", namespace, ip)
+	}
+
+	if namespace == "" {
+		if hostSubnet != "" {
+			add(DriftOrphanedOnHostSubnet, "", "hostSubnet '%s' carries ip '%s' no namespace lists", hostSubnet, ip)
+		} else if inCloud {
+			add(DriftOrphanedInCloud, "", "instance '%s' of host '%s' carries ip '%s' no hostSubnet or namespace knows",
+				instance, cloudHost, ip)
+		}
+	} else if hostSubnet == "" {
+		if inCloud {
+			add(DriftMissingOnHostSubnet, namespace, "no hostSubnet carries ip '%s' of namespace '%s' assigned to instance '%s'",
+				ip, namespace, instance)
+		} else {
+			add(DriftMissingOnHostSubnet, namespace, "neither a hostSubnet nor an instance carries ip '%s' of namespace '%s'",
+				ip, namespace)
+		}
+	} else {
+		if s.annotations[ip] != namespace {
+			add(DriftWrongNamespaceAnnotation, namespace,
+				"hostSubnet '%s' annotates ip '%s' with namespace '%s' instead of '%s'",
+				hostSubnet, ip, s.annotations[ip], namespace)
+		}
+		if inCloud && cloudHost != hostSubnet {
+			add(DriftWrongHostSubnet, namespace, "hostSubnet '%s' carries ip '%s' assigned to instance '%s' of host '%s'",
+				hostSubnet, ip, instance, cloudHost)
+		}
+	}
+
+	if hostSubnet != "" && !inCloud && s.complete {
+		add(DriftMissingInCloud, namespace, "hostSubnet '%s' carries ip '%s' no instance carries in the cloud",
+			hostSubnet, ip)
+	}
+
+	return result
+}
+
+// readEgressIPSources -- reads the egress IPs of all namespaces, NetNamespaces and HostSubnets and of the instances of
+// the HostSubnets. The instances are read after a resync of the cloud provider, a cached location of an IP may be
+// outdated. Failures to read an instance are returned together with the sources, failures of the api server and the
+// resync without them.
+func (h *ProdEgressIPHandler) readEgressIPSources(ctx context.Context) (*egressIPSources, error) {
+	result, hostSubnets, err := h.readOcpEgressIPs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if syncer, ok := h.cloud.(cloudprovider.InventorySyncer); ok {
+		if err := syncer.Resync(ctx); err != nil {
+			return nil, fmt.Errorf("can't resync the cloud before reading the instances: %w", err)
+		}
+	}
+
+	unclaimed := h.unclaimedIPs()
+
+	var cloudErrors error
+	for _, hostSubnet := range hostSubnets {
+		instance, err := h.cloud.InstanceByHostName(ctx, hostSubnet.Name)
+		if err != nil {
+			result.complete = false
+			cloudErrors = multierror.Append(cloudErrors,
+				fmt.Errorf("can't read instance of hostSubnet '%s': %w", hostSubnet.Name, err))
+			continue
+		}
+
+		result.instances[hostSubnet.Name] = (*instance).ID()
+		for _, ip := range (*instance).SecondaryIps() {
+			if unclaimed[ip.String()] || (!h.ipv6Egress && cloudprovider.FamilyOf(*ip) == cloudprovider.IPv6) {
+				continue
+			}
+			result.cloud[ip.String()] = hostSubnet.Name
+		}
+	}
+
+	return result, cloudErrors
+}
+
+// readOcpEgressIPs -- reads the egress IPs of all namespaces, NetNamespaces and HostSubnets. The HostSubnets read are
+// returned, too.
+func (h *ProdEgressIPHandler) readOcpEgressIPs(ctx context.Context) (*egressIPSources, []ocpnetv1.HostSubnet, error) {
+	result := &egressIPSources{
+		namespaces:    make(map[string][]string),
+		netNamespaces: make(map[string]string),
+		hostSubnets:   make(map[string][]string),
+		annotations:   make(map[string]string),
+		annotated:     make(map[string]bool),
+		cloud:         make(map[string]string),
+		instances:     make(map[string]string),
+		inFlight:      make(map[string]bool),
+		foreign:       make(map[string]bool),
+		complete:      true,
+	}
+
+	managed := make(map[string]bool)
+	namespaces := &corev1.NamespaceList{}
+	if err := h.client.List(ctx, namespaces); err != nil {
+		return nil, nil, err
+	}
+	for i := range namespaces.Items {
+		namespace := &namespaces.Items[i]
+		if !managedNamespace(namespace) {
+			continue
+		}
+		managed[namespace.Name] = true
+		result.addInFlight(namespace)
+
+		ips, err := h.getAnnotatedIPs(namespace)
+		if err != nil {
+			log.Error(err, "skipping namespace with invalid ip list", "namespace", namespace.Name)
+			continue
+		}
+		for _, ip := range ips {
+			result.namespaces[ip.String()] = append(result.namespaces[ip.String()], namespace.Name)
+		}
+	}
+
+	netNamespaces := &ocpnetv1.NetNamespaceList{}
+	if err := h.client.List(ctx, netNamespaces); err != nil {
+		return nil, nil, err
+	}
+	for _, netNamespace := range netNamespaces.Items {
+		for _, ip := range netNamespace.EgressIPs {
+			parsed := net.ParseIP(ip)
+			if parsed == nil {
+				continue
+			}
+
+			if managed[netNamespace.Name] {
+				result.netNamespaces[parsed.String()] = netNamespace.Name
+			} else {
+				result.foreign[parsed.String()] = true
+			}
+		}
+	}
+
+	hostSubnets := &ocpnetv1.HostSubnetList{}
+	if err := h.client.List(ctx, hostSubnets); err != nil {
+		return nil, nil, err
+	}
+	for i := range hostSubnets.Items {
+		hostSubnet := &hostSubnets.Items[i]
+		result.addInFlight(hostSubnet)
+
+		for _, ip := range h.ReadIpsFromHostSubnet(hostSubnet) {
+			result.hostSubnets[ip.String()] = append(result.hostSubnets[ip.String()], hostSubnet.Name)
+			result.annotations[ip.String()] = hostSubnet.GetAnnotations()[IPToNamespaceAnnotation+ip.String()]
+		}
+		for ip, namespace := range ipNamespaces(hostSubnet) {
+			if parsed := net.ParseIP(ip); parsed != nil && namespace != "" {
+				result.annotated[parsed.String()] = true
+			}
+		}
+	}
+
+	return result, hostSubnets.Items, nil
+}
+
+// unclaimedIPs -- returns the unclaimed IPs of the warm pool. They are assigned to the nodes without being used.
+func (h *ProdEgressIPHandler) unclaimedIPs() map[string]bool {
+	result := make(map[string]bool)
+	if pool, ok := h.cloud.(interface{ Unclaimed() []*net.IP }); ok {
+		for _, ip := range pool.Unclaimed() {
+			result[ip.String()] = true
+		}
+	}
+
+	return result
+}
+
+// managedNamespace -- checks if the namespace carries the annotations of the operator. The egress IPs of other
+// namespaces are managed by someone else.
+func managedNamespace(namespace *corev1.Namespace) bool {
+	annotations := namespace.GetAnnotations()
+	_, selected := annotations[egressipam.NamespaceAnnotation]
+	_, associated := annotations[egressipam.NamespaceAssociationAnnotation]
+	return selected || associated
+}
+
+// owns -- checks if a namespace, NetNamespace or HostSubnet (as egress IP or IP annotation) references the IP or an
+// operation in progress may use it.
+func (s *egressIPSources) owns(ip string) bool {
+	_, onNetNamespace := s.netNamespaces[ip]
+	return len(s.namespaces[ip]) > 0 || onNetNamespace || len(s.hostSubnets[ip]) > 0 ||
+		s.annotated[ip] || s.inFlight[ip] || s.foreign[ip]
+}
+
+// addInFlight -- marks the IPs of the intent of the namespace or hostSubnet as in progress.
+func (s *egressIPSources) addInFlight(object apiv1.Object) {
+	intent, err := readIntent(object)
+	if err != nil || intent == nil {
+		return
+	}
+
+	for _, ip := range intent.IPs {
+		s.inFlight[ip] = true
+	}
+	for _, ip := range intent.Replacements {
+		s.inFlight[ip] = true
+	}
+}
+
+// RepairDrift repairs a single drift found by AuditDrift. Drifts that can't be repaired are returned as error.
+func (h *ProdEgressIPHandler) RepairDrift(ctx context.Context, drift Drift) error {
+	if !drift.Repairable() {
+		return fmt.Errorf("drift '%s' of ip '%s' can't be repaired: %s", drift.Kind, drift.IP, drift.Message)
+	}
+
+	ip := net.ParseIP(drift.IP)
+	if ip == nil {
+		return &cloudprovider.InvalidIPError{IP: drift.IP, Reason: "is not a valid ip address"}
+	}
+
+	switch drift.Kind {
+	case DriftMissingOnNetNamespace:
+		netNamespace, err := h.LoadNetNameSpace(ctx, drift.Namespace)
+		if err != nil {
+			return err
+		}
+		netNamespace.EgressIPs = appendIfMissing(netNamespace.EgressIPs, ip.String())
+		return h.SaveNetNameSpace(ctx, netNamespace)
+
+	case DriftUnknownOnNetNamespace:
+		namespace, err := h.LoadNamespace(ctx, drift.Namespace)
+		if err != nil {
+			return err
+		}
+		if !managedNamespace(namespace) {
+			return fmt.Errorf("namespace '%s' is not managed by the operator - ip '%s' is kept on its NetNamespace",
+				drift.Namespace, drift.IP)
+		}
+
+		netNamespace, err := h.LoadNetNameSpace(ctx, drift.Namespace)
+		if err != nil {
+			return err
+		}
+		netNamespace.EgressIPs = removeString(netNamespace.EgressIPs, ip.String())
+		return h.SaveNetNameSpace(ctx, netNamespace)
+
+	case DriftMissingOnHostSubnet:
+		return h.addIPToOcpNode(ctx, drift.Instance, drift.Namespace, &ip)
+
+	case DriftWrongHostSubnet:
+		err := h.addIPToOcpNode(ctx, drift.Instance, drift.Namespace, &ip)
+		if err != nil {
+			return err
+		}
+
+		hostSubnet, err := h.LoadHostSubnet(ctx, drift.HostSubnet)
+		if err != nil {
+			return err
+		}
+		hostSubnet.EgressIPs = removeString(hostSubnet.EgressIPs, ip.String())
+		removeIPNamespace(hostSubnet, ip.String())
+		return h.SaveHostSubnet(ctx, hostSubnet)
+
+	case DriftWrongNamespaceAnnotation:
+		hostSubnet, err := h.LoadHostSubnet(ctx, drift.HostSubnet)
+		if err != nil {
+			return err
+		}
+		setIPNamespace(hostSubnet, ip.String(), drift.Namespace)
+		return h.SaveHostSubnet(ctx, hostSubnet)
+	}
+
+	return fmt.Errorf("unknown drift '%s' of ip '%s'", drift.Kind, drift.IP)
+}
+
+func driftKindIndex(kind DriftKind) int {
+	for i, k := range DriftKinds {
+		if k == kind {
+			return i
+		}
+	}
+	return len(DriftKinds)
+}
+
+func appendIfMissing(list []string, value string) []string {
+	for _, l := range list {
+		if l == value {
+			return list
+		}
+	}
+	return append(list, value)
+}
+
+func removeString(list []string, value string) []string {
+	result := make([]string, 0, len(list))
+	for _, l := range list {
+		if l != value {
+			result = append(result, l)
+		}
+	}
+	return result
+}
@@ -0,0 +1,148 @@
+package openshift
+
+import (
+	"context"
+	"errors"
+	"github.com/klenkes74/aws-egressip-operator/pkg/observability"
+	"net"
+	"time"
+)
+
+const (
+	defaultDriftAuditPeriod = 10 * time.Minute
+	driftAuditTimeout       = 5 * time.Minute // limit of a single audit including the repairs
+)
+
+// DriftAuditPeriod returns the time between two drift audits. It is read from the environment variable
+// DRIFT_AUDIT_PERIOD (e.g. "30m"), the default is ten minutes. "0" disables the audit.
+func DriftAuditPeriod() time.Duration {
+	return durationFromEnvironment("DRIFT_AUDIT_PERIOD", defaultDriftAuditPeriod)
+}
+
+// DriftAuditor runs the drift audit periodically. Drifts are repaired according to the policy, all others (and failed
+// repairs) raise an alarm for the namespace of the IP until a later audit does not find them anymore.
+type DriftAuditor struct {
+	handler  EgressIPHandler
+	policy   DriftPolicy
+	period   time.Duration
+	alarming observability.AlarmStore
+
+	alarms map[string][]*net.IP // namespace -> IPs alarmed by the last audit
+}
+
+// NewDriftAuditor creates the auditor running the audit of the handler every period.
+func NewDriftAuditor(handler EgressIPHandler, policy DriftPolicy, period time.Duration, alarming observability.AlarmStore) *DriftAuditor {
+	return &DriftAuditor{
+		handler:  handler,
+		policy:   policy,
+		period:   period,
+		alarming: alarming,
+		alarms:   make(map[string][]*net.IP),
+	}
+}
+
+// Start runs the audit every period until stopped. It is a manager.Runnable of the controller-runtime.
+func (a *DriftAuditor) Start(stop <-chan struct{}) error {
+	log.Info("starting drift audit",
+		"period", a.period,
+		"repair", a.policy,
+	)
+
+	ticker := time.NewTicker(a.period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), driftAuditTimeout)
+		_, err := a.Audit(ctx)
+		cancel()
+		if err != nil {
+			log.Error(err, "drift audit is incomplete")
+		}
+	}
+}
+
+// Audit runs a single audit. The drifts the policy allows are repaired, the others raise an alarm. The number of drifts
+// per kind and the repairs are published as metrics. Returns the drifts found.
+func (a *DriftAuditor) Audit(ctx context.Context) ([]Drift, error) {
+	drifts, err := a.handler.AuditDrift(ctx)
+	if drifts == nil {
+		return nil, err
+	}
+
+	found := make(map[string]int)
+	alarms := make(map[string][]*net.IP)
+	for _, drift := range drifts {
+		found[string(drift.Kind)]++
+
+		if a.policy.Repairs(drift) {
+			repairErr := a.handler.RepairDrift(ctx, drift)
+			observability.CountDriftRepair(string(drift.Kind), repairErr == nil)
+			if repairErr == nil {
+				log.Info("repaired drift",
+					"kind", drift.Kind,
+					"ip", drift.IP,
+					"drift", drift.Message,
+				)
+				continue
+			}
+
+			log.Error(repairErr, "could not repair drift",
+				"kind", drift.Kind,
+				"ip", drift.IP,
+				"drift", drift.Message,
+			)
+		} else {
+			log.Error(errors.New(drift.Message), "found drift",
+				"kind", drift.Kind,
+				"ip", drift.IP,
+			)
+		}
+
+		if ip := net.ParseIP(drift.IP); drift.Namespace != "" && !containsIP(alarms[drift.Namespace], &ip) {
+			alarms[drift.Namespace] = append(alarms[drift.Namespace], &ip)
+		}
+	}
+
+	observability.ReportDrift(driftKindNames(DriftKinds), found)
+	a.raiseAlarms(alarms)
+
+	log.Info("drift audit done",
+		"drifts", len(drifts),
+		"found", found,
+	)
+	return drifts, err
+}
+
+// raiseAlarms -- raises the alarms of the audit and removes the alarms of IPs the last audit raised but this one did
+// not.
+func (a *DriftAuditor) raiseAlarms(alarms map[string][]*net.IP) {
+	for namespace, ips := range a.alarms {
+		for _, ip := range ips {
+			if !containsIP(alarms[namespace], ip) {
+				a.alarming.RemoveAlarmForIP(namespace, ip)
+			}
+		}
+	}
+
+	for namespace, ips := range alarms {
+		a.alarming.AddAlarm(namespace, ips)
+	}
+
+	a.alarms = alarms
+}
+
+func containsIP(ips []*net.IP, ip *net.IP) bool {
+	for _, i := range ips {
+		if i.Equal(*ip) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -1,36 +1,77 @@
 package openshift
 
 import (
+	"context"
 	"github.com/klenkes74/aws-egressip-operator/pkg/cloudprovider"
 	"github.com/klenkes74/aws-egressip-operator/pkg/logger"
 	ocpnetv1 "github.com/openshift/api/network/v1"
 	corev1 "k8s.io/api/core/v1"
 	"net"
+	"os"
+	"strconv"
 )
 
 // The logger for the whole package.
 var log = logger.Log.WithName("egress-ip-handler")
 
-// NewEgressIPHandler - creates a new handler with cloudprovider and OCP client
+// NewEgressIPHandler - creates a new handler with cloudprovider and OCP client. IPv6 egress IPs are only handled if the
+// environment variable SDN_IPV6_EGRESS is set to true since the SDN of OpenShift 3.11 supports IPv4 only. The
+// environment variable IP_ASSIGNMENT_MODE selects if partially failed assignments are rolled back ("rollback", the
+// default) or kept ("partial"). With ZONE_FAILOVER set to true the IPs of a zone without egress nodes are replaced by
+// IPs of other zones until the zone recovers.
 func NewEgressIPHandler(c cloudprovider.CloudProvider, o OcpClient) *EgressIPHandler {
 	data := &ProdEgressIPHandler{
-		client: o,
-		cloud:  c,
+		client:         o,
+		cloud:          c,
+		assignmentMode: assignmentModeFromEnvironment(),
+	}
+
+	ipv6Egress, found := os.LookupEnv("SDN_IPV6_EGRESS")
+	if found {
+		var err error
+		data.ipv6Egress, err = strconv.ParseBool(ipv6Egress)
+		if err != nil {
+			log.Error(err, "invalid value of SDN_IPV6_EGRESS - IPv6 egress ips are disabled", "value", ipv6Egress)
+		}
+	}
+
+	zoneFailover, found := os.LookupEnv("ZONE_FAILOVER")
+	if found {
+		var err error
+		data.zoneFailover, err = strconv.ParseBool(zoneFailover)
+		if err != nil {
+			log.Error(err, "invalid value of ZONE_FAILOVER - zone failover is disabled", "value", zoneFailover)
+		}
 	}
 
 	result := EgressIPHandler(data)
 	return &result
 }
 
-// The EgressIPHandler hides the infrastructure from the workflows defined in the reconcilers.
+// The EgressIPHandler hides the infrastructure from the workflows defined in the reconcilers. Calls to the cloud and
+// the api server are cancelled when the context is done.
 type EgressIPHandler interface {
 	// adds IPs (specified or random) to the infrastructure (AWS and hostSubnet)
-	AddIPsToInfrastructure(namespace *corev1.Namespace) ([]*net.IP, error)
+	AddIPsToInfrastructure(ctx context.Context, namespace *corev1.Namespace) ([]*net.IP, error)
 
 	// ensures that the IPs are on the given host
-	CheckIPsForHost(hostSubnet *ocpnetv1.HostSubnet, ips []*net.IP) error
-	// redistributes IPs from a failing host
-	RedistributeIPsFromHost(node *ocpnetv1.HostSubnet) (map[string]string, error)
+	CheckIPsForHost(ctx context.Context, hostSubnet *ocpnetv1.HostSubnet, ips []*net.IP) error
+	// redistributes IPs from a failing host (or fails them over to other zones if its zone has no other egress node)
+	RedistributeIPsFromHost(ctx context.Context, node *ocpnetv1.HostSubnet) (map[string]string, error)
+	// checks if the instance of the host has been terminated or does not exist anymore
+	HostInstanceGone(ctx context.Context, node *ocpnetv1.HostSubnet) (bool, error)
+	// reclaims the IPs freed by the gone instance of the host on other hosts
+	ReclaimIPsFromTerminatedHost(ctx context.Context, node *ocpnetv1.HostSubnet) (map[string]string, error)
+	// moves the failed over IPs of the namespace back to their zones, returns true if some are still failed over
+	ReturnFailedOverIPs(ctx context.Context, namespace string) (bool, error)
+	// compares the egress IPs of the namespaces, NetNamespaces, HostSubnets and the cloud and returns the mismatches
+	AuditDrift(ctx context.Context) ([]Drift, error)
+	// repairs a mismatch found by AuditDrift
+	RepairDrift(ctx context.Context, drift Drift) error
+	// returns the secondary IPs of the egress nodes nothing in OpenShift references
+	FindOrphanedIPs(ctx context.Context) ([]OrphanedIP, error)
+	// removes the orphaned IPs from the cloud unless they are referenced again, returns the IPs removed
+	RemoveOrphanedIPs(ctx context.Context, orphans []OrphanedIP) ([]string, error)
 	// returns a map with key=IP and value=new hostname
 	ReadIpsFromHostSubnet(node *ocpnetv1.HostSubnet) []*net.IP
 
@@ -39,14 +80,21 @@ type EgressIPHandler interface {
 	// Removes the IPs from the NetNamespace
 	RemoveIPsFromNetNamespace(netNamespace *ocpnetv1.NetNamespace)
 	// removes IPs (specified on the NetNamespace) from the infrastructure (AWS and hostSubnet)
-	RemoveIPsFromInfrastructure(netNamespace *ocpnetv1.NetNamespace) error
+	RemoveIPsFromInfrastructure(ctx context.Context, netNamespace *ocpnetv1.NetNamespace) error
+
+	// rolls back the operation left over on the namespace by a stopped operator
+	RecoverNamespaceIntent(ctx context.Context, namespace *corev1.Namespace) (bool, error)
+	// rolls back the redistribution left over on the hostSubnet by a stopped operator
+	RecoverHostSubnetIntent(ctx context.Context, hostSubnet *ocpnetv1.HostSubnet) (bool, error)
 
-	LoadNamespace(name string) (*corev1.Namespace, error)
-	SaveNamespace(instance *corev1.Namespace) error
+	LoadNamespace(ctx context.Context, name string) (*corev1.Namespace, error)
+	SaveNamespace(ctx context.Context, instance *corev1.Namespace) error
+	// Saves the status (conditions) of the namespace
+	SaveNamespaceStatus(ctx context.Context, instance *corev1.Namespace) error
 
-	LoadNetNameSpace(name string) (*ocpnetv1.NetNamespace, error)
-	SaveNetNameSpace(instance *ocpnetv1.NetNamespace) error
+	LoadNetNameSpace(ctx context.Context, name string) (*ocpnetv1.NetNamespace, error)
+	SaveNetNameSpace(ctx context.Context, instance *ocpnetv1.NetNamespace) error
 
-	LoadHostSubnet(name string) (*ocpnetv1.HostSubnet, error)
-	SaveHostSubnet(instance *ocpnetv1.HostSubnet) error
+	LoadHostSubnet(ctx context.Context, name string) (*ocpnetv1.HostSubnet, error)
+	SaveHostSubnet(ctx context.Context, instance *ocpnetv1.HostSubnet) error
 }
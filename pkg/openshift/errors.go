@@ -0,0 +1,105 @@
+package openshift
+
+import (
+	"fmt"
+	"github.com/klenkes74/aws-egressip-operator/pkg/cloudprovider"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"strings"
+)
+
+var (
+	_ cloudprovider.ClassifiedError = &NotFoundError{}
+	_ cloudprovider.ClassifiedError = &ConflictError{}
+	_ cloudprovider.ClassifiedError = &ObjectDeletedError{}
+)
+
+// NotFoundError is returned when an OpenShift object does not exist.
+type NotFoundError struct {
+	Kind string // the kind of the object (e.g. "HostSubnet")
+	Name string
+	Err  error // the error of the api server
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("%s '%s' not found: %v", e.Kind, e.Name, e.Err)
+}
+
+// Unwrap returns the error of the api server.
+func (e *NotFoundError) Unwrap() error { return e.Err }
+
+// Retryable -- a missing object won't appear by repeating the operation.
+func (e *NotFoundError) Retryable() bool { return false }
+
+// ConflictError is returned when an update collides with a concurrent change of the object.
+type ConflictError struct {
+	Kind string
+	Name string
+	Err  error
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s '%s' has been changed concurrently: %v", e.Kind, e.Name, e.Err)
+}
+
+// Unwrap returns the error of the api server.
+func (e *ConflictError) Unwrap() error { return e.Err }
+
+// Retryable -- the update succeeds on a freshly loaded object.
+func (e *ConflictError) Retryable() bool { return true }
+
+// ObjectDeletedError is returned when an update failed since the object has been deleted in between (the UID does
+// not match anymore).
+type ObjectDeletedError struct {
+	Kind string
+	Name string
+	Err  error
+}
+
+func (e *ObjectDeletedError) Error() string {
+	return fmt.Sprintf("%s '%s' has been deleted: %v", e.Kind, e.Name, e.Err)
+}
+
+// Unwrap returns the error of the api server.
+func (e *ObjectDeletedError) Unwrap() error { return e.Err }
+
+// Retryable -- the object is gone.
+func (e *ObjectDeletedError) Retryable() bool { return false }
+
+// classifyAPIError -- converts the error of the api server into one of the errors above. Other errors are returned
+// unchanged. The api server reports an update of a deleted object (UID precondition failed) only within the message
+// of the storage error, so this is the single place matching the message text.
+func classifyAPIError(kind string, name string, err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case strings.Contains(err.Error(), "StorageError: invalid object"):
+		return &ObjectDeletedError{Kind: kind, Name: name, Err: err}
+	case apierrors.IsNotFound(err):
+		return &NotFoundError{Kind: kind, Name: name, Err: err}
+	case apierrors.IsConflict(err):
+		return &ConflictError{Kind: kind, Name: name, Err: err}
+	}
+
+	return err
+}
+
+// IsNotFound checks if the error reports a missing object. Unclassified errors of the api server are checked, too.
+func IsNotFound(err error) bool {
+	if _, ok := err.(*NotFoundError); ok {
+		return true
+	}
+
+	return apierrors.IsNotFound(err)
+}
+
+// IsConflict checks if the error reports a concurrent change of the object.
+func IsConflict(err error) bool {
+	_, ok := err.(*ConflictError)
+	return ok
+}
+
+// IsObjectDeleted checks if the error reports an update of an object deleted in between.
+func IsObjectDeleted(err error) bool {
+	_, ok := err.(*ObjectDeletedError)
+	return ok
+}
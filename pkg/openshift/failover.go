@@ -0,0 +1,163 @@
+package openshift
+
+import (
+	"context"
+	"fmt"
+	"github.com/hashicorp/go-multierror"
+	"github.com/klenkes74/aws-egressip-operator/pkg/cloudprovider"
+	corev1 "k8s.io/api/core/v1"
+	"net"
+	"sort"
+	"strings"
+)
+
+// FailoverAnnotation -- The egress IPs of a namespace that replace IPs of a zone without egress nodes as comma
+// separated list of "<failover ip>=<original ip>" (e.g. "10.0.2.17=10.0.1.11"). The failover IPs return to the zone of
+// the original IPs once it has egress nodes again.
+const FailoverAnnotation = "egressip-ipam-operator.redhat-cop.io/failover"
+
+// HasFailedOverIPs checks if egress IPs of the namespace have been failed over to other zones.
+func HasFailedOverIPs(namespace *corev1.Namespace) bool {
+	return len(readFailovers(namespace.GetAnnotations())) > 0
+}
+
+// ReturnFailedOverIPs moves the failed over IPs of the namespace back to the zones of their original IPs. The original
+// IP is reclaimed (or a new IP of its subnet if it has been taken in the meantime) and replaces the failover IP in the
+// namespace and its NetNamespace, then the failover IP is removed. IPs of zones still without egress nodes stay failed
+// over. Returns true if there are failed over IPs left.
+func (h *ProdEgressIPHandler) ReturnFailedOverIPs(ctx context.Context, name string) (bool, error) {
+	namespace, err := h.LoadNamespace(ctx, name)
+	if err != nil {
+		return false, err
+	}
+
+	failovers := readFailovers(namespace.GetAnnotations())
+	failoverIPs := make([]string, 0, len(failovers))
+	for failoverIP := range failovers {
+		failoverIPs = append(failoverIPs, failoverIP)
+	}
+	sort.Strings(failoverIPs)
+
+	pending := false
+	var result error
+
+	for _, failoverIP := range failoverIPs {
+		err := h.returnFailedOverIP(ctx, name, failoverIP, failovers[failoverIP])
+		if cloudprovider.IsNoEgressNode(err) {
+			log.Info("the zone of the original ip has no egress node yet - keeping the failover ip",
+				"namespace", name,
+				"failover-ip", failoverIP,
+				"original-ip", failovers[failoverIP],
+			)
+			pending = true
+			continue
+		}
+		if err != nil {
+			log.Error(err, "could not return the failover ip to the zone of the original ip",
+				"namespace", name,
+				"failover-ip", failoverIP,
+				"original-ip", failovers[failoverIP],
+			)
+			pending = true
+			result = multierror.Append(result, err)
+		}
+	}
+
+	return pending, result
+}
+
+// returnFailedOverIP -- reclaims the original IP in its zone, replaces the failover IP by it and removes the failover
+// IP. The failover IP is removed last, so the namespace keeps an egress IP if the operator stops in between.
+func (h *ProdEgressIPHandler) returnFailedOverIP(ctx context.Context, namespace string, failoverIP string, originalIP string) error {
+	failover := net.ParseIP(failoverIP)
+	original := net.ParseIP(originalIP)
+	if failover == nil || original == nil {
+		return fmt.Errorf("annotation '%s' of namespace '%s' has the invalid entry '%s=%s'",
+			FailoverAnnotation, namespace, failoverIP, originalIP)
+	}
+
+	instanceID, assigned, err := h.cloud.ReclaimIP(ctx, cloudprovider.IPRequest{Namespace: namespace}, &original)
+	if err != nil {
+		return err
+	}
+
+	err = h.addIPToOcpNode(ctx, instanceID, namespace, assigned)
+	if err != nil {
+		return err
+	}
+
+	err = h.replaceNamespaceIP(ctx, namespace, []*net.IP{&failover}, assigned, func(failovers map[string]string) {
+		delete(failovers, failoverIP)
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Info("returned failed over ip to its zone",
+		"namespace", namespace,
+		"failover-ip", failoverIP,
+		"ip", assigned.String(),
+		"instance", instanceID,
+	)
+	return h.removeIPsFromNodes(ctx, []string{failoverIP}, "")
+}
+
+// inheritFailover -- returns the change of the failed over IPs for replacing the old IPs by the new one. The new IP
+// stands in for the original IP of a replaced failover IP, or for the given origin if it replaces an IP of another
+// zone. Otherwise it is no failover IP.
+func inheritFailover(old []*net.IP, ip *net.IP, origin string) func(map[string]string) {
+	return func(failovers map[string]string) {
+		for _, o := range old {
+			if original, found := failovers[o.String()]; found {
+				origin = original
+				delete(failovers, o.String())
+			}
+		}
+
+		if origin != "" {
+			failovers[ip.String()] = origin
+		}
+	}
+}
+
+// updateFailovers -- changes the failed over IPs of the namespace with the given function. The namespace needs to be
+// saved after that.
+func updateFailovers(namespace *corev1.Namespace, change func(map[string]string)) {
+	annotations := namespace.GetAnnotations()
+	failovers := readFailovers(annotations)
+
+	change(failovers)
+
+	if len(failovers) == 0 {
+		delete(annotations, FailoverAnnotation)
+		return
+	}
+
+	entries := make([]string, 0, len(failovers))
+	for failoverIP, original := range failovers {
+		entries = append(entries, failoverIP+"="+original)
+	}
+	sort.Strings(entries)
+
+	if annotations == nil {
+		annotations = make(map[string]string, 1)
+	}
+	annotations[FailoverAnnotation] = strings.Join(entries, ",")
+	namespace.SetAnnotations(annotations)
+}
+
+// readFailovers -- parses the failover annotation into a map with key=failover ip and the original ip as value.
+func readFailovers(annotations map[string]string) map[string]string {
+	result := make(map[string]string)
+
+	for _, entry := range strings.Split(annotations[FailoverAnnotation], ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			continue
+		}
+
+		result[parts[0]] = parts[1]
+	}
+
+	return result
+}
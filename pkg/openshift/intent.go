@@ -0,0 +1,402 @@
+package openshift
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/hashicorp/go-multierror"
+	"github.com/klenkes74/aws-egressip-operator/pkg/cloudprovider"
+	ocpnetv1 "github.com/openshift/api/network/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net"
+	"time"
+)
+
+// IntentAnnotation -- The write-ahead record of a multi-step operation on the egress IPs of a namespace or hostSubnet.
+// It is written before the cloud is changed and cleared with the last save of the operation. A leftover intent means
+// the operator stopped in the middle of the operation.
+const IntentAnnotation = "egressip-ipam-operator.redhat-cop.io/intent"
+
+// IntentOperation -- the multi-step operation an intent is recorded for.
+type IntentOperation string
+
+const (
+	// AddIPsIntent -- egress IPs are added to the cloud and the HostSubnets for a namespace.
+	AddIPsIntent IntentOperation = "add-ips"
+	// RedistributeIPsIntent -- the egress IPs of a hostSubnet are moved to other nodes.
+	RedistributeIPsIntent IntentOperation = "redistribute-ips"
+	// ReclaimIPsIntent -- the egress IPs freed by the gone instance of a hostSubnet are reclaimed on other nodes.
+	ReclaimIPsIntent IntentOperation = "reclaim-ips"
+	// FailoverIPsIntent -- the egress IPs of a hostSubnet without other egress nodes in its zone are replaced by IPs of
+	// other zones.
+	FailoverIPsIntent IntentOperation = "failover-ips"
+)
+
+// Intent -- the write-ahead record of an operation. The IPs are all IPs the operation may have touched: the specified
+// or redistributed IPs when it starts, the random IPs as soon as the cloud assigned them. The allocated IPs are the IPs
+// the operation newly assigned in the cloud, only they are unassigned by a rollback. The replacements are the new IPs
+// assigned by a reclaim or failover (old ip -> new ip), the failed over IPs are the old IPs replaced in another zone.
+type Intent struct {
+	Operation    IntentOperation   `json:"operation"`
+	Started      time.Time         `json:"started"`
+	IPs          []string          `json:"ips,omitempty"`
+	Allocated    []string          `json:"allocated,omitempty"`
+	Replacements map[string]string `json:"replacements,omitempty"`
+	FailedOver   []string          `json:"failedOver,omitempty"`
+}
+
+func newIntent(operation IntentOperation, ips []*net.IP) *Intent {
+	result := &Intent{Operation: operation, Started: time.Now().UTC()}
+	for _, ip := range ips {
+		if ip != nil {
+			result.IPs = append(result.IPs, ip.String())
+		}
+	}
+	return result
+}
+
+// allocate -- records the IPs the cloud assigned to the instances as allocated. Failed assignments are reported without
+// instance or IP.
+func (i *Intent) allocate(instances []string, ips []*net.IP) {
+	for n, instance := range instances {
+		if instance != "" && n < len(ips) && ips[n] != nil {
+			i.Allocated = append(i.Allocated, ips[n].String())
+		}
+	}
+}
+
+// resumable -- checks if the operation is resumed instead of being rolled back. Reclaims and failovers replace IPs
+// of the namespaces, rolling them back would only cease egress.
+func (i *Intent) resumable() bool {
+	return i.Operation == ReclaimIPsIntent || i.Operation == FailoverIPsIntent
+}
+
+// readIntent -- returns the intent recorded on the object or nil if there is none.
+func readIntent(object apiv1.Object) (*Intent, error) {
+	value, found := object.GetAnnotations()[IntentAnnotation]
+	if !found || value == "" {
+		return nil, nil
+	}
+
+	result := &Intent{}
+	if err := json.Unmarshal([]byte(value), result); err != nil {
+		return nil, fmt.Errorf("annotation '%s' of '%s' is no valid intent: %v", IntentAnnotation, object.GetName(), err)
+	}
+	return result, nil
+}
+
+// setIntent -- records the intent on the object. The object needs to be saved after that.
+func setIntent(object apiv1.Object, intent *Intent) error {
+	value, err := json.Marshal(intent)
+	if err != nil {
+		return err
+	}
+
+	annotations := object.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string, 1)
+	}
+	annotations[IntentAnnotation] = string(value)
+	object.SetAnnotations(annotations)
+	return nil
+}
+
+// clearIntent -- removes the intent from the object. Returns true if there has been one.
+func clearIntent(object apiv1.Object) bool {
+	annotations := object.GetAnnotations()
+	if _, found := annotations[IntentAnnotation]; !found {
+		return false
+	}
+
+	delete(annotations, IntentAnnotation)
+	object.SetAnnotations(annotations)
+	return true
+}
+
+// beginNamespaceIntent -- records the intent on the namespace and saves it before the cloud is changed.
+func (h *ProdEgressIPHandler) beginNamespaceIntent(ctx context.Context, namespace *corev1.Namespace, intent *Intent) error {
+	if err := setIntent(namespace, intent); err != nil {
+		return err
+	}
+
+	return h.SaveNamespace(ctx, namespace)
+}
+
+// endNamespaceIntent -- clears the intent of a failed operation and saves the namespace. Successful operations clear
+// the intent in memory only, it is saved by the reconciler together with the result.
+func (h *ProdEgressIPHandler) endNamespaceIntent(ctx context.Context, namespace *corev1.Namespace) error {
+	if !clearIntent(namespace) {
+		return nil
+	}
+
+	return h.SaveNamespace(ctx, namespace)
+}
+
+// RecoverNamespaceIntent rolls back an operation of the namespace left over by a stopped operator: the IPs allocated by
+// the operation are removed from the cloud, the HostSubnets and the NetNamespace and the intent is cleared. IPs of the
+// intent not recorded as allocated are allocated if an egress node carries them but no HostSubnet does, the operator
+// stopped before recording them then. Other IPs of the intent are left in place. Returns true if there has been an
+// intent to recover.
+func (h *ProdEgressIPHandler) RecoverNamespaceIntent(ctx context.Context, namespace *corev1.Namespace) (bool, error) {
+	intent, err := readIntent(namespace)
+	if err != nil || intent == nil {
+		return false, err
+	}
+
+	unrecorded, err := h.unrecordedAllocations(ctx, intent)
+	if err != nil {
+		// the intent is kept to retry the recovery.
+		return true, err
+	}
+	allocated := append(append([]string{}, intent.Allocated...), unrecorded...)
+
+	log.Info("rolling back the leftover intent of namespace",
+		"namespace", namespace.Name,
+		"operation", intent.Operation,
+		"started", intent.Started,
+		"ips", intent.IPs,
+		"allocated", allocated,
+	)
+
+	err = h.removeIPsFromNodes(ctx, allocated, "")
+
+	netNamespace, err2 := h.LoadNetNameSpace(ctx, namespace.Name)
+	if err2 != nil && !IsNotFound(err2) {
+		err = multierror.Append(err, err2)
+	}
+	if netNamespace != nil && containsAny(netNamespace.EgressIPs, allocated) {
+		h.RemoveIPsFromNetNamespace(netNamespace)
+		if err2 := h.SaveNetNameSpace(ctx, netNamespace); err2 != nil {
+			err = multierror.Append(err, err2)
+		}
+	}
+
+	if err != nil {
+		// the intent is kept to retry the recovery.
+		return true, err
+	}
+
+	return true, h.endNamespaceIntent(ctx, namespace)
+}
+
+// unrecordedAllocations -- returns the IPs of the intent not recorded as allocated that an egress node carries but no
+// HostSubnet does. A cloud provider caching the state of the cloud is resynced first. Cloud providers unable to list
+// their egress nodes have no unrecorded allocations.
+func (h *ProdEgressIPHandler) unrecordedAllocations(ctx context.Context, intent *Intent) ([]string, error) {
+	candidates := make([]string, 0, len(intent.IPs))
+	for _, ip := range intent.IPs {
+		if !containsAny(intent.Allocated, []string{ip}) {
+			candidates = append(candidates, ip)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	lister, ok := h.cloud.(cloudprovider.EgressNodeLister)
+	if !ok {
+		log.Info("the cloud provider can't list its egress nodes - only the recorded allocations are rolled back",
+			"ips", candidates,
+		)
+		return nil, nil
+	}
+	if syncer, ok := h.cloud.(cloudprovider.InventorySyncer); ok {
+		if err := syncer.Resync(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	nodes, err := lister.EgressNodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	carried := make(map[string]bool)
+	for _, node := range nodes {
+		for _, ip := range (*node).SecondaryIps() {
+			carried[ip.String()] = true
+		}
+	}
+
+	hostSubnets := &ocpnetv1.HostSubnetList{}
+	if err := h.client.List(ctx, hostSubnets); err != nil {
+		return nil, classifyAPIError("HostSubnet", "", err)
+	}
+	for _, hostSubnet := range hostSubnets.Items {
+		for _, ip := range hostSubnet.EgressIPs {
+			if parsed := net.ParseIP(ip); parsed != nil {
+				carried[parsed.String()] = false
+			}
+		}
+	}
+
+	result := make([]string, 0, len(candidates))
+	for _, ip := range candidates {
+		if carried[ip] {
+			result = append(result, ip)
+		}
+	}
+	return result, nil
+}
+
+// beginHostSubnetIntent -- records the intent on the hostSubnet and saves it before the IPs are moved.
+func (h *ProdEgressIPHandler) beginHostSubnetIntent(ctx context.Context, hostSubnet *ocpnetv1.HostSubnet, intent *Intent) error {
+	if err := setIntent(hostSubnet, intent); err != nil {
+		return err
+	}
+
+	return h.SaveHostSubnet(ctx, hostSubnet)
+}
+
+// endHostSubnetIntent -- clears the intent of a failed operation and saves the hostSubnet. Successful operations clear
+// the intent in memory only, it is saved by the reconciler together with the result.
+func (h *ProdEgressIPHandler) endHostSubnetIntent(ctx context.Context, hostSubnet *ocpnetv1.HostSubnet) error {
+	if !clearIntent(hostSubnet) {
+		return nil
+	}
+
+	return h.SaveHostSubnet(ctx, hostSubnet)
+}
+
+// RecoverHostSubnetIntent rolls back a redistribution of the hostSubnet left over by a stopped operator: the IPs of the
+// intent are removed from the HostSubnets of the other nodes and put back on the hostSubnet to be redistributed again.
+// The cloud is not changed, moved IPs stay on the instance they have been moved to until they are moved again. A
+// leftover reclaim or failover is kept to be resumed. Returns true if there has been an intent to recover.
+func (h *ProdEgressIPHandler) RecoverHostSubnetIntent(ctx context.Context, hostSubnet *ocpnetv1.HostSubnet) (bool, error) {
+	intent, err := readIntent(hostSubnet)
+	if err != nil || intent == nil {
+		return false, err
+	}
+	if intent.resumable() {
+		// resumed by the next redistribution of the hostSubnet.
+		return false, nil
+	}
+
+	log.Info("rolling back the leftover intent of hostSubnet",
+		"hostSubnet", hostSubnet.Name,
+		"operation", intent.Operation,
+		"started", intent.Started,
+		"ips", intent.IPs,
+	)
+
+	namespaces, err := h.removeIPsFromHostSubnets(ctx, intent.IPs, hostSubnet.Name)
+	if err != nil {
+		// the intent is kept to retry the recovery.
+		return true, err
+	}
+
+	for _, ip := range intent.IPs {
+		if !containsAny(hostSubnet.EgressIPs, []string{ip}) {
+			hostSubnet.EgressIPs = append(hostSubnet.EgressIPs, ip)
+		}
+		if _, found := ipNamespaces(hostSubnet)[ip]; !found && namespaces[ip] != "" {
+			setIPNamespace(hostSubnet, ip, namespaces[ip])
+		}
+	}
+
+	return true, h.endHostSubnetIntent(ctx, hostSubnet)
+}
+
+// removeIPsFromHostSubnets -- removes the IPs and their IP-to-namespace annotations from all HostSubnets carrying them
+// without changing the cloud. The hostSubnet with the given name is skipped. Returns the namespaces of the removed
+// annotations with key=ip.
+func (h *ProdEgressIPHandler) removeIPsFromHostSubnets(ctx context.Context, ips []string, skipHostSubnet string) (map[string]string, error) {
+	namespaces := make(map[string]string)
+	if len(ips) == 0 {
+		return namespaces, nil
+	}
+
+	hostSubnets := &ocpnetv1.HostSubnetList{}
+	if err := h.client.List(ctx, hostSubnets); err != nil {
+		return namespaces, classifyAPIError("HostSubnet", "", err)
+	}
+
+	var result error
+	for i := range hostSubnets.Items {
+		hostSubnet := &hostSubnets.Items[i]
+		if hostSubnet.Name == skipHostSubnet {
+			continue
+		}
+
+		changed := false
+		owners := ipNamespaces(hostSubnet)
+		for _, ip := range ips {
+			for n, egressIP := range hostSubnet.EgressIPs {
+				if egressIP == ip {
+					hostSubnet.EgressIPs = append(hostSubnet.EgressIPs[:n], hostSubnet.EgressIPs[n+1:]...)
+					changed = true
+					break
+				}
+			}
+			if removeIPNamespace(hostSubnet, ip) {
+				namespaces[ip] = owners[ip]
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+
+		log.Info("removing egressIPs from hostSubnet",
+			"ips", ips,
+			"hostSubnet", hostSubnet.Name,
+		)
+		if err := h.SaveHostSubnet(ctx, hostSubnet); err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+
+	return namespaces, result
+}
+
+// removeIPsFromNodes -- removes the IPs from the cloud and the HostSubnets of the nodes carrying them. The hostSubnet
+// with the given name is skipped. IPs already removed are no error.
+func (h *ProdEgressIPHandler) removeIPsFromNodes(ctx context.Context, ips []string, skipHostSubnet string) error {
+	var result error
+
+	for _, ipString := range ips {
+		ip := net.ParseIP(ipString)
+		if ip == nil {
+			continue
+		}
+
+		instanceID, err := h.cloud.RemoveIP(ctx, &ip)
+		if err != nil {
+			if !cloudprovider.IsNotFound(err) {
+				result = multierror.Append(result, err)
+			}
+			continue
+		}
+		if instanceID == "" {
+			continue
+		}
+
+		instance, err := h.cloud.Instance(ctx, instanceID)
+		if err != nil {
+			result = multierror.Append(result, err)
+			continue
+		}
+		if (*instance).HostName() == skipHostSubnet {
+			continue
+		}
+
+		err = h.removeIPFromHostSubnet(ctx, *instance, &ip)
+		if err != nil && !IsNotFound(err) {
+			result = multierror.Append(result, err)
+		}
+	}
+
+	return result
+}
+
+// containsAny -- checks if any of the values is in the list.
+func containsAny(list []string, values []string) bool {
+	for _, l := range list {
+		for _, v := range values {
+			if l == v {
+				return true
+			}
+		}
+	}
+	return false
+}
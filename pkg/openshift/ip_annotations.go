@@ -0,0 +1,147 @@
+package openshift
+
+import (
+	"context"
+	"github.com/hashicorp/go-multierror"
+	ocpnetv1 "github.com/openshift/api/network/v1"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// limit of the cleanup of the IP-to-namespace annotations of all HostSubnets
+const ipAnnotationCleanupTimeout = 5 * time.Minute
+
+// setIPNamespace -- sets the IP-to-namespace annotation of the IP on the hostSubnet. Returns true if it changed. The
+// hostSubnet needs to be saved after that.
+func setIPNamespace(hostSubnet *ocpnetv1.HostSubnet, ip string, namespace string) bool {
+	annotations := hostSubnet.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string, 1)
+	}
+
+	if current, found := annotations[IPToNamespaceAnnotation+ip]; found && current == namespace {
+		return false
+	}
+
+	annotations[IPToNamespaceAnnotation+ip] = namespace
+	hostSubnet.SetAnnotations(annotations)
+	return true
+}
+
+// removeIPNamespace -- removes the IP-to-namespace annotation of the IP from the hostSubnet. Returns true if it
+// changed. The hostSubnet needs to be saved after that.
+func removeIPNamespace(hostSubnet *ocpnetv1.HostSubnet, ip string) bool {
+	annotations := hostSubnet.GetAnnotations()
+	if _, found := annotations[IPToNamespaceAnnotation+ip]; !found {
+		return false
+	}
+
+	delete(annotations, IPToNamespaceAnnotation+ip)
+	return true
+}
+
+// ipNamespaces -- returns the IP-to-namespace annotations of the hostSubnet with key=ip and the namespace as value.
+// Other annotations sharing the prefix (e.g. the intent) are skipped.
+func ipNamespaces(hostSubnet *ocpnetv1.HostSubnet) map[string]string {
+	result := make(map[string]string)
+
+	for key, namespace := range hostSubnet.GetAnnotations() {
+		if !strings.HasPrefix(key, IPToNamespaceAnnotation) {
+			continue
+		}
+
+		ip := strings.TrimPrefix(key, IPToNamespaceAnnotation)
+		if net.ParseIP(ip) != nil {
+			result[ip] = namespace
+		}
+	}
+
+	return result
+}
+
+// pruneIPNamespaces -- removes the IP-to-namespace annotations of the IPs not listed in the egress IPs of the
+// hostSubnet and returns the IPs removed. The hostSubnet needs to be saved after that.
+func pruneIPNamespaces(hostSubnet *ocpnetv1.HostSubnet) []string {
+	egressIPs := make(map[string]bool, len(hostSubnet.EgressIPs))
+	for _, ip := range hostSubnet.EgressIPs {
+		egressIPs[ip] = true
+	}
+
+	result := make([]string, 0)
+	for ip := range ipNamespaces(hostSubnet) {
+		if !egressIPs[ip] {
+			removeIPNamespace(hostSubnet, ip)
+			result = append(result, ip)
+		}
+	}
+	sort.Strings(result)
+
+	return result
+}
+
+// IPAnnotationCleanup removes the stale IP-to-namespace annotations of all HostSubnets once at startup. Older versions
+// of the operator kept them when the IPs left the HostSubnet. HostSubnets with an operation in progress are skipped,
+// the handler keeps their annotations in sync when the operation ends.
+type IPAnnotationCleanup struct {
+	client OcpClient
+}
+
+// NewIPAnnotationCleanup creates the cleanup of the IP-to-namespace annotations.
+func NewIPAnnotationCleanup(client OcpClient) *IPAnnotationCleanup {
+	return &IPAnnotationCleanup{client: client}
+}
+
+// Start runs the cleanup once. It is a manager.Runnable of the controller-runtime. Failures are logged only, the next
+// start of the operator retries them.
+func (c *IPAnnotationCleanup) Start(<-chan struct{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), ipAnnotationCleanupTimeout)
+	defer cancel()
+
+	removed, err := c.Cleanup(ctx)
+	if err != nil {
+		log.Error(err, "cleanup of the stale ip annotations of hostSubnets is incomplete")
+	}
+
+	log.Info("cleaned up the stale ip annotations of hostSubnets", "removed", removed)
+	return nil
+}
+
+// Cleanup removes the stale IP-to-namespace annotations of all HostSubnets and returns the removed IPs per hostSubnet.
+func (c *IPAnnotationCleanup) Cleanup(ctx context.Context) (map[string][]string, error) {
+	hostSubnets := &ocpnetv1.HostSubnetList{}
+	if err := c.client.List(ctx, hostSubnets); err != nil {
+		return nil, classifyAPIError("HostSubnet", "", err)
+	}
+
+	result := make(map[string][]string)
+	var err error
+
+	for i := range hostSubnets.Items {
+		hostSubnet := &hostSubnets.Items[i]
+
+		if intent, err2 := readIntent(hostSubnet); err2 != nil || intent != nil {
+			log.Info("skipping hostSubnet with an operation in progress", "hostSubnet", hostSubnet.Name)
+			continue
+		}
+
+		stale := pruneIPNamespaces(hostSubnet)
+		if len(stale) == 0 {
+			continue
+		}
+
+		if err2 := classifyAPIError("HostSubnet", hostSubnet.Name, c.client.Update(ctx, hostSubnet)); err2 != nil {
+			err = multierror.Append(err, err2)
+			continue
+		}
+
+		log.Info("removed stale ip annotations from hostSubnet",
+			"hostSubnet", hostSubnet.Name,
+			"ips", stale,
+		)
+		result[hostSubnet.Name] = stale
+	}
+
+	return result, err
+}
@@ -0,0 +1,39 @@
+package openshift
+
+import (
+	"github.com/klenkes74/aws-egressip-operator/pkg/cloudprovider"
+	"net"
+	"strings"
+)
+
+// ParseIPList parses the comma separated list of IPv4 and IPv6 addresses of an egress IP annotation. Blanks around the
+// addresses are ignored. An empty list returns no IPs, an invalid address a cloudprovider.InvalidIPError.
+func ParseIPList(value string) ([]*net.IP, error) {
+	result := make([]*net.IP, 0)
+
+	for _, ipString := range strings.Split(value, ",") {
+		ipString = strings.TrimSpace(ipString)
+		if ipString == "" {
+			continue
+		}
+
+		ip := net.ParseIP(ipString)
+		if ip == nil {
+			return nil, &cloudprovider.InvalidIPError{IP: ipString, Reason: "is not a valid ip address"}
+		}
+		result = append(result, &ip)
+	}
+
+	return result, nil
+}
+
+// containsIPv6 checks if any of the IPs is an IPv6 address.
+func containsIPv6(ips []*net.IP) bool {
+	for _, ip := range ips {
+		if cloudprovider.FamilyOf(*ip) == cloudprovider.IPv6 {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,121 @@
+package openshift
+
+import (
+	"context"
+	"fmt"
+	"github.com/hashicorp/go-multierror"
+	"github.com/klenkes74/aws-egressip-operator/pkg/cloudprovider"
+	ocpnetv1 "github.com/openshift/api/network/v1"
+	"net"
+)
+
+// validateSpecifiedIPs -- checks the specified IPs of the namespace before the cloud is changed: every IP may be listed
+// once and must not be owned by another namespace, neither as egress IP of its NetNamespace nor as egress IP of a
+// HostSubnet annotated with it. An egress IP of a HostSubnet without IP annotation is owned by an unknown namespace.
+// The checks of the cloud provider (subnets, reserved addresses, zones, network interfaces) follow if it is an
+// IPValidator. Invalid IPs are reported as cloudprovider.InvalidIPError combined in a multierror.
+func (h *ProdEgressIPHandler) validateSpecifiedIPs(ctx context.Context, request cloudprovider.IPRequest, ips []*net.IP) error {
+	var result error
+
+	seen := make(map[string]bool, len(ips))
+	for _, ip := range ips {
+		if ip == nil {
+			result = multierror.Append(result, &cloudprovider.InvalidIPError{IP: "<nil>", Reason: "is no ip address"})
+			continue
+		}
+
+		if seen[ip.String()] {
+			result = multierror.Append(result, &cloudprovider.InvalidIPError{IP: ip.String(), Reason: "is listed twice"})
+		}
+		seen[ip.String()] = true
+	}
+	if result != nil {
+		return result
+	}
+
+	owners, hostSubnets, err := h.egressIPOwners(ctx)
+	if err != nil {
+		return err
+	}
+	for _, ip := range ips {
+		if err := validateOwnerOfIP(ip.String(), request.Namespace, owners[ip.String()], hostSubnets[ip.String()]); err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+	if result != nil {
+		return result
+	}
+
+	if validator, ok := h.cloud.(cloudprovider.IPValidator); ok {
+		return validator.ValidateSpecifiedIPs(ctx, request, ips)
+	}
+
+	return nil
+}
+
+// validateOwnerOfIP -- checks that the IP is unused or owned by the namespace only.
+func validateOwnerOfIP(ip string, namespace string, owners []string, hostSubnets []string) error {
+	for _, owner := range owners {
+		if owner != namespace {
+			return &cloudprovider.InvalidIPError{IP: ip, Reason: fmt.Sprintf("is already used by namespace '%s'", owner)}
+		}
+	}
+
+	if len(owners) == 0 && len(hostSubnets) > 0 {
+		return &cloudprovider.InvalidIPError{
+			IP:     ip,
+			Reason: fmt.Sprintf("is already an egress ip of hostSubnet '%s' without namespace", hostSubnets[0]),
+		}
+	}
+
+	return nil
+}
+
+// egressIPOwners -- returns the namespaces owning the egress IPs of the NetNamespaces and the HostSubnets by their IP
+// annotations (ip -> namespaces) and the HostSubnets carrying the egress IPs (ip -> hostSubnets). Stale IP annotations
+// of IPs the HostSubnet does not carry are skipped.
+func (h *ProdEgressIPHandler) egressIPOwners(ctx context.Context) (map[string][]string, map[string][]string, error) {
+	netNamespaces := &ocpnetv1.NetNamespaceList{}
+	if err := h.client.List(ctx, netNamespaces); err != nil {
+		return nil, nil, err
+	}
+
+	hostSubnets := &ocpnetv1.HostSubnetList{}
+	if err := h.client.List(ctx, hostSubnets); err != nil {
+		return nil, nil, err
+	}
+
+	owners := make(map[string][]string)
+	addOwner := func(ip string, namespace string) {
+		parsed := net.ParseIP(ip)
+		if parsed == nil || namespace == "" {
+			return
+		}
+		for _, owner := range owners[parsed.String()] {
+			if owner == namespace {
+				return
+			}
+		}
+		owners[parsed.String()] = append(owners[parsed.String()], namespace)
+	}
+
+	for _, netNamespace := range netNamespaces.Items {
+		for _, ip := range netNamespace.EgressIPs {
+			addOwner(ip, netNamespace.Name)
+		}
+	}
+
+	carriers := make(map[string][]string)
+	for i := range hostSubnets.Items {
+		hostSubnet := &hostSubnets.Items[i]
+		namespaces := ipNamespaces(hostSubnet)
+		for _, ip := range hostSubnet.EgressIPs {
+			if parsed := net.ParseIP(ip); parsed != nil {
+				addOwner(ip, namespaces[ip])
+				carriers[parsed.String()] = append(carriers[parsed.String()], hostSubnet.Name)
+			}
+		}
+	}
+
+	return owners, carriers, nil
+}
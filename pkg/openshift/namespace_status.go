@@ -0,0 +1,47 @@
+package openshift
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	apiv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// EgressIPsValidCondition is the condition of the namespace status reporting if the egress IPs could be assigned.
+const EgressIPsValidCondition corev1.NamespaceConditionType = "EgressIPsValid"
+
+// Reasons of the EgressIPsValidCondition, also used as reasons of the events of the namespace.
+const (
+	ReasonEgressIPsAssigned = "EgressIPsAssigned"
+	ReasonInvalidEgressIPs  = "InvalidEgressIPs"
+)
+
+// SetEgressIPCondition sets the EgressIPsValidCondition of the namespace status. The transition time only changes
+// with the status. Returns true if the condition has been changed.
+func SetEgressIPCondition(namespace *corev1.Namespace, status corev1.ConditionStatus, reason string, message string) bool {
+	for i := range namespace.Status.Conditions {
+		condition := &namespace.Status.Conditions[i]
+		if condition.Type != EgressIPsValidCondition {
+			continue
+		}
+
+		if condition.Status == status && condition.Reason == reason && condition.Message == message {
+			return false
+		}
+
+		if condition.Status != status {
+			condition.LastTransitionTime = apiv1.Now()
+		}
+		condition.Status = status
+		condition.Reason = reason
+		condition.Message = message
+		return true
+	}
+
+	namespace.Status.Conditions = append(namespace.Status.Conditions, corev1.NamespaceCondition{
+		Type:               EgressIPsValidCondition,
+		Status:             status,
+		LastTransitionTime: apiv1.Now(),
+		Reason:             reason,
+		Message:            message,
+	})
+	return true
+}
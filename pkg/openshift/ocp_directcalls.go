@@ -20,6 +20,8 @@ func NewOcpClient(ocp client.Client) *OcpClient {
 type OcpClient interface {
 	Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error
 	Update(ctx context.Context, obj runtime.Object, opts ...client.UpdateOption) error
+	List(ctx context.Context, list runtime.Object, opts ...client.ListOption) error
+	UpdateStatus(ctx context.Context, obj runtime.Object) error
 }
 
 // ensure the type of OcpClientImpl
@@ -39,3 +41,13 @@ func (o OcpClientImpl) Get(ctx context.Context, key client.ObjectKey, obj runtim
 func (o OcpClientImpl) Update(ctx context.Context, obj runtime.Object, opts ...client.UpdateOption) error {
 	return o.client.Update(ctx, obj, opts...)
 }
+
+// List -- retrieve a list of OCP objects.
+func (o OcpClientImpl) List(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+	return o.client.List(ctx, list, opts...)
+}
+
+// UpdateStatus -- update the status of an OCP object.
+func (o OcpClientImpl) UpdateStatus(ctx context.Context, obj runtime.Object) error {
+	return o.client.Status().Update(ctx, obj)
+}
@@ -0,0 +1,284 @@
+package openshift
+
+import (
+	"context"
+	"fmt"
+	"github.com/hashicorp/go-multierror"
+	"github.com/klenkes74/aws-egressip-operator/pkg/observability"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// OrphanCollectorMode -- what the collector does with secondary IPs of egress nodes nothing in OpenShift references.
+type OrphanCollectorMode string
+
+const (
+	// OrphanCollectorOff disables the collector.
+	OrphanCollectorOff OrphanCollectorMode = "off"
+	// OrphanCollectorReport logs the orphaned IPs past their grace period and publishes them as metric only.
+	OrphanCollectorReport OrphanCollectorMode = "report"
+	// OrphanCollectorRemove unassigns the orphaned IPs past their grace period from the instances.
+	OrphanCollectorRemove OrphanCollectorMode = "remove"
+)
+
+const (
+	defaultOrphanCollectorMode        = OrphanCollectorReport
+	defaultOrphanCollectorPeriod      = 10 * time.Minute
+	defaultOrphanCollectorGracePeriod = time.Hour
+	orphanCollectionTimeout           = 5 * time.Minute // limit of a single collection including the removals
+)
+
+// ParseOrphanCollectorMode parses the collector mode ("off", "report" or "remove"). An empty value returns the default.
+func ParseOrphanCollectorMode(value string) (OrphanCollectorMode, error) {
+	switch OrphanCollectorMode(strings.ToLower(strings.TrimSpace(value))) {
+	case "":
+		return defaultOrphanCollectorMode, nil
+	case OrphanCollectorOff:
+		return OrphanCollectorOff, nil
+	case OrphanCollectorReport:
+		return OrphanCollectorReport, nil
+	case OrphanCollectorRemove:
+		return OrphanCollectorRemove, nil
+	default:
+		return defaultOrphanCollectorMode, fmt.Errorf("unknown orphan collector mode '%s' (valid: '%s', '%s', '%s')", value,
+			OrphanCollectorOff, OrphanCollectorReport, OrphanCollectorRemove)
+	}
+}
+
+// OrphanCollectorModeFromEnvironment reads the collector mode from the environment variable ORPHAN_IP_GC. An invalid
+// value is logged and the orphaned IPs are reported only.
+func OrphanCollectorModeFromEnvironment() OrphanCollectorMode {
+	value, _ := os.LookupEnv("ORPHAN_IP_GC")
+
+	result, err := ParseOrphanCollectorMode(value)
+	if err != nil {
+		log.Error(err, "invalid value of ORPHAN_IP_GC", "using default", result)
+	}
+
+	return result
+}
+
+// OrphanCollectorPeriod returns the time between two collections of orphaned IPs. It is read from the environment
+// variable ORPHAN_IP_GC_PERIOD (e.g. "30m"), the default is ten minutes.
+func OrphanCollectorPeriod() time.Duration {
+	result := durationFromEnvironment("ORPHAN_IP_GC_PERIOD", defaultOrphanCollectorPeriod)
+	if result == 0 {
+		log.Info("ORPHAN_IP_GC_PERIOD must not be 0", "using default", defaultOrphanCollectorPeriod)
+		return defaultOrphanCollectorPeriod
+	}
+
+	return result
+}
+
+// OrphanGracePeriod returns how long an IP has to be orphaned before it is reported or removed. It is read from the
+// environment variable ORPHAN_IP_GC_GRACE_PERIOD (e.g. "2h"), the default is one hour.
+func OrphanGracePeriod() time.Duration {
+	return durationFromEnvironment("ORPHAN_IP_GC_GRACE_PERIOD", defaultOrphanCollectorGracePeriod)
+}
+
+// ParseIPExclusions parses a comma separated list of IPs and CIDRs (e.g. "10.0.1.5,10.0.2.0/28").
+func ParseIPExclusions(value string) ([]*net.IPNet, error) {
+	result := make([]*net.IPNet, 0)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("'%s' is no ip address", entry)
+			}
+
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			result = append(result, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, cidr, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is no cidr: %w", entry, err)
+		}
+		result = append(result, cidr)
+	}
+
+	return result, nil
+}
+
+// OrphanExclusionsFromEnvironment reads the IPs and CIDRs never collected from the environment variable
+// ORPHAN_IP_GC_EXCLUDE. An invalid value is logged and excludes everything to keep the collector from removing IPs the
+// administrator wanted to protect.
+func OrphanExclusionsFromEnvironment() []*net.IPNet {
+	value, _ := os.LookupEnv("ORPHAN_IP_GC_EXCLUDE")
+
+	result, err := ParseIPExclusions(value)
+	if err != nil {
+		log.Error(err, "invalid value of ORPHAN_IP_GC_EXCLUDE - no orphaned ip is collected")
+		_, all4, _ := net.ParseCIDR("0.0.0.0/0")
+		_, all6, _ := net.ParseCIDR("::/0")
+		return []*net.IPNet{all4, all6}
+	}
+
+	return result
+}
+
+// durationFromEnvironment -- reads a duration (e.g. "30m") from the environment variable. Invalid or negative values
+// are logged and the default is used.
+func durationFromEnvironment(name string, defaultValue time.Duration) time.Duration {
+	value, found := os.LookupEnv(name)
+	if !found {
+		return defaultValue
+	}
+
+	result, err := time.ParseDuration(value)
+	if err != nil || result < 0 {
+		log.Error(fmt.Errorf("%s '%s' is no valid duration", name, value), "using default", "duration", defaultValue)
+		return defaultValue
+	}
+
+	return result
+}
+
+// OrphanCollector looks periodically for secondary IPs of egress nodes nothing in OpenShift references. IPs orphaned
+// for longer than the grace period are reported or removed depending on the mode. Excluded IPs are never touched.
+type OrphanCollector struct {
+	handler    EgressIPHandler
+	mode       OrphanCollectorMode
+	period     time.Duration
+	grace      time.Duration
+	exclusions []*net.IPNet
+
+	firstSeen map[string]time.Time // IP -> the first collection finding it orphaned
+}
+
+// NewOrphanCollector creates the collector running every period.
+func NewOrphanCollector(handler EgressIPHandler, mode OrphanCollectorMode, period time.Duration, grace time.Duration, exclusions []*net.IPNet) *OrphanCollector {
+	return &OrphanCollector{
+		handler:    handler,
+		mode:       mode,
+		period:     period,
+		grace:      grace,
+		exclusions: exclusions,
+		firstSeen:  make(map[string]time.Time),
+	}
+}
+
+// Start runs the collection every period until stopped. It is a manager.Runnable of the controller-runtime.
+func (c *OrphanCollector) Start(stop <-chan struct{}) error {
+	log.Info("starting orphaned ip collector",
+		"mode", c.mode,
+		"period", c.period,
+		"grace-period", c.grace,
+		"exclusions", c.exclusions,
+	)
+
+	ticker := time.NewTicker(c.period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), orphanCollectionTimeout)
+		_, err := c.Collect(ctx)
+		cancel()
+		if err != nil {
+			log.Error(err, "orphaned ip collection failed")
+		}
+	}
+}
+
+// Collect runs a single collection. Returns the orphaned IPs past their grace period. They are removed in remove mode
+// and logged in report mode.
+func (c *OrphanCollector) Collect(ctx context.Context) ([]OrphanedIP, error) {
+	orphans, err := c.handler.FindOrphanedIPs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	seen := make(map[string]time.Time)
+	due := make([]OrphanedIP, 0)
+	excluded := 0
+	for _, orphan := range orphans {
+		if c.excludes(orphan.IP) {
+			excluded++
+			continue
+		}
+
+		firstSeen, found := c.firstSeen[orphan.IP]
+		if !found {
+			firstSeen = now
+		}
+		seen[orphan.IP] = firstSeen
+
+		if now.Sub(firstSeen) >= c.grace {
+			due = append(due, orphan)
+		}
+	}
+	c.firstSeen = seen // IPs not orphaned anymore start a new grace period when they are orphaned again
+
+	observability.ReportOrphanedIPs(len(seen)-len(due), len(due), excluded)
+
+	if c.mode != OrphanCollectorRemove {
+		for _, orphan := range due {
+			log.Info("found orphaned ip",
+				"ip", orphan.IP,
+				"instance", orphan.Instance,
+				"hostname", orphan.HostName,
+				"orphaned-since", seen[orphan.IP],
+			)
+		}
+		return due, nil
+	}
+
+	if len(due) == 0 {
+		return due, nil
+	}
+
+	removed, err := c.handler.RemoveOrphanedIPs(ctx, due)
+	for _, ip := range removed {
+		delete(c.firstSeen, ip)
+	}
+	observability.CountOrphanedIPRemovals(len(removed), countFailedRemovals(due, err))
+
+	return due, err
+}
+
+// excludes -- checks if the IP is on the exclusion list.
+func (c *OrphanCollector) excludes(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return true
+	}
+
+	for _, exclusion := range c.exclusions {
+		if exclusion.Contains(parsed) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// countFailedRemovals -- the number of due IPs the removal failed for.
+func countFailedRemovals(due []OrphanedIP, err error) int {
+	if err == nil {
+		return 0
+	}
+	if errs, ok := err.(*multierror.Error); ok {
+		return len(errs.Errors)
+	}
+
+	return len(due) // the references could not be read, nothing has been removed
+}
@@ -0,0 +1,103 @@
+package openshift
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hashicorp/go-multierror"
+	"github.com/klenkes74/aws-egressip-operator/pkg/cloudprovider"
+	"net"
+	"sort"
+)
+
+// OrphanedIP is a secondary IP of an egress node no namespace, NetNamespace or HostSubnet references.
+type OrphanedIP struct {
+	IP       string
+	Instance string // the instance carrying the IP
+	HostName string // the hostname of the instance
+}
+
+// FindOrphanedIPs lists the secondary IPs of all egress nodes of the cloud and returns the ones not referenced by a
+// namespace, a NetNamespace or a HostSubnet (as egress IP or IP annotation) sorted by IP. IPs of operations in
+// progress and unclaimed IPs of the warm pool are never orphaned. IPv6 addresses are only considered if the SDN
+// supports IPv6 egress IPs.
+func (h *ProdEgressIPHandler) FindOrphanedIPs(ctx context.Context) ([]OrphanedIP, error) {
+	lister, ok := h.cloud.(cloudprovider.EgressNodeLister)
+	if !ok {
+		return nil, errors.New("the cloud provider can't list its egress nodes")
+	}
+
+	sources, _, err := h.readOcpEgressIPs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes, err := lister.EgressNodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	unclaimed := h.unclaimedIPs()
+
+	result := make([]OrphanedIP, 0)
+	for _, node := range nodes {
+		for _, ip := range (*node).SecondaryIps() {
+			if !h.ipv6Egress && cloudprovider.FamilyOf(*ip) == cloudprovider.IPv6 {
+				continue
+			}
+			if unclaimed[ip.String()] || sources.owns(ip.String()) {
+				continue
+			}
+
+			result = append(result, OrphanedIP{IP: ip.String(), Instance: (*node).ID(), HostName: (*node).HostName()})
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].IP < result[j].IP
+	})
+	return result, nil
+}
+
+// RemoveOrphanedIPs unassigns the orphaned IPs in the cloud (releasing their public IPs) and returns the IPs removed.
+// The references are read again first: IPs referenced in the meantime are kept. IPs already gone are no error.
+func (h *ProdEgressIPHandler) RemoveOrphanedIPs(ctx context.Context, orphans []OrphanedIP) ([]string, error) {
+	sources, _, err := h.readOcpEgressIPs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	unclaimed := h.unclaimedIPs()
+
+	var result error
+	removed := make([]string, 0, len(orphans))
+	for _, orphan := range orphans {
+		if unclaimed[orphan.IP] || sources.owns(orphan.IP) {
+			log.Info("orphaned ip is used again - keeping it",
+				"ip", orphan.IP,
+				"instance", orphan.Instance,
+			)
+			continue
+		}
+
+		ip := net.ParseIP(orphan.IP)
+		if ip == nil {
+			result = multierror.Append(result, &cloudprovider.InvalidIPError{IP: orphan.IP, Reason: "is no ip address"})
+			continue
+		}
+
+		instanceID, err := h.cloud.RemoveIP(ctx, &ip)
+		if err != nil && !cloudprovider.IsNotFound(err) {
+			result = multierror.Append(result, fmt.Errorf("can't remove orphaned ip '%s': %w", orphan.IP, err))
+			continue
+		}
+
+		log.Info("removed orphaned ip",
+			"ip", orphan.IP,
+			"instance", instanceID,
+		)
+		removed = append(removed, orphan.IP)
+	}
+
+	return removed, result
+}
@@ -19,17 +19,39 @@ import (
 // IPToNamespaceAnnotation -- Will be used to construct the IP-to-namespace annotation on hostSubnet in form of "egressip-ipam-operator.redhat-cop.io/<ip>=<namespace>"
 const IPToNamespaceAnnotation = "egressip-ipam-operator.redhat-cop.io/"
 
+// IPFamiliesAnnotation -- The address families of the random IPs of a namespace as comma separated list (e.g.
+// "IPv4,IPv6"). Without the annotation a namespace gets IPv4 addresses.
+const IPFamiliesAnnotation = "egressip-ipam-operator.redhat-cop.io/ip-families"
+
+// ZonesAnnotation -- The failure zones getting random IPs for a namespace as comma separated list in preferred order
+// (e.g. "eu-central-1b,eu-central-1a"). Without the annotation all zones get an IP.
+const ZonesAnnotation = "egressip-ipam-operator.redhat-cop.io/zones"
+
+// ZoneCountAnnotation -- The number of failure zones getting a random IP for a namespace. The first zones of the
+// ZonesAnnotation (or of all zones in alphabetical order) are used.
+const ZoneCountAnnotation = "egressip-ipam-operator.redhat-cop.io/zone-count"
+
+// ElasticIPAnnotation -- Opt-in of a namespace ("true") to get a public (elastic) IP for every IPv4 egress IP.
+const ElasticIPAnnotation = "egressip-ipam-operator.redhat-cop.io/elastic-ip"
+
+// PublicIPsAnnotation -- The public IPs associated with the egress IPs of a namespace as comma separated list.
+const PublicIPsAnnotation = "egressip-ipam-operator.redhat-cop.io/public-ips"
+
 var _ EgressIPHandler = &ProdEgressIPHandler{}
 
 // ProdEgressIPHandler The AWS/OCP implementation of the EgressIPHandler
 type ProdEgressIPHandler struct {
 	client OcpClient
 	cloud  cloudprovider.CloudProvider
+
+	ipv6Egress     bool           // the SDN supports IPv6 egress IPs on HostSubnets and NetNamespaces
+	assignmentMode AssignmentMode // rollback or keep partially failed assignments
+	zoneFailover   bool           // replace the IPs of a zone without egress nodes by IPs of other zones
 }
 
 // CheckIPsForHost - tests if all IPs are attached to this host
-func (h *ProdEgressIPHandler) CheckIPsForHost(hostSubnet *ocpnetv1.HostSubnet, ips []*net.IP) error {
-	i, err := h.cloud.InstanceByHostName(hostSubnet.Name)
+func (h *ProdEgressIPHandler) CheckIPsForHost(ctx context.Context, hostSubnet *ocpnetv1.HostSubnet, ips []*net.IP) error {
+	i, err := h.cloud.InstanceByHostName(ctx, hostSubnet.Name)
 	if err != nil {
 		return err
 	}
@@ -59,74 +81,297 @@ func (h *ProdEgressIPHandler) CheckIPsForHost(hostSubnet *ocpnetv1.HostSubnet, i
 	return nil
 }
 
-// AddIPsToInfrastructure - adds the annotated IPs of the namespace to the operating system and AWS.
-func (h *ProdEgressIPHandler) AddIPsToInfrastructure(namespace *corev1.Namespace) ([]*net.IP, error) {
+// AddIPsToInfrastructure - adds the annotated IPs of the namespace to the operating system and AWS. If a step fails,
+// the steps done so far are rolled back unless the handler accepts partial success. Then the IPs assigned by the cloud
+// are added to their HostSubnets and returned together with the error, failed assignments as empty entries. The
+// operation is recorded as intent on the namespace, which is saved for that.
+func (h *ProdEgressIPHandler) AddIPsToInfrastructure(ctx context.Context, namespace *corev1.Namespace) ([]*net.IP, error) {
 	var ips []*net.IP
 	var err error
 	var ipErrors []error
 
 	var instances []string
+	request, err := h.ipRequest(namespace)
+	if err != nil {
+		return nil, err
+	}
+
 	ips, err = h.getAnnotatedIPs(namespace)
-	if err == nil { // no IPS annotated
-		instances, err = h.addSpecifiedIPsToCloudProvider(ips)
-	} else {
-		instances, ips, err = h.cloud.AddRandomIPs()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ips) > 0 {
+		if containsIPv6(ips) && !h.ipv6Egress {
+			return nil, fmt.Errorf("namespace '%s' requests IPv6 egress ips but the SDN does not support them", namespace.Name)
+		}
+
+		err = h.validateSpecifiedIPs(ctx, request, ips)
+		if err != nil {
+			return nil, err
+		}
 	}
+
+	// the specified IPs are recorded before the cloud is changed, random IPs as soon as the cloud assigned them.
+	intent := newIntent(AddIPsIntent, ips)
+	err = h.beginNamespaceIntent(ctx, namespace, intent)
 	if err != nil {
 		return nil, err
 	}
+	transaction := newSaga(fmt.Sprintf("add ips of namespace '%s'", namespace.Name))
+
+	if len(ips) > 0 {
+		instances, err = h.addSpecifiedIPsToCloudProvider(ctx, request, ips)
+	} else {
+		instances, ips, err = h.addRandomIPsToCloudProvider(ctx, namespace, request, intent)
+	}
+	h.recordCloudAssignments(transaction, instances, ips)
+
+	// the IPs allocated in the cloud are known now, random IPs may have been recorded one by one already.
+	recorded := len(intent.Allocated)
+	intent.IPs = newIntent(AddIPsIntent, ips).IPs
+	intent.Allocated = nil
+	intent.allocate(instances, ips)
+	if len(intent.Allocated) > recorded {
+		if err2 := h.beginNamespaceIntent(ctx, namespace, intent); err2 != nil {
+			err = multierror.Append(err, err2)
+		}
+	}
+	if err != nil && (h.assignmentMode != AcceptPartialSuccess || len(intent.Allocated) == 0) {
+		return nil, h.failNamespaceOperation(ctx, namespace, transaction, err)
+	}
+
+	ipErrors = make([]error, 0)
+	if err != nil {
+		// the IPs assigned so far are kept and added to their HostSubnets like the IPs of a complete assignment.
+		ipErrors = append(ipErrors, err)
+		ips = keptIPs(instances, ips)
+	}
 
 	log.Info("added ips to infrastructure",
 		"ips", ips,
 		"instances", instances,
 	)
 
-	ipErrors = make([]error, 0)
 	for i, instance := range instances {
-		err = h.addIPToOcpNode(instance, namespace.Name, ips[i])
+		if instance == "" || i >= len(ips) || ips[i] == nil {
+			continue
+		}
+
+		err = h.addIPToOcpNode(ctx, instance, namespace.Name, ips[i])
+		if err != nil {
+			ipErrors = append(ipErrors, err)
+			continue
+		}
+		h.recordOcpAssignment(transaction, instance, ips[i])
+	}
+
+	// RemoveIP of the cloud assignment releases the public IPs, too.
+	if wantsElasticIPs(namespace) {
+		err = h.associatePublicIPs(ctx, namespace, request, ips)
 		if err != nil {
 			ipErrors = append(ipErrors, err)
 		}
 	}
 
 	if len(ipErrors) > 0 {
+		err = nil
 		for _, e := range ipErrors {
 			err = multierror.Append(err, e)
 		}
-	} else {
-		err = nil
+
+		err = h.failNamespaceOperation(ctx, namespace, transaction, err)
+		if h.assignmentMode == AcceptPartialSuccess {
+			return ips, err
+		}
+		return nil, err
 	}
 
-	return ips, err
+	// the reconciler saves the namespace after the NetNamespace.
+	clearIntent(namespace)
+	return ips, nil
 }
 
-// returns the IPs that are annotated to be used for the egress ips.
-func (h *ProdEgressIPHandler) getAnnotatedIPs(instance *corev1.Namespace) ([]*net.IP, error) {
-	var ips []*net.IP
+// addRandomIPsToCloudProvider -- adds random IPs in the cloud. If the cloud provider reports every IP right after
+// assigning it, the IP is recorded as allocated in the intent and the namespace is saved before the next one is
+// assigned.
+func (h *ProdEgressIPHandler) addRandomIPsToCloudProvider(ctx context.Context, namespace *corev1.Namespace, request cloudprovider.IPRequest, intent *Intent) ([]string, []*net.IP, error) {
+	assigner, ok := h.cloud.(cloudprovider.RecordingIPAssigner)
+	if !ok {
+		return h.cloud.AddRandomIPs(ctx, request)
+	}
 
-	ipstring, found := instance.GetAnnotations()[egressipam.NamespaceAssociationAnnotation]
-	if !found || len(ipstring) < 7 {
-		return nil, fmt.Errorf("no ips annotated ('%s' is not a valid list of ips)", ipstring)
+	return assigner.AddRandomIPsRecorded(ctx, request, func(_ string, ip *net.IP) error {
+		intent.IPs = append(intent.IPs, ip.String())
+		intent.Allocated = append(intent.Allocated, ip.String())
+		return h.beginNamespaceIntent(ctx, namespace, intent)
+	})
+}
+
+// keptIPs -- returns the IPs with empty entries for the failed assignments of the cloud provider.
+func keptIPs(instances []string, ips []*net.IP) []*net.IP {
+	result := make([]*net.IP, len(ips))
+	for i, ip := range ips {
+		if i < len(instances) && instances[i] != "" {
+			result[i] = ip
+		}
+	}
+	return result
+}
+
+// failNamespaceOperation -- rolls back the failed operation (depending on the assignment mode) and clears the intent.
+func (h *ProdEgressIPHandler) failNamespaceOperation(ctx context.Context, namespace *corev1.Namespace, transaction *saga, err error) error {
+	err = h.abort(transaction, err)
+
+	if err2 := h.endNamespaceIntent(ctx, namespace); err2 != nil {
+		log.Error(err2, "could not clear the intent - it will be rolled back with the next reconcile",
+			"namespace", namespace.Name,
+		)
+		err = multierror.Append(err, err2)
 	}
 
-	ipStrings := strings.Split(ipstring, ",")
-	ips = make([]*net.IP, len(ipStrings))
+	return err
+}
+
+// recordCloudAssignments -- records the IPs newly assigned by the cloud provider in the saga. Failed assignments are
+// reported without instance or IP and need no rollback. Moved IPs are recorded with recordCloudMove.
+func (h *ProdEgressIPHandler) recordCloudAssignments(transaction *saga, instances []string, ips []*net.IP) {
+	for i, instance := range instances {
+		if instance == "" || i >= len(ips) || ips[i] == nil {
+			continue
+		}
 
-	for i, ip := range ipStrings {
-		ipStruct := net.ParseIP(ip)
-		ips[i] = &ipStruct
+		ip := ips[i]
+		transaction.done(fmt.Sprintf("assign ip '%s' to instance '%s'", ip.String(), instance), func(ctx context.Context) error {
+			_, err := h.cloud.RemoveIP(ctx, ip)
+			if cloudprovider.IsNotFound(err) {
+				return nil
+			}
+			return err
+		})
+	}
+}
+
+// recordCloudMove -- records the IP moved to the instance by the cloud provider in the saga. The IP has been owned by
+// the namespace before, so the rollback never releases it. It stays on the instance and the hostSubnet keeps it to be
+// moved again with the next redistribution.
+func recordCloudMove(transaction *saga, instanceID string, ip *net.IP) {
+	transaction.done(fmt.Sprintf("move ip '%s' to instance '%s'", ip.String(), instanceID), func(context.Context) error {
+		log.Info("keeping the moved ip on the instance - it is moved again with the next redistribution",
+			"ip", ip.String(),
+			"instance", instanceID,
+		)
+		return nil
+	})
+}
+
+// recordOcpAssignment -- records the IP added to the HostSubnet of the instance in the saga.
+func (h *ProdEgressIPHandler) recordOcpAssignment(transaction *saga, instanceID string, ip *net.IP) {
+	transaction.done(fmt.Sprintf("add ip '%s' to node of instance '%s'", ip.String(), instanceID), func(ctx context.Context) error {
+		instance, err := h.cloud.Instance(ctx, instanceID)
+		if err != nil {
+			return err
+		}
+
+		return h.removeIPFromHostSubnet(ctx, *instance, ip)
+	})
+}
+
+// wantsElasticIPs -- checks if the namespace opted in to public IPs for its egress IPs.
+func wantsElasticIPs(namespace *corev1.Namespace) bool {
+	optIn, err := strconv.ParseBool(namespace.GetAnnotations()[ElasticIPAnnotation])
+	return err == nil && optIn
+}
+
+// associatePublicIPs -- associates a public IP with every IPv4 egress IP and records them in the PublicIPsAnnotation of
+// the namespace. The namespace needs to be saved after that.
+func (h *ProdEgressIPHandler) associatePublicIPs(ctx context.Context, namespace *corev1.Namespace, request cloudprovider.IPRequest, ips []*net.IP) error {
+	var err error
+	publicIPs := make([]string, 0, len(ips))
+
+	for _, ip := range ips {
+		if ip == nil || cloudprovider.FamilyOf(*ip) != cloudprovider.IPv4 {
+			continue
+		}
+
+		publicIP, err2 := h.cloud.AssociatePublicIP(ctx, request, ip)
+		if err2 != nil {
+			err = multierror.Append(err, err2)
+			continue
+		}
+
+		publicIPs = append(publicIPs, publicIP.String())
+	}
+
+	annotations := namespace.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string, 1)
+	}
+	annotations[PublicIPsAnnotation] = strings.Join(publicIPs, ",")
+	namespace.SetAnnotations(annotations)
+
+	log.Info("associated public ips",
+		"namespace", namespace.Name,
+		"ips", ips,
+		"public-ips", publicIPs,
+	)
+	return err
+}
+
+// returns the IPs that are annotated to be used for the egress ips. No IPs are returned if none are annotated.
+func (h *ProdEgressIPHandler) getAnnotatedIPs(instance *corev1.Namespace) ([]*net.IP, error) {
+	ipstring, found := instance.GetAnnotations()[egressipam.NamespaceAssociationAnnotation]
+	if !found {
+		return nil, nil
+	}
+
+	ips, err := ParseIPList(ipstring)
+	if err != nil {
+		return nil, fmt.Errorf("annotation '%s' of namespace '%s' is not a valid list of ips: %w",
+			egressipam.NamespaceAssociationAnnotation, instance.Name, err)
 	}
 
 	return ips, nil
 }
 
-func (h *ProdEgressIPHandler) addIPToOcpNode(instanceID string, namespace string, ip *net.IP) error {
-	instance, err := h.cloud.Instance(instanceID)
+// ipRequest -- creates the request for the cloud provider. The address families and zones of random IPs are read from
+// the IPFamiliesAnnotation, ZonesAnnotation and ZoneCountAnnotation of the namespace.
+func (h *ProdEgressIPHandler) ipRequest(namespace *corev1.Namespace) (cloudprovider.IPRequest, error) {
+	result := cloudprovider.IPRequest{Namespace: namespace.Name}
+
+	families, err := cloudprovider.ParseIPFamilies(namespace.GetAnnotations()[IPFamiliesAnnotation])
+	if err != nil {
+		return result, fmt.Errorf("annotation '%s' of namespace '%s' is invalid: %v",
+			IPFamiliesAnnotation, namespace.Name, err)
+	}
+
+	for _, family := range families {
+		if family == cloudprovider.IPv6 && !h.ipv6Egress {
+			return result, fmt.Errorf("namespace '%s' requests IPv6 egress ips but the SDN does not support them", namespace.Name)
+		}
+	}
+
+	result.Families = families
+	result.Zones = cloudprovider.ParseZones(namespace.GetAnnotations()[ZonesAnnotation])
+
+	if zoneCount, found := namespace.GetAnnotations()[ZoneCountAnnotation]; found {
+		result.ZoneCount, err = strconv.Atoi(strings.TrimSpace(zoneCount))
+		if err != nil || result.ZoneCount < 1 {
+			return result, fmt.Errorf("annotation '%s' of namespace '%s' is no positive number: '%s'",
+				ZoneCountAnnotation, namespace.Name, zoneCount)
+		}
+	}
+
+	return result, nil
+}
+
+func (h *ProdEgressIPHandler) addIPToOcpNode(ctx context.Context, instanceID string, namespace string, ip *net.IP) error {
+	instance, err := h.cloud.Instance(ctx, instanceID)
 	if err != nil {
 		return err
 	}
 
-	err = h.addIPToHostSubnet(instance, namespace, ip)
+	err = h.addIPToHostSubnet(ctx, instance, namespace, ip)
 	if err != nil {
 		return err
 	}
@@ -134,8 +379,11 @@ func (h *ProdEgressIPHandler) addIPToOcpNode(instanceID string, namespace string
 	return nil
 }
 
-func (h *ProdEgressIPHandler) addIPToHostSubnet(instance *cloudprovider.CloudInstance, namespace string, ip *net.IP) error {
-	hostSubnet, err := h.LoadHostSubnet((*instance).HostName())
+// addIPToHostSubnet -- adds the IP to the egress IPs of the HostSubnet of the instance and annotates the namespace
+// owning it. An IP already on the HostSubnet is annotated if the annotation is missing, a different namespace is left
+// to the drift audit.
+func (h *ProdEgressIPHandler) addIPToHostSubnet(ctx context.Context, instance *cloudprovider.CloudInstance, namespace string, ip *net.IP) error {
+	hostSubnet, err := h.LoadHostSubnet(ctx, (*instance).HostName())
 	if err != nil {
 		return err
 	}
@@ -149,13 +397,17 @@ func (h *ProdEgressIPHandler) addIPToHostSubnet(instance *cloudprovider.CloudIns
 		}
 	}
 
+	changed := false
 	if !found {
 		hostSubnet.EgressIPs = append(hostSubnet.EgressIPs, ip.String())
+		setIPNamespace(hostSubnet, ip.String(), namespace)
+		changed = true
+	} else if _, annotated := ipNamespaces(hostSubnet)[ip.String()]; !annotated {
+		changed = setIPNamespace(hostSubnet, ip.String(), namespace)
+	}
 
-		annotations := hostSubnet.GetAnnotations()
-		annotations[IPToNamespaceAnnotation+ip.String()] = namespace
-
-		err := h.SaveHostSubnet(hostSubnet)
+	if changed {
+		err := h.SaveHostSubnet(ctx, hostSubnet)
 		if err != nil {
 			return err
 		}
@@ -165,8 +417,8 @@ func (h *ProdEgressIPHandler) addIPToHostSubnet(instance *cloudprovider.CloudIns
 	return nil
 }
 
-func (h *ProdEgressIPHandler) addSpecifiedIPsToCloudProvider(ips []*net.IP) ([]string, error) {
-	instances, err := h.cloud.AddSpecifiedIPs(ips)
+func (h *ProdEgressIPHandler) addSpecifiedIPsToCloudProvider(ctx context.Context, request cloudprovider.IPRequest, ips []*net.IP) ([]string, error) {
+	instances, err := h.cloud.AddSpecifiedIPs(ctx, request, ips)
 	if err != nil {
 		return instances, err
 	}
@@ -188,7 +440,7 @@ func (h *ProdEgressIPHandler) addSpecifiedIPsToCloudProvider(ips []*net.IP) ([]s
 }
 
 // RemoveIPsFromInfrastructure - Removes the IP from AWS and the HostSubnets it had been distributed to. Will return a multierror.
-func (h *ProdEgressIPHandler) RemoveIPsFromInfrastructure(netNamespace *ocpnetv1.NetNamespace) error {
+func (h *ProdEgressIPHandler) RemoveIPsFromInfrastructure(ctx context.Context, netNamespace *ocpnetv1.NetNamespace) error {
 	var result []error
 	var err error
 
@@ -197,7 +449,7 @@ func (h *ProdEgressIPHandler) RemoveIPsFromInfrastructure(netNamespace *ocpnetv1
 		ip := net.ParseIP(ipString)
 
 		var instanceID string
-		instanceID, err = h.cloud.RemoveIP(&ip)
+		instanceID, err = h.cloud.RemoveIP(ctx, &ip)
 		if err != nil {
 			log.Error(err, "ignoring this error - most probably the IP has been removed already",
 				"ip", ip,
@@ -208,9 +460,9 @@ func (h *ProdEgressIPHandler) RemoveIPsFromInfrastructure(netNamespace *ocpnetv1
 		}
 		if instanceID != "" {
 			var instance *cloudprovider.CloudInstance
-			instance, err = h.cloud.Instance(instanceID)
+			instance, err = h.cloud.Instance(ctx, instanceID)
 			if instance != nil {
-				err = h.removeIPFromHostSubnet(*instance, &ip)
+				err = h.removeIPFromHostSubnet(ctx, *instance, &ip)
 			} else {
 				log.Error(err, "didn't load the instance from aws - can not remove the IP from host subnet",
 					"instance-id", instanceID)
@@ -234,8 +486,10 @@ func (h *ProdEgressIPHandler) RemoveIPsFromInfrastructure(netNamespace *ocpnetv1
 	return err
 }
 
-func (h *ProdEgressIPHandler) removeIPFromHostSubnet(instance cloudprovider.CloudInstance, ip *net.IP) error {
-	hostSubnet, err := h.LoadHostSubnet(instance.HostName())
+// removeIPFromHostSubnet -- removes the IP from the egress IPs of the HostSubnet of the instance together with the
+// annotation of the namespace owning it.
+func (h *ProdEgressIPHandler) removeIPFromHostSubnet(ctx context.Context, instance cloudprovider.CloudInstance, ip *net.IP) error {
+	hostSubnet, err := h.LoadHostSubnet(ctx, instance.HostName())
 	if err != nil {
 		return err
 	}
@@ -261,7 +515,19 @@ func (h *ProdEgressIPHandler) removeIPFromHostSubnet(instance cloudprovider.Clou
 			}
 		}
 
-		err := h.SaveHostSubnet(hostSubnet)
+		removeIPNamespace(hostSubnet, ip.String())
+
+		err := h.SaveHostSubnet(ctx, hostSubnet)
+		if err != nil {
+			return err
+		}
+	} else if removeIPNamespace(hostSubnet, ip.String()) {
+		log.Info("ip not defined as egressIP on this node - removing its stale namespace annotation",
+			"ip", ip.String(),
+			"hostSubnet", hostSubnet.Name,
+		)
+
+		err := h.SaveHostSubnet(ctx, hostSubnet)
 		if err != nil {
 			return err
 		}
@@ -315,82 +581,88 @@ func (h *ProdEgressIPHandler) RemoveIPsFromNetNamespace(netNamespace *ocpnetv1.N
 	}
 }
 
-func (h *ProdEgressIPHandler) removeFromCloudProvider(ips []*net.IP) error {
-	var errList []error
-	errList = make([]error, 0)
-
-	for i, ip := range ips {
-		_, err := h.cloud.RemoveIP(ip)
-		if err != nil {
-			if strings.Contains(err.Error(), "found no network interface") {
-				log.Info("the IP is already away. no need to work on this one")
-			} else if strings.Contains(err.Error(), "found no attached network interface") {
-				log.Info("the IP is not attached to any network interface. no need to work on this one")
-			} else {
-				log.Error(err, "removing of ip failed",
-					"ip", ip.String(),
-				)
-				errList = append(errList, err)
-			}
-		} else {
-			log.Info("removed aws ip "+strconv.Itoa(i+1)+" of "+strconv.Itoa(len(ips)),
-				"ip", ip.String(),
-			)
-		}
-	}
-
-	if len(errList) > 0 {
-		var result error
-		for _, err := range errList {
-			result = multierror.Append(result, err)
-		}
-
-		return result
-	}
-
-	return nil
-}
-
 // RedistributeIPsFromHost - redistributes the secondary IPs from the given host and returns a map with key=ip-address
-// and the instance id as value.
-func (h *ProdEgressIPHandler) RedistributeIPsFromHost(hostSubnet *ocpnetv1.HostSubnet) (map[string]string, error) {
+// and the instance id as value. Every IP is moved to another instance by the cloud provider without unassigning it
+// first, the HostSubnets are updated after the move. The IP-to-namespace annotations move with the IPs. If a step
+// fails, the new assignments are rolled back and the IPs are kept on the hostSubnet to be redistributed again unless
+// the handler accepts partial success. The operation is recorded as intent on the hostSubnet, which is saved for that.
+// If the zone of the host has no other egress node and zone failover is enabled, the IPs are failed over to other zones
+// instead. A leftover reclaim or failover is resumed.
+func (h *ProdEgressIPHandler) RedistributeIPsFromHost(ctx context.Context, hostSubnet *ocpnetv1.HostSubnet) (map[string]string, error) {
 	ips := h.ReadIpsFromHostSubnet(hostSubnet)
 	if len(ips) == 0 {
 		return nil, fmt.Errorf("hostSubnet '%s' does not carry egress ips", hostSubnet.Name)
 	}
 
+	if intent, err := readIntent(hostSubnet); err == nil && intent != nil && intent.resumable() {
+		// moving the IPs would lose the replacements of the leftover operation.
+		return h.replaceIPsOfHost(ctx, hostSubnet, intent.Operation)
+	}
+
 	result := make(map[string]string, len(ips))
 
 	ipErrors := make([]error, 0)
-	var instances []string
+	instances := make([]string, len(ips))
 
-	err := h.removeFromCloudProvider(ips)
+	err := h.beginHostSubnetIntent(ctx, hostSubnet, newIntent(RedistributeIPsIntent, ips))
 	if err != nil {
-		log.Error(err, "could not remove IP from cloud provider")
 		return nil, err
 	}
 
-	hostSubnet.EgressIPs = []string{}
+	transaction := newSaga(fmt.Sprintf("redistribute ips of hostSubnet '%s'", hostSubnet.Name))
 
-	instances, err = h.addSpecifiedIPsToCloudProvider(ips)
-	if err != nil {
-		log.Error(err, "could not add specified ip to cloud provider")
-		return nil, err
+	for i, ip := range ips {
+		instances[i], err = h.cloud.MoveIP(ctx, cloudprovider.IPRequest{}, ip)
+		if err != nil {
+			log.Error(err, "could not move ip to another instance",
+				"ip", ip.String(),
+			)
+			err = h.failHostSubnetOperation(ctx, hostSubnet, transaction, err)
+			if cloudprovider.IsNoEgressNode(err) && h.zoneFailover {
+				log.Info("no other egress node in the zone of the host - failing over its ips to other zones",
+					"hostSubnet", hostSubnet.Name,
+				)
+				return h.replaceIPsOfHost(ctx, hostSubnet, FailoverIPsIntent)
+			}
+			return nil, err
+		}
+		recordCloudMove(transaction, instances[i], ip)
+
+		log.Info("moved aws ip "+strconv.Itoa(i+1)+" of "+strconv.Itoa(len(ips)),
+			"ip", ip.String(),
+			"instance", instances[i],
+		)
 	}
 
+	egressIPs := hostSubnet.EgressIPs
+	namespaces := ipNamespaces(hostSubnet)
+	hostSubnet.EgressIPs = []string{}
+	pruneIPNamespaces(hostSubnet)
+	transaction.done("remove egress ips from hostSubnet", func(context.Context) error {
+		hostSubnet.EgressIPs = egressIPs
+		for _, ip := range egressIPs {
+			if namespace, found := namespaces[ip]; found {
+				setIPNamespace(hostSubnet, ip, namespace)
+			}
+		}
+		return nil
+	})
+
 	for i, instance := range instances {
-		namespace := hostSubnet.GetAnnotations()[IPToNamespaceAnnotation+ips[i].String()]
+		namespace := namespaces[ips[i].String()]
 		if len(namespace) == 0 {
 			ipErrors = append(ipErrors, errors.New("did not find namespace for ip '"+ips[i].String()+"'"))
 		}
 
-		err := h.addIPToOcpNode(instance, namespace, ips[i])
+		err := h.addIPToOcpNode(ctx, instance, namespace, ips[i])
 		if err != nil {
 			log.Error(err, "could not add IP to OCP",
 				"instance", instance,
 				"ip", ips[i],
 			)
 			ipErrors = append(ipErrors, err)
+		} else {
+			h.recordOcpAssignment(transaction, instance, ips[i])
 		}
 		result[ips[i].String()] = instance
 	}
@@ -409,8 +681,31 @@ func (h *ProdEgressIPHandler) RedistributeIPsFromHost(hostSubnet *ocpnetv1.HostS
 
 	if err != nil {
 		log.Error(err, "error when assigning ips")
+
+		err = h.failHostSubnetOperation(ctx, hostSubnet, transaction, err)
+		if h.assignmentMode != AcceptPartialSuccess {
+			return nil, err
+		}
+		return result, err
 	}
-	return result, err
+
+	// the reconciler saves the hostSubnet without the redistributed IPs.
+	clearIntent(hostSubnet)
+	return result, nil
+}
+
+// failHostSubnetOperation -- rolls back the failed operation (depending on the assignment mode) and clears the intent.
+func (h *ProdEgressIPHandler) failHostSubnetOperation(ctx context.Context, hostSubnet *ocpnetv1.HostSubnet, transaction *saga, err error) error {
+	err = h.abort(transaction, err)
+
+	if err2 := h.endHostSubnetIntent(ctx, hostSubnet); err2 != nil {
+		log.Error(err2, "could not clear the intent - it will be rolled back with the next reconcile",
+			"hostSubnet", hostSubnet.Name,
+		)
+		err = multierror.Append(err, err2)
+	}
+
+	return err
 }
 
 // ReadIpsFromHostSubnet - Reads the IP from the status field of the OCP node object and returns them as array.
@@ -432,37 +727,37 @@ func (h *ProdEgressIPHandler) ReadIpsFromHostSubnet(hostSubnet *ocpnetv1.HostSub
 }
 
 // LoadHostSubnet - really?
-func (h *ProdEgressIPHandler) LoadHostSubnet(name string) (*ocpnetv1.HostSubnet, error) {
+func (h *ProdEgressIPHandler) LoadHostSubnet(ctx context.Context, name string) (*ocpnetv1.HostSubnet, error) {
 	result := &ocpnetv1.HostSubnet{}
-	err := h.client.Get(context.TODO(), types.NamespacedName{Name: name}, result)
+	err := h.client.Get(ctx, types.NamespacedName{Name: name}, result)
 	if err != nil {
 		log.Error(err, "unable to retrieve", "hostSubnet", name)
-		return nil, err
+		return nil, classifyAPIError("HostSubnet", name, err)
 	}
 
 	return result, nil
 }
 
 // SaveHostSubnet - really?
-func (h *ProdEgressIPHandler) SaveHostSubnet(instance *ocpnetv1.HostSubnet) error {
-	return h.client.Update(context.TODO(), instance)
+func (h *ProdEgressIPHandler) SaveHostSubnet(ctx context.Context, instance *ocpnetv1.HostSubnet) error {
+	return classifyAPIError("HostSubnet", instance.Name, h.client.Update(ctx, instance))
 }
 
 // LoadNetNameSpace - really?
-func (h *ProdEgressIPHandler) LoadNetNameSpace(name string) (*ocpnetv1.NetNamespace, error) {
+func (h *ProdEgressIPHandler) LoadNetNameSpace(ctx context.Context, name string) (*ocpnetv1.NetNamespace, error) {
 	result := &ocpnetv1.NetNamespace{}
-	err := h.client.Get(context.TODO(), types.NamespacedName{Name: name}, result)
+	err := h.client.Get(ctx, types.NamespacedName{Name: name}, result)
 	if err != nil {
-		return nil, err
+		return nil, classifyAPIError("NetNamespace", name, err)
 	}
 
 	return result, nil
 }
 
-// SaveNetNameSpace - really?
-func (h *ProdEgressIPHandler) SaveNetNameSpace(instance *ocpnetv1.NetNamespace) error {
-	err := h.client.Update(context.TODO(), instance)
-	if err != nil && strings.Contains(err.Error(), "StorageError: invalid object, Code: 4") {
+// SaveNetNameSpace - really? An already deleted NetNamespace is no error.
+func (h *ProdEgressIPHandler) SaveNetNameSpace(ctx context.Context, instance *ocpnetv1.NetNamespace) error {
+	err := classifyAPIError("NetNamespace", instance.Name, h.client.Update(ctx, instance))
+	if IsObjectDeleted(err) {
 		log.Info("the object did not match the UID - probably it is already deleted")
 		err = nil
 	}
@@ -471,17 +766,22 @@ func (h *ProdEgressIPHandler) SaveNetNameSpace(instance *ocpnetv1.NetNamespace)
 }
 
 // LoadNamespace - really?
-func (h *ProdEgressIPHandler) LoadNamespace(name string) (*corev1.Namespace, error) {
+func (h *ProdEgressIPHandler) LoadNamespace(ctx context.Context, name string) (*corev1.Namespace, error) {
 	result := &corev1.Namespace{}
-	err := h.client.Get(context.TODO(), types.NamespacedName{Name: name}, result)
+	err := h.client.Get(ctx, types.NamespacedName{Name: name}, result)
 	if err != nil {
-		return nil, err
+		return nil, classifyAPIError("Namespace", name, err)
 	}
 
 	return result, nil
 }
 
 // SaveNamespace - really?
-func (h *ProdEgressIPHandler) SaveNamespace(instance *corev1.Namespace) error {
-	return h.client.Update(context.TODO(), instance)
+func (h *ProdEgressIPHandler) SaveNamespace(ctx context.Context, instance *corev1.Namespace) error {
+	return classifyAPIError("Namespace", instance.Name, h.client.Update(ctx, instance))
+}
+
+// SaveNamespaceStatus saves the status subresource of the namespace.
+func (h *ProdEgressIPHandler) SaveNamespaceStatus(ctx context.Context, instance *corev1.Namespace) error {
+	return classifyAPIError("Namespace", instance.Name, h.client.UpdateStatus(ctx, instance))
 }
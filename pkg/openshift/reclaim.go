@@ -0,0 +1,227 @@
+package openshift
+
+import (
+	"context"
+	"fmt"
+	"github.com/hashicorp/go-multierror"
+	"github.com/klenkes74/aws-egressip-operator/pkg/cloudprovider"
+	ocpnetv1 "github.com/openshift/api/network/v1"
+	"github.com/redhat-cop/egressip-ipam-operator/pkg/controller/egressipam"
+	"net"
+	"strings"
+)
+
+// HostInstanceGone - checks if the instance of the hostSubnet has been terminated or does not exist anymore. The cloud
+// freed its IPs then and they have to be reclaimed instead of being moved.
+func (h *ProdEgressIPHandler) HostInstanceGone(ctx context.Context, hostSubnet *ocpnetv1.HostSubnet) (bool, error) {
+	return h.cloud.InstanceGone(ctx, hostSubnet.Name)
+}
+
+// ReclaimIPsFromTerminatedHost - assigns the IPs the cloud freed with the gone instance of the hostSubnet to other
+// nodes in the same subnets and returns a map with key=ip-address and the instance id as value. An IP taken by others
+// in the meantime is replaced by a new IP of the same subnet, which is written to the annotations of the namespace and
+// its NetNamespace. With zone failover enabled, IPs of a subnet without egress nodes are replaced by IPs of other
+// zones. IPs failing to be reclaimed stay on the hostSubnet to be reclaimed with the next reconcile. The reclaim is
+// recorded as intent on the hostSubnet and resumed if the operator stops in the middle of it.
+func (h *ProdEgressIPHandler) ReclaimIPsFromTerminatedHost(ctx context.Context, hostSubnet *ocpnetv1.HostSubnet) (map[string]string, error) {
+	return h.replaceIPsOfHost(ctx, hostSubnet, ReclaimIPsIntent)
+}
+
+// replaceIPsOfHost -- reclaims the IPs of the hostSubnet or fails them over to other zones. A leftover reclaim or
+// failover is resumed with the replacements recorded.
+func (h *ProdEgressIPHandler) replaceIPsOfHost(ctx context.Context, hostSubnet *ocpnetv1.HostSubnet, operation IntentOperation) (map[string]string, error) {
+	ips := h.ReadIpsFromHostSubnet(hostSubnet)
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("hostSubnet '%s' does not carry egress ips", hostSubnet.Name)
+	}
+
+	intent, err := readIntent(hostSubnet)
+	if err != nil {
+		return nil, err
+	}
+	if intent == nil || !intent.resumable() {
+		intent = newIntent(operation, ips)
+		if err := h.beginHostSubnetIntent(ctx, hostSubnet, intent); err != nil {
+			return nil, err
+		}
+	} else {
+		log.Info("resuming the replacement of the ips of hostSubnet",
+			"hostSubnet", hostSubnet.Name,
+			"operation", intent.Operation,
+			"started", intent.Started,
+			"replacements", intent.Replacements,
+		)
+	}
+
+	result := make(map[string]string, len(ips))
+	remaining := make([]string, 0)
+	var reclaimErrors error
+
+	for _, ip := range ips {
+		instanceID, err := h.reclaimIP(ctx, hostSubnet, intent, ip)
+		if err != nil {
+			log.Error(err, "could not reclaim ip",
+				"hostSubnet", hostSubnet.Name,
+				"ip", ip.String(),
+			)
+			reclaimErrors = multierror.Append(reclaimErrors, err)
+			remaining = append(remaining, ip.String())
+			continue
+		}
+
+		result[ip.String()] = instanceID
+	}
+
+	log.Info("Replaced the ips of the hostSubnet",
+		"hostSubnet", hostSubnet.Name,
+		"operation", intent.Operation,
+		"result", result,
+	)
+
+	// the reconciler saves the hostSubnet without the reclaimed IPs and their annotations.
+	hostSubnet.EgressIPs = remaining
+	pruneIPNamespaces(hostSubnet)
+	if reclaimErrors != nil {
+		return result, reclaimErrors
+	}
+
+	clearIntent(hostSubnet)
+	return result, nil
+}
+
+// reclaimIP -- reclaims the IP on another node and adds it to the HostSubnet of that node. A failover replaces the IP
+// by one of another zone right away, a reclaim only if the subnet of the IP has no egress node left. If the cloud
+// assigned a replacement, it is recorded in the intent before the namespace is changed, so a resumed operation uses the
+// same replacement.
+func (h *ProdEgressIPHandler) reclaimIP(ctx context.Context, hostSubnet *ocpnetv1.HostSubnet, intent *Intent, ip *net.IP) (string, error) {
+	namespace := hostSubnet.GetAnnotations()[IPToNamespaceAnnotation+ip.String()]
+	if len(namespace) == 0 {
+		return "", fmt.Errorf("did not find namespace for ip '%s'", ip.String())
+	}
+	request := cloudprovider.IPRequest{Namespace: namespace}
+
+	reclaimed := ip
+	recorded := net.ParseIP(intent.Replacements[ip.String()])
+	if recorded != nil {
+		reclaimed = &recorded
+	}
+
+	var instanceID string
+	var assigned *net.IP
+	var err error
+
+	failover := h.zoneFailover && intent.Operation == FailoverIPsIntent && recorded == nil
+	if !failover {
+		instanceID, assigned, err = h.cloud.ReclaimIP(ctx, request, reclaimed)
+		failover = cloudprovider.IsNoEgressNode(err) && h.zoneFailover
+	}
+	if failover {
+		log.Info("failing over ip to another zone",
+			"ip", reclaimed.String(),
+			"namespace", namespace,
+		)
+		instanceID, assigned, err = h.cloud.FailoverIP(ctx, request, reclaimed)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if !assigned.Equal(*reclaimed) {
+		if intent.Replacements == nil {
+			intent.Replacements = make(map[string]string, 1)
+		}
+		intent.Replacements[ip.String()] = assigned.String()
+		intent.IPs = append(intent.IPs, assigned.String())
+		if failover && !containsAny(intent.FailedOver, []string{ip.String()}) {
+			intent.FailedOver = append(intent.FailedOver, ip.String())
+		}
+
+		if err := h.beginHostSubnetIntent(ctx, hostSubnet, intent); err != nil {
+			return "", err
+		}
+	}
+
+	if !assigned.Equal(*ip) {
+		old := []*net.IP{ip, reclaimed}
+
+		origin := ""
+		if containsAny(intent.FailedOver, []string{ip.String()}) {
+			origin = ip.String()
+		}
+
+		err = h.replaceNamespaceIP(ctx, namespace, old, assigned, inheritFailover(old, assigned, origin))
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return instanceID, h.addIPToOcpNode(ctx, instanceID, namespace, assigned)
+}
+
+// replaceNamespaceIP -- replaces the old IPs by the new one in the egress IPs of the NetNamespace and in the IP
+// annotations of the NetNamespace and the namespace. The failed over IPs of the namespace are changed by the given
+// function. The NetNamespace is saved first, so the reconcilers find matching IPs and don't change the infrastructure.
+func (h *ProdEgressIPHandler) replaceNamespaceIP(ctx context.Context, name string, old []*net.IP, ip *net.IP, failovers func(map[string]string)) error {
+	netNamespace, err := h.LoadNetNameSpace(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	namespace, err := h.LoadNamespace(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	log.Info("replacing egress ip of namespace",
+		"namespace", name,
+		"old-ips", old,
+		"ip", ip.String(),
+	)
+
+	netNamespace.EgressIPs = replaceIPs(netNamespace.EgressIPs, old, ip)
+	replaceIPsInAnnotation(netNamespace.GetAnnotations(), old, ip)
+	replaceIPsInAnnotation(namespace.GetAnnotations(), old, ip)
+	updateFailovers(namespace, failovers)
+
+	err = h.SaveNetNameSpace(ctx, netNamespace)
+	if err != nil {
+		return err
+	}
+
+	return h.SaveNamespace(ctx, namespace)
+}
+
+// replaceIPsInAnnotation -- replaces the old IPs by the new one in the IP list annotation.
+func replaceIPsInAnnotation(annotations map[string]string, old []*net.IP, ip *net.IP) {
+	value, found := annotations[egressipam.NamespaceAssociationAnnotation]
+	if !found {
+		return
+	}
+
+	ips := replaceIPs(strings.Split(value, ","), old, ip)
+	annotations[egressipam.NamespaceAssociationAnnotation] = strings.Join(ips, ",")
+}
+
+// replaceIPs -- replaces the old IPs in the list by the new one. The new IP is listed once.
+func replaceIPs(list []string, old []*net.IP, ip *net.IP) []string {
+	result := make([]string, 0, len(list))
+	added := false
+
+	for _, entry := range list {
+		parsed := net.ParseIP(strings.TrimSpace(entry))
+
+		replaced := parsed.Equal(*ip)
+		for _, o := range old {
+			replaced = replaced || (parsed != nil && parsed.Equal(*o))
+		}
+
+		if !replaced {
+			result = append(result, entry)
+		} else if !added {
+			result = append(result, ip.String())
+			added = true
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,28 @@
+package openshift
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+const defaultReconcileTimeout = 2 * time.Minute
+
+// ReconcileTimeout returns the time a single reconcile may take including all calls to the cloud and the api server.
+// It is read from the environment variable RECONCILE_TIMEOUT (e.g. "90s"), the default is two minutes. When the time
+// is up, the calls are cancelled and the request is requeued.
+func ReconcileTimeout() time.Duration {
+	value, found := os.LookupEnv("RECONCILE_TIMEOUT")
+	if !found {
+		return defaultReconcileTimeout
+	}
+
+	result, err := time.ParseDuration(value)
+	if err != nil || result <= 0 {
+		log.Error(fmt.Errorf("RECONCILE_TIMEOUT '%s' is no valid positive duration", value),
+			"using default", "timeout", defaultReconcileTimeout)
+		return defaultReconcileTimeout
+	}
+
+	return result
+}
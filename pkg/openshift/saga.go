@@ -0,0 +1,117 @@
+package openshift
+
+import (
+	"context"
+	"fmt"
+	"github.com/hashicorp/go-multierror"
+	"os"
+	"strings"
+	"time"
+)
+
+// AssignmentMode -- how the handler reacts when adding or redistributing egress IPs fails after some of the steps
+// succeeded.
+type AssignmentMode string
+
+const (
+	// RollbackOnFailure undoes all steps done so far. The IPs are not left on instances or HostSubnets without an owner
+	// and the next reconcile starts from scratch.
+	RollbackOnFailure AssignmentMode = "rollback"
+	// AcceptPartialSuccess keeps the IPs assigned so far and reports the failures only.
+	AcceptPartialSuccess AssignmentMode = "partial"
+)
+
+const defaultAssignmentMode = RollbackOnFailure
+
+// time limit of the compensating steps of a rollback
+const rollbackTimeout = time.Minute
+
+// ParseAssignmentMode parses the assignment mode ("rollback" or "partial"). An empty value returns the default.
+func ParseAssignmentMode(value string) (AssignmentMode, error) {
+	switch AssignmentMode(strings.ToLower(strings.TrimSpace(value))) {
+	case "":
+		return defaultAssignmentMode, nil
+	case RollbackOnFailure:
+		return RollbackOnFailure, nil
+	case AcceptPartialSuccess:
+		return AcceptPartialSuccess, nil
+	default:
+		return defaultAssignmentMode, fmt.Errorf("unknown assignment mode '%s' (valid: '%s', '%s')",
+			value, RollbackOnFailure, AcceptPartialSuccess)
+	}
+}
+
+// assignmentModeFromEnvironment -- reads the assignment mode from the environment variable IP_ASSIGNMENT_MODE. An
+// invalid value is logged and the default is used.
+func assignmentModeFromEnvironment() AssignmentMode {
+	value, _ := os.LookupEnv("IP_ASSIGNMENT_MODE")
+
+	result, err := ParseAssignmentMode(value)
+	if err != nil {
+		log.Error(err, "invalid value of IP_ASSIGNMENT_MODE", "using default", result)
+	}
+
+	return result
+}
+
+// saga -- records the compensating step of every step done so far. On failure the compensating steps run in reverse
+// order to undo all changes of the cloud and the api server.
+type saga struct {
+	name          string
+	compensations []compensation
+}
+
+type compensation struct {
+	step string
+	undo func(ctx context.Context) error
+}
+
+func newSaga(name string) *saga {
+	return &saga{name: name}
+}
+
+// done -- records a successful step together with the step undoing it.
+func (s *saga) done(step string, undo func(ctx context.Context) error) {
+	s.compensations = append(s.compensations, compensation{step: step, undo: undo})
+}
+
+// rollback -- runs the compensating steps in reverse order. The context of the failed operation may be done already
+// (e.g. by the reconcile timeout), so the steps get a time limit of their own. All steps are tried. Returns the cause,
+// combined with the failed compensations if there are any.
+func (s *saga) rollback(cause error) error {
+	if len(s.compensations) == 0 {
+		return cause
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), rollbackTimeout)
+	defer cancel()
+
+	log.Info("rolling back", "saga", s.name, "steps", len(s.compensations), "cause", cause.Error())
+
+	result := cause
+	for i := len(s.compensations) - 1; i >= 0; i-- {
+		c := s.compensations[i]
+
+		err := c.undo(ctx)
+		if err != nil {
+			log.Error(err, "could not undo step", "saga", s.name, "step", c.step)
+			result = multierror.Append(result, fmt.Errorf("rollback of '%s' failed: %v", c.step, err))
+			continue
+		}
+
+		log.Info("undone step", "saga", s.name, "step", c.step)
+	}
+	s.compensations = nil
+
+	return result
+}
+
+// abort -- handles a failure of the saga depending on the assignment mode of the handler.
+func (h *ProdEgressIPHandler) abort(s *saga, err error) error {
+	if h.assignmentMode == AcceptPartialSuccess {
+		log.Info("keeping the steps done so far", "saga", s.name, "steps", len(s.compensations), "cause", err.Error())
+		return err
+	}
+
+	return s.rollback(err)
+}
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"github.com/klenkes74/aws-egressip-operator/pkg/cloudprovider"
 	"github.com/klenkes74/aws-egressip-operator/test/mocks"
 	"github.com/stretchr/testify/assert"
 	"net"
@@ -18,7 +21,7 @@ func TestSuccessfulAddRandomIPs(t *testing.T) {
 	mockAddRandomIPSuccessfully(mockAws, "vm-5", "1.1.3.33")
 	mockAddRandomIPSuccessfully(mockAws, "vm-6", "1.1.3.33")
 
-	instances, ips, err := service.AddRandomIPs()
+	instances, ips, err := service.AddRandomIPs(context.TODO(), cloudprovider.IPRequest{})
 
 	assert.Len(t, instances, 3)
 	assert.Len(t, ips, 3)
@@ -38,7 +41,7 @@ func TestFailedAddRandomIPs(t *testing.T) {
 	mockAddRandomIPSuccessfully(mockAws, "vm-5", "1.1.3.33")
 	mockAddRandomIPSuccessfully(mockAws, "vm-6", "1.1.3.33")
 
-	instances, ips, err := service.AddRandomIPs()
+	instances, ips, err := service.AddRandomIPs(context.TODO(), cloudprovider.IPRequest{})
 
 	assert.Len(t, instances, 3)
 	assert.Len(t, ips, 3)
@@ -50,3 +53,52 @@ func TestFailedAddRandomIPs(t *testing.T) {
 
 	mockAws.AssertExpectations(t)
 }
+
+func TestAddRandomIPsRecordedRecordsEveryIP(t *testing.T) {
+	mockAws := &mocks.AwsClient{}
+	service := createAwsCloudProviderMock(mockAws)
+
+	mockAddRandomIPSuccessfully(mockAws, "vm-1", "1.1.1.11")
+	mockAddRandomIPSuccessfully(mockAws, "vm-2", "1.1.1.11")
+	mockAddRandomIPSuccessfully(mockAws, "vm-3", "1.1.2.22")
+	mockAddRandomIPSuccessfully(mockAws, "vm-4", "1.1.2.22")
+	mockAddRandomIPSuccessfully(mockAws, "vm-5", "1.1.3.33")
+	mockAddRandomIPSuccessfully(mockAws, "vm-6", "1.1.3.33")
+
+	recorded := make([]string, 0)
+	instances, ips, err := service.AddRandomIPsRecorded(context.TODO(), cloudprovider.IPRequest{},
+		func(_ string, ip *net.IP) error {
+			recorded = append(recorded, ip.String())
+			return nil
+		})
+
+	assert.Nil(t, err)
+	assert.Len(t, instances, 3)
+	assert.Len(t, ips, 3)
+	assert.ElementsMatch(t, recorded, []string{"1.1.1.11", "1.1.2.22", "1.1.3.33"})
+}
+
+func TestAddRandomIPsRecordedStopsAfterFailedRecord(t *testing.T) {
+	mockAws := &mocks.AwsClient{}
+	service := createAwsCloudProviderMock(mockAws)
+
+	mockAddRandomIPSuccessfully(mockAws, "vm-1", "1.1.1.11")
+	mockAddRandomIPSuccessfully(mockAws, "vm-2", "1.1.1.11")
+	mockAddRandomIPSuccessfully(mockAws, "vm-3", "1.1.2.22")
+	mockAddRandomIPSuccessfully(mockAws, "vm-4", "1.1.2.22")
+	mockAddRandomIPSuccessfully(mockAws, "vm-5", "1.1.3.33")
+	mockAddRandomIPSuccessfully(mockAws, "vm-6", "1.1.3.33")
+
+	instances, ips, err := service.AddRandomIPsRecorded(context.TODO(), cloudprovider.IPRequest{},
+		func(string, *net.IP) error {
+			return errors.New("api server unavailable")
+		})
+
+	// the ip assigned is returned to be rolled back, no further ip is assigned.
+	assert.NotNil(t, err)
+	assert.Len(t, instances, 1)
+	if assert.Len(t, ips, 1) {
+		assert.NotNil(t, ips[0])
+	}
+	mockAws.AssertNumberOfCalls(t, "AssignPrivateIPAddresses", 1)
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"github.com/klenkes74/aws-egressip-operator/pkg/cloudprovider"
 	"github.com/klenkes74/aws-egressip-operator/test/mocks"
 	"github.com/stretchr/testify/assert"
 	"net"
@@ -24,7 +26,7 @@ func TestSuccessfulAddSpecifiedIPs(t *testing.T) {
 		ips = append(ips, &parsed)
 	}
 
-	instances, err := service.AddSpecifiedIPs(ips)
+	instances, err := service.AddSpecifiedIPs(context.TODO(), cloudprovider.IPRequest{}, ips)
 
 	assert.Len(t, instances, 3)
 	assert.Nil(t, err)
@@ -49,7 +51,7 @@ func TestFailedAddSpecifiedIPs(t *testing.T) {
 		ips = append(ips, &parsed)
 	}
 
-	instances, err := service.AddSpecifiedIPs(ips)
+	instances, err := service.AddSpecifiedIPs(context.TODO(), cloudprovider.IPRequest{}, ips)
 
 	assert.Len(t, instances, 3)
 	assert.NotNil(t, err)
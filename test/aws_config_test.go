@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"github.com/klenkes74/aws-egressip-operator/pkg/cloudprovider"
+	"github.com/klenkes74/aws-egressip-operator/test/mocks"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+// withEnvironment sets the environment variables (an empty value unsets it) and returns the function restoring them.
+func withEnvironment(values map[string]string) func() {
+	previous := make(map[string]*string, len(values))
+	for key, value := range values {
+		if old, found := os.LookupEnv(key); found {
+			previous[key] = &old
+		} else {
+			previous[key] = nil
+		}
+
+		if value == "" {
+			_ = os.Unsetenv(key)
+		} else {
+			_ = os.Setenv(key, value)
+		}
+	}
+
+	return func() {
+		for key, value := range previous {
+			if value == nil {
+				_ = os.Unsetenv(key)
+			} else {
+				_ = os.Setenv(key, *value)
+			}
+		}
+	}
+}
+
+func TestAwsConfigFromEnvironment(t *testing.T) {
+	defer withEnvironment(map[string]string{"AWS_REGION": "eu-west-1", "CLUSTER_NAME": "prod", "CLUSTER_TAG_VALUE": ""})()
+
+	config, err := cloudprovider.AwsConfigFromEnvironment()
+
+	assert.Nil(t, err)
+	assert.Equal(t, "eu-west-1", config.Region)
+	assert.Equal(t, "prod", config.ClusterName)
+	assert.Equal(t, "owned", config.ClusterTagValue)
+	assert.NotNil(t, config.NodeSelector)
+	assert.NotNil(t, config.Placement)
+}
+
+func TestAwsConfigReadsSharedClusterTagValue(t *testing.T) {
+	defer withEnvironment(map[string]string{"AWS_REGION": "eu-west-1", "CLUSTER_NAME": "prod", "CLUSTER_TAG_VALUE": "shared"})()
+
+	config, err := cloudprovider.AwsConfigFromEnvironment()
+	assert.Nil(t, err)
+
+	service, err := cloudprovider.NewAwsCloudProvider(config, &mocks.AwsClient{})
+	assert.Nil(t, err)
+
+	key, value := service.ClusterTag()
+	assert.Equal(t, "kubernetes.io/cluster/prod", key)
+	assert.Equal(t, "shared", value)
+}
+
+func TestAwsConfigRejectsInvalidClusterTagValue(t *testing.T) {
+	defer withEnvironment(map[string]string{"AWS_REGION": "eu-west-1", "CLUSTER_NAME": "prod", "CLUSTER_TAG_VALUE": "mine"})()
+
+	_, err := cloudprovider.AwsConfigFromEnvironment()
+
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "the cluster tag value 'mine' is neither 'owned' nor 'shared'")
+	}
+}
+
+func TestAwsConfigRequiresClusterNameAndRegion(t *testing.T) {
+	defer withEnvironment(map[string]string{"AWS_REGION": "", "CLUSTER_NAME": ""})()
+
+	_, err := cloudprovider.AwsConfigFromEnvironment()
+
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "AWS_REGION")
+		assert.Contains(t, err.Error(), "CLUSTER_NAME")
+	}
+}
+
+func TestAwsConfigReportsAllInvalidValues(t *testing.T) {
+	defer withEnvironment(map[string]string{
+		"AWS_REGION":              "frankfurt",
+		"CLUSTER_NAME":            "prod",
+		"INVENTORY_RESYNC_PERIOD": "often",
+		"PLACEMENT_STRATEGY":      "anywhere",
+	})()
+
+	_, err := cloudprovider.AwsConfigFromEnvironment()
+
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "INVENTORY_RESYNC_PERIOD")
+		assert.Contains(t, err.Error(), "PLACEMENT_STRATEGY")
+	}
+
+	config := cloudprovider.DefaultAwsConfig("frankfurt", "prod")
+	err = config.Validate()
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "'frankfurt' is no valid AWS region")
+	}
+}
+
+func TestNewAwsCloudProviderRejectsInvalidConfig(t *testing.T) {
+	service, err := cloudprovider.NewAwsCloudProvider(cloudprovider.DefaultAwsConfig(region, ""), &mocks.AwsClient{})
+
+	assert.Nil(t, service)
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "the cluster name is missing")
+	}
+}
+
+func TestUninitializedAwsCloudProviderRejectsCalls(t *testing.T) {
+	mockAws := &mocks.AwsClient{}
+	service := &cloudprovider.AwsCloudProvider{Aws: mockAws, Region: region, ClusterName: clusterName}
+
+	_, _, err := service.AddRandomIPs(context.TODO(), cloudprovider.IPRequest{})
+
+	assert.Equal(t, cloudprovider.ErrProviderNotInitialized, err)
+	mockAws.AssertExpectations(t)
+}
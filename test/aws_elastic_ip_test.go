@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/klenkes74/aws-egressip-operator/pkg/cloudprovider"
+	"github.com/klenkes74/aws-egressip-operator/pkg/openshift"
+	"github.com/klenkes74/aws-egressip-operator/test/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net"
+	"testing"
+)
+
+// createElasticIPProvider creates the provider without the default of no associated Elastic IPs.
+func createElasticIPProvider(mockAws *mocks.AwsClient, poolSelector string) *cloudprovider.AwsCloudProvider {
+	selector, _ := cloudprovider.ParseTagSelector(poolSelector)
+
+	mockDefaultInstanceAwsCalls(mockAws)
+	mockDefaultSubnetAwsCalls(mockAws)
+
+	return createAwsCloudProvider(mockAws, func(config *cloudprovider.AwsConfig) {
+		config.ElasticIPPoolSelector = selector
+	})
+}
+
+func mockElasticIPsOfIP(mockAws *mocks.AwsClient, ip string, addresses ...*ec2.Address) {
+	mockAws.On("DescribeAddresses", mock.Anything, &ec2.DescribeAddressesInput{
+		Filters: []*ec2.Filter{createFilter("private-ip-address", []string{ip})},
+	}).Return(&ec2.DescribeAddressesOutput{Addresses: addresses}, nil).Once()
+}
+
+func TestAssociatePublicIPAllocatesElasticIP(t *testing.T) {
+	defer useMultiInterfaceInstance()()
+
+	mockAws := &mocks.AwsClient{}
+	service := createElasticIPProvider(mockAws, "")
+
+	mockDescribeNetworkInterfaceByIPMock(mockAws, "1.1.1.40")
+	mockElasticIPsOfIP(mockAws, "1.1.1.40")
+	mockAws.On("AllocateAddress", mock.Anything, &ec2.AllocateAddressInput{Domain: aws.String("vpc")}).
+		Return(&ec2.AllocateAddressOutput{AllocationId: aws.String("eipalloc-1"), PublicIp: aws.String("203.0.113.10")}, nil).Once()
+	mockAws.On("CreateTags", mock.Anything, &ec2.CreateTagsInput{
+		Resources: aws.StringSlice([]string{"eipalloc-1"}),
+		Tags: []*ec2.Tag{
+			{Key: aws.String("kubernetes.io/cluster/nicer"), Value: aws.String("owned")},
+			{Key: aws.String("aws-egressip-operator/allocated"), Value: aws.String("true")},
+			{Key: aws.String("aws-egressip-operator/namespace"), Value: aws.String("my-namespace")},
+		},
+	}).Return(&ec2.CreateTagsOutput{}, nil).Once()
+	mockAws.On("AssociateAddress", mock.Anything, &ec2.AssociateAddressInput{
+		AllocationId:       aws.String("eipalloc-1"),
+		NetworkInterfaceId: aws.String("vm-1"),
+		PrivateIpAddress:   aws.String("1.1.1.40"),
+		AllowReassociation: aws.Bool(false),
+	}).Return(&ec2.AssociateAddressOutput{AssociationId: aws.String("eipassoc-1")}, nil).Once()
+
+	ip := net.ParseIP("1.1.1.40")
+	result, err := service.AssociatePublicIP(context.TODO(), cloudprovider.IPRequest{Namespace: "my-namespace"}, &ip)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "203.0.113.10", result.String())
+
+	mockAws.AssertExpectations(t)
+}
+
+func TestAssociatePublicIPReleasesElasticIPOnFailure(t *testing.T) {
+	defer useMultiInterfaceInstance()()
+
+	mockAws := &mocks.AwsClient{}
+	service := createElasticIPProvider(mockAws, "")
+
+	mockDescribeNetworkInterfaceByIPMock(mockAws, "1.1.1.40")
+	mockElasticIPsOfIP(mockAws, "1.1.1.40")
+	mockAws.On("AllocateAddress", mock.Anything, mock.Anything).
+		Return(&ec2.AllocateAddressOutput{AllocationId: aws.String("eipalloc-1"), PublicIp: aws.String("203.0.113.10")}, nil).Once()
+	mockAws.On("CreateTags", mock.Anything, mock.Anything).Return(&ec2.CreateTagsOutput{}, nil).Once()
+	mockAws.On("AssociateAddress", mock.Anything, mock.Anything).Return(nil, assert.AnError).Once()
+	mockAws.On("ReleaseAddress", mock.Anything, &ec2.ReleaseAddressInput{AllocationId: aws.String("eipalloc-1")}).
+		Return(&ec2.ReleaseAddressOutput{}, nil).Once()
+
+	ip := net.ParseIP("1.1.1.40")
+	_, err := service.AssociatePublicIP(context.TODO(), cloudprovider.IPRequest{}, &ip)
+
+	assert.NotNil(t, err)
+
+	mockAws.AssertExpectations(t)
+}
+
+func TestAssociatePublicIPTakesElasticIPFromPool(t *testing.T) {
+	defer useMultiInterfaceInstance()()
+
+	mockAws := &mocks.AwsClient{}
+	service := createElasticIPProvider(mockAws, "egress-pool=nicer")
+
+	poolTag := []*ec2.Tag{{Key: aws.String("egress-pool"), Value: aws.String("nicer")}}
+
+	mockDescribeNetworkInterfaceByIPMock(mockAws, "1.1.1.40")
+	mockElasticIPsOfIP(mockAws, "1.1.1.40")
+	mockAws.On("DescribeAddresses", mock.Anything, &ec2.DescribeAddressesInput{
+		Filters: []*ec2.Filter{createFilter("domain", []string{"vpc"})},
+	}).Return(&ec2.DescribeAddressesOutput{
+		Addresses: []*ec2.Address{
+			{AllocationId: aws.String("eipalloc-1"), PublicIp: aws.String("203.0.113.1"), AssociationId: aws.String("eipassoc-1"), Tags: poolTag},
+			{AllocationId: aws.String("eipalloc-2"), PublicIp: aws.String("203.0.113.2")},
+			{AllocationId: aws.String("eipalloc-3"), PublicIp: aws.String("203.0.113.3"), Tags: poolTag},
+		},
+	}, nil).Once()
+	mockAws.On("AssociateAddress", mock.Anything, &ec2.AssociateAddressInput{
+		AllocationId:       aws.String("eipalloc-3"),
+		NetworkInterfaceId: aws.String("vm-1"),
+		PrivateIpAddress:   aws.String("1.1.1.40"),
+		AllowReassociation: aws.Bool(false),
+	}).Return(&ec2.AssociateAddressOutput{AssociationId: aws.String("eipassoc-3")}, nil).Once()
+
+	ip := net.ParseIP("1.1.1.40")
+	result, err := service.AssociatePublicIP(context.TODO(), cloudprovider.IPRequest{}, &ip)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "203.0.113.3", result.String())
+
+	mockAws.AssertExpectations(t)
+	mockAws.AssertNotCalled(t, "AllocateAddress", mock.Anything, mock.Anything)
+}
+
+func TestRemoveIPReleasesAllocatedElasticIP(t *testing.T) {
+	defer useMultiInterfaceInstance()()
+
+	mockAws := &mocks.AwsClient{}
+	service := createElasticIPProvider(mockAws, "")
+
+	mockDescribeNetworkInterfaceByIPMock(mockAws, "1.1.1.40")
+	mockElasticIPsOfIP(mockAws, "1.1.1.40", &ec2.Address{
+		AllocationId:  aws.String("eipalloc-1"),
+		AssociationId: aws.String("eipassoc-1"),
+		PublicIp:      aws.String("203.0.113.10"),
+		Tags:          []*ec2.Tag{{Key: aws.String("aws-egressip-operator/allocated"), Value: aws.String("true")}},
+	})
+	mockAws.On("DisassociateAddress", mock.Anything, &ec2.DisassociateAddressInput{AssociationId: aws.String("eipassoc-1")}).
+		Return(&ec2.DisassociateAddressOutput{}, nil).Once()
+	mockAws.On("ReleaseAddress", mock.Anything, &ec2.ReleaseAddressInput{AllocationId: aws.String("eipalloc-1")}).
+		Return(&ec2.ReleaseAddressOutput{}, nil).Once()
+	mockAws.On("UnassignPrivateIPAddresses", mock.Anything, &ec2.UnassignPrivateIpAddressesInput{
+		NetworkInterfaceId: aws.String("vm-1"),
+		PrivateIpAddresses: aws.StringSlice([]string{"1.1.1.40"}),
+	}).Return(&ec2.UnassignPrivateIpAddressesOutput{}, nil).Once()
+
+	ip := net.ParseIP("1.1.1.40")
+	instanceID, err := service.RemoveIP(context.TODO(), &ip)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "vm-1", instanceID)
+
+	mockAws.AssertExpectations(t)
+}
+
+func TestRemoveIPReturnsElasticIPToPool(t *testing.T) {
+	defer useMultiInterfaceInstance()()
+
+	mockAws := &mocks.AwsClient{}
+	service := createElasticIPProvider(mockAws, "egress-pool=nicer")
+
+	mockDescribeNetworkInterfaceByIPMock(mockAws, "1.1.1.40")
+	mockElasticIPsOfIP(mockAws, "1.1.1.40", &ec2.Address{
+		AllocationId:  aws.String("eipalloc-3"),
+		AssociationId: aws.String("eipassoc-3"),
+		PublicIp:      aws.String("203.0.113.3"),
+		Tags:          []*ec2.Tag{{Key: aws.String("egress-pool"), Value: aws.String("nicer")}},
+	})
+	mockAws.On("DisassociateAddress", mock.Anything, &ec2.DisassociateAddressInput{AssociationId: aws.String("eipassoc-3")}).
+		Return(&ec2.DisassociateAddressOutput{}, nil).Once()
+	mockAws.On("UnassignPrivateIPAddresses", mock.Anything, mock.Anything).Return(&ec2.UnassignPrivateIpAddressesOutput{}, nil).Once()
+
+	ip := net.ParseIP("1.1.1.40")
+	_, err := service.RemoveIP(context.TODO(), &ip)
+
+	assert.Nil(t, err)
+
+	mockAws.AssertExpectations(t)
+	mockAws.AssertNotCalled(t, "ReleaseAddress", mock.Anything, mock.Anything)
+}
+
+func TestHandlerRecordsPublicIPsOnNamespace(t *testing.T) {
+	original := instances
+	defer func() { instances = original }()
+	instances = map[string]*ec2.Instance{
+		"vm-1": createInstance("vm-1", "1.1.1.34", "nice-a", "ip-1-1-1-34.my-local.inf", "subnet-1", "1.1.1.11"),
+	}
+
+	cloudInstance := &mocks.CloudInstance{}
+	cloudInstance.On("ID").Return("vm-1")
+	cloudInstance.On("HostName").Return("ip-1-1-1-34.my-local.inf")
+	instance := cloudprovider.CloudInstance(cloudInstance)
+
+	publicIP := net.ParseIP("203.0.113.10")
+	cloud := &mocks.CloudProvider{}
+	cloud.On("AddRandomIPs", mock.Anything, mock.Anything).Return([]string{"vm-1"}, defaultIPs("1.1.1.11"), nil)
+	cloud.On("Instance", mock.Anything, "vm-1").Return(&instance, nil)
+	cloud.On("AssociatePublicIP", mock.Anything, cloudprovider.IPRequest{Namespace: "default-namespace"}, defaultIPs("1.1.1.11")[0]).
+		Return(&publicIP, nil).Once()
+
+	mockOcp := &mocks.OcpClient{}
+	mockSaveNamespaces(mockOcp)
+	mockHostSubnet(t, mockOcp, "ip-1-1-1-34.my-local.inf")
+
+	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
+
+	namespace := defaultNamespace()
+	namespace.Annotations[openshift.ElasticIPAnnotation] = "true"
+	ips, err := service.AddIPsToInfrastructure(context.TODO(), namespace)
+
+	assert.Nil(t, err)
+	assert.Equal(t, defaultIPs("1.1.1.11"), ips)
+	assert.Equal(t, "203.0.113.10", namespace.Annotations[openshift.PublicIPsAnnotation])
+
+	cloud.AssertExpectations(t)
+}
+
+func TestMockCloudAssociatesPublicIP(t *testing.T) {
+	service := createMockCloudProvider(t)
+
+	ip := net.ParseIP("1.1.1.4")
+	publicIP, err := service.AssociatePublicIP(context.TODO(), cloudprovider.IPRequest{}, &ip)
+	assert.Nil(t, err)
+	assert.Equal(t, "203.0.113.1", publicIP.String())
+
+	again, err := service.AssociatePublicIP(context.TODO(), cloudprovider.IPRequest{}, &ip)
+	assert.Nil(t, err)
+	assert.Equal(t, publicIP.String(), again.String())
+
+	unassigned := net.ParseIP("1.1.1.99")
+	_, err = service.AssociatePublicIP(context.TODO(), cloudprovider.IPRequest{}, &unassigned)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/klenkes74/aws-egressip-operator/pkg/cloudprovider"
+	"github.com/klenkes74/aws-egressip-operator/test/mocks"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+)
+
+func TestFailoverIPAssignsIPInNextZone(t *testing.T) {
+	mockAws := &mocks.AwsClient{}
+	service := createAwsCloudProviderMock(mockAws)
+	mockAddRandomIPSuccessfully(mockAws, "vm-3", "1.1.2.99")
+	mockAddRandomIPSuccessfully(mockAws, "vm-4", "1.1.2.99")
+
+	ip := net.ParseIP("1.1.1.11")
+	instanceID, replacement, err := service.FailoverIP(context.TODO(), cloudprovider.IPRequest{}, &ip)
+
+	assert.Nil(t, err)
+	assert.Contains(t, []string{"vm-3", "vm-4"}, instanceID)
+	assert.Equal(t, "1.1.2.99", replacement.String())
+}
+
+func TestFailoverIPPrefersZonesOfNamespace(t *testing.T) {
+	mockAws := &mocks.AwsClient{}
+	service := createAwsCloudProviderMock(mockAws)
+	mockAddRandomIPSuccessfully(mockAws, "vm-5", "1.1.3.99")
+	mockAddRandomIPSuccessfully(mockAws, "vm-6", "1.1.3.99")
+
+	ip := net.ParseIP("1.1.1.11")
+	request := cloudprovider.IPRequest{Zones: []string{"nice-a", "nice-c"}}
+	instanceID, replacement, err := service.FailoverIP(context.TODO(), request, &ip)
+
+	assert.Nil(t, err)
+	assert.Contains(t, []string{"vm-5", "vm-6"}, instanceID)
+	assert.Equal(t, "1.1.3.99", replacement.String())
+}
+
+func TestReclaimIPReportsZoneWithoutEgressNode(t *testing.T) {
+	originalInstances := instances
+	defer func() { instances = originalInstances }()
+	// all instances of zone nice-a are gone.
+	instances = map[string]*ec2.Instance{
+		"vm-3": createInstance("vm-3", "1.1.2.75", "nice-b", "ip-1-1-2-75.my-local.inf", "subnet-2"),
+	}
+
+	mockAws := &mocks.AwsClient{}
+	service := createAwsCloudProviderMock(mockAws)
+	mockDescribeNetworkInterfaceByIPMock(mockAws, "1.1.1.60")
+
+	ip := net.ParseIP("1.1.1.60")
+	_, _, err := service.ReclaimIP(context.TODO(), cloudprovider.IPRequest{}, &ip)
+
+	assert.True(t, cloudprovider.IsNoEgressNode(err), "expected no egress node error but got: %v", err)
+}
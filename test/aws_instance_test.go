@@ -1,10 +1,12 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/klenkes74/aws-egressip-operator/test/mocks"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"testing"
 )
 
@@ -14,7 +16,7 @@ func TestSuccessfulInstance(t *testing.T) {
 
 	mockDescribeInstance(mockAws, "vm-1")
 
-	instance, err := service.Instance("vm-1")
+	instance, err := service.Instance(context.TODO(), "vm-1")
 
 	assert.Equal(t, "vm-1", (*instance).ID())
 
@@ -27,14 +29,14 @@ func TestFailedInstance(t *testing.T) {
 	mockAws := &mocks.AwsClient{}
 	service := createAwsCloudProviderMock(mockAws)
 
-	mockAws.On("DescribeInstances", &ec2.DescribeInstancesInput{
+	mockAws.On("DescribeInstances", mock.Anything, &ec2.DescribeInstancesInput{
 		Filters: []*ec2.Filter{
 			createFilter("instance-id", []string{"err-1"}),
 			createFilter("instance-state-name", []string{"running"}),
 		},
 	}).Return(nil, errors.New("AWS could not find instance"))
 
-	_, err := service.Instance("err-1")
+	_, err := service.Instance(context.TODO(), "err-1")
 
 	assert.NotNil(t, err)
 
@@ -47,7 +49,7 @@ func TestSuccessfulInstanceByHostname(t *testing.T) {
 
 	mockDescribeInstance(mockAws, "vm-1")
 
-	_, err := service.InstanceByHostName("ip-1-1-1-34.my-local.inf")
+	_, err := service.InstanceByHostName(context.TODO(), "ip-1-1-1-34.my-local.inf")
 
 	assert.Nil(t, err)
 
@@ -58,13 +60,13 @@ func TestFailedInstanceByHostname(t *testing.T) {
 	mockAws := &mocks.AwsClient{}
 	service := createAwsCloudProviderMock(mockAws)
 
-	mockAws.On("DescribeInstances", &ec2.DescribeInstancesInput{
+	mockAws.On("DescribeInstances", mock.Anything, &ec2.DescribeInstancesInput{
 		Filters: []*ec2.Filter{
 			createFilter("private-dns-name", []string{"ip-1-1-1-31.my-local.inf"}),
 		},
 	}).Return(nil, errors.New("AWS could not find instance"))
 
-	_, err := service.InstanceByHostName("ip-1-1-1-31.my-local.inf")
+	_, err := service.InstanceByHostName(context.TODO(), "ip-1-1-1-31.my-local.inf")
 
 	assert.NotNil(t, err)
 
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/klenkes74/aws-egressip-operator/pkg/cloudprovider"
+	"github.com/klenkes74/aws-egressip-operator/test/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net"
+	"testing"
+)
+
+// useTypedInstances replaces the default instances with two instances of different instance types in subnet-1. The
+// returned function restores the default instances.
+func useTypedInstances(smallType string, largeType string) func() {
+	original := instances
+
+	small := createInstance("vm-1", "1.1.1.34", "nice-a", "ip-1-1-1-34.my-local.inf", "subnet-1", "1.1.1.40")
+	small.InstanceType = aws.String(smallType)
+	large := createInstance("vm-2", "1.1.1.93", "nice-a", "ip-1-1-1-93.my-local.inf", "subnet-1", "1.1.1.94", "1.1.1.95")
+	large.InstanceType = aws.String(largeType)
+
+	instances = map[string]*ec2.Instance{"vm-1": small, "vm-2": large}
+
+	return func() {
+		instances = original
+	}
+}
+
+func TestAddRandomIPSkipsFullInstanceType(t *testing.T) {
+	defer useTypedInstances("t3.nano", "m5.large")()
+
+	mockAws := &mocks.AwsClient{}
+	service := createAwsCloudProviderMock(mockAws)
+
+	mockInstanceType(mockAws, "t3.nano", 2, 2)
+	mockInstanceType(mockAws, "m5.large", 3, 10)
+	mockAddRandomIPSuccessfully(mockAws, "vm-2", "1.1.1.11").Once()
+
+	instanceIDs, ips, _ := service.AddRandomIPs(context.TODO(), cloudprovider.IPRequest{})
+
+	ip := net.ParseIP("1.1.1.11")
+	assert.Contains(t, instanceIDs, "vm-2")
+	assert.Contains(t, ips, &ip)
+
+	mockAws.AssertExpectations(t)
+	mockAws.AssertNotCalled(t, "AssignPrivateIPAddresses", mock.Anything, &ec2.AssignPrivateIpAddressesInput{
+		NetworkInterfaceId:             aws.String("vm-1"),
+		SecondaryPrivateIpAddressCount: aws.Int64(1),
+	})
+}
+
+func TestAddSpecifiedIPFailsEarlyWhenSubnetIsFull(t *testing.T) {
+	defer useTypedInstances("t3.nano", "t3.micro")()
+
+	mockAws := &mocks.AwsClient{}
+	service := createAwsCloudProviderMock(mockAws)
+
+	mockInstanceType(mockAws, "t3.nano", 2, 2)
+	mockInstanceType(mockAws, "t3.micro", 2, 2)
+
+	_, err := service.AddSpecifiedIPs(context.TODO(), cloudprovider.IPRequest{}, defaultIPs("1.1.1.12"))
+
+	assert.True(t, cloudprovider.IsCapacityExhausted(err), "expected capacity exhausted error but got: %v", err)
+	mockAws.AssertNotCalled(t, "AssignPrivateIPAddresses", mock.Anything, mock.Anything)
+}
+
+func TestAddSpecifiedIPFailsEarlyWhenInstanceReachedENILimit(t *testing.T) {
+	defer useTypedInstances("t3.nano", "t3.micro")()
+	// vm-1 carries 3 ips on two ENIs, none of them is full on its own.
+	addNetworkInterface(instances["vm-1"], "eni-1b", "1.1.1.50", "subnet-1")
+
+	mockAws := &mocks.AwsClient{}
+	service := createAwsCloudProviderMock(mockAws)
+
+	mockInstanceType(mockAws, "t3.nano", 1, 3)
+	mockInstanceType(mockAws, "t3.micro", 1, 3)
+
+	_, err := service.AddSpecifiedIPs(context.TODO(), cloudprovider.IPRequest{}, defaultIPs("1.1.1.12"))
+
+	assert.True(t, cloudprovider.IsCapacityExhausted(err), "expected capacity exhausted error but got: %v", err)
+	mockAws.AssertNotCalled(t, "AssignPrivateIPAddresses", mock.Anything, mock.Anything)
+}
+
+func TestNetworkInterfaceReportsCapacity(t *testing.T) {
+	defer useTypedInstances("t3.nano", "m5.large")()
+
+	mockAws := &mocks.AwsClient{}
+	service := createAwsCloudProviderMock(mockAws)
+
+	mockInstanceType(mockAws, "m5.large", 3, 10)
+	mockDescribeInstance(mockAws, "vm-2")
+
+	instance, err := service.Instance(context.TODO(), "vm-2")
+	assert.Nil(t, err)
+
+	networkInterfaces := (*instance).NetworkInterfaces()
+	assert.Len(t, networkInterfaces, 1)
+	assert.Equal(t, 3, networkInterfaces[0].IPCount())
+	assert.Equal(t, 10, networkInterfaces[0].IPCapacity())
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/klenkes74/aws-egressip-operator/pkg/cloudprovider"
+	"github.com/klenkes74/aws-egressip-operator/test/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"sync"
+	"testing"
+	"time"
+)
+
+func mockInstanceInventory(mockAws *mocks.AwsClient, instanceIDs ...string) {
+	reservations := make([]*ec2.Reservation, 0)
+	for _, id := range instanceIDs {
+		reservations = append(reservations, createReservation(id)...)
+	}
+
+	mockAws.On("DescribeInstances", mock.Anything, &ec2.DescribeInstancesInput{
+		Filters: []*ec2.Filter{
+			createFilter("tag-key", []string{"kubernetes.io/cluster/nicer"}),
+			createFilter("instance-state-name", []string{"running"}),
+		},
+	}).Return(&ec2.DescribeInstancesOutput{
+		Reservations: reservations,
+	}, nil).Once()
+}
+
+func TestResyncEvictsTerminatedInstances(t *testing.T) {
+	mockAws := &mocks.AwsClient{}
+	service := createAwsCloudProvider(mockAws)
+	mockDefaultSubnetAwsCalls(mockAws)
+
+	mockInstanceInventory(mockAws, "vm-1", "vm-2")
+	assert.Nil(t, service.Resync(context.TODO()))
+
+	instance, err := service.InstanceByHostName(context.TODO(), "ip-1-1-1-93.my-local.inf")
+	assert.Nil(t, err)
+	assert.Equal(t, "vm-2", (*instance).ID())
+
+	mockInstanceInventory(mockAws, "vm-1")
+	assert.Nil(t, service.Resync(context.TODO()))
+
+	mockAws.On("DescribeInstances", mock.Anything, &ec2.DescribeInstancesInput{
+		Filters: []*ec2.Filter{
+			createFilter("instance-id", []string{"vm-2"}),
+			createFilter("instance-state-name", []string{"running"}),
+		},
+	}).Return(nil, errors.New("instance vm-2 is terminated")).Once()
+
+	_, err = service.Instance(context.TODO(), "vm-2")
+	assert.NotNil(t, err)
+
+	instance, err = service.Instance(context.TODO(), "vm-1")
+	assert.Nil(t, err)
+	assert.Equal(t, "vm-1", (*instance).ID())
+
+	mockAws.AssertExpectations(t)
+}
+
+func TestConcurrentInventoryAccess(t *testing.T) {
+	mockAws := &mocks.AwsClient{}
+	service := createAwsCloudProviderMock(mockAws)
+	for id := range instances {
+		mockDescribeInstance(mockAws, id)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			assert.Nil(t, service.(*cloudprovider.AwsCloudProvider).Resync(context.TODO()))
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := service.Instance(context.TODO(), "vm-1")
+			assert.Nil(t, err)
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := service.InstanceByHostName(context.TODO(), "ip-1-1-3-21.my-local.inf")
+			assert.Nil(t, err)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestInventoryResyncStopsWithManager(t *testing.T) {
+	mockAws := &mocks.AwsClient{}
+	service := createAwsCloudProviderMock(mockAws).(*cloudprovider.AwsCloudProvider)
+
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- service.Start(stop)
+	}()
+
+	close(stop)
+
+	select {
+	case err := <-done:
+		assert.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("inventory resync did not stop")
+	}
+}
+
+func TestInventoryKeepsIPsAssignedSinceLastResync(t *testing.T) {
+	defer useTypedInstances("t3.nano", "t3.micro")()
+
+	mockAws := &mocks.AwsClient{}
+	service := createAwsCloudProviderMock(mockAws)
+
+	// vm-1 can take one more ip, vm-2 is full.
+	mockInstanceType(mockAws, "t3.nano", 2, 3)
+	mockInstanceType(mockAws, "t3.micro", 2, 3)
+	mockAddRandomIPSuccessfully(mockAws, "vm-1", "1.1.1.11").Once()
+
+	request := cloudprovider.IPRequest{Zones: []string{"nice-a"}, ZoneCount: 1}
+
+	instanceIDs, _, err := service.AddRandomIPs(context.TODO(), request)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"vm-1"}, instanceIDs)
+
+	instance, err := service.Instance(context.TODO(), "vm-1")
+	assert.Nil(t, err)
+	assert.Contains(t, ipStrings((*instance).SecondaryIps()), "1.1.1.11")
+
+	// the second call sees vm-1 being full now.
+	_, _, err = service.AddRandomIPs(context.TODO(), request)
+	assert.True(t, cloudprovider.IsCapacityExhausted(err), "expected capacity exhausted error but got: %v", err)
+	mockAws.AssertExpectations(t)
+}
+
+// mockAllInstances -- AWS returns all instances of the cluster.
+func mockAllInstances(mockAws *mocks.AwsClient) *mock.Call {
+	return mockAws.On("DescribeInstances", mock.Anything, &ec2.DescribeInstancesInput{
+		Filters: []*ec2.Filter{
+			createFilter("tag-key", []string{"kubernetes.io/cluster/nicer"}),
+			createFilter("instance-state-name", []string{"running"}),
+		},
+	}).Return(&ec2.DescribeInstancesOutput{
+		Reservations: createReservations(),
+	}, nil)
+}
+
+func TestConcurrentReadsOfStaleInventoryShareOneResync(t *testing.T) {
+	mockAws := &mocks.AwsClient{}
+	service := createAwsCloudProvider(mockAws)
+	mockDefaultSubnetAwsCalls(mockAws)
+	mockAllInstances(mockAws).After(50 * time.Millisecond)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			nodes, err := service.EgressNodes(context.TODO())
+			assert.Nil(t, err)
+			assert.NotEmpty(t, nodes)
+		}()
+	}
+	wg.Wait()
+
+	mockAws.AssertNumberOfCalls(t, "DescribeInstances", 1)
+}
+
+func TestInventoryKeepsIPsAssignedDuringResync(t *testing.T) {
+	defer useTypedInstances("t3.nano", "t3.micro")()
+
+	mockAws := &mocks.AwsClient{}
+	service := createAwsCloudProvider(mockAws)
+	mockDefaultSubnetAwsCalls(mockAws)
+	mockNoElasticIPs(mockAws)
+	mockInstanceType(mockAws, "t3.nano", 2, 3)
+	mockInstanceType(mockAws, "t3.micro", 2, 3)
+	mockAddRandomIPSuccessfully(mockAws, "vm-1", "1.1.1.11").Once()
+
+	mockAllInstances(mockAws).Once()
+	assert.Nil(t, service.Resync(context.TODO()))
+
+	// the ip is assigned after AWS has been read by the resync, the result of the resync does not contain it.
+	request := cloudprovider.IPRequest{Zones: []string{"nice-a"}, ZoneCount: 1}
+	mockAllInstances(mockAws).
+		Run(func(mock.Arguments) {
+			instanceIDs, _, err := service.AddRandomIPs(context.TODO(), request)
+			assert.Nil(t, err)
+			assert.Equal(t, []string{"vm-1"}, instanceIDs)
+		}).
+		Once()
+	assert.Nil(t, service.Resync(context.TODO()))
+
+	instance, err := service.Instance(context.TODO(), "vm-1")
+	assert.Nil(t, err)
+	assert.Contains(t, ipStrings((*instance).SecondaryIps()), "1.1.1.11")
+	mockAws.AssertExpectations(t)
+}
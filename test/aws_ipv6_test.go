@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/klenkes74/aws-egressip-operator/pkg/cloudprovider"
+	"github.com/klenkes74/aws-egressip-operator/pkg/openshift"
+	"github.com/klenkes74/aws-egressip-operator/test/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net"
+	"testing"
+)
+
+// useIPv6Subnet adds the IPv6 CIDR 2001:db8:1::/64 to subnet-1 and replaces the default instances with vm-1 in
+// subnet-1 carrying the IPv6 address 2001:db8:1::10 and vm-3 in subnet-2 without IPv6. The returned function restores
+// the defaults.
+func useIPv6Subnet() func() {
+	originalSubnets := subnets
+	originalInstances := instances
+
+	ipv6Subnet := *subnets[0]
+	ipv6Subnet.Ipv6CidrBlockAssociationSet = []*ec2.SubnetIpv6CidrBlockAssociation{
+		{
+			Ipv6CidrBlock:      aws.String("2001:db8:1::/64"),
+			Ipv6CidrBlockState: &ec2.SubnetCidrBlockState{State: aws.String(ec2.SubnetCidrBlockStateCodeAssociated)},
+		},
+	}
+	subnets = []*ec2.Subnet{&ipv6Subnet, subnets[1]}
+
+	vm1 := createInstance("vm-1", "1.1.1.34", "nice-a", "ip-1-1-1-34.my-local.inf", "subnet-1")
+	vm1.NetworkInterfaces[0].Ipv6Addresses = []*ec2.InstanceIpv6Address{{Ipv6Address: aws.String("2001:db8:1::10")}}
+	instances = map[string]*ec2.Instance{
+		"vm-1": vm1,
+		"vm-3": createInstance("vm-3", "1.1.2.75", "nice-b", "ip-1-1-2-75.my-local.inf", "subnet-2"),
+	}
+
+	return func() {
+		subnets = originalSubnets
+		instances = originalInstances
+	}
+}
+
+func TestInstanceReportsIPv6Addresses(t *testing.T) {
+	defer useIPv6Subnet()()
+
+	mockAws := &mocks.AwsClient{}
+	service := createAwsCloudProviderMock(mockAws)
+	mockDescribeInstance(mockAws, "vm-1")
+
+	instance, err := service.Instance(context.TODO(), "vm-1")
+
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, defaultIPs("2001:db8:1::10"), (*instance).SecondaryIps())
+	assert.Equal(t, 1, (*instance).NetworkInterfaces()[0].IPCount())
+}
+
+func TestAddSpecifiedIPv6(t *testing.T) {
+	defer useIPv6Subnet()()
+
+	mockAws := &mocks.AwsClient{}
+	service := createAwsCloudProviderMock(mockAws)
+
+	mockAws.On("AssignIPv6Addresses", mock.Anything, &ec2.AssignIpv6AddressesInput{
+		NetworkInterfaceId: aws.String("vm-1"),
+		Ipv6Addresses:      aws.StringSlice([]string{"2001:db8:1::20"}),
+	}).Return(&ec2.AssignIpv6AddressesOutput{}, nil).Once()
+
+	result, err := service.AddSpecifiedIPs(context.TODO(), cloudprovider.IPRequest{}, defaultIPs("2001:db8:1::20"))
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"vm-1"}, result)
+
+	mockAws.AssertExpectations(t)
+}
+
+func TestAddSpecifiedIPv6OutsideOfSubnets(t *testing.T) {
+	defer useIPv6Subnet()()
+
+	mockAws := &mocks.AwsClient{}
+	service := createAwsCloudProviderMock(mockAws)
+
+	_, err := service.AddSpecifiedIPs(context.TODO(), cloudprovider.IPRequest{}, defaultIPs("2001:db8:2::20"))
+
+	assert.NotNil(t, err)
+	mockAws.AssertNotCalled(t, "AssignIPv6Addresses")
+}
+
+func TestAddRandomIPv6SkipsSubnetsWithoutIPv6(t *testing.T) {
+	defer useIPv6Subnet()()
+
+	mockAws := &mocks.AwsClient{}
+	service := createAwsCloudProviderMock(mockAws)
+
+	mockAws.On("AssignIPv6Addresses", mock.Anything, &ec2.AssignIpv6AddressesInput{
+		NetworkInterfaceId: aws.String("vm-1"),
+		Ipv6AddressCount:   aws.Int64(1),
+	}).Return(&ec2.AssignIpv6AddressesOutput{
+		AssignedIpv6Addresses: aws.StringSlice([]string{"2001:db8:1::21"}),
+	}, nil).Once()
+
+	instanceIDs, ips, err := service.AddRandomIPs(context.TODO(), cloudprovider.IPRequest{Families: []cloudprovider.IPFamily{cloudprovider.IPv6}})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"vm-1"}, instanceIDs)
+	assert.Equal(t, defaultIPs("2001:db8:1::21"), ips)
+
+	mockAws.AssertExpectations(t)
+}
+
+func TestRemoveIPv6(t *testing.T) {
+	defer useIPv6Subnet()()
+
+	mockAws := &mocks.AwsClient{}
+	service := createAwsCloudProviderMock(mockAws)
+
+	mockAws.On("DescribeNetworkInterfaces", mock.Anything, &ec2.DescribeNetworkInterfacesInput{
+		Filters: []*ec2.Filter{
+			createFilter("ipv6-addresses.ipv6-address", []string{"2001:db8:1::10"}),
+		},
+	}).Return(&ec2.DescribeNetworkInterfacesOutput{
+		NetworkInterfaces: []*ec2.NetworkInterface{networkInterfaces["1.1.1.34"]},
+	}, nil).Once()
+	mockAws.On("UnassignIPv6Addresses", mock.Anything, &ec2.UnassignIpv6AddressesInput{
+		NetworkInterfaceId: aws.String("vm-1"),
+		Ipv6Addresses:      aws.StringSlice([]string{"2001:db8:1::10"}),
+	}).Return(&ec2.UnassignIpv6AddressesOutput{}, nil).Once()
+
+	ip := net.ParseIP("2001:db8:1::10")
+	instanceID, err := service.RemoveIP(context.TODO(), &ip)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "vm-1", instanceID)
+
+	mockAws.AssertExpectations(t)
+}
+
+func TestParseMixedIPList(t *testing.T) {
+	ips, err := openshift.ParseIPList("1.1.1.11, 2001:db8:1::20,,1.1.2.22")
+
+	assert.Nil(t, err)
+	assert.Equal(t, defaultIPs("1.1.1.11", "2001:db8:1::20", "1.1.2.22"), ips)
+
+	_, err = openshift.ParseIPList("1.1.1.11,1.1.1")
+	assert.NotNil(t, err)
+}
+
+func TestParseIPFamilies(t *testing.T) {
+	families, err := cloudprovider.ParseIPFamilies("ipv6, IPv4,IPv6")
+
+	assert.Nil(t, err)
+	assert.Equal(t, []cloudprovider.IPFamily{cloudprovider.IPv6, cloudprovider.IPv4}, families)
+
+	_, err = cloudprovider.ParseIPFamilies("IPv5")
+	assert.NotNil(t, err)
+}
+
+func TestHandlerRejectsIPv6WithoutSdnSupport(t *testing.T) {
+	cloud := &mocks.CloudProvider{}
+	mockOcp := &mocks.OcpClient{}
+
+	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
+
+	namespace := defaultNamespace()
+	namespace.Annotations["egressip-ipam-operator.redhat-cop.io/egressips"] = "1.1.1.11,2001:db8:1::20"
+	_, err := service.AddIPsToInfrastructure(context.TODO(), namespace)
+	assert.NotNil(t, err)
+
+	namespace = defaultNamespace()
+	namespace.Annotations[openshift.IPFamiliesAnnotation] = "IPv4,IPv6"
+	_, err = service.AddIPsToInfrastructure(context.TODO(), namespace)
+	assert.NotNil(t, err)
+
+	cloud.AssertNotCalled(t, "AddSpecifiedIPs")
+	cloud.AssertNotCalled(t, "AddRandomIPs")
+}
+
+func TestMockCloudAddsRandomIPv6(t *testing.T) {
+	config, err := cloudprovider.ParseMockConfig([]byte(mockCloudConfig))
+	assert.Nil(t, err)
+	config.Subnets[0].IPv6CIDR = "2001:db8:1::/64"
+
+	service, err := cloudprovider.NewMockCloudProvider(config)
+	assert.Nil(t, err)
+
+	instanceIDs, ips, err := service.AddRandomIPs(context.TODO(), cloudprovider.IPRequest{
+		Families: []cloudprovider.IPFamily{cloudprovider.IPv4, cloudprovider.IPv6},
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"vm-1", "vm-2", "vm-1"}, instanceIDs)
+	assert.Equal(t, defaultIPs("1.1.1.5", "1.1.2.4", "2001:db8:1::4"), ips)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/klenkes74/aws-egressip-operator/pkg/cloudprovider"
+	"github.com/klenkes74/aws-egressip-operator/test/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net"
+	"testing"
+)
+
+// mockDescribeNetworkInterfaceByIPv6 -- AWS finds the network interface of vm-1 carrying the IPv6 address.
+func mockDescribeNetworkInterfaceByIPv6(mockAws *mocks.AwsClient, ip string) {
+	mockAws.On("DescribeNetworkInterfaces", mock.Anything, &ec2.DescribeNetworkInterfacesInput{
+		Filters: []*ec2.Filter{
+			createFilter("ipv6-addresses.ipv6-address", []string{ip}),
+		},
+	}).Return(&ec2.DescribeNetworkInterfacesOutput{
+		NetworkInterfaces: []*ec2.NetworkInterface{networkInterfaces["1.1.1.34"]},
+	}, nil).Once()
+}
+
+func TestMoveIPReassignsToOtherInstance(t *testing.T) {
+	defer useRedistributionInstances()()
+
+	mockAws := &mocks.AwsClient{}
+	service := createAwsCloudProviderMock(mockAws)
+	mockDescribeNetworkInterfaceByIPMock(mockAws, "1.1.1.11")
+	mockMoveIPSuccessfully(mockAws, "vm-2", "1.1.1.11").Once()
+
+	ip := net.ParseIP("1.1.1.11")
+	instanceID, err := service.MoveIP(context.TODO(), cloudprovider.IPRequest{}, &ip)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "vm-2", instanceID)
+	mockAws.AssertNotCalled(t, "UnassignPrivateIPAddresses", mock.Anything, mock.Anything)
+	mockAws.AssertExpectations(t)
+}
+
+func TestMoveIPv6UnassignsAndAssigns(t *testing.T) {
+	defer useIPv6Subnet()()
+	instances["vm-2"] = createInstance("vm-2", "1.1.1.35", "nice-a", "ip-1-1-1-35.my-local.inf", "subnet-1")
+
+	mockAws := &mocks.AwsClient{}
+	service := createAwsCloudProviderMock(mockAws)
+	mockDescribeNetworkInterfaceByIPv6(mockAws, "2001:db8:1::10")
+
+	mockAws.On("UnassignIPv6Addresses", mock.Anything, &ec2.UnassignIpv6AddressesInput{
+		NetworkInterfaceId: aws.String("vm-1"),
+		Ipv6Addresses:      aws.StringSlice([]string{"2001:db8:1::10"}),
+	}).Return(&ec2.UnassignIpv6AddressesOutput{}, nil).Once()
+	mockAws.On("AssignIPv6Addresses", mock.Anything, &ec2.AssignIpv6AddressesInput{
+		NetworkInterfaceId: aws.String("vm-2"),
+		Ipv6Addresses:      aws.StringSlice([]string{"2001:db8:1::10"}),
+	}).Return(&ec2.AssignIpv6AddressesOutput{}, nil).Once()
+
+	ip := net.ParseIP("2001:db8:1::10")
+	instanceID, err := service.MoveIP(context.TODO(), cloudprovider.IPRequest{}, &ip)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "vm-2", instanceID)
+	mockAws.AssertExpectations(t)
+}
+
+func TestMoveIPv6PutsIPBackWhenAssignmentFails(t *testing.T) {
+	defer useIPv6Subnet()()
+	instances["vm-2"] = createInstance("vm-2", "1.1.1.35", "nice-a", "ip-1-1-1-35.my-local.inf", "subnet-1")
+
+	mockAws := &mocks.AwsClient{}
+	service := createAwsCloudProviderMock(mockAws)
+	mockDescribeNetworkInterfaceByIPv6(mockAws, "2001:db8:1::10")
+
+	mockAws.On("UnassignIPv6Addresses", mock.Anything, mock.Anything).Return(&ec2.UnassignIpv6AddressesOutput{}, nil).Once()
+	mockAws.On("AssignIPv6Addresses", mock.Anything, &ec2.AssignIpv6AddressesInput{
+		NetworkInterfaceId: aws.String("vm-2"),
+		Ipv6Addresses:      aws.StringSlice([]string{"2001:db8:1::10"}),
+	}).Return(nil, errors.New("assigning failed")).Once()
+	mockAws.On("AssignIPv6Addresses", mock.Anything, &ec2.AssignIpv6AddressesInput{
+		NetworkInterfaceId: aws.String("vm-1"),
+		Ipv6Addresses:      aws.StringSlice([]string{"2001:db8:1::10"}),
+	}).Return(&ec2.AssignIpv6AddressesOutput{}, nil).Once()
+
+	ip := net.ParseIP("2001:db8:1::10")
+	_, err := service.MoveIP(context.TODO(), cloudprovider.IPRequest{}, &ip)
+
+	assert.NotNil(t, err)
+	mockAws.AssertExpectations(t)
+}
+
+// mockInstanceOutsideInventory -- AWS returns the instance in the state with the given additional tags. The inventory
+// only reads running instances.
+func mockInstanceOutsideInventory(mockAws *mocks.AwsClient, instance ec2.Instance, state string, tags ...*ec2.Tag) {
+	instance.State = &ec2.InstanceState{Name: aws.String(state)}
+	instance.Tags = append(append([]*ec2.Tag{}, instance.Tags...), tags...)
+
+	mockAws.On("DescribeInstances", mock.Anything, &ec2.DescribeInstancesInput{
+		Filters: []*ec2.Filter{
+			createFilter("instance-id", []string{*instance.InstanceId}),
+		},
+	}).Return(&ec2.DescribeInstancesOutput{
+		Reservations: []*ec2.Reservation{{Instances: []*ec2.Instance{&instance}}},
+	}, nil).Once()
+}
+
+func TestMoveIPFromStoppedInstance(t *testing.T) {
+	defer useRedistributionInstances()()
+	stopped := *instances["vm-1"]
+	delete(instances, "vm-1")
+
+	mockAws := &mocks.AwsClient{}
+	service := createAwsCloudProviderMock(mockAws)
+	mockDescribeNetworkInterfaceByIPMock(mockAws, "1.1.1.11")
+	mockInstanceOutsideInventory(mockAws, stopped, ec2.InstanceStateNameStopped,
+		&ec2.Tag{Key: aws.String("kubernetes.io/cluster/nicer"), Value: aws.String("owned")})
+	mockMoveIPSuccessfully(mockAws, "vm-2", "1.1.1.11").Once()
+
+	ip := net.ParseIP("1.1.1.11")
+	instanceID, err := service.MoveIP(context.TODO(), cloudprovider.IPRequest{}, &ip)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "vm-2", instanceID)
+	mockAws.AssertExpectations(t)
+}
+
+func TestMoveIPRejectsIPOfInstanceOutsideTheCluster(t *testing.T) {
+	defer useRedistributionInstances()()
+	foreign := *instances["vm-1"]
+	delete(instances, "vm-1")
+
+	mockAws := &mocks.AwsClient{}
+	service := createAwsCloudProviderMock(mockAws)
+	mockDescribeNetworkInterfaceByIPMock(mockAws, "1.1.1.11")
+	mockInstanceOutsideInventory(mockAws, foreign, ec2.InstanceStateNameStopped)
+
+	ip := net.ParseIP("1.1.1.11")
+	_, err := service.MoveIP(context.TODO(), cloudprovider.IPRequest{}, &ip)
+
+	assert.True(t, cloudprovider.IsInvalidIP(err))
+	mockAws.AssertNotCalled(t, "AssignPrivateIPAddresses", mock.Anything, mock.Anything)
+	mockAws.AssertExpectations(t)
+}
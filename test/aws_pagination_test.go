@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/klenkes74/aws-egressip-operator/pkg/cloudprovider"
+	"github.com/klenkes74/aws-egressip-operator/test/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net"
+	"testing"
+)
+
+// createPagedAwsCloudProviderMock returns a provider whose instances and subnets are delivered by AWS in two pages.
+// The workers vm-5 and vm-1 share a single reservation on the second page.
+func createPagedAwsCloudProviderMock(mockAws *mocks.AwsClient) cloudprovider.CloudProvider {
+	instanceFilters := []*ec2.Filter{
+		createFilter("tag-key", []string{"kubernetes.io/cluster/nicer"}),
+		createFilter("instance-state-name", []string{"running"}),
+	}
+
+	mockAws.On("DescribeInstances", mock.Anything, &ec2.DescribeInstancesInput{Filters: instanceFilters}).
+		Return(&ec2.DescribeInstancesOutput{
+			Reservations: createReservation("vm-3"),
+			NextToken:    aws.String("instances-2"),
+		}, nil).Maybe()
+	mockAws.On("DescribeInstances", mock.Anything, &ec2.DescribeInstancesInput{Filters: instanceFilters, NextToken: aws.String("instances-2")}).
+		Return(&ec2.DescribeInstancesOutput{
+			Reservations: []*ec2.Reservation{
+				{Instances: []*ec2.Instance{instances["vm-5"], instances["vm-1"]}},
+			},
+		}, nil).Maybe()
+
+	subnetFilters := []*ec2.Filter{
+		createFilter("tag-key", []string{"kubernetes.io/cluster/nicer"}),
+	}
+	mockAws.On("DescribeSubnets", mock.Anything, &ec2.DescribeSubnetsInput{Filters: subnetFilters}).
+		Return(&ec2.DescribeSubnetsOutput{
+			Subnets:   subnets[:2],
+			NextToken: aws.String("subnets-2"),
+		}, nil).Maybe()
+	mockAws.On("DescribeSubnets", mock.Anything, &ec2.DescribeSubnetsInput{Filters: subnetFilters, NextToken: aws.String("subnets-2")}).
+		Return(&ec2.DescribeSubnetsOutput{
+			Subnets: subnets[2:],
+		}, nil).Maybe()
+
+	return createAwsCloudProvider(mockAws)
+}
+
+func TestAddRandomIPsReadsAllPagesAndReservations(t *testing.T) {
+	mockAws := &mocks.AwsClient{}
+	service := createPagedAwsCloudProviderMock(mockAws)
+
+	mockAddRandomIPSuccessfully(mockAws, "vm-1", "1.1.1.11").Once()
+	mockAddRandomIPSuccessfully(mockAws, "vm-3", "1.1.2.22").Once()
+	mockAddRandomIPSuccessfully(mockAws, "vm-5", "1.1.3.33").Once()
+
+	instanceIDs, ips, err := service.AddRandomIPs(context.TODO(), cloudprovider.IPRequest{})
+
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"vm-1", "vm-3", "vm-5"}, instanceIDs)
+	assert.ElementsMatch(t, defaultIPs("1.1.1.11", "1.1.2.22", "1.1.3.33"), ips)
+
+	mockAws.AssertExpectations(t)
+}
+
+func TestRemoveIPReadsAllNetworkInterfacePages(t *testing.T) {
+	mockAws := &mocks.AwsClient{}
+	service := createAwsCloudProviderMock(mockAws)
+	ip := net.ParseIP("1.1.1.11")
+
+	filters := []*ec2.Filter{
+		createFilter("addresses.private-ip-address", []string{ip.String()}),
+	}
+	mockAws.On("DescribeNetworkInterfaces", mock.Anything, &ec2.DescribeNetworkInterfacesInput{Filters: filters}).
+		Return(&ec2.DescribeNetworkInterfacesOutput{
+			NetworkInterfaces: []*ec2.NetworkInterface{},
+			NextToken:         aws.String("enis-2"),
+		}, nil).Once()
+	mockAws.On("DescribeNetworkInterfaces", mock.Anything, &ec2.DescribeNetworkInterfacesInput{Filters: filters, NextToken: aws.String("enis-2")}).
+		Return(&ec2.DescribeNetworkInterfacesOutput{
+			NetworkInterfaces: []*ec2.NetworkInterface{
+				{
+					Attachment:         &ec2.NetworkInterfaceAttachment{InstanceId: aws.String("vm-1")},
+					NetworkInterfaceId: aws.String("vm-1"),
+				},
+			},
+		}, nil).Once()
+	mockAws.On("UnassignPrivateIPAddresses", mock.Anything, &ec2.UnassignPrivateIpAddressesInput{
+		NetworkInterfaceId: aws.String("vm-1"),
+		PrivateIpAddresses: aws.StringSlice([]string{ip.String()}),
+	}).Return(&ec2.UnassignPrivateIpAddressesOutput{}, nil).Once()
+
+	instanceID, err := service.RemoveIP(context.TODO(), &ip)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "vm-1", instanceID)
+
+	mockAws.AssertExpectations(t)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/klenkes74/aws-egressip-operator/pkg/cloudprovider"
+	"github.com/klenkes74/aws-egressip-operator/test/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"testing"
+)
+
+// mockDryRuns -- answers the dry runs of all actions as permitted except the denied ones.
+func mockDryRuns(mockAws *mocks.AwsClient, denied ...string) {
+	answer := func(action string) error {
+		for _, d := range denied {
+			if d == action {
+				return awserr.New("UnauthorizedOperation", "You are not authorized to perform this operation.", nil)
+			}
+		}
+		return awserr.New("DryRunOperation", "Request would have succeeded, but DryRun flag is set.", nil)
+	}
+
+	mockAws.On("DescribeInstances", mock.Anything, mock.MatchedBy(func(r *ec2.DescribeInstancesInput) bool {
+		return r.DryRun != nil && *r.DryRun
+	})).Return(nil, answer("DescribeInstances")).Once()
+	mockAws.On("DescribeInstanceTypes", mock.Anything, mock.MatchedBy(func(r *ec2.DescribeInstanceTypesInput) bool {
+		return r.DryRun != nil && *r.DryRun
+	})).Return(nil, answer("DescribeInstanceTypes")).Once()
+	mockAws.On("DescribeSubnets", mock.Anything, mock.MatchedBy(func(r *ec2.DescribeSubnetsInput) bool {
+		return r.DryRun != nil && *r.DryRun
+	})).Return(nil, answer("DescribeSubnets")).Once()
+	mockAws.On("DescribeNetworkInterfaces", mock.Anything, mock.MatchedBy(func(r *ec2.DescribeNetworkInterfacesInput) bool {
+		return r.DryRun != nil && *r.DryRun
+	})).Return(nil, answer("DescribeNetworkInterfaces")).Once()
+	mockAws.On("DescribeAddresses", mock.Anything, mock.MatchedBy(func(r *ec2.DescribeAddressesInput) bool {
+		return r.DryRun != nil && *r.DryRun
+	})).Return(nil, answer("DescribeAddresses")).Once()
+	mockAws.On("AllocateAddress", mock.Anything, mock.MatchedBy(func(r *ec2.AllocateAddressInput) bool {
+		return r.DryRun != nil && *r.DryRun
+	})).Return(nil, answer("AllocateAddress")).Once()
+	mockAws.On("ReleaseAddress", mock.Anything, mock.MatchedBy(func(r *ec2.ReleaseAddressInput) bool {
+		return r.DryRun != nil && *r.DryRun
+	})).Return(nil, answer("ReleaseAddress")).Once()
+	mockAws.On("AssociateAddress", mock.Anything, mock.MatchedBy(func(r *ec2.AssociateAddressInput) bool {
+		return r.DryRun != nil && *r.DryRun
+	})).Return(nil, answer("AssociateAddress")).Once()
+	mockAws.On("DisassociateAddress", mock.Anything, mock.MatchedBy(func(r *ec2.DisassociateAddressInput) bool {
+		return r.DryRun != nil && *r.DryRun
+	})).Return(nil, answer("DisassociateAddress")).Once()
+	mockAws.On("CreateTags", mock.Anything, mock.MatchedBy(func(r *ec2.CreateTagsInput) bool {
+		return r.DryRun != nil && *r.DryRun
+	})).Return(nil, answer("CreateTags")).Once()
+}
+
+func findPreflightCheck(report cloudprovider.PreflightReport, name string) cloudprovider.PreflightCheck {
+	for _, check := range report.Checks {
+		if check.Name == name {
+			return check
+		}
+	}
+	return cloudprovider.PreflightCheck{}
+}
+
+func TestPreflightPassesWithAllPermissions(t *testing.T) {
+	mockAws := &mocks.AwsClient{}
+	service := createAwsCloudProvider(mockAws) // without the generic mock of DescribeAddresses answering the dry run
+
+	mockDryRuns(mockAws)
+	mockDefaultSubnetAwsCalls(mockAws)
+	mockDefaultInstanceAwsCalls(mockAws)
+
+	report := service.Preflight(context.TODO())
+
+	assert.True(t, report.Passed(), report.Error())
+	assert.Nil(t, report.Error())
+	assert.Equal(t, cloudprovider.PreflightPassed, findPreflightCheck(report, "ec2:AllocateAddress").Status)
+	assert.Equal(t, cloudprovider.PreflightPassed, findPreflightCheck(report, "cluster").Status)
+	assert.Equal(t, cloudprovider.PreflightUnverified, findPreflightCheck(report, "ec2:AssignPrivateIpAddresses").Status)
+
+	mockAws.AssertExpectations(t)
+}
+
+func TestPreflightFailsWithMissingPermission(t *testing.T) {
+	mockAws := &mocks.AwsClient{}
+	service := createAwsCloudProvider(mockAws)
+
+	mockDryRuns(mockAws, "AssociateAddress")
+	mockDefaultSubnetAwsCalls(mockAws)
+	mockDefaultInstanceAwsCalls(mockAws)
+
+	report := service.Preflight(context.TODO())
+
+	assert.False(t, report.Passed())
+	if assert.Len(t, report.Failed(), 1) {
+		assert.Equal(t, "ec2:AssociateAddress", report.Failed()[0].Name)
+	}
+	assert.Contains(t, report.Error().Error(), "ec2:AssociateAddress")
+
+	mockAws.AssertExpectations(t)
+}
+
+func TestPreflightFailsWithoutInstancesOfTheCluster(t *testing.T) {
+	mockAws := &mocks.AwsClient{}
+	service := createAwsCloudProvider(mockAws)
+
+	mockDryRuns(mockAws)
+	mockDefaultSubnetAwsCalls(mockAws)
+	mockAws.On("DescribeInstances", mock.Anything, mock.MatchedBy(func(r *ec2.DescribeInstancesInput) bool {
+		return r.DryRun == nil
+	})).Return(&ec2.DescribeInstancesOutput{}, nil).Once()
+
+	report := service.Preflight(context.TODO())
+
+	assert.False(t, report.Passed())
+	check := findPreflightCheck(report, "cluster")
+	assert.Equal(t, cloudprovider.PreflightFailed, check.Status)
+	assert.Contains(t, check.Message, "kubernetes.io/cluster/nicer")
+
+	mockAws.AssertExpectations(t)
+}
+
+func TestPreflightSkipsAllocationWithElasticIPPool(t *testing.T) {
+	mockAws := &mocks.AwsClient{}
+	service := createElasticIPProvider(mockAws, "pool=egress")
+
+	mockDryRuns(mockAws, "AllocateAddress")
+
+	report := service.Preflight(context.TODO())
+
+	assert.True(t, report.Passed(), report.Error())
+	assert.Equal(t, cloudprovider.PreflightUnverified, findPreflightCheck(report, "ec2:AllocateAddress").Status)
+	mockAws.AssertNotCalled(t, "AllocateAddress", mock.Anything, mock.Anything)
+}
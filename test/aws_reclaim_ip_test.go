@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/klenkes74/aws-egressip-operator/pkg/cloudprovider"
+	"github.com/klenkes74/aws-egressip-operator/test/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net"
+	"testing"
+)
+
+// mockInstanceInState -- AWS returns the instance of the host in the given state.
+func mockInstanceInState(mockAws *mocks.AwsClient, instanceID string, state string) {
+	instance := *instances[instanceID]
+	instance.State = &ec2.InstanceState{Name: aws.String(state)}
+
+	mockAws.On("DescribeInstances", mock.Anything, &ec2.DescribeInstancesInput{
+		Filters: []*ec2.Filter{
+			createFilter("private-dns-name", []string{*instance.PrivateDnsName}),
+		},
+	}).Return(&ec2.DescribeInstancesOutput{
+		Reservations: []*ec2.Reservation{{Instances: []*ec2.Instance{&instance}}},
+	}, nil).Once()
+}
+
+func TestInstanceGoneWhenTerminated(t *testing.T) {
+	defer useRedistributionInstances()()
+
+	mockAws := &mocks.AwsClient{}
+	service := createAwsCloudProviderMock(mockAws)
+	mockInstanceInState(mockAws, "vm-1", ec2.InstanceStateNameTerminated)
+
+	gone, err := service.InstanceGone(context.TODO(), "ip-1-1-1-34.my-local.inf")
+
+	assert.Nil(t, err)
+	assert.True(t, gone)
+	mockAws.AssertExpectations(t)
+}
+
+func TestInstanceNotGoneWhenRunning(t *testing.T) {
+	defer useRedistributionInstances()()
+
+	mockAws := &mocks.AwsClient{}
+	service := createAwsCloudProviderMock(mockAws)
+	mockInstanceInState(mockAws, "vm-1", ec2.InstanceStateNameRunning)
+
+	gone, err := service.InstanceGone(context.TODO(), "ip-1-1-1-34.my-local.inf")
+
+	assert.Nil(t, err)
+	assert.False(t, gone)
+	mockAws.AssertExpectations(t)
+}
+
+func TestReclaimIPAssignsFreedIP(t *testing.T) {
+	defer useRedistributionInstances()()
+
+	mockAws := &mocks.AwsClient{}
+	service := createAwsCloudProviderMock(mockAws)
+	mockInstanceInState(mockAws, "vm-1", ec2.InstanceStateNameTerminated)
+	mockDescribeNetworkInterfaceByIPMock(mockAws, "1.1.1.60")
+	mockAddSpecifiedIPSuccessfully(mockAws, "vm-2", "1.1.1.60").Once()
+
+	gone, _ := service.InstanceGone(context.TODO(), "ip-1-1-1-34.my-local.inf")
+	assert.True(t, gone)
+
+	ip := net.ParseIP("1.1.1.60")
+	instanceID, assigned, err := service.ReclaimIP(context.TODO(), cloudprovider.IPRequest{}, &ip)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "vm-2", instanceID)
+	assert.Equal(t, &ip, assigned)
+	mockAws.AssertExpectations(t)
+}
+
+func TestReclaimIPReplacesIPTakenInTheMeantime(t *testing.T) {
+	defer useRedistributionInstances()()
+
+	mockAws := &mocks.AwsClient{}
+	service := createAwsCloudProviderMock(mockAws)
+
+	// an instance outside the cluster took the freed ip.
+	mockAws.On("DescribeNetworkInterfaces", mock.Anything, &ec2.DescribeNetworkInterfacesInput{
+		Filters: []*ec2.Filter{
+			createFilter("addresses.private-ip-address", []string{"1.1.1.60"}),
+		},
+	}).Return(&ec2.DescribeNetworkInterfacesOutput{
+		NetworkInterfaces: []*ec2.NetworkInterface{
+			{
+				Attachment:         &ec2.NetworkInterfaceAttachment{InstanceId: aws.String("vm-foreign")},
+				NetworkInterfaceId: aws.String("eni-foreign"),
+				PrivateIpAddress:   aws.String("1.1.1.40"),
+				PrivateIpAddresses: []*ec2.NetworkInterfacePrivateIpAddress{
+					{Primary: aws.Bool(true), PrivateIpAddress: aws.String("1.1.1.40")},
+					{Primary: aws.Bool(false), PrivateIpAddress: aws.String("1.1.1.60")},
+				},
+				SubnetId: aws.String("subnet-1"),
+			},
+		},
+	}, nil)
+	mockAddRandomIPSuccessfully(mockAws, "vm-2", "1.1.1.99").Once()
+
+	ip := net.ParseIP("1.1.1.60")
+	instanceID, assigned, err := service.ReclaimIP(context.TODO(), cloudprovider.IPRequest{}, &ip)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "vm-2", instanceID)
+	assert.Equal(t, "1.1.1.99", assigned.String())
+	mockAws.AssertNotCalled(t, "AssignPrivateIPAddresses", mock.Anything, &ec2.AssignPrivateIpAddressesInput{
+		NetworkInterfaceId: aws.String("vm-2"),
+		PrivateIpAddresses: aws.StringSlice([]string{"1.1.1.60"}),
+	})
+	mockAws.AssertExpectations(t)
+}
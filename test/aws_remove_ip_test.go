@@ -1,11 +1,13 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/klenkes74/aws-egressip-operator/test/mocks"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"net"
 	"testing"
 )
@@ -15,7 +17,7 @@ func TestSuccessfulRemoveIP(t *testing.T) {
 	service := createAwsCloudProviderMock(mockAws)
 	ip := net.ParseIP("1.1.1.11")
 
-	mockAws.On("DescribeNetworkInterfaces", &ec2.DescribeNetworkInterfacesInput{
+	mockAws.On("DescribeNetworkInterfaces", mock.Anything, &ec2.DescribeNetworkInterfacesInput{
 		Filters: []*ec2.Filter{
 			{
 				Name:   aws.String("addresses.private-ip-address"),
@@ -33,12 +35,12 @@ func TestSuccessfulRemoveIP(t *testing.T) {
 		},
 	}, nil)
 
-	mockAws.On("UnassignPrivateIPAddresses", &ec2.UnassignPrivateIpAddressesInput{
+	mockAws.On("UnassignPrivateIPAddresses", mock.Anything, &ec2.UnassignPrivateIpAddressesInput{
 		NetworkInterfaceId: aws.String("vm-1"),
 		PrivateIpAddresses: aws.StringSlice([]string{ip.String()}),
 	}).Return(&ec2.UnassignPrivateIpAddressesOutput{}, nil)
 
-	_, err := service.RemoveIP(&ip)
+	_, err := service.RemoveIP(context.TODO(), &ip)
 
 	assert.Nil(t, err)
 
@@ -50,7 +52,7 @@ func TestFailedRemoveIP(t *testing.T) {
 	service := createAwsCloudProviderMock(mockAws)
 	ip := net.ParseIP("1.1.1.11")
 
-	mockAws.On("DescribeNetworkInterfaces", &ec2.DescribeNetworkInterfacesInput{
+	mockAws.On("DescribeNetworkInterfaces", mock.Anything, &ec2.DescribeNetworkInterfacesInput{
 		Filters: []*ec2.Filter{
 			{
 				Name:   aws.String("addresses.private-ip-address"),
@@ -68,12 +70,12 @@ func TestFailedRemoveIP(t *testing.T) {
 		},
 	}, nil)
 
-	mockAws.On("UnassignPrivateIPAddresses", &ec2.UnassignPrivateIpAddressesInput{
+	mockAws.On("UnassignPrivateIPAddresses", mock.Anything, &ec2.UnassignPrivateIpAddressesInput{
 		NetworkInterfaceId: aws.String("vm-1"),
 		PrivateIpAddresses: aws.StringSlice([]string{ip.String()}),
 	}).Return(nil, errors.New("AWS could not remove the IP"))
 
-	_, err := service.RemoveIP(&ip)
+	_, err := service.RemoveIP(context.TODO(), &ip)
 
 	assert.NotNil(t, err)
 
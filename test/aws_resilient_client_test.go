@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/klenkes74/aws-egressip-operator/pkg/cloudprovider"
+	"github.com/klenkes74/aws-egressip-operator/test/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"testing"
+	"time"
+)
+
+func fastResilienceOptions() cloudprovider.ResilienceOptions {
+	return cloudprovider.ResilienceOptions{
+		MaxRetries:       3,
+		BaseDelay:        time.Millisecond,
+		MaxDelay:         time.Millisecond,
+		RateLimit:        1000,
+		Burst:            100,
+		FailureThreshold: 5,
+		OpenDuration:     time.Minute,
+	}
+}
+
+func TestResilientClientRetriesThrottledCalls(t *testing.T) {
+	mockAws := &mocks.AwsClient{}
+	mockAws.On("DescribeSubnets", mock.Anything, mock.Anything).
+		Return(nil, awserr.New("RequestLimitExceeded", "Request limit exceeded.", nil)).Twice()
+	mockAws.On("DescribeSubnets", mock.Anything, mock.Anything).
+		Return(&ec2.DescribeSubnetsOutput{Subnets: subnets}, nil).Once()
+
+	client := cloudprovider.NewResilientAwsClient(mockAws, fastResilienceOptions())
+	result, err := client.DescribeSubnets(context.TODO(), &ec2.DescribeSubnetsInput{})
+
+	assert.Nil(t, err)
+	assert.Equal(t, subnets, result.Subnets)
+	mockAws.AssertNumberOfCalls(t, "DescribeSubnets", 3)
+}
+
+func TestResilientClientRetriesServerErrors(t *testing.T) {
+	mockAws := &mocks.AwsClient{}
+	mockAws.On("DescribeSubnets", mock.Anything, mock.Anything).
+		Return(nil, awserr.NewRequestFailure(awserr.New("Unknown", "bad gateway", nil), 502, "request-1"))
+
+	client := cloudprovider.NewResilientAwsClient(mockAws, fastResilienceOptions())
+	_, err := client.DescribeSubnets(context.TODO(), &ec2.DescribeSubnetsInput{})
+
+	assert.NotNil(t, err)
+	mockAws.AssertNumberOfCalls(t, "DescribeSubnets", 4)
+}
+
+func TestResilientClientDoesNotRetryClientErrors(t *testing.T) {
+	mockAws := &mocks.AwsClient{}
+	mockAws.On("AssignPrivateIPAddresses", mock.Anything, mock.Anything).
+		Return(nil, awserr.New("PrivateIpAddressLimitExceeded", "Number of private addresses will exceed limit.", nil))
+
+	client := cloudprovider.NewResilientAwsClient(mockAws, fastResilienceOptions())
+	_, err := client.AssignPrivateIPAddresses(context.TODO(), &ec2.AssignPrivateIpAddressesInput{})
+
+	assert.NotNil(t, err)
+	mockAws.AssertNumberOfCalls(t, "AssignPrivateIPAddresses", 1)
+	assert.Equal(t, cloudprovider.CircuitClosed, client.CircuitState())
+}
+
+func TestResilientClientOpensCircuitBreaker(t *testing.T) {
+	options := fastResilienceOptions()
+	options.MaxRetries = 0
+	options.FailureThreshold = 2
+	options.OpenDuration = 20 * time.Millisecond
+
+	mockAws := &mocks.AwsClient{}
+	mockAws.On("DescribeSubnets", mock.Anything, mock.Anything).
+		Return(nil, awserr.New("ServiceUnavailable", "Service unavailable.", nil)).Twice()
+	mockAws.On("DescribeSubnets", mock.Anything, mock.Anything).
+		Return(&ec2.DescribeSubnetsOutput{}, nil).Once()
+
+	client := cloudprovider.NewResilientAwsClient(mockAws, options)
+	_, _ = client.DescribeSubnets(context.TODO(), &ec2.DescribeSubnetsInput{})
+	_, _ = client.DescribeSubnets(context.TODO(), &ec2.DescribeSubnetsInput{})
+
+	_, err := client.DescribeSubnets(context.TODO(), &ec2.DescribeSubnetsInput{})
+	assert.Equal(t, cloudprovider.ErrCircuitOpen, err)
+	assert.Equal(t, cloudprovider.CircuitOpen, client.CircuitState())
+	assert.NotNil(t, client.HealthCheck(nil))
+	mockAws.AssertNumberOfCalls(t, "DescribeSubnets", 2)
+
+	time.Sleep(2 * options.OpenDuration)
+
+	_, err = client.DescribeSubnets(context.TODO(), &ec2.DescribeSubnetsInput{})
+	assert.Nil(t, err)
+	assert.Equal(t, cloudprovider.CircuitClosed, client.CircuitState())
+	assert.Nil(t, client.HealthCheck(nil))
+}
+
+func TestResilientClientLimitsRate(t *testing.T) {
+	options := fastResilienceOptions()
+	options.RateLimit = 20
+	options.Burst = 1
+
+	mockAws := &mocks.AwsClient{}
+	mockAws.On("DescribeSubnets", mock.Anything, mock.Anything).Return(&ec2.DescribeSubnetsOutput{}, nil)
+
+	client := cloudprovider.NewResilientAwsClient(mockAws, options)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		_, err := client.DescribeSubnets(context.TODO(), &ec2.DescribeSubnetsInput{})
+		assert.Nil(t, err)
+	}
+
+	assert.True(t, time.Since(start) >= 80*time.Millisecond, "3 calls with 20/s and a burst of 1 need 100ms")
+}
+
+func TestResilientClientStopsRetryingWhenContextIsCancelled(t *testing.T) {
+	options := fastResilienceOptions()
+	options.BaseDelay = time.Minute
+	options.MaxDelay = time.Minute
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	mockAws := &mocks.AwsClient{}
+	mockAws.On("DescribeSubnets", mock.Anything, mock.Anything).
+		Return(nil, awserr.New("RequestLimitExceeded", "Request limit exceeded.", nil)).
+		Run(func(mock.Arguments) { cancel() })
+
+	client := cloudprovider.NewResilientAwsClient(mockAws, options)
+	_, err := client.DescribeSubnets(ctx, &ec2.DescribeSubnetsInput{})
+
+	assert.Equal(t, context.Canceled, err)
+	mockAws.AssertNumberOfCalls(t, "DescribeSubnets", 1)
+	assert.Equal(t, cloudprovider.CircuitClosed, client.CircuitState())
+}
+
+func TestResilientClientLimitsTheDurationOfACall(t *testing.T) {
+	options := fastResilienceOptions()
+	options.MaxRetries = 1
+	options.Timeout = 10 * time.Millisecond
+
+	mockAws := &mocks.AwsClient{}
+	mockAws.On("DescribeSubnets", mock.Anything, mock.Anything).
+		Return(nil, context.DeadlineExceeded).
+		Run(func(args mock.Arguments) { <-args.Get(0).(context.Context).Done() })
+
+	client := cloudprovider.NewResilientAwsClient(mockAws, options)
+	_, err := client.DescribeSubnets(context.TODO(), &ec2.DescribeSubnetsInput{})
+
+	assert.NotNil(t, err)
+	assert.True(t, cloudprovider.IsRetryable(err))
+	mockAws.AssertNumberOfCalls(t, "DescribeSubnets", 2)
+}
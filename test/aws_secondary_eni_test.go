@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/klenkes74/aws-egressip-operator/pkg/cloudprovider"
+	"github.com/klenkes74/aws-egressip-operator/test/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net"
+	"testing"
+)
+
+// useMultiInterfaceInstance replaces the default instances with a single instance carrying two ENIs in subnet-1.
+// The returned function restores the default instances.
+func useMultiInterfaceInstance() func() {
+	original := instances
+
+	instances = map[string]*ec2.Instance{
+		"vm-1": addNetworkInterface(
+			createInstance("vm-1", "1.1.1.34", "nice-a", "ip-1-1-1-34.my-local.inf", "subnet-1", "1.1.1.40"),
+			"eni-1b", "1.1.1.50", "subnet-1", "1.1.1.51", "1.1.1.52",
+		),
+	}
+
+	return func() {
+		instances = original
+	}
+}
+
+func mockInterfaceFull(mockAws *mocks.AwsClient, input *ec2.AssignPrivateIpAddressesInput) {
+	mockAws.On("AssignPrivateIPAddresses", mock.Anything, input).
+		Return(nil, awserr.New("PrivateIpAddressLimitExceeded", "limit of private addresses reached", nil)).
+		Once()
+}
+
+func TestInstanceReportsAllNetworkInterfaces(t *testing.T) {
+	defer useMultiInterfaceInstance()()
+
+	mockAws := &mocks.AwsClient{}
+	service := createAwsCloudProviderMock(mockAws)
+	mockDescribeInstance(mockAws, "vm-1")
+
+	instance, err := service.Instance(context.TODO(), "vm-1")
+	assert.Nil(t, err)
+
+	assert.Equal(t, "vm-1", (*instance).NetworkInterface())
+	assert.ElementsMatch(t, defaultIPs("1.1.1.40", "1.1.1.51", "1.1.1.52"), (*instance).SecondaryIps())
+
+	networkInterfaces := (*instance).NetworkInterfaces()
+	assert.Len(t, networkInterfaces, 2)
+	assert.Equal(t, "eni-1b", networkInterfaces[1].ID())
+	assert.Equal(t, "subnet-1", networkInterfaces[1].Network())
+	assert.Equal(t, 1, networkInterfaces[1].DeviceIndex())
+	assert.Equal(t, 3, networkInterfaces[1].IPCount())
+	assert.ElementsMatch(t, defaultIPs("1.1.1.51", "1.1.1.52"), networkInterfaces[1].SecondaryIps())
+}
+
+func TestAddRandomIPUsesNextInterfaceWhenFull(t *testing.T) {
+	defer useMultiInterfaceInstance()()
+
+	mockAws := &mocks.AwsClient{}
+	service := createAwsCloudProviderMock(mockAws)
+
+	mockInterfaceFull(mockAws, &ec2.AssignPrivateIpAddressesInput{
+		NetworkInterfaceId:             aws.String("vm-1"),
+		SecondaryPrivateIpAddressCount: aws.Int64(1),
+	})
+	mockAddRandomIPSuccessfully(mockAws, "eni-1b", "1.1.1.11").Once()
+
+	instanceIDs, ips, _ := service.AddRandomIPs(context.TODO(), cloudprovider.IPRequest{})
+
+	ip := net.ParseIP("1.1.1.11")
+	assert.Contains(t, instanceIDs, "vm-1")
+	assert.Contains(t, ips, &ip)
+
+	mockAws.AssertExpectations(t)
+}
+
+func TestAddRandomIPFailsWhenAllInterfacesAreFull(t *testing.T) {
+	defer useMultiInterfaceInstance()()
+
+	mockAws := &mocks.AwsClient{}
+	service := createAwsCloudProviderMock(mockAws)
+
+	for _, eni := range []string{"vm-1", "eni-1b"} {
+		mockInterfaceFull(mockAws, &ec2.AssignPrivateIpAddressesInput{
+			NetworkInterfaceId:             aws.String(eni),
+			SecondaryPrivateIpAddressCount: aws.Int64(1),
+		})
+	}
+
+	_, _, err := service.AddRandomIPs(context.TODO(), cloudprovider.IPRequest{})
+
+	assert.True(t, cloudprovider.IsCapacityExhausted(err), "expected capacity exhausted error but got: %v", err)
+
+	mockAws.AssertExpectations(t)
+}
+
+func TestAddSpecifiedIPUsesNextInterfaceWhenFull(t *testing.T) {
+	defer useMultiInterfaceInstance()()
+
+	mockAws := &mocks.AwsClient{}
+	service := createAwsCloudProviderMock(mockAws)
+
+	mockInterfaceFull(mockAws, &ec2.AssignPrivateIpAddressesInput{
+		NetworkInterfaceId: aws.String("vm-1"),
+		PrivateIpAddresses: aws.StringSlice([]string{"1.1.1.12"}),
+	})
+	mockAddSpecifiedIPSuccessfully(mockAws, "eni-1b", "1.1.1.12").Once()
+
+	result, err := service.AddSpecifiedIPs(context.TODO(), cloudprovider.IPRequest{}, defaultIPs("1.1.1.12"))
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"vm-1"}, result)
+
+	mockAws.AssertExpectations(t)
+}
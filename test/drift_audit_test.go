@@ -0,0 +1,372 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/klenkes74/aws-egressip-operator/pkg/cloudprovider"
+	"github.com/klenkes74/aws-egressip-operator/pkg/observability"
+	"github.com/klenkes74/aws-egressip-operator/pkg/openshift"
+	"github.com/klenkes74/aws-egressip-operator/test/mocks"
+	netv1 "github.com/openshift/api/network/v1"
+	"github.com/redhat-cop/egressip-ipam-operator/pkg/controller/egressipam"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	corev1 "k8s.io/api/core/v1"
+	apiv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"net"
+	"testing"
+)
+
+// mockEgressIPSources -- the api server lists the namespaces (name -> ip list annotation), the NetNamespaces (name ->
+// egress ips) and the hostSubnets.
+func mockEgressIPSources(mockOcp *mocks.OcpClient, namespaces map[string]string, netNamespaces map[string][]string, hostSubnets ...*netv1.HostSubnet) {
+	mockOcp.On("List", mock.Anything, mock.AnythingOfType("*v1.NamespaceList")).
+		Run(func(args mock.Arguments) {
+			list := args.Get(1).(*corev1.NamespaceList)
+			for name, ips := range namespaces {
+				list.Items = append(list.Items, corev1.Namespace{ObjectMeta: apiv1.ObjectMeta{
+					Name:        name,
+					Annotations: map[string]string{egressipam.NamespaceAssociationAnnotation: ips},
+				}})
+			}
+		}).
+		Return(nil)
+	mockOcp.On("List", mock.Anything, mock.AnythingOfType("*v1.NetNamespaceList")).
+		Run(func(args mock.Arguments) {
+			list := args.Get(1).(*netv1.NetNamespaceList)
+			for name, ips := range netNamespaces {
+				list.Items = append(list.Items, netv1.NetNamespace{
+					ObjectMeta: apiv1.ObjectMeta{Name: name},
+					NetName:    name,
+					EgressIPs:  ips,
+				})
+			}
+		}).
+		Return(nil)
+	mockOcp.On("List", mock.Anything, mock.AnythingOfType("*v1.HostSubnetList")).
+		Run(func(args mock.Arguments) {
+			list := args.Get(1).(*netv1.HostSubnetList)
+			for _, hostSubnet := range hostSubnets {
+				list.Items = append(list.Items, *hostSubnet.DeepCopy())
+			}
+		}).
+		Return(nil)
+}
+
+// mockInstanceWithIPs -- the cloud returns the instance of the host carrying the secondary IPs.
+func mockInstanceWithIPs(cloud *mocks.CloudProvider, instanceID string, hostName string, ips ...string) {
+	instance := &mocks.CloudInstance{}
+	instance.On("ID").Return(instanceID).Maybe()
+	instance.On("HostName").Return(hostName).Maybe()
+	secondaryIPs := make([]*net.IP, len(ips))
+	for i, ip := range ips {
+		parsed := net.ParseIP(ip)
+		secondaryIPs[i] = &parsed
+	}
+	instance.On("SecondaryIps").Return(secondaryIPs).Maybe()
+
+	cloudInstance := cloudprovider.CloudInstance(instance)
+	cloud.On("Instance", mock.Anything, instanceID).Return(&cloudInstance, nil).Maybe()
+	cloud.On("InstanceByHostName", mock.Anything, hostName).Return(&cloudInstance, nil).Maybe()
+}
+
+// resyncingCloud -- a cloud provider caching the cloud. The instance lookups done before the resync are counted.
+type resyncingCloud struct {
+	*mocks.CloudProvider
+
+	resyncs         int
+	lookupsAtResync int
+}
+
+func (c *resyncingCloud) Resync(context.Context) error {
+	c.resyncs++
+	for _, call := range c.CloudProvider.Calls {
+		if call.Method == "InstanceByHostName" || call.Method == "Instance" {
+			c.lookupsAtResync++
+		}
+	}
+	return nil
+}
+
+func driftKindsByIP(drifts []openshift.Drift) map[string][]openshift.DriftKind {
+	result := make(map[string][]openshift.DriftKind)
+	for _, drift := range drifts {
+		result[drift.IP] = append(result[drift.IP], drift.Kind)
+	}
+	return result
+}
+
+func TestAuditDriftFindsNothingWhenAllSourcesAgree(t *testing.T) {
+	cloud := &mocks.CloudProvider{}
+	mockOcp := &mocks.OcpClient{}
+
+	mockEgressIPSources(mockOcp,
+		map[string]string{"default-test": "1.1.1.11,1.1.2.22"},
+		map[string][]string{"default-test": {"1.1.1.11", "1.1.2.22"}},
+		defaultHostSubnet("host-1", "1.1.1.34", "1.1.1.11"),
+		defaultHostSubnet("host-3", "1.1.2.34", "1.1.2.22"),
+	)
+	mockInstanceWithIPs(cloud, "vm-1", "host-1", "1.1.1.11")
+	mockInstanceWithIPs(cloud, "vm-3", "host-3", "1.1.2.22")
+
+	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
+	drifts, err := service.AuditDrift(context.TODO())
+
+	assert.Nil(t, err)
+	assert.Empty(t, drifts)
+}
+
+func TestAuditDriftClassifiesMismatches(t *testing.T) {
+	cloud := &mocks.CloudProvider{}
+	mockOcp := &mocks.OcpClient{}
+
+	hostSubnet := defaultHostSubnet("host-2", "1.1.1.35", "1.1.1.14", "1.1.1.15")
+	hostSubnet.Annotations[openshift.IPToNamespaceAnnotation+"1.1.1.15"] = "other"
+	mockEgressIPSources(mockOcp,
+		map[string]string{"default-test": "1.1.1.11,1.1.1.12,1.1.1.15"},
+		map[string][]string{"default-test": {"1.1.1.12", "1.1.1.15", "1.1.1.16"}},
+		defaultHostSubnet("host-1", "1.1.1.34", "1.1.1.11"),
+		hostSubnet,
+	)
+	mockInstanceWithIPs(cloud, "vm-1", "host-1", "1.1.1.12")
+	mockInstanceWithIPs(cloud, "vm-2", "host-2", "1.1.1.11", "1.1.1.13", "1.1.1.15")
+
+	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
+	drifts, err := service.AuditDrift(context.TODO())
+
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]openshift.DriftKind{
+		"1.1.1.11": {openshift.DriftMissingOnNetNamespace, openshift.DriftWrongHostSubnet},
+		"1.1.1.12": {openshift.DriftMissingOnHostSubnet},
+		"1.1.1.13": {openshift.DriftOrphanedInCloud},
+		"1.1.1.14": {openshift.DriftMissingInCloud, openshift.DriftOrphanedOnHostSubnet},
+		"1.1.1.15": {openshift.DriftWrongNamespaceAnnotation},
+		"1.1.1.16": {openshift.DriftUnknownOnNetNamespace},
+	}, driftKindsByIP(drifts))
+
+	for _, drift := range drifts {
+		if drift.Kind == openshift.DriftMissingOnHostSubnet {
+			assert.Equal(t, "vm-1", drift.Instance)
+			assert.True(t, drift.Repairable())
+		}
+	}
+}
+
+func TestAuditDriftReportsIPsListedTwice(t *testing.T) {
+	cloud := &mocks.CloudProvider{}
+	mockOcp := &mocks.OcpClient{}
+
+	mockEgressIPSources(mockOcp,
+		map[string]string{"default-test": "1.1.1.11", "other": "1.1.1.11"},
+		map[string][]string{"default-test": {"1.1.1.11"}},
+		defaultHostSubnet("host-1", "1.1.1.34", "1.1.1.11"),
+	)
+	mockInstanceWithIPs(cloud, "vm-1", "host-1", "1.1.1.11")
+
+	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
+	drifts, err := service.AuditDrift(context.TODO())
+
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]openshift.DriftKind{"1.1.1.11": {openshift.DriftDuplicateIP}}, driftKindsByIP(drifts))
+}
+
+func TestAuditDriftSkipsIPsOfOperationsInProgress(t *testing.T) {
+	cloud := &mocks.CloudProvider{}
+	mockOcp := &mocks.OcpClient{}
+
+	hostSubnet := defaultHostSubnet("host-1", "1.1.1.34", "1.1.1.11")
+	hostSubnet.Annotations[openshift.IntentAnnotation] = `{"operation":"redistribute-ips","ips":["1.1.1.11"]}`
+	mockEgressIPSources(mockOcp,
+		map[string]string{"default-test": "1.1.1.11"},
+		map[string][]string{"default-test": {"1.1.1.11"}},
+		hostSubnet,
+	)
+	mockInstanceWithIPs(cloud, "vm-2", "host-1")
+
+	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
+	drifts, err := service.AuditDrift(context.TODO())
+
+	assert.Nil(t, err)
+	assert.Empty(t, drifts)
+}
+
+func TestAuditDriftLeavesHostsWithoutInstanceOutOfCloudComparison(t *testing.T) {
+	cloud := &mocks.CloudProvider{}
+	mockOcp := &mocks.OcpClient{}
+
+	mockEgressIPSources(mockOcp,
+		map[string]string{"default-test": "1.1.1.11"},
+		map[string][]string{"default-test": {"1.1.1.11"}},
+		defaultHostSubnet("host-1", "1.1.1.34", "1.1.1.11"),
+	)
+	cloud.On("InstanceByHostName", mock.Anything, "host-1").Return(nil, errors.New("aws unavailable"))
+
+	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
+	drifts, err := service.AuditDrift(context.TODO())
+
+	assert.NotNil(t, err)
+	assert.Empty(t, drifts)
+}
+
+func TestAuditDriftResyncsTheCloudBeforeReadingInstances(t *testing.T) {
+	cloud := &resyncingCloud{CloudProvider: &mocks.CloudProvider{}}
+	mockOcp := &mocks.OcpClient{}
+
+	mockEgressIPSources(mockOcp,
+		map[string]string{"default-test": "1.1.1.11"},
+		map[string][]string{"default-test": {"1.1.1.11"}},
+		defaultHostSubnet("host-1", "1.1.1.34", "1.1.1.11"),
+	)
+	mockInstanceWithIPs(cloud.CloudProvider, "vm-1", "host-1", "1.1.1.11")
+
+	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
+	drifts, err := service.AuditDrift(context.TODO())
+
+	assert.Nil(t, err)
+	assert.Empty(t, drifts)
+	assert.Equal(t, 1, cloud.resyncs)
+	assert.Equal(t, 0, cloud.lookupsAtResync)
+}
+
+func TestAuditDriftSkipsNetNamespacesOfUnmanagedNamespaces(t *testing.T) {
+	cloud := &mocks.CloudProvider{}
+	mockOcp := &mocks.OcpClient{}
+
+	// kube-system carries the annotations of the operator neither.
+	mockEgressIPSources(mockOcp,
+		map[string]string{"default-test": "1.1.1.11"},
+		map[string][]string{"default-test": {"1.1.1.11"}, "kube-system": {"1.1.1.20"}},
+		defaultHostSubnet("host-1", "1.1.1.34", "1.1.1.11", "1.1.1.20"),
+	)
+	mockInstanceWithIPs(cloud, "vm-1", "host-1", "1.1.1.11", "1.1.1.20")
+
+	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
+	drifts, err := service.AuditDrift(context.TODO())
+
+	assert.Nil(t, err)
+	assert.Empty(t, drifts)
+}
+
+func TestRepairDriftKeepsIPsOnNetNamespacesOfUnmanagedNamespaces(t *testing.T) {
+	cloud := &mocks.CloudProvider{}
+	mockOcp := &mocks.OcpClient{}
+	mockOcp.On("Get", mock.Anything, types.NamespacedName{Name: "kube-system"}, mock.AnythingOfType("*v1.Namespace")).
+		Return(nil)
+
+	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
+	err := service.RepairDrift(context.TODO(), openshift.Drift{
+		Kind:      openshift.DriftUnknownOnNetNamespace,
+		IP:        "1.1.1.20",
+		Namespace: "kube-system",
+	})
+
+	assert.NotNil(t, err)
+	mockOcp.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+}
+
+func TestRepairDriftAddsIPToNetNamespace(t *testing.T) {
+	cloud := &mocks.CloudProvider{}
+	mockOcp := &mocks.OcpClient{}
+	netNamespace := mockNetNamespace(mockOcp, "default-test", "1.1.1.12")
+
+	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
+	err := service.RepairDrift(context.TODO(), openshift.Drift{
+		Kind:      openshift.DriftMissingOnNetNamespace,
+		IP:        "1.1.1.11",
+		Namespace: "default-test",
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1.1.1.12", "1.1.1.11"}, netNamespace.EgressIPs)
+}
+
+func TestRepairDriftMovesIPToHostSubnetOfInstance(t *testing.T) {
+	cloud := &mocks.CloudProvider{}
+	mockOcp := &mocks.OcpClient{}
+	mockCloudInstance(cloud, "vm-2", "host-2")
+
+	store := map[string][]string{"host-1": {"1.1.1.11", "1.1.1.12"}}
+	mockHostSubnetStore(mockOcp, store)
+
+	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
+	err := service.RepairDrift(context.TODO(), openshift.Drift{
+		Kind:       openshift.DriftWrongHostSubnet,
+		IP:         "1.1.1.11",
+		Namespace:  "default-test",
+		HostSubnet: "host-1",
+		Instance:   "vm-2",
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1.1.1.11"}, store["host-2"])
+	assert.Equal(t, []string{"1.1.1.12"}, store["host-1"])
+}
+
+func TestRepairDriftRejectsDriftsThatCanNotBeRepaired(t *testing.T) {
+	cloud := &mocks.CloudProvider{}
+	mockOcp := &mocks.OcpClient{}
+
+	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
+	err := service.RepairDrift(context.TODO(), openshift.Drift{
+		Kind:       openshift.DriftMissingInCloud,
+		IP:         "1.1.1.11",
+		HostSubnet: "host-1",
+	})
+
+	assert.NotNil(t, err)
+	mockOcp.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+}
+
+func TestParseDriftPolicy(t *testing.T) {
+	policy, err := openshift.ParseDriftPolicy("")
+	assert.Nil(t, err)
+	assert.Empty(t, policy)
+
+	policy, err = openshift.ParseDriftPolicy(" missing-on-netnamespace, Wrong-HostSubnet ")
+	assert.Nil(t, err)
+	assert.Equal(t, openshift.DriftPolicy{
+		openshift.DriftMissingOnNetNamespace: true,
+		openshift.DriftWrongHostSubnet:       true,
+	}, policy)
+
+	policy, err = openshift.ParseDriftPolicy("all")
+	assert.Nil(t, err)
+	assert.True(t, policy.Repairs(openshift.Drift{Kind: openshift.DriftWrongNamespaceAnnotation}))
+	assert.False(t, policy.Repairs(openshift.Drift{Kind: openshift.DriftMissingOnHostSubnet}))
+	assert.True(t, policy.Repairs(openshift.Drift{Kind: openshift.DriftMissingOnHostSubnet, Instance: "vm-1"}))
+
+	_, err = openshift.ParseDriftPolicy("orphaned-in-cloud")
+	assert.NotNil(t, err)
+}
+
+func TestDriftAuditorRepairsAccordingToPolicyAndAlarmsTheRest(t *testing.T) {
+	cloud := &mocks.CloudProvider{}
+	mockOcp := &mocks.OcpClient{}
+
+	mockEgressIPSources(mockOcp,
+		map[string]string{"drift-test": "1.1.1.11,1.1.1.12"},
+		map[string][]string{"drift-test": {"1.1.1.11"}},
+		defaultHostSubnet("host-1", "1.1.1.34", "1.1.1.11", "1.1.1.12"),
+	)
+	netNamespace := mockNetNamespace(mockOcp, "drift-test", "1.1.1.11")
+	mockInstanceWithIPs(cloud, "vm-1", "host-1", "1.1.1.11")
+
+	alarming := *observability.NewAlarmStore()
+	defer alarming.RemoveAlarm("drift-test")
+
+	handler := *openshift.NewEgressIPHandler(cloud, mockOcp)
+	policy := openshift.DriftPolicy{openshift.DriftMissingOnNetNamespace: true}
+	auditor := openshift.NewDriftAuditor(handler, policy, 0, alarming)
+	drifts, err := auditor.Audit(context.TODO())
+
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]openshift.DriftKind{
+		"1.1.1.11": {openshift.DriftWrongNamespaceAnnotation},
+		"1.1.1.12": {openshift.DriftMissingOnNetNamespace, openshift.DriftWrongNamespaceAnnotation, openshift.DriftMissingInCloud},
+	}, driftKindsByIP(drifts))
+	assert.Equal(t, []string{"1.1.1.11", "1.1.1.12"}, netNamespace.EgressIPs)
+	if assert.Contains(t, alarming.GetFailed(), "drift-test") {
+		assert.Len(t, alarming.GetFailed()["drift-test"].FailedIPs, 2)
+	}
+}
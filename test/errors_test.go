@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/hashicorp/go-multierror"
+	"github.com/klenkes74/aws-egressip-operator/pkg/cloudprovider"
+	"github.com/klenkes74/aws-egressip-operator/pkg/openshift"
+	"github.com/klenkes74/aws-egressip-operator/test/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"net"
+	"testing"
+)
+
+func classifiedAwsError(t *testing.T, code string) error {
+	options := fastResilienceOptions()
+	options.MaxRetries = 1
+
+	mockAws := &mocks.AwsClient{}
+	mockAws.On("DescribeNetworkInterfaces", mock.Anything, mock.Anything).Return(nil, awserr.New(code, "failed", nil))
+
+	client := cloudprovider.NewResilientAwsClient(mockAws, options)
+	_, err := client.DescribeNetworkInterfaces(context.TODO(), &ec2.DescribeNetworkInterfacesInput{})
+	assert.NotNil(t, err)
+
+	return err
+}
+
+func TestAwsErrorsAreClassified(t *testing.T) {
+	err := classifiedAwsError(t, "RequestLimitExceeded")
+	assert.True(t, cloudprovider.IsThrottled(err))
+	assert.True(t, cloudprovider.IsRetryable(err))
+
+	err = classifiedAwsError(t, "UnauthorizedOperation")
+	assert.True(t, cloudprovider.IsPermissionDenied(err))
+	assert.False(t, cloudprovider.IsRetryable(err))
+
+	err = classifiedAwsError(t, "InvalidNetworkInterfaceID.NotFound")
+	assert.True(t, cloudprovider.IsNotFound(err))
+	assert.False(t, cloudprovider.IsRetryable(err))
+
+	err = classifiedAwsError(t, "InvalidIPAddress.InUse")
+	assert.True(t, cloudprovider.IsConflict(err))
+	assert.True(t, cloudprovider.IsRetryable(err))
+
+	err = classifiedAwsError(t, "PrivateIpAddressLimitExceeded")
+	_, isAwsError := err.(awserr.Error)
+	assert.True(t, isAwsError, "unclassified aws errors are returned unchanged")
+	assert.False(t, cloudprovider.IsRetryable(err))
+}
+
+func TestRetryableCombinedErrors(t *testing.T) {
+	throttled := &cloudprovider.ThrottledError{Operation: "AssignPrivateIpAddresses", Err: errors.New("slow down")}
+	exhausted := &cloudprovider.CapacityExhaustedError{Network: "subnet-1"}
+
+	assert.True(t, cloudprovider.IsRetryable(multierror.Append(nil, throttled, cloudprovider.ErrCircuitOpen)))
+	assert.False(t, cloudprovider.IsRetryable(multierror.Append(nil, throttled, exhausted)))
+	assert.True(t, cloudprovider.IsCapacityExhausted(multierror.Append(nil, throttled, exhausted)))
+	assert.False(t, cloudprovider.IsRetryable(errors.New("unclassified")))
+}
+
+func TestMockCloudReportsMissingIPAsNotFound(t *testing.T) {
+	service := createMockCloudProvider(t)
+
+	ip := net.ParseIP("1.1.1.99")
+	_, err := service.RemoveIP(context.TODO(), &ip)
+
+	assert.True(t, cloudprovider.IsNotFound(err))
+
+	_, err = service.Instance(context.TODO(), "vm-99")
+	assert.True(t, cloudprovider.IsNotFound(err))
+}
+
+func TestSaveDeletedNetNamespaceIsNoError(t *testing.T) {
+	netNamespace := defaultNetNamespace()
+	resource := schema.GroupResource{Group: "network.openshift.io", Resource: "netnamespaces"}
+
+	mockOcp := &mocks.OcpClient{}
+	mockOcp.On("Update", mock.Anything, netNamespace).
+		Return(apierrors.NewConflict(resource, netNamespace.Name,
+			errors.New("StorageError: invalid object, Code: 4, Key: /netnamespaces/default-namespace"))).Once()
+	mockOcp.On("Update", mock.Anything, netNamespace).
+		Return(apierrors.NewConflict(resource, netNamespace.Name, errors.New("the object has been modified"))).Once()
+
+	service := *openshift.NewEgressIPHandler(&mocks.CloudProvider{}, mockOcp)
+
+	err := service.SaveNetNameSpace(context.TODO(), netNamespace)
+	assert.Nil(t, err)
+
+	err = service.SaveNetNameSpace(context.TODO(), netNamespace)
+	assert.True(t, openshift.IsConflict(err))
+	assert.True(t, cloudprovider.IsRetryable(err))
+}
+
+func TestLoadMissingNamespaceIsNotFound(t *testing.T) {
+	mockOcp := &mocks.OcpClient{}
+	mockOcp.On("Get", mock.Anything, mock.Anything, mock.Anything).
+		Return(apierrors.NewNotFound(schema.GroupResource{Resource: "namespaces"}, "gone")).Once()
+
+	service := *openshift.NewEgressIPHandler(&mocks.CloudProvider{}, mockOcp)
+
+	_, err := service.LoadNamespace(context.TODO(), "gone")
+	assert.True(t, openshift.IsNotFound(err))
+	assert.False(t, cloudprovider.IsRetryable(err))
+}
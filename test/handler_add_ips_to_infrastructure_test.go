@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/klenkes74/aws-egressip-operator/pkg/openshift"
 	"github.com/klenkes74/aws-egressip-operator/test/mocks"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	corev1 "k8s.io/api/core/v1"
 	"testing"
+	"time"
 )
 
 func TestAddIPsToInfrastructureRandomOK(t *testing.T) {
@@ -28,6 +31,7 @@ func TestAddIPsToInfrastructureSpecifiedFail(t *testing.T) {
 func successAddIPsToInfrastructure(t *testing.T, namespace *corev1.Namespace) {
 	mockAws := &mocks.AwsClient{}
 	mockOcp := &mocks.OcpClient{}
+	mockSaveNamespaces(mockOcp)
 
 	cloud := createAwsCloudProviderMock(mockAws)
 
@@ -62,7 +66,7 @@ func successAddIPsToInfrastructure(t *testing.T, namespace *corev1.Namespace) {
 
 	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
 
-	result, err := service.AddIPsToInfrastructure(namespace)
+	result, err := service.AddIPsToInfrastructure(context.TODO(), namespace)
 
 	assert.ElementsMatch(t, defaultIPs("1.1.1.11", "1.1.2.22", "1.1.3.33"), result, "The IPs should match!")
 
@@ -72,6 +76,7 @@ func successAddIPsToInfrastructure(t *testing.T, namespace *corev1.Namespace) {
 func failAddIPsToInfrastructure(t *testing.T, namespace *corev1.Namespace) {
 	mockAws := &mocks.AwsClient{}
 	mockOcp := &mocks.OcpClient{}
+	mockSaveNamespaces(mockOcp)
 
 	cloud := createAwsCloudProviderMock(mockAws)
 
@@ -106,7 +111,24 @@ func failAddIPsToInfrastructure(t *testing.T, namespace *corev1.Namespace) {
 
 	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
 
-	_, err := service.AddIPsToInfrastructure(namespace)
+	_, err := service.AddIPsToInfrastructure(context.TODO(), namespace)
 
 	assert.NotNil(t, err)
 }
+
+func TestAddIPsToInfrastructurePassesContextToCloud(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	cloud := &mocks.CloudProvider{}
+	cloud.On("AddRandomIPs", ctx, mock.Anything).Return(nil, nil, context.DeadlineExceeded).Once()
+
+	mockOcp := &mocks.OcpClient{}
+	mockSaveNamespaces(mockOcp)
+
+	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
+	_, err := service.AddIPsToInfrastructure(ctx, defaultNamespace())
+
+	assert.Equal(t, context.DeadlineExceeded, err)
+	cloud.AssertExpectations(t)
+}
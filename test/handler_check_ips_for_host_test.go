@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"github.com/klenkes74/aws-egressip-operator/pkg/openshift"
 	"github.com/klenkes74/aws-egressip-operator/test/mocks"
 	"github.com/stretchr/testify/assert"
@@ -21,7 +22,7 @@ func TestCheckIPsForHostOk(t *testing.T) {
 	data := defaultHostSubnet("ip-1-1-1-34.my-local.inf", "1.1.1.34")
 	ips := defaultIPs()
 
-	err := service.CheckIPsForHost(data, ips)
+	err := service.CheckIPsForHost(context.TODO(), data, ips)
 
 	assert.Nil(t, err)
 }
@@ -39,7 +40,7 @@ func TestCheckIPsForHostMissing(t *testing.T) {
 	data := defaultHostSubnet("ip-1-1-1-34.my-local.inf", "1.1.1.34")
 	ips := defaultIPs()
 
-	err := service.CheckIPsForHost(data, ips)
+	err := service.CheckIPsForHost(context.TODO(), data, ips)
 
 	assert.NotNil(t, err)
 }
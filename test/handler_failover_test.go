@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"github.com/klenkes74/aws-egressip-operator/pkg/cloudprovider"
+	"github.com/klenkes74/aws-egressip-operator/pkg/openshift"
+	"github.com/klenkes74/aws-egressip-operator/test/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net"
+	"testing"
+)
+
+func TestRedistributeIPsFromHostFailsOverIPsOfLostZone(t *testing.T) {
+	defer withEnvironment(map[string]string{"ZONE_FAILOVER": "true"})()
+
+	cloud := &mocks.CloudProvider{}
+	mockOcp := &mocks.OcpClient{}
+
+	ip := net.ParseIP("1.1.1.11")
+	replacement := net.ParseIP("1.1.2.99")
+	cloud.On("MoveIP", mock.Anything, mock.Anything, &ip).
+		Return("", &cloudprovider.NoEgressNodeError{Network: "subnet-1"}).Once()
+	cloud.On("FailoverIP", mock.Anything, mock.Anything, &ip).Return("vm-3", &replacement, nil).Once()
+	mockCloudInstance(cloud, "vm-3", "host-3")
+
+	store := map[string][]string{}
+	mockHostSubnetStore(mockOcp, store)
+	namespace, netNamespace := mockIPListNamespaces(mockOcp, "1.1.1.11,1.1.3.33")
+
+	hostSubnet := defaultHostSubnet("host-1", "1.1.1.34", "1.1.1.11")
+
+	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
+	result, err := service.RedistributeIPsFromHost(context.TODO(), hostSubnet)
+
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"1.1.1.11": "vm-3"}, result)
+	assert.Equal(t, []string{"1.1.2.99"}, store["host-3"])
+	assert.Equal(t, []string{"1.1.2.99", "1.1.3.33"}, netNamespace.EgressIPs)
+	assert.Equal(t, "1.1.2.99=1.1.1.11", namespace.Annotations[openshift.FailoverAnnotation])
+	assert.Empty(t, hostSubnet.EgressIPs)
+	cloud.AssertExpectations(t)
+}
+
+func TestRedistributeIPsFromHostDoesNotFailOverWithoutZoneFailover(t *testing.T) {
+	cloud := &mocks.CloudProvider{}
+	mockOcp := &mocks.OcpClient{}
+	mockSaveHostSubnets(mockOcp)
+
+	ip := net.ParseIP("1.1.1.11")
+	cloud.On("MoveIP", mock.Anything, mock.Anything, &ip).
+		Return("", &cloudprovider.NoEgressNodeError{Network: "subnet-1"}).Once()
+
+	hostSubnet := defaultHostSubnet("host-1", "1.1.1.34", "1.1.1.11")
+
+	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
+	result, err := service.RedistributeIPsFromHost(context.TODO(), hostSubnet)
+
+	assert.Nil(t, result)
+	assert.True(t, cloudprovider.IsNoEgressNode(err), "expected no egress node error but got: %v", err)
+	assert.Equal(t, []string{"1.1.1.11"}, hostSubnet.EgressIPs)
+	cloud.AssertNotCalled(t, "FailoverIP", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestReturnFailedOverIPsMovesIPBackToItsZone(t *testing.T) {
+	cloud := &mocks.CloudProvider{}
+	mockOcp := &mocks.OcpClient{}
+
+	original := net.ParseIP("1.1.1.11")
+	failover := net.ParseIP("1.1.2.99")
+	cloud.On("ReclaimIP", mock.Anything, mock.Anything, &original).Return("vm-1", &original, nil).Once()
+	cloud.On("RemoveIP", mock.Anything, &failover).Return("vm-3", nil).Once()
+	mockCloudInstance(cloud, "vm-1", "host-1")
+	mockCloudInstance(cloud, "vm-3", "host-3")
+
+	store := map[string][]string{"host-3": {"1.1.2.99"}}
+	mockHostSubnetStore(mockOcp, store)
+	namespace, netNamespace := mockIPListNamespaces(mockOcp, "1.1.2.99,1.1.3.33")
+	namespace.Annotations[openshift.FailoverAnnotation] = "1.1.2.99=1.1.1.11"
+
+	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
+	pending, err := service.ReturnFailedOverIPs(context.TODO(), "default-test")
+
+	assert.Nil(t, err)
+	assert.False(t, pending)
+	assert.Equal(t, []string{"1.1.1.11"}, store["host-1"])
+	assert.Empty(t, store["host-3"])
+	assert.Equal(t, []string{"1.1.1.11", "1.1.3.33"}, netNamespace.EgressIPs)
+	assert.NotContains(t, namespace.Annotations, openshift.FailoverAnnotation)
+	cloud.AssertExpectations(t)
+}
+
+func TestReturnFailedOverIPsKeepsIPWhileZoneHasNoEgressNode(t *testing.T) {
+	cloud := &mocks.CloudProvider{}
+	mockOcp := &mocks.OcpClient{}
+
+	original := net.ParseIP("1.1.1.11")
+	cloud.On("ReclaimIP", mock.Anything, mock.Anything, &original).
+		Return("", nil, &cloudprovider.NoEgressNodeError{Network: "subnet-1"}).Once()
+
+	namespace, netNamespace := mockIPListNamespaces(mockOcp, "1.1.2.99,1.1.3.33")
+	namespace.Annotations[openshift.FailoverAnnotation] = "1.1.2.99=1.1.1.11"
+
+	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
+	pending, err := service.ReturnFailedOverIPs(context.TODO(), "default-test")
+
+	assert.Nil(t, err)
+	assert.True(t, pending)
+	assert.Equal(t, []string{"1.1.2.99", "1.1.3.33"}, netNamespace.EgressIPs)
+	assert.Equal(t, "1.1.2.99=1.1.1.11", namespace.Annotations[openshift.FailoverAnnotation])
+	cloud.AssertNotCalled(t, "RemoveIP", mock.Anything, mock.Anything)
+}
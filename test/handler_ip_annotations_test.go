@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"github.com/klenkes74/aws-egressip-operator/pkg/openshift"
+	"github.com/klenkes74/aws-egressip-operator/test/mocks"
+	netv1 "github.com/openshift/api/network/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"k8s.io/apimachinery/pkg/types"
+	"testing"
+)
+
+// mockHostSubnetObjects -- the api server keeps the HostSubnets (host -> hostSubnet) including their annotations.
+func mockHostSubnetObjects(mockOcp *mocks.OcpClient, store map[string]*netv1.HostSubnet) {
+	mockOcp.On("Get", mock.Anything, mock.Anything, mock.AnythingOfType("*v1.HostSubnet")).
+		Run(func(args mock.Arguments) {
+			name := args.Get(1).(types.NamespacedName).Name
+			store[name].DeepCopyInto(args.Get(2).(*netv1.HostSubnet))
+		}).
+		Return(nil)
+
+	mockOcp.On("Update", mock.Anything, mock.AnythingOfType("*v1.HostSubnet")).
+		Run(func(args mock.Arguments) {
+			hostSubnet := args.Get(1).(*netv1.HostSubnet)
+			store[hostSubnet.Name] = hostSubnet.DeepCopy()
+		}).
+		Return(nil)
+}
+
+func TestRemoveIPsFromInfrastructureRemovesIPAnnotation(t *testing.T) {
+	cloud := &mocks.CloudProvider{}
+	mockOcp := &mocks.OcpClient{}
+
+	ips := defaultIPs("1.1.1.11")
+	cloud.On("RemoveIP", mock.Anything, mock.Anything).Return("vm-1", nil).Once()
+	mockCloudInstance(cloud, "vm-1", "host-1")
+
+	store := map[string]*netv1.HostSubnet{
+		"host-1": defaultHostSubnet("host-1", "1.1.1.34", "1.1.1.11", "1.1.1.12"),
+	}
+	mockHostSubnetObjects(mockOcp, store)
+
+	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
+	err := service.RemoveIPsFromInfrastructure(context.TODO(), defaultNetNamespace(ips[0].String()))
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1.1.1.12"}, store["host-1"].EgressIPs)
+	assert.NotContains(t, store["host-1"].Annotations, openshift.IPToNamespaceAnnotation+"1.1.1.11")
+	assert.Equal(t, "default-test", store["host-1"].Annotations[openshift.IPToNamespaceAnnotation+"1.1.1.12"])
+}
+
+func TestRemoveIPsFromInfrastructureRemovesStaleIPAnnotation(t *testing.T) {
+	cloud := &mocks.CloudProvider{}
+	mockOcp := &mocks.OcpClient{}
+
+	cloud.On("RemoveIP", mock.Anything, mock.Anything).Return("vm-1", nil).Once()
+	mockCloudInstance(cloud, "vm-1", "host-1")
+
+	hostSubnet := defaultHostSubnet("host-1", "1.1.1.34")
+	hostSubnet.Annotations[openshift.IPToNamespaceAnnotation+"1.1.1.11"] = "default-test"
+	store := map[string]*netv1.HostSubnet{"host-1": hostSubnet}
+	mockHostSubnetObjects(mockOcp, store)
+
+	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
+	err := service.RemoveIPsFromInfrastructure(context.TODO(), defaultNetNamespace("1.1.1.11"))
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, countHostSubnetUpdates(mockOcp))
+	assert.NotContains(t, store["host-1"].Annotations, openshift.IPToNamespaceAnnotation+"1.1.1.11")
+}
+
+func TestAddIPsToInfrastructureAnnotatesUnannotatedIPOnHostSubnet(t *testing.T) {
+	cloud := &mocks.CloudProvider{}
+	mockOcp := &mocks.OcpClient{}
+	mockSaveNamespaces(mockOcp)
+
+	ips := defaultIPs("1.1.1.11")
+	cloud.On("AddRandomIPs", mock.Anything, mock.Anything).Return([]string{"vm-1"}, ips, nil).Once()
+	mockCloudInstance(cloud, "vm-1", "host-1")
+
+	hostSubnet := defaultHostSubnet("host-1", "1.1.1.34", "1.1.1.11")
+	delete(hostSubnet.Annotations, openshift.IPToNamespaceAnnotation+"1.1.1.11")
+	store := map[string]*netv1.HostSubnet{"host-1": hostSubnet}
+	mockHostSubnetObjects(mockOcp, store)
+
+	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
+	_, err := service.AddIPsToInfrastructure(context.TODO(), defaultNamespace())
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1.1.1.11"}, store["host-1"].EgressIPs)
+	assert.Equal(t, "default-namespace", store["host-1"].Annotations[openshift.IPToNamespaceAnnotation+"1.1.1.11"])
+}
+
+func TestIPAnnotationCleanupRemovesStaleAnnotations(t *testing.T) {
+	mockOcp := &mocks.OcpClient{}
+
+	stale := defaultHostSubnet("host-1", "1.1.1.34", "1.1.1.11")
+	stale.Annotations[openshift.IPToNamespaceAnnotation+"1.1.1.12"] = "default-test"
+	stale.Annotations[openshift.IPToNamespaceAnnotation+"2001:db8:1::20"] = "default-test"
+	stale.Annotations[openshift.ZonesAnnotation] = "eu-central-1a"
+
+	clean := defaultHostSubnet("host-2", "1.1.1.35", "1.1.1.21")
+
+	inProgress := defaultHostSubnet("host-3", "1.1.1.36")
+	inProgress.Annotations[openshift.IPToNamespaceAnnotation+"1.1.1.31"] = "default-test"
+	inProgress.Annotations[openshift.IntentAnnotation] = "{}"
+
+	mockOcp.On("List", mock.Anything, mock.AnythingOfType("*v1.HostSubnetList")).
+		Run(func(args mock.Arguments) {
+			list := args.Get(1).(*netv1.HostSubnetList)
+			for _, hostSubnet := range []*netv1.HostSubnet{stale, clean, inProgress} {
+				list.Items = append(list.Items, *hostSubnet.DeepCopy())
+			}
+		}).
+		Return(nil)
+
+	saved := make(map[string]*netv1.HostSubnet)
+	mockOcp.On("Update", mock.Anything, mock.AnythingOfType("*v1.HostSubnet")).
+		Run(func(args mock.Arguments) {
+			hostSubnet := args.Get(1).(*netv1.HostSubnet)
+			saved[hostSubnet.Name] = hostSubnet.DeepCopy()
+		}).
+		Return(nil)
+
+	cleanup := openshift.NewIPAnnotationCleanup(mockOcp)
+	removed, err := cleanup.Cleanup(context.TODO())
+
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]string{"host-1": {"1.1.1.12", "2001:db8:1::20"}}, removed)
+	if assert.Contains(t, saved, "host-1") {
+		assert.Equal(t, map[string]string{
+			openshift.IPToNamespaceAnnotation + "1.1.1.11": "default-test",
+			openshift.ZonesAnnotation:                      "eu-central-1a",
+		}, saved["host-1"].Annotations)
+	}
+	assert.Len(t, saved, 1)
+}
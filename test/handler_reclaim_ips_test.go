@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/klenkes74/aws-egressip-operator/pkg/openshift"
+	"github.com/klenkes74/aws-egressip-operator/test/mocks"
+	netv1 "github.com/openshift/api/network/v1"
+	"github.com/redhat-cop/egressip-ipam-operator/pkg/controller/egressipam"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"net"
+	"strings"
+	"testing"
+)
+
+// mockIPListNamespaces -- the api server returns the namespace and the NetNamespace "default-test" with the IP list
+// annotation and saves them.
+func mockIPListNamespaces(mockOcp *mocks.OcpClient, ips string) (*corev1.Namespace, *netv1.NetNamespace) {
+	namespace := defaultNamespace()
+	namespace.Name = "default-test"
+	namespace.Annotations[egressipam.NamespaceAssociationAnnotation] = ips
+
+	netNamespace := mockNetNamespace(mockOcp, "default-test", strings.Split(ips, ",")...)
+	netNamespace.Annotations = map[string]string{egressipam.NamespaceAssociationAnnotation: ips}
+
+	mockOcp.On("Get", mock.Anything, types.NamespacedName{Name: "default-test"}, mock.AnythingOfType("*v1.Namespace")).
+		Run(func(args mock.Arguments) {
+			*args.Get(2).(*corev1.Namespace) = *namespace.DeepCopy()
+		}).
+		Return(nil)
+	mockOcp.On("Update", mock.Anything, mock.AnythingOfType("*v1.Namespace")).
+		Run(func(args mock.Arguments) {
+			*namespace = *args.Get(1).(*corev1.Namespace)
+		}).
+		Return(nil)
+
+	return namespace, netNamespace
+}
+
+func TestReclaimIPsFromTerminatedHostReclaimsTheSameIPs(t *testing.T) {
+	cloud := &mocks.CloudProvider{}
+	mockOcp := &mocks.OcpClient{}
+
+	ip := net.ParseIP("1.1.1.11")
+	cloud.On("ReclaimIP", mock.Anything, mock.Anything, &ip).Return("vm-2", &ip, nil).Once()
+	mockCloudInstance(cloud, "vm-2", "host-2")
+
+	store := map[string][]string{}
+	mockHostSubnetStore(mockOcp, store)
+
+	hostSubnet := defaultHostSubnet("host-1", "1.1.1.34", "1.1.1.11")
+
+	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
+	result, err := service.ReclaimIPsFromTerminatedHost(context.TODO(), hostSubnet)
+
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"1.1.1.11": "vm-2"}, result)
+	assert.Equal(t, []string{"1.1.1.11"}, store["host-2"])
+	assert.Empty(t, hostSubnet.EgressIPs)
+	assert.NotContains(t, hostSubnet.Annotations, openshift.IntentAnnotation)
+	mockOcp.AssertNotCalled(t, "Update", mock.Anything, mock.AnythingOfType("*v1.Namespace"))
+	cloud.AssertExpectations(t)
+}
+
+func TestReclaimIPsFromTerminatedHostReplacesTakenIP(t *testing.T) {
+	cloud := &mocks.CloudProvider{}
+	mockOcp := &mocks.OcpClient{}
+
+	ip := net.ParseIP("1.1.1.11")
+	replacement := net.ParseIP("1.1.1.99")
+	cloud.On("ReclaimIP", mock.Anything, mock.Anything, &ip).Return("vm-2", &replacement, nil).Once()
+	mockCloudInstance(cloud, "vm-2", "host-2")
+
+	store := map[string][]string{}
+	mockHostSubnetStore(mockOcp, store)
+	namespace, netNamespace := mockIPListNamespaces(mockOcp, "1.1.1.11,1.1.2.22")
+
+	hostSubnet := defaultHostSubnet("host-1", "1.1.1.34", "1.1.1.11")
+
+	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
+	result, err := service.ReclaimIPsFromTerminatedHost(context.TODO(), hostSubnet)
+
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"1.1.1.11": "vm-2"}, result)
+	assert.Equal(t, []string{"1.1.1.99"}, store["host-2"])
+	assert.Equal(t, []string{"1.1.1.99", "1.1.2.22"}, netNamespace.EgressIPs)
+	assert.Equal(t, "1.1.1.99,1.1.2.22", netNamespace.Annotations[egressipam.NamespaceAssociationAnnotation])
+	assert.Equal(t, "1.1.1.99,1.1.2.22", namespace.Annotations[egressipam.NamespaceAssociationAnnotation])
+	assert.Empty(t, hostSubnet.EgressIPs)
+	cloud.AssertExpectations(t)
+}
+
+func TestReclaimIPsFromTerminatedHostResumesRecordedReplacement(t *testing.T) {
+	cloud := &mocks.CloudProvider{}
+	mockOcp := &mocks.OcpClient{}
+
+	replacement := net.ParseIP("1.1.1.99")
+	cloud.On("ReclaimIP", mock.Anything, mock.Anything, &replacement).Return("vm-2", &replacement, nil).Once()
+	mockCloudInstance(cloud, "vm-2", "host-2")
+
+	store := map[string][]string{"host-2": {"1.1.1.99"}}
+	mockHostSubnetStore(mockOcp, store)
+	// the operator stopped after the namespace had been changed.
+	namespace, _ := mockIPListNamespaces(mockOcp, "1.1.1.99")
+
+	hostSubnet := defaultHostSubnet("host-1", "1.1.1.34", "1.1.1.11")
+	hostSubnet.Annotations[openshift.IntentAnnotation] = `{"operation":"reclaim-ips","started":"2020-05-04T12:00:00Z","ips":["1.1.1.11","1.1.1.99"],"replacements":{"1.1.1.11":"1.1.1.99"}}`
+
+	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
+	_, err := service.ReclaimIPsFromTerminatedHost(context.TODO(), hostSubnet)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1.1.1.99"}, store["host-2"])
+	assert.Equal(t, "1.1.1.99", namespace.Annotations[egressipam.NamespaceAssociationAnnotation])
+	assert.NotContains(t, hostSubnet.Annotations, openshift.IntentAnnotation)
+	cloud.AssertExpectations(t)
+}
+
+func TestReclaimIPsFromTerminatedHostKeepsFailedIPs(t *testing.T) {
+	cloud := &mocks.CloudProvider{}
+	mockOcp := &mocks.OcpClient{}
+	mockSaveHostSubnets(mockOcp)
+
+	ip := net.ParseIP("1.1.1.11")
+	cloud.On("ReclaimIP", mock.Anything, mock.Anything, &ip).Return("", nil, errors.New("no capacity in zone")).Once()
+
+	hostSubnet := defaultHostSubnet("host-1", "1.1.1.34", "1.1.1.11")
+
+	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
+	_, err := service.ReclaimIPsFromTerminatedHost(context.TODO(), hostSubnet)
+
+	assert.NotNil(t, err)
+	assert.Equal(t, []string{"1.1.1.11"}, hostSubnet.EgressIPs)
+	assert.Contains(t, hostSubnet.Annotations[openshift.IntentAnnotation], `"operation":"reclaim-ips"`)
+}
+
+func TestRecoverHostSubnetIntentKeepsReclaim(t *testing.T) {
+	cloud := &mocks.CloudProvider{}
+	mockOcp := &mocks.OcpClient{}
+
+	hostSubnet := defaultHostSubnet("host-1", "1.1.1.34", "1.1.1.11")
+	hostSubnet.Annotations[openshift.IntentAnnotation] = `{"operation":"reclaim-ips","started":"2020-05-04T12:00:00Z","ips":["1.1.1.11"]}`
+
+	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
+	recovered, err := service.RecoverHostSubnetIntent(context.TODO(), hostSubnet)
+
+	assert.False(t, recovered)
+	assert.Nil(t, err)
+	assert.Contains(t, hostSubnet.Annotations, openshift.IntentAnnotation)
+	cloud.AssertNotCalled(t, "RemoveIP", mock.Anything, mock.Anything)
+}
@@ -1,108 +1,111 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/klenkes74/aws-egressip-operator/pkg/openshift"
 	"github.com/klenkes74/aws-egressip-operator/test/mocks"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"testing"
 )
 
+// useRedistributionInstances -- replaces the default instances with vm-1 carrying the egress ip 1.1.1.11 and vm-2 as
+// the other instance in subnet-1. The returned function restores the defaults.
+func useRedistributionInstances() func() {
+	originalInstances := instances
+
+	instances = map[string]*ec2.Instance{
+		"vm-1": createInstance("vm-1", "1.1.1.34", "nice-a", "ip-1-1-1-34.my-local.inf", "subnet-1", []string{"1.1.1.11"}...),
+		"vm-2": createInstance("vm-2", "1.1.1.35", "nice-a", "ip-1-1-1-35.my-local.inf", "subnet-1"),
+	}
+
+	return func() {
+		instances = originalInstances
+	}
+}
+
 func TestRedistributeIPsFromHostOK(t *testing.T) {
 	mockAws := &mocks.AwsClient{}
 	mockOcp := &mocks.OcpClient{}
+	mockSaveHostSubnets(mockOcp)
 
+	defer useRedistributionInstances()()
 	cloud := createAwsCloudProviderMock(mockAws)
 
-	instances = make(map[string]*ec2.Instance)
-	instances["vm-1"] = createInstance("vm-1", "1.1.1.34", "nice-a", "ip-1-1-1-34.my-local.inf", "subnet-1", []string{"1.1.1.11"}...)
 	mockHostSubnet(t, mockOcp, "ip-1-1-1-34.my-local.inf")
+	mockHostSubnet(t, mockOcp, "ip-1-1-1-35.my-local.inf")
 	mockedInstance := mockedInstanceByName("ip-1-1-1-34.my-local.inf")
 	mockDescribeNetworkInterfaceByIPMock(mockAws, "1.1.1.11")
 
-	mockAws.On("UnassignPrivateIPAddresses", &ec2.UnassignPrivateIpAddressesInput{
-		NetworkInterfaceId: aws.String("vm-1"),
-		PrivateIpAddresses: aws.StringSlice([]string{"1.1.1.11"}),
-	}).Return(&ec2.UnassignPrivateIpAddressesOutput{}, nil)
-
-	mockAddSpecifiedIPSuccessfully(mockAws, "vm-1", "1.1.1.11")
-	mockAddSpecifiedIPSuccessfully(mockAws, "vm-2", "1.1.1.11")
-
-	if mockedInstance == nil {
-		t.Errorf("Can't find the instance with name '%v'", "ip-1-1-1-34.my-local.inf")
-		return
-	}
+	mockMoveIPSuccessfully(mockAws, "vm-2", "1.1.1.11").Once()
 
 	subnet := defaultHostSubnet("ip-1-1-1-34.my-local.inf", *mockedInstance.PrivateIpAddress, createSecondaryIPs(mockedInstance)...)
 
 	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
-	result, err := service.RedistributeIPsFromHost(subnet)
+	result, err := service.RedistributeIPsFromHost(context.TODO(), subnet)
 
-	assert.Equal(t, "vm-1", result["1.1.1.11"])
 	assert.Nil(t, err)
+	assert.Equal(t, "vm-2", result["1.1.1.11"])
+	assert.Empty(t, subnet.EgressIPs)
+	assert.NotContains(t, subnet.Annotations, openshift.IPToNamespaceAnnotation+"1.1.1.11")
+	// moved in one step - the ip has never been unassigned
+	mockAws.AssertNotCalled(t, "UnassignPrivateIPAddresses", mock.Anything, mock.Anything)
+	mockAws.AssertExpectations(t)
 }
 
-func TestRedistributeIPsFromHostFailUnassign(t *testing.T) {
+func TestRedistributeIPsFromHostFailMove(t *testing.T) {
 	mockAws := &mocks.AwsClient{}
 	mockOcp := &mocks.OcpClient{}
+	mockSaveHostSubnets(mockOcp)
 
+	defer useRedistributionInstances()()
 	cloud := createAwsCloudProviderMock(mockAws)
 
-	instances = make(map[string]*ec2.Instance)
-	instances["vm-1"] = createInstance("vm-1", "1.1.1.34", "nice-a", "ip-1-1-1-34.my-local.inf", "subnet-1", []string{"1.1.1.11"}...)
 	mockHostSubnet(t, mockOcp, "ip-1-1-1-34.my-local.inf")
 	mockedInstance := mockedInstanceByName("ip-1-1-1-34.my-local.inf")
 	mockDescribeNetworkInterfaceByIPMock(mockAws, "1.1.1.11")
 
-	mockAws.On("UnassignPrivateIPAddresses", &ec2.UnassignPrivateIpAddressesInput{
-		NetworkInterfaceId: aws.String("vm-1"),
+	mockAws.On("AssignPrivateIPAddresses", mock.Anything, &ec2.AssignPrivateIpAddressesInput{
+		NetworkInterfaceId: aws.String("vm-2"),
 		PrivateIpAddresses: aws.StringSlice([]string{"1.1.1.11"}),
-	}).Return(nil, errors.New("failing to un assign the ip"))
-
-	if mockedInstance == nil {
-		t.Errorf("Can't find the instance with name '%v'", "ip-1-1-1-34.my-local.inf")
-		return
-	}
+		AllowReassignment:  aws.Bool(true),
+	}).Return(nil, errors.New("failing to reassign the ip"))
 
 	subnet := defaultHostSubnet("ip-1-1-1-34.my-local.inf", *mockedInstance.PrivateIpAddress, createSecondaryIPs(mockedInstance)...)
 
 	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
-	_, err := service.RedistributeIPsFromHost(subnet)
+	_, err := service.RedistributeIPsFromHost(context.TODO(), subnet)
 
 	assert.NotNil(t, err)
+	// the ip is still on the failing host and kept on its hostSubnet to be redistributed again
+	assert.Equal(t, []string{"1.1.1.11"}, subnet.EgressIPs)
+	mockAws.AssertNotCalled(t, "UnassignPrivateIPAddresses", mock.Anything, mock.Anything)
 }
 
 func TestRedistributeIPsFromHostFailAssign(t *testing.T) {
 	mockAws := &mocks.AwsClient{}
 	mockOcp := &mocks.OcpClient{}
+	mockSaveHostSubnets(mockOcp)
 
-	cloud := createAwsCloudProviderMock(mockAws)
-
+	// no other instance in the subnet to move the ip to
 	instances = make(map[string]*ec2.Instance)
 	instances["vm-1"] = createInstance("vm-1", "1.1.1.34", "nice-a", "ip-1-1-1-34.my-local.inf", "subnet-1", []string{"1.1.1.11"}...)
+	cloud := createAwsCloudProviderMock(mockAws)
+
 	mockHostSubnet(t, mockOcp, "ip-1-1-1-34.my-local.inf")
 	mockedInstance := mockedInstanceByName("ip-1-1-1-34.my-local.inf")
 	mockDescribeNetworkInterfaceByIPMock(mockAws, "1.1.1.11")
 
-	mockAws.On("UnassignPrivateIPAddresses", &ec2.UnassignPrivateIpAddressesInput{
-		NetworkInterfaceId: aws.String("vm-1"),
-		PrivateIpAddresses: aws.StringSlice([]string{"1.1.1.11"}),
-	}).Return(&ec2.UnassignPrivateIpAddressesOutput{}, nil)
-
-	mockAddSpecifiedIPFail(mockAws, "vm-1", "1.1.1.11")
-	mockAddSpecifiedIPFail(mockAws, "vm-2", "1.1.1.11")
-
-	if mockedInstance == nil {
-		t.Errorf("Can't find the instance with name '%v'", "ip-1-1-1-34.my-local.inf")
-		return
-	}
-
 	subnet := defaultHostSubnet("ip-1-1-1-34.my-local.inf", *mockedInstance.PrivateIpAddress, createSecondaryIPs(mockedInstance)...)
 
 	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
-	_, err := service.RedistributeIPsFromHost(subnet)
+	_, err := service.RedistributeIPsFromHost(context.TODO(), subnet)
 
 	assert.NotNil(t, err)
+	assert.Equal(t, []string{"1.1.1.11"}, subnet.EgressIPs)
+	mockAws.AssertNotCalled(t, "AssignPrivateIPAddresses", mock.Anything, mock.Anything)
+	mockAws.AssertNotCalled(t, "UnassignPrivateIPAddresses", mock.Anything, mock.Anything)
 }
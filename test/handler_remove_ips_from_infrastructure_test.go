@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/klenkes74/aws-egressip-operator/pkg/openshift"
@@ -22,7 +23,7 @@ func TestRemoveIPsFromInfrastructureOK(t *testing.T) {
 	mockDescribeNetworkInterfaceByIPMock(mockAws, "1.1.1.11")
 	mockHostSubnet(t, mockOcp, "ip-1-1-1-34.my-local.inf")
 
-	mockAws.On("UnassignPrivateIPAddresses", &ec2.UnassignPrivateIpAddressesInput{
+	mockAws.On("UnassignPrivateIPAddresses", mock.Anything, &ec2.UnassignPrivateIpAddressesInput{
 		NetworkInterfaceId: aws.String("vm-1"),
 		PrivateIpAddresses: aws.StringSlice([]string{"1.1.1.11"}),
 	}).Return(&ec2.UnassignPrivateIpAddressesOutput{}, nil)
@@ -31,6 +32,6 @@ func TestRemoveIPsFromInfrastructureOK(t *testing.T) {
 
 	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
 
-	err := service.RemoveIPsFromInfrastructure(defaultNetNamespace("1.1.1.11"))
+	err := service.RemoveIPsFromInfrastructure(context.TODO(), defaultNetNamespace("1.1.1.11"))
 	assert.Nil(t, err)
 }
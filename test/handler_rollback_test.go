@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/klenkes74/aws-egressip-operator/pkg/cloudprovider"
+	"github.com/klenkes74/aws-egressip-operator/pkg/openshift"
+	"github.com/klenkes74/aws-egressip-operator/test/mocks"
+	netv1 "github.com/openshift/api/network/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	apiv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"net"
+	"testing"
+)
+
+// mockCloudInstance -- the cloud knows the instance with the given host name.
+func mockCloudInstance(cloud *mocks.CloudProvider, instanceID string, hostName string) {
+	instance := &mocks.CloudInstance{}
+	instance.On("ID").Return(instanceID).Maybe()
+	instance.On("HostName").Return(hostName).Maybe()
+
+	cloudInstance := cloudprovider.CloudInstance(instance)
+	cloud.On("Instance", mock.Anything, instanceID).Return(&cloudInstance, nil).Maybe()
+}
+
+// mockHostSubnetStore -- the api server keeps the egress IPs of the HostSubnets (host -> ips). Loading the HostSubnets
+// of the failing hosts returns the error.
+func mockHostSubnetStore(mockOcp *mocks.OcpClient, store map[string][]string, failing ...string) {
+	for _, hostName := range failing {
+		mockOcp.On("Get", mock.Anything, types.NamespacedName{Name: hostName}, mock.AnythingOfType("*v1.HostSubnet")).
+			Return(errors.New("api server unavailable"))
+	}
+
+	mockOcp.On("Get", mock.Anything, mock.Anything, mock.AnythingOfType("*v1.HostSubnet")).
+		Run(func(args mock.Arguments) {
+			name := args.Get(1).(types.NamespacedName).Name
+			hostSubnet := args.Get(2).(*netv1.HostSubnet)
+			hostSubnet.ObjectMeta = apiv1.ObjectMeta{Name: name, Annotations: make(map[string]string)}
+			hostSubnet.EgressIPs = append([]string{}, store[name]...)
+		}).
+		Return(nil)
+
+	mockOcp.On("Update", mock.Anything, mock.AnythingOfType("*v1.HostSubnet")).
+		Run(func(args mock.Arguments) {
+			hostSubnet := args.Get(1).(*netv1.HostSubnet)
+			store[hostSubnet.Name] = append([]string{}, hostSubnet.EgressIPs...)
+		}).
+		Return(nil)
+}
+
+// countHostSubnetUpdates -- the number of hostSubnets saved.
+func countHostSubnetUpdates(mockOcp *mocks.OcpClient) int {
+	result := 0
+	for _, call := range mockOcp.Calls {
+		if _, ok := call.Arguments.Get(1).(*netv1.HostSubnet); ok && call.Method == "Update" {
+			result++
+		}
+	}
+	return result
+}
+
+// mockPartialRandomAssignment -- the cloud assigns 1.1.1.11 to vm-1 and 1.1.2.22 to vm-2 and fails in the third zone.
+func mockPartialRandomAssignment(cloud *mocks.CloudProvider) []*net.IP {
+	ips := defaultIPs("1.1.1.11", "1.1.2.22")
+
+	cloud.On("AddRandomIPs", mock.Anything, mock.Anything).
+		Return([]string{"vm-1", "vm-2", ""}, []*net.IP{ips[0], ips[1], nil}, errors.New("no capacity in zone")).
+		Once()
+
+	return ips
+}
+
+func TestAddIPsToInfrastructureRollsBackPartialCloudAssignment(t *testing.T) {
+	cloud := &mocks.CloudProvider{}
+	mockOcp := &mocks.OcpClient{}
+	mockSaveNamespaces(mockOcp)
+
+	ips := mockPartialRandomAssignment(cloud)
+	cloud.On("RemoveIP", mock.Anything, ips[0]).Return("vm-1", nil).Once()
+	cloud.On("RemoveIP", mock.Anything, ips[1]).Return("vm-2", nil).Once()
+
+	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
+	result, err := service.AddIPsToInfrastructure(context.TODO(), defaultNamespace())
+
+	assert.Nil(t, result)
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "no capacity in zone")
+	}
+	cloud.AssertExpectations(t)
+}
+
+func TestAddIPsToInfrastructureKeepsPartialCloudAssignment(t *testing.T) {
+	defer withEnvironment(map[string]string{"IP_ASSIGNMENT_MODE": "partial"})()
+
+	cloud := &mocks.CloudProvider{}
+	mockOcp := &mocks.OcpClient{}
+	mockSaveNamespaces(mockOcp)
+
+	ips := mockPartialRandomAssignment(cloud)
+	mockCloudInstance(cloud, "vm-1", "host-1")
+	mockCloudInstance(cloud, "vm-2", "host-2")
+
+	store := map[string][]string{"host-1": {"1.1.1.12"}}
+	mockHostSubnetStore(mockOcp, store)
+
+	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
+	result, err := service.AddIPsToInfrastructure(context.TODO(), defaultNamespace())
+
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "no capacity in zone")
+	}
+	assert.Equal(t, []*net.IP{ips[0], ips[1], nil}, result)
+	assert.Equal(t, 2, countHostSubnetUpdates(mockOcp))
+	assert.Equal(t, []string{"1.1.1.12", "1.1.1.11"}, store["host-1"])
+	assert.Equal(t, []string{"1.1.2.22"}, store["host-2"])
+	cloud.AssertNotCalled(t, "RemoveIP", mock.Anything, mock.Anything)
+}
+
+func TestAddIPsToInfrastructureRollsBackWhenHostSubnetFails(t *testing.T) {
+	cloud := &mocks.CloudProvider{}
+	mockOcp := &mocks.OcpClient{}
+	mockSaveNamespaces(mockOcp)
+
+	ips := defaultIPs("1.1.1.11", "1.1.2.22")
+	cloud.On("AddRandomIPs", mock.Anything, mock.Anything).
+		Return([]string{"vm-1", "vm-2"}, ips, nil).
+		Once()
+	cloud.On("RemoveIP", mock.Anything, ips[0]).Return("vm-1", nil).Once()
+	cloud.On("RemoveIP", mock.Anything, ips[1]).Return("vm-2", nil).Once()
+
+	mockCloudInstance(cloud, "vm-1", "host-1")
+	mockCloudInstance(cloud, "vm-2", "host-2")
+
+	store := map[string][]string{"host-1": {"1.1.1.12"}}
+	mockHostSubnetStore(mockOcp, store, "host-2")
+
+	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
+	result, err := service.AddIPsToInfrastructure(context.TODO(), defaultNamespace())
+
+	assert.Nil(t, result)
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "api server unavailable")
+	}
+	cloud.AssertExpectations(t)
+	assert.Equal(t, 2, countHostSubnetUpdates(mockOcp)) // adding and removing the ip
+	assert.Equal(t, []string{"1.1.1.12"}, store["host-1"])
+}
+
+func TestRedistributeIPsFromHostRollsBackToHostSubnet(t *testing.T) {
+	cloud := &mocks.CloudProvider{}
+	mockOcp := &mocks.OcpClient{}
+	mockSaveHostSubnets(mockOcp)
+
+	ips := defaultIPs("1.1.1.11", "1.1.2.22")
+	cloud.On("MoveIP", mock.Anything, mock.Anything, ips[0]).Return("vm-2", nil).Once()
+	cloud.On("MoveIP", mock.Anything, mock.Anything, ips[1]).Return("", errors.New("no capacity in zone")).Once()
+
+	hostSubnet := defaultHostSubnet("host-1", "1.1.1.34", "1.1.1.11", "1.1.2.22")
+
+	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
+	result, err := service.RedistributeIPsFromHost(context.TODO(), hostSubnet)
+
+	assert.Nil(t, result)
+	assert.NotNil(t, err)
+	assert.Equal(t, []string{"1.1.1.11", "1.1.2.22"}, hostSubnet.EgressIPs)
+	assert.Equal(t, "default-test", hostSubnet.Annotations[openshift.IPToNamespaceAnnotation+"1.1.1.11"])
+	assert.Equal(t, "default-test", hostSubnet.Annotations[openshift.IPToNamespaceAnnotation+"1.1.2.22"])
+	// the ip moved to vm-2 is kept there to be moved again - releasing it would take it from the namespace
+	cloud.AssertNotCalled(t, "RemoveIP", mock.Anything, mock.Anything)
+	cloud.AssertExpectations(t)
+}
+
+func TestParseAssignmentMode(t *testing.T) {
+	mode, err := openshift.ParseAssignmentMode("")
+	assert.Nil(t, err)
+	assert.Equal(t, openshift.RollbackOnFailure, mode)
+
+	mode, err = openshift.ParseAssignmentMode(" Partial ")
+	assert.Nil(t, err)
+	assert.Equal(t, openshift.AcceptPartialSuccess, mode)
+
+	_, err = openshift.ParseAssignmentMode("sometimes")
+	assert.NotNil(t, err)
+}
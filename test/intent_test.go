@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"github.com/klenkes74/aws-egressip-operator/pkg/cloudprovider"
+	"github.com/klenkes74/aws-egressip-operator/pkg/openshift"
+	"github.com/klenkes74/aws-egressip-operator/test/mocks"
+	netv1 "github.com/openshift/api/network/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"net"
+	"testing"
+)
+
+// recordSavedIntents -- the api server saves namespaces and the test gets the intents they carried.
+func recordSavedIntents(mockOcp *mocks.OcpClient) *[]string {
+	result := make([]string, 0)
+
+	mockOcp.On("Update", mock.Anything, mock.AnythingOfType("*v1.Namespace")).
+		Run(func(args mock.Arguments) {
+			result = append(result, args.Get(1).(*corev1.Namespace).Annotations[openshift.IntentAnnotation])
+		}).
+		Return(nil)
+
+	return &result
+}
+
+// mockNetNamespace -- the api server returns the NetNamespace with the egress IPs and saves it.
+func mockNetNamespace(mockOcp *mocks.OcpClient, name string, egressIPs ...string) *netv1.NetNamespace {
+	stored := &netv1.NetNamespace{NetName: name, EgressIPs: egressIPs}
+	stored.Name = name
+
+	mockOcp.On("Get", mock.Anything, types.NamespacedName{Name: name}, mock.AnythingOfType("*v1.NetNamespace")).
+		Run(func(args mock.Arguments) {
+			*args.Get(2).(*netv1.NetNamespace) = *stored
+		}).
+		Return(nil)
+	mockOcp.On("Update", mock.Anything, mock.AnythingOfType("*v1.NetNamespace")).
+		Run(func(args mock.Arguments) {
+			*stored = *args.Get(1).(*netv1.NetNamespace)
+		}).
+		Return(nil)
+
+	return stored
+}
+
+// recordingCloud -- a cloud provider reporting every random IP as soon as it has been assigned.
+type recordingCloud struct {
+	*mocks.CloudProvider
+
+	instances []string
+	ips       []*net.IP
+}
+
+func (c *recordingCloud) AddRandomIPsRecorded(_ context.Context, _ cloudprovider.IPRequest, record cloudprovider.IPRecorder) ([]string, []*net.IP, error) {
+	for i, ip := range c.ips {
+		if err := record(c.instances[i], ip); err != nil {
+			return c.instances[:i+1], c.ips[:i+1], err
+		}
+	}
+	return c.instances, c.ips, nil
+}
+
+// listingCloud -- a cloud provider listing its egress nodes.
+type listingCloud struct {
+	*mocks.CloudProvider
+
+	nodes []*cloudprovider.CloudInstance
+}
+
+func (c *listingCloud) EgressNodes(context.Context) ([]*cloudprovider.CloudInstance, error) {
+	return c.nodes, nil
+}
+
+// egressNodeWithIPs -- an egress node carrying the secondary IPs.
+func egressNodeWithIPs(instanceID string, ips ...string) *cloudprovider.CloudInstance {
+	instance := &mocks.CloudInstance{}
+	instance.On("ID").Return(instanceID).Maybe()
+	instance.On("SecondaryIps").Return(defaultIPs(ips...)).Maybe()
+
+	result := cloudprovider.CloudInstance(instance)
+	return &result
+}
+
+func TestAddIPsToInfrastructureRecordsIntentOfRandomIPs(t *testing.T) {
+	cloud := &mocks.CloudProvider{}
+	mockOcp := &mocks.OcpClient{}
+	intents := recordSavedIntents(mockOcp)
+
+	cloud.On("AddRandomIPs", mock.Anything, mock.Anything).
+		Return([]string{"vm-1"}, defaultIPs("1.1.1.11"), nil).
+		Once()
+	mockCloudInstance(cloud, "vm-1", "host-1")
+	mockHostSubnetStore(mockOcp, map[string][]string{})
+
+	namespace := defaultNamespace()
+	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
+	_, err := service.AddIPsToInfrastructure(context.TODO(), namespace)
+
+	assert.Nil(t, err)
+	if assert.Len(t, *intents, 2) {
+		assert.Contains(t, (*intents)[0], `"operation":"add-ips"`)
+		assert.NotContains(t, (*intents)[0], "1.1.1.11")
+		assert.Contains(t, (*intents)[1], `"ips":["1.1.1.11"]`)
+		assert.Contains(t, (*intents)[1], `"allocated":["1.1.1.11"]`)
+	}
+	// cleared in memory, the reconciler saves the namespace after the NetNamespace.
+	assert.NotContains(t, namespace.Annotations, openshift.IntentAnnotation)
+}
+
+func TestAddIPsToInfrastructureClearsIntentOfFailedOperation(t *testing.T) {
+	cloud := &mocks.CloudProvider{}
+	mockOcp := &mocks.OcpClient{}
+	intents := recordSavedIntents(mockOcp)
+
+	ips := mockPartialRandomAssignment(cloud)
+	cloud.On("RemoveIP", mock.Anything, ips[0]).Return("vm-1", nil).Once()
+	cloud.On("RemoveIP", mock.Anything, ips[1]).Return("vm-2", nil).Once()
+
+	namespace := defaultNamespace()
+	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
+	_, err := service.AddIPsToInfrastructure(context.TODO(), namespace)
+
+	assert.NotNil(t, err)
+	if assert.Len(t, *intents, 3) {
+		assert.Contains(t, (*intents)[1], `"ips":["1.1.1.11","1.1.2.22"]`)
+		assert.Equal(t, "", (*intents)[2])
+	}
+	cloud.AssertExpectations(t)
+}
+
+func TestAddIPsToInfrastructureRecordsRandomIPsAsTheyAreAssigned(t *testing.T) {
+	cloud := &recordingCloud{
+		CloudProvider: &mocks.CloudProvider{},
+		instances:     []string{"vm-1", "vm-2"},
+		ips:           defaultIPs("1.1.1.11", "1.1.2.22"),
+	}
+	mockOcp := &mocks.OcpClient{}
+	intents := recordSavedIntents(mockOcp)
+
+	mockCloudInstance(cloud.CloudProvider, "vm-1", "host-1")
+	mockCloudInstance(cloud.CloudProvider, "vm-2", "host-2")
+	mockHostSubnetStore(mockOcp, map[string][]string{})
+
+	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
+	_, err := service.AddIPsToInfrastructure(context.TODO(), defaultNamespace())
+
+	assert.Nil(t, err)
+	// every ip is saved before the next one is assigned and not saved again afterwards.
+	if assert.Len(t, *intents, 3) {
+		assert.NotContains(t, (*intents)[0], "1.1.1.11")
+		assert.Contains(t, (*intents)[1], `"allocated":["1.1.1.11"]`)
+		assert.Contains(t, (*intents)[2], `"allocated":["1.1.1.11","1.1.2.22"]`)
+	}
+	cloud.AssertNotCalled(t, "AddRandomIPs", mock.Anything, mock.Anything)
+}
+
+func TestRecoverNamespaceIntentRollsBackLeftoverIPs(t *testing.T) {
+	cloud := &mocks.CloudProvider{}
+	mockOcp := &mocks.OcpClient{}
+	intents := recordSavedIntents(mockOcp)
+
+	ip := net.ParseIP("1.1.1.11")
+	cloud.On("RemoveIP", mock.Anything, &ip).Return("vm-1", nil).Once()
+	mockCloudInstance(cloud, "vm-1", "host-1")
+
+	store := map[string][]string{"host-1": {"1.1.1.11", "1.1.1.12"}}
+	mockHostSubnetStore(mockOcp, store)
+	netNamespace := mockNetNamespace(mockOcp, "default-namespace", "1.1.1.11")
+
+	namespace := defaultNamespace()
+	namespace.Annotations[openshift.IntentAnnotation] = `{"operation":"add-ips","started":"2020-05-04T12:00:00Z","ips":["1.1.1.11"],"allocated":["1.1.1.11"]}`
+
+	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
+	recovered, err := service.RecoverNamespaceIntent(context.TODO(), namespace)
+
+	assert.True(t, recovered)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1.1.1.12"}, store["host-1"])
+	assert.Empty(t, netNamespace.EgressIPs)
+	assert.Equal(t, []string{""}, *intents)
+	assert.NotContains(t, namespace.Annotations, openshift.IntentAnnotation)
+	cloud.AssertExpectations(t)
+}
+
+func TestRecoverNamespaceIntentKeepsIPsNotAllocatedByTheOperation(t *testing.T) {
+	cloud := &mocks.CloudProvider{}
+	mockOcp := &mocks.OcpClient{}
+	intents := recordSavedIntents(mockOcp)
+
+	store := map[string][]string{"host-1": {"1.1.1.11", "1.1.1.12"}}
+	mockHostSubnetStore(mockOcp, store)
+	netNamespace := mockNetNamespace(mockOcp, "default-namespace", "1.1.1.11")
+
+	// the operator stopped before the cloud assigned the specified ip.
+	namespace := defaultNamespace()
+	namespace.Annotations[openshift.IntentAnnotation] = `{"operation":"add-ips","started":"2020-05-04T12:00:00Z","ips":["1.1.1.11"]}`
+
+	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
+	recovered, err := service.RecoverNamespaceIntent(context.TODO(), namespace)
+
+	assert.True(t, recovered)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1.1.1.11", "1.1.1.12"}, store["host-1"])
+	assert.Equal(t, []string{"1.1.1.11"}, netNamespace.EgressIPs)
+	assert.Equal(t, []string{""}, *intents)
+	cloud.AssertNotCalled(t, "RemoveIP", mock.Anything, mock.Anything)
+}
+
+func TestRecoverNamespaceIntentRollsBackUnrecordedAllocations(t *testing.T) {
+	cloud := &listingCloud{CloudProvider: &mocks.CloudProvider{}}
+	mockOcp := &mocks.OcpClient{}
+	intents := recordSavedIntents(mockOcp)
+
+	// the cloud assigned 1.1.1.11 before the operator stopped, 1.1.1.12 has been owned by host-1 before.
+	cloud.nodes = []*cloudprovider.CloudInstance{egressNodeWithIPs("vm-1", "1.1.1.11", "1.1.1.12")}
+	ip := net.ParseIP("1.1.1.11")
+	cloud.On("RemoveIP", mock.Anything, &ip).Return("vm-1", nil).Once()
+	mockCloudInstance(cloud.CloudProvider, "vm-1", "host-1")
+
+	store := map[string][]string{"host-1": {"1.1.1.12"}}
+	mockHostSubnetStore(mockOcp, store)
+	mockHostSubnets(mockOcp, defaultHostSubnet("host-1", "1.1.1.34", "1.1.1.12"))
+	mockNetNamespace(mockOcp, "default-namespace")
+
+	namespace := defaultNamespace()
+	namespace.Annotations[openshift.IntentAnnotation] = `{"operation":"add-ips","started":"2020-05-04T12:00:00Z","ips":["1.1.1.11","1.1.1.12","1.1.1.13"]}`
+
+	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
+	recovered, err := service.RecoverNamespaceIntent(context.TODO(), namespace)
+
+	assert.True(t, recovered)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1.1.1.12"}, store["host-1"])
+	assert.Equal(t, []string{""}, *intents)
+	cloud.AssertExpectations(t)
+	cloud.AssertNumberOfCalls(t, "RemoveIP", 1)
+}
+
+func TestRecoverNamespaceIntentWithoutIntent(t *testing.T) {
+	cloud := &mocks.CloudProvider{}
+	mockOcp := &mocks.OcpClient{}
+
+	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
+	recovered, err := service.RecoverNamespaceIntent(context.TODO(), defaultNamespace())
+
+	assert.False(t, recovered)
+	assert.Nil(t, err)
+	mockOcp.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+}
+
+func TestRecoverHostSubnetIntentPutsIPsBack(t *testing.T) {
+	cloud := &mocks.CloudProvider{}
+	mockOcp := &mocks.OcpClient{}
+
+	saved := make(map[string]*netv1.HostSubnet)
+	mockOcp.On("List", mock.Anything, mock.AnythingOfType("*v1.HostSubnetList")).
+		Run(func(args mock.Arguments) {
+			list := args.Get(1).(*netv1.HostSubnetList)
+			list.Items = append(list.Items,
+				*defaultHostSubnet("host-1", "1.1.1.34"),
+				*defaultHostSubnet("host-2", "1.1.1.35", "1.1.1.11"),
+			)
+		}).
+		Return(nil)
+	mockOcp.On("Update", mock.Anything, mock.AnythingOfType("*v1.HostSubnet")).
+		Run(func(args mock.Arguments) {
+			hostSubnet := args.Get(1).(*netv1.HostSubnet)
+			saved[hostSubnet.Name] = hostSubnet.DeepCopy()
+		}).
+		Return(nil)
+
+	// the operator stopped after the ip had been moved to host-2.
+	hostSubnet := defaultHostSubnet("host-1", "1.1.1.34")
+	hostSubnet.Annotations[openshift.IntentAnnotation] = `{"operation":"redistribute-ips","started":"2020-05-04T12:00:00Z","ips":["1.1.1.11"]}`
+
+	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
+	recovered, err := service.RecoverHostSubnetIntent(context.TODO(), hostSubnet)
+
+	assert.True(t, recovered)
+	assert.Nil(t, err)
+	if assert.Contains(t, saved, "host-2") {
+		assert.Empty(t, saved["host-2"].EgressIPs)
+		assert.NotContains(t, saved["host-2"].Annotations, openshift.IPToNamespaceAnnotation+"1.1.1.11")
+	}
+	assert.Equal(t, []string{"1.1.1.11"}, hostSubnet.EgressIPs)
+	assert.Equal(t, "default-test", hostSubnet.Annotations[openshift.IPToNamespaceAnnotation+"1.1.1.11"])
+	assert.NotContains(t, hostSubnet.Annotations, openshift.IntentAnnotation)
+	// the moved ip stays on the instance of host-2 in the cloud.
+	cloud.AssertNotCalled(t, "RemoveIP", mock.Anything, mock.Anything)
+}
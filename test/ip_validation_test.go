@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/klenkes74/aws-egressip-operator/pkg/cloudprovider"
+	"github.com/klenkes74/aws-egressip-operator/pkg/openshift"
+	"github.com/klenkes74/aws-egressip-operator/test/mocks"
+	netv1 "github.com/openshift/api/network/v1"
+	"github.com/redhat-cop/egressip-ipam-operator/pkg/controller/egressipam"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	corev1 "k8s.io/api/core/v1"
+	apiv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"testing"
+)
+
+// namespaceWithSpecifiedIPs -- the default namespace with the IPs annotated.
+func namespaceWithSpecifiedIPs(ips string) *corev1.Namespace {
+	result := defaultNamespace()
+	result.Annotations[egressipam.NamespaceAssociationAnnotation] = ips
+	return result
+}
+
+// mockNetNamespaces -- the api server lists the NetNamespaces with their egress IPs (namespace -> ip).
+func mockNetNamespaces(mockOcp *mocks.OcpClient, egressIPs map[string]string) {
+	mockOcp.On("List", mock.Anything, mock.AnythingOfType("*v1.NetNamespaceList")).
+		Run(func(args mock.Arguments) {
+			list := args.Get(1).(*netv1.NetNamespaceList)
+			for namespace, ip := range egressIPs {
+				list.Items = append(list.Items, netv1.NetNamespace{
+					ObjectMeta: apiv1.ObjectMeta{Name: namespace},
+					NetName:    namespace,
+					EgressIPs:  []string{ip},
+				})
+			}
+		}).
+		Return(nil)
+}
+
+// mockHostSubnets -- the api server lists the hostSubnets.
+func mockHostSubnets(mockOcp *mocks.OcpClient, hostSubnets ...*netv1.HostSubnet) {
+	mockOcp.On("List", mock.Anything, mock.AnythingOfType("*v1.HostSubnetList")).
+		Run(func(args mock.Arguments) {
+			list := args.Get(1).(*netv1.HostSubnetList)
+			for _, hostSubnet := range hostSubnets {
+				list.Items = append(list.Items, *hostSubnet.DeepCopy())
+			}
+		}).
+		Return(nil)
+}
+
+func TestValidateSpecifiedIPsAcceptsUnusedIPs(t *testing.T) {
+	mockAws := &mocks.AwsClient{}
+	service := createAwsCloudProviderMock(mockAws).(cloudprovider.IPValidator)
+
+	mockDescribeNetworkInterfaceByIPMock(mockAws, "1.1.1.40")
+	mockDescribeNetworkInterfaceByIPMock(mockAws, "1.1.2.40")
+
+	err := service.ValidateSpecifiedIPs(context.TODO(), cloudprovider.IPRequest{}, defaultIPs("1.1.1.40", "1.1.2.40"))
+
+	assert.Nil(t, err)
+}
+
+func TestValidateSpecifiedIPsRejectsUnusableIPs(t *testing.T) {
+	mockAws := &mocks.AwsClient{}
+	service := createAwsCloudProviderMock(mockAws).(cloudprovider.IPValidator)
+
+	instances = make(map[string]*ec2.Instance)
+	instances["vm-1"] = createInstance("vm-1", "1.1.1.34", "nice-a", "ip-1-1-1-34.my-local.inf", "subnet-1")
+
+	mockDescribeNetworkInterfaceByIPMock(mockAws, "1.1.1.34")
+	mockDescribeNetworkInterfaceByIPMock(mockAws, "1.1.2.40")
+
+	err := service.ValidateSpecifiedIPs(context.TODO(), cloudprovider.IPRequest{},
+		defaultIPs("1.1.9.40", "1.1.1.3", "1.1.3.255", "1.1.1.34", "1.1.2.40", "1.1.2.41"))
+
+	if assert.NotNil(t, err) {
+		assert.True(t, cloudprovider.IsInvalidIP(err))
+		assert.False(t, cloudprovider.IsRetryable(err))
+		assert.Contains(t, err.Error(), "'1.1.9.40': is in no egress subnet of the cluster")
+		assert.Contains(t, err.Error(), "'1.1.1.3': is reserved by AWS")
+		assert.Contains(t, err.Error(), "'1.1.3.255': is reserved by AWS")
+		assert.Contains(t, err.Error(), "'1.1.1.34': is the primary address of network interface 'vm-1'")
+		assert.Contains(t, err.Error(), "'1.1.2.41': is in zone 'nice-b' like '1.1.2.40'")
+		assert.NotContains(t, err.Error(), "'1.1.2.40':")
+	}
+}
+
+func TestValidateSpecifiedIPsAcceptsIPsOfStoppedEgressNodes(t *testing.T) {
+	defer useRedistributionInstances()()
+	stopped := *instances["vm-1"]
+	delete(instances, "vm-1")
+
+	mockAws := &mocks.AwsClient{}
+	service := createAwsCloudProviderMock(mockAws).(cloudprovider.IPValidator)
+	mockDescribeNetworkInterfaceByIPMock(mockAws, "1.1.1.11")
+	mockInstanceOutsideInventory(mockAws, stopped, ec2.InstanceStateNameStopped,
+		&ec2.Tag{Key: aws.String("kubernetes.io/cluster/nicer"), Value: aws.String("shared")})
+
+	err := service.ValidateSpecifiedIPs(context.TODO(), cloudprovider.IPRequest{}, defaultIPs("1.1.1.11"))
+
+	assert.Nil(t, err)
+	mockAws.AssertExpectations(t)
+}
+
+func TestValidateSpecifiedIPsRejectsIPsOfInstancesOutsideTheCluster(t *testing.T) {
+	defer useRedistributionInstances()()
+	foreign := *instances["vm-1"]
+	delete(instances, "vm-1")
+
+	mockAws := &mocks.AwsClient{}
+	service := createAwsCloudProviderMock(mockAws).(cloudprovider.IPValidator)
+	mockDescribeNetworkInterfaceByIPMock(mockAws, "1.1.1.11")
+	mockInstanceOutsideInventory(mockAws, foreign, ec2.InstanceStateNameRunning)
+
+	err := service.ValidateSpecifiedIPs(context.TODO(), cloudprovider.IPRequest{}, defaultIPs("1.1.1.11"))
+
+	if assert.NotNil(t, err) {
+		assert.True(t, cloudprovider.IsInvalidIP(err))
+		assert.Contains(t, err.Error(), "'1.1.1.11': is used by network interface 'vm-1' outside the egress nodes of the cluster")
+	}
+	mockAws.AssertExpectations(t)
+}
+
+func TestAddIPsToInfrastructureRejectsIPOfOtherNamespace(t *testing.T) {
+	cloud := &mocks.CloudProvider{}
+	mockOcp := &mocks.OcpClient{}
+	mockNetNamespaces(mockOcp, map[string]string{"other-namespace": "1.1.1.40"})
+	mockHostSubnets(mockOcp)
+
+	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
+
+	_, err := service.AddIPsToInfrastructure(context.TODO(), namespaceWithSpecifiedIPs("1.1.1.40,1.1.2.40"))
+
+	if assert.NotNil(t, err) {
+		assert.True(t, cloudprovider.IsInvalidIP(err))
+		assert.Contains(t, err.Error(), "is already used by namespace 'other-namespace'")
+	}
+	cloud.AssertNotCalled(t, "AddSpecifiedIPs", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestAddIPsToInfrastructureRejectsIPsOwnedByHostSubnets(t *testing.T) {
+	cloud := &mocks.CloudProvider{}
+	mockOcp := &mocks.OcpClient{}
+	mockNetNamespaces(mockOcp, map[string]string{})
+
+	// 1.1.1.40 is annotated with another namespace, 1.1.2.40 is not annotated at all.
+	annotated := defaultHostSubnet("host-1", "1.1.1.34", "1.1.1.40")
+	annotated.Annotations[openshift.IPToNamespaceAnnotation+"1.1.1.40"] = "other-namespace"
+	unannotated := defaultHostSubnet("host-3", "1.1.2.34")
+	unannotated.EgressIPs = []string{"1.1.2.40"}
+	mockHostSubnets(mockOcp, annotated, unannotated)
+
+	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
+
+	_, err := service.AddIPsToInfrastructure(context.TODO(), namespaceWithSpecifiedIPs("1.1.1.40,1.1.2.40"))
+
+	if assert.NotNil(t, err) {
+		assert.True(t, cloudprovider.IsInvalidIP(err))
+		assert.Contains(t, err.Error(), "'1.1.1.40': is already used by namespace 'other-namespace'")
+		assert.Contains(t, err.Error(), "'1.1.2.40': is already an egress ip of hostSubnet 'host-3' without namespace")
+	}
+	cloud.AssertNotCalled(t, "AddSpecifiedIPs", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestAddIPsToInfrastructureRejectsDuplicateIPs(t *testing.T) {
+	cloud := &mocks.CloudProvider{}
+	mockOcp := &mocks.OcpClient{}
+
+	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
+
+	_, err := service.AddIPsToInfrastructure(context.TODO(), namespaceWithSpecifiedIPs("1.1.1.40, 1.1.1.40"))
+
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "'1.1.1.40': is listed twice")
+	}
+	mockOcp.AssertNotCalled(t, "List", mock.Anything, mock.Anything)
+	cloud.AssertNotCalled(t, "AddSpecifiedIPs", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestAddIPsToInfrastructureRejectsUnparsableIPs(t *testing.T) {
+	cloud := &mocks.CloudProvider{}
+	mockOcp := &mocks.OcpClient{}
+
+	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
+
+	_, err := service.AddIPsToInfrastructure(context.TODO(), namespaceWithSpecifiedIPs("1.1.1.40,1.1.1.400"))
+
+	if assert.NotNil(t, err) {
+		assert.True(t, cloudprovider.IsInvalidIP(err))
+		assert.Contains(t, err.Error(), "'1.1.1.400': is not a valid ip address")
+	}
+	cloud.AssertNotCalled(t, "AddSpecifiedIPs", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestSetEgressIPConditionKeepsTransitionTime(t *testing.T) {
+	namespace := defaultNamespace()
+
+	assert.True(t, openshift.SetEgressIPCondition(namespace, corev1.ConditionFalse, openshift.ReasonInvalidEgressIPs, "first"))
+	transition := namespace.Status.Conditions[0].LastTransitionTime
+
+	assert.False(t, openshift.SetEgressIPCondition(namespace, corev1.ConditionFalse, openshift.ReasonInvalidEgressIPs, "first"))
+	assert.True(t, openshift.SetEgressIPCondition(namespace, corev1.ConditionFalse, openshift.ReasonInvalidEgressIPs, "second"))
+
+	if assert.Len(t, namespace.Status.Conditions, 1) {
+		assert.Equal(t, openshift.EgressIPsValidCondition, namespace.Status.Conditions[0].Type)
+		assert.Equal(t, "second", namespace.Status.Conditions[0].Message)
+		assert.Equal(t, transition, namespace.Status.Conditions[0].LastTransitionTime)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"github.com/klenkes74/aws-egressip-operator/pkg/cloudprovider"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+)
+
+var mockCloudConfig = `
+clusterName: nicer
+region: nice
+ipsPerInterface: 3
+subnets:
+  - id: subnet-1
+    cidr: 1.1.1.0/24
+    zone: nice-a
+  - id: subnet-2
+    cidr: 1.1.2.0/24
+    zone: nice-b
+instances:
+  - id: vm-1
+    hostname: ip-1-1-1-34.my-local.inf
+    zone: nice-a
+    interfaces:
+      - id: eni-1
+        subnet: subnet-1
+        primaryIP: 1.1.1.34
+        secondaryIPs:
+          - 1.1.1.4
+  - id: vm-2
+    hostname: ip-1-1-2-75.my-local.inf
+    zone: nice-b
+    interfaces:
+      - id: eni-2
+        subnet: subnet-2
+        primaryIP: 1.1.2.75
+        maxIPs: 2
+`
+
+func createMockCloudProvider(t *testing.T) cloudprovider.CloudProvider {
+	config, err := cloudprovider.ParseMockConfig([]byte(mockCloudConfig))
+	if err != nil {
+		t.Fatalf("can't parse the mock cloud config: %v", err)
+	}
+
+	service, err := cloudprovider.NewMockCloudProvider(config)
+	if err != nil {
+		t.Fatalf("can't create the mock cloud: %v", err)
+	}
+
+	return service
+}
+
+func TestMockCloudSeededInstance(t *testing.T) {
+	service := createMockCloudProvider(t)
+
+	instance, err := service.InstanceByHostName(context.TODO(), "ip-1-1-1-34.my-local.inf")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "vm-1", (*instance).ID())
+	assert.Equal(t, "nice-a", (*instance).FailureZone())
+	assert.ElementsMatch(t, defaultIPs("1.1.1.4"), (*instance).SecondaryIps())
+}
+
+func TestMockCloudAddRandomIPs(t *testing.T) {
+	service := createMockCloudProvider(t)
+
+	instances, ips, err := service.AddRandomIPs(context.TODO(), cloudprovider.IPRequest{})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"vm-1", "vm-2"}, instances)
+	assert.ElementsMatch(t, defaultIPs("1.1.1.5", "1.1.2.4"), ips)
+}
+
+func TestMockCloudEnforcesInterfaceLimit(t *testing.T) {
+	service := createMockCloudProvider(t)
+
+	_, _, err := service.AddRandomIPs(context.TODO(), cloudprovider.IPRequest{})
+	assert.Nil(t, err)
+
+	instances, ips, err := service.AddRandomIPs(context.TODO(), cloudprovider.IPRequest{})
+
+	assert.NotNil(t, err)
+	assert.Equal(t, []string{"", ""}, instances)
+	assert.Equal(t, []*net.IP{nil, nil}, ips)
+}
+
+func TestMockCloudAddSpecifiedIPAlreadyInUse(t *testing.T) {
+	service := createMockCloudProvider(t)
+
+	_, err := service.AddSpecifiedIPs(context.TODO(), cloudprovider.IPRequest{}, defaultIPs("1.1.1.4"))
+
+	assert.NotNil(t, err)
+}
+
+func TestMockCloudRemoveIP(t *testing.T) {
+	service := createMockCloudProvider(t)
+	ip := net.ParseIP("1.1.1.4")
+
+	instanceID, err := service.RemoveIP(context.TODO(), &ip)
+	assert.Nil(t, err)
+	assert.Equal(t, "vm-1", instanceID)
+
+	_, err = service.RemoveIP(context.TODO(), &ip)
+	assert.NotNil(t, err)
+
+	instances, err := service.AddSpecifiedIPs(context.TODO(), cloudprovider.IPRequest{}, defaultIPs("1.1.1.4"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"vm-1"}, instances)
+}
+
+func TestMockCloudRejectsChangesWithCancelledContext(t *testing.T) {
+	service := createMockCloudProvider(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _, err := service.AddRandomIPs(ctx, cloudprovider.IPRequest{})
+	assert.Equal(t, context.Canceled, err)
+
+	instance, err := service.Instance(context.TODO(), "vm-1")
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, defaultIPs("1.1.1.4"), (*instance).SecondaryIps())
+}
+
+func TestCreateCloudProviderReturnsErrorOfInvalidMockConfig(t *testing.T) {
+	defer withEnvironment(map[string]string{"CLOUD_PROVIDER": "MOCK", "MOCK_CLOUD_CONFIG": "/nonexistent/mock-cloud.yaml"})()
+
+	result := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := cloudprovider.CreateCloudProvider()
+			result <- err
+		}()
+	}
+
+	for i := 0; i < 2; i++ {
+		err := <-result
+		if assert.NotNil(t, err) {
+			assert.Contains(t, err.Error(), "can not read the mock cloud configuration '/nonexistent/mock-cloud.yaml'")
+		}
+	}
+}
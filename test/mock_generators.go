@@ -18,7 +18,7 @@ import (
 	"time"
 )
 
-var region = "nice"
+var region = "eu-nice-1"
 var clusterName = "nicer"
 
 //goland:noinspection GoUnusedGlobalVariable
@@ -72,7 +72,7 @@ func createInstance(instanceID string, ip string, failureZone string, hostName s
 
 	return &ec2.Instance{
 		InstanceId:        &instanceID,
-		NetworkInterfaces: []*ec2.InstanceNetworkInterface{createInstanceNetworkInterface(instanceID, ip, failureZone, hostName, subnetID, ips...)},
+		NetworkInterfaces: []*ec2.InstanceNetworkInterface{createInstanceNetworkInterface(instanceID, instanceID, 0, ip, failureZone, hostName, subnetID, ips...)},
 		OutpostArn:        &instanceID,
 		PrivateDnsName:    &hostName,
 		PrivateIpAddress:  &ip,
@@ -82,11 +82,24 @@ func createInstance(instanceID string, ip string, failureZone string, hostName s
 				Key:   &tagKey,
 				Value: &tagValue,
 			},
+			{
+				Key:   aws.String("k8s.io/cluster-autoscaler/enabled"),
+				Value: aws.String("true"),
+			},
 		},
 	}
 }
 
-func createInstanceNetworkInterface(instanceID string, ip string, failureZone string, hostName string, subnetID string, ips ...string) *ec2.InstanceNetworkInterface {
+// addNetworkInterface attaches an additional network interface to the instance.
+func addNetworkInterface(instance *ec2.Instance, interfaceID string, ip string, subnetID string, ips ...string) *ec2.Instance {
+	networkInterface := createInstanceNetworkInterface(*instance.InstanceId, interfaceID, int64(len(instance.NetworkInterfaces)),
+		ip, *networkInterfaces[*instance.PrivateIpAddress].AvailabilityZone, *instance.PrivateDnsName, subnetID, ips...)
+
+	instance.NetworkInterfaces = append(instance.NetworkInterfaces, networkInterface)
+	return instance
+}
+
+func createInstanceNetworkInterface(instanceID string, interfaceID string, deviceIndex int64, ip string, failureZone string, hostName string, subnetID string, ips ...string) *ec2.InstanceNetworkInterface {
 	privateIPs := make([]*ec2.InstancePrivateIpAddress, len(ips)+1)
 	networkPrivateIPs := make([]*ec2.NetworkInterfacePrivateIpAddress, len(ips)+1)
 
@@ -103,6 +116,7 @@ func createInstanceNetworkInterface(instanceID string, ip string, failureZone st
 
 	if len(ips) > 0 {
 		for i, sip := range ips {
+			sip := sip
 			privateIPs[i+1] = &ec2.InstancePrivateIpAddress{
 				Primary:          &[]bool{false}[0],
 				PrivateIpAddress: &sip,
@@ -115,23 +129,25 @@ func createInstanceNetworkInterface(instanceID string, ip string, failureZone st
 	}
 
 	result := ec2.InstanceNetworkInterface{
-		NetworkInterfaceId: &instanceID,
+		NetworkInterfaceId: &interfaceID,
 		PrivateDnsName:     &hostName,
 		PrivateIpAddress:   &ip,
 		PrivateIpAddresses: privateIPs,
 		SubnetId:           &subnetID,
 		Attachment: &ec2.InstanceNetworkInterfaceAttachment{
-			AttachmentId: &instanceID,
+			AttachmentId: &interfaceID,
+			DeviceIndex:  &deviceIndex,
 		},
 	}
 
 	networkInterface := &ec2.NetworkInterface{
 		Attachment: &ec2.NetworkInterfaceAttachment{
-			AttachmentId: &instanceID,
+			AttachmentId: &interfaceID,
+			DeviceIndex:  &deviceIndex,
 			InstanceId:   &instanceID,
 		},
 		AvailabilityZone:   &failureZone,
-		NetworkInterfaceId: &instanceID,
+		NetworkInterfaceId: &interfaceID,
 		OutpostArn:         &instanceID,
 		PrivateDnsName:     &hostName,
 		PrivateIpAddress:   &ip,
@@ -156,7 +172,7 @@ func mockDescribeNetworkInterfaceByIPMock(mockAws *mocks.AwsClient, ips ...strin
 		}
 	}
 
-	mockAws.On("DescribeNetworkInterfaces", &ec2.DescribeNetworkInterfacesInput{
+	mockAws.On("DescribeNetworkInterfaces", mock.Anything, &ec2.DescribeNetworkInterfacesInput{
 		Filters: []*ec2.Filter{
 			createFilter("addresses.private-ip-address", ips),
 		},
@@ -184,22 +200,34 @@ func createReservation(instanceID string) []*ec2.Reservation {
 	return result
 }
 
-func createAwsCloudProviderMock(mockAws *mocks.AwsClient) cloudprovider.CloudProvider {
-	service := &cloudprovider.AwsCloudProvider{
-		Aws:         mockAws,
-		Region:      region,
-		ClusterName: clusterName,
+// createAwsCloudProvider creates the provider with the default configuration of the test cluster. The configuration
+// may be changed by the configure functions.
+func createAwsCloudProvider(mockAws *mocks.AwsClient, configure ...func(config *cloudprovider.AwsConfig)) *cloudprovider.AwsCloudProvider {
+	config := cloudprovider.DefaultAwsConfig(region, clusterName)
+	for _, c := range configure {
+		c(&config)
 	}
 
+	service, err := cloudprovider.NewAwsCloudProvider(config, mockAws)
+	if err != nil {
+		panic(err)
+	}
+	return service
+}
+
+func createAwsCloudProviderMock(mockAws *mocks.AwsClient) cloudprovider.CloudProvider {
+	service := createAwsCloudProvider(mockAws)
+
 	mockDefaultInstanceAwsCalls(mockAws)
 	mockDefaultSubnetAwsCalls(mockAws)
+	mockNoElasticIPs(mockAws)
 
 	result := cloudprovider.CloudProvider(service)
 	return result
 }
 
 func mockDefaultInstanceAwsCalls(mockAws *mocks.AwsClient) {
-	mockAws.On("DescribeInstances", &ec2.DescribeInstancesInput{
+	mockAws.On("DescribeInstances", mock.Anything, &ec2.DescribeInstancesInput{
 		Filters: []*ec2.Filter{
 			createFilter("tag-key", []string{"kubernetes.io/cluster/nicer"}),
 			createFilter("instance-state-name", []string{"running"}),
@@ -207,22 +235,10 @@ func mockDefaultInstanceAwsCalls(mockAws *mocks.AwsClient) {
 	}).Return(&ec2.DescribeInstancesOutput{
 		Reservations: createReservations(),
 	}, nil).Maybe()
-
-	//goland:noinspection SpellCheckingInspection
-	mockAws.On("DescribeInstances", &ec2.DescribeInstancesInput{
-		Filters: []*ec2.Filter{
-			createFilter("tag-key", []string{"kubernetes.io/cluster/nicer"}),
-			createFilter("tag:k8s.io/cluster-autoscaler/enabled", []string{"true"}),
-			createFilter("tag:ClusterNode", []string{"WorkerNode"}),
-			createFilter("instance-state-name", []string{"running"}),
-		},
-	}).Return(&ec2.DescribeInstancesOutput{
-		Reservations: createReservations(),
-	}, nil).Maybe()
 }
 
 func mockDescribeInstance(mockAws *mocks.AwsClient, instanceID string) {
-	mockAws.On("DescribeInstances", &ec2.DescribeInstancesInput{
+	mockAws.On("DescribeInstances", mock.Anything, &ec2.DescribeInstancesInput{
 		Filters: []*ec2.Filter{
 			createFilter("instance-id", []string{instanceID}),
 			createFilter("instance-state-name", []string{"running"}),
@@ -231,7 +247,7 @@ func mockDescribeInstance(mockAws *mocks.AwsClient, instanceID string) {
 		Reservations: createReservation(instanceID),
 	}, nil).Maybe()
 
-	mockAws.On("DescribeInstances", &ec2.DescribeInstancesInput{
+	mockAws.On("DescribeInstances", mock.Anything, &ec2.DescribeInstancesInput{
 		Filters: []*ec2.Filter{
 			createFilter("private-dns-name", []string{*instances[instanceID].PrivateDnsName}),
 		},
@@ -241,7 +257,7 @@ func mockDescribeInstance(mockAws *mocks.AwsClient, instanceID string) {
 }
 
 func mockDefaultSubnetAwsCalls(mockAws *mocks.AwsClient) {
-	mockAws.On("DescribeSubnets", &ec2.DescribeSubnetsInput{
+	mockAws.On("DescribeSubnets", mock.Anything, &ec2.DescribeSubnetsInput{
 		Filters: []*ec2.Filter{
 			createFilter("tag-key", []string{"kubernetes.io/cluster/nicer"}),
 		},
@@ -250,6 +266,11 @@ func mockDefaultSubnetAwsCalls(mockAws *mocks.AwsClient) {
 	}, nil).Maybe()
 }
 
+// mockNoElasticIPs -- no Elastic IPs are associated with any IP.
+func mockNoElasticIPs(mockAws *mocks.AwsClient) {
+	mockAws.On("DescribeAddresses", mock.Anything, mock.Anything).Return(&ec2.DescribeAddressesOutput{}, nil).Maybe()
+}
+
 func createFilter(key string, value []string) *ec2.Filter {
 	values := make([]*string, 0)
 
@@ -305,6 +326,15 @@ func defaultIPs(ips ...string) []*net.IP {
 	return result
 }
 
+// ipStrings -- the string representations of the IPs.
+func ipStrings(ips []*net.IP) []string {
+	result := make([]string, len(ips))
+	for i, ip := range ips {
+		result[i] = ip.String()
+	}
+	return result
+}
+
 func mockHostSubnet(t *testing.T, mockOcp *mocks.OcpClient, hostName string) *mock.Call {
 	return mockOcp.On("Get", mock.Anything, types.NamespacedName{Namespace: "",
 		Name: hostName}, mock.AnythingOfType("*v1.HostSubnet"),
@@ -332,12 +362,22 @@ func mockHostSubnet(t *testing.T, mockOcp *mocks.OcpClient, hostName string) *mo
 	}).Return(nil).Maybe()
 }
 
+// mockSaveNamespaces -- the api server saves namespaces (e.g. the intent of adding egress ips).
+func mockSaveNamespaces(mockOcp *mocks.OcpClient) *mock.Call {
+	return mockOcp.On("Update", mock.Anything, mock.AnythingOfType("*v1.Namespace")).Return(nil)
+}
+
+// mockSaveHostSubnets -- the api server saves hostSubnets (e.g. the intent of redistributing egress ips).
+func mockSaveHostSubnets(mockOcp *mocks.OcpClient) *mock.Call {
+	return mockOcp.On("Update", mock.Anything, mock.AnythingOfType("*v1.HostSubnet")).Return(nil)
+}
+
 func createSecondaryIPs(instance *ec2.Instance) []string {
 	result := make([]string, 0)
 
-	if len(instance.NetworkInterfaces[0].PrivateIpAddresses) > 1 {
-		for _, ip := range instance.NetworkInterfaces[0].PrivateIpAddresses[1:len(instance.NetworkInterfaces[0].PrivateIpAddresses)] {
-			if *ip.PrivateIpAddress != "" {
+	for _, networkInterface := range instance.NetworkInterfaces {
+		for _, ip := range networkInterface.PrivateIpAddresses {
+			if !*ip.Primary && *ip.PrivateIpAddress != "" {
 				result = append(result, *ip.PrivateIpAddress)
 			}
 		}
@@ -386,7 +426,7 @@ func defaultNamespace(ips ...string) *corev1.Namespace {
 }
 
 func mockAddRandomIPSuccessfully(mockAws *mocks.AwsClient, networkInterfaceID string, ip string) *mock.Call {
-	return mockAws.On("AssignPrivateIPAddresses", &ec2.AssignPrivateIpAddressesInput{
+	return mockAws.On("AssignPrivateIPAddresses", mock.Anything, &ec2.AssignPrivateIpAddressesInput{
 		NetworkInterfaceId:             aws.String(networkInterfaceID),
 		SecondaryPrivateIpAddressCount: aws.Int64(1),
 	}).Return(&ec2.AssignPrivateIpAddressesOutput{
@@ -397,14 +437,30 @@ func mockAddRandomIPSuccessfully(mockAws *mocks.AwsClient, networkInterfaceID st
 }
 
 func mockAddRandomIPFail(mockAws *mocks.AwsClient, networkInterfaceID string) *mock.Call {
-	return mockAws.On("AssignPrivateIPAddresses", &ec2.AssignPrivateIpAddressesInput{
+	return mockAws.On("AssignPrivateIPAddresses", mock.Anything, &ec2.AssignPrivateIpAddressesInput{
 		NetworkInterfaceId:             aws.String(networkInterfaceID),
 		SecondaryPrivateIpAddressCount: aws.Int64(1),
 	}).Return(nil, errors.New("assigning IP for network interface '"+networkInterfaceID+"' failed")).Maybe()
 }
 
+func mockInstanceType(mockAws *mocks.AwsClient, instanceType string, interfaces int64, ipsPerInterface int64) *mock.Call {
+	return mockAws.On("DescribeInstanceTypes", mock.Anything, &ec2.DescribeInstanceTypesInput{
+		InstanceTypes: aws.StringSlice([]string{instanceType}),
+	}).Return(&ec2.DescribeInstanceTypesOutput{
+		InstanceTypes: []*ec2.InstanceTypeInfo{
+			{
+				InstanceType: aws.String(instanceType),
+				NetworkInfo: &ec2.NetworkInfo{
+					MaximumNetworkInterfaces:  aws.Int64(interfaces),
+					Ipv4AddressesPerInterface: aws.Int64(ipsPerInterface),
+				},
+			},
+		},
+	}, nil).Maybe()
+}
+
 func mockAddSpecifiedIPSuccessfully(mockAws *mocks.AwsClient, networkInterfaceID string, ip string) *mock.Call {
-	return mockAws.On("AssignPrivateIPAddresses", &ec2.AssignPrivateIpAddressesInput{
+	return mockAws.On("AssignPrivateIPAddresses", mock.Anything, &ec2.AssignPrivateIpAddressesInput{
 		NetworkInterfaceId: aws.String(networkInterfaceID),
 		PrivateIpAddresses: aws.StringSlice([]string{ip}),
 	}).Return(&ec2.AssignPrivateIpAddressesOutput{
@@ -414,8 +470,21 @@ func mockAddSpecifiedIPSuccessfully(mockAws *mocks.AwsClient, networkInterfaceID
 	}, nil).Maybe()
 }
 
+// mockMoveIPSuccessfully -- AWS reassigns the private ip to the network interface.
+func mockMoveIPSuccessfully(mockAws *mocks.AwsClient, networkInterfaceID string, ip string) *mock.Call {
+	return mockAws.On("AssignPrivateIPAddresses", mock.Anything, &ec2.AssignPrivateIpAddressesInput{
+		NetworkInterfaceId: aws.String(networkInterfaceID),
+		PrivateIpAddresses: aws.StringSlice([]string{ip}),
+		AllowReassignment:  aws.Bool(true),
+	}).Return(&ec2.AssignPrivateIpAddressesOutput{
+		AssignedPrivateIpAddresses: []*ec2.AssignedPrivateIpAddress{
+			{PrivateIpAddress: aws.String(ip)},
+		},
+	}, nil)
+}
+
 func mockAddSpecifiedIPFail(mockAws *mocks.AwsClient, networkInterfaceID string, ip string) *mock.Call {
-	return mockAws.On("AssignPrivateIPAddresses", &ec2.AssignPrivateIpAddressesInput{
+	return mockAws.On("AssignPrivateIPAddresses", mock.Anything, &ec2.AssignPrivateIpAddressesInput{
 		NetworkInterfaceId: aws.String(networkInterfaceID),
 		PrivateIpAddresses: aws.StringSlice([]string{ip}),
 	}).Return(nil, errors.New("assigning IP for network interface '"+networkInterfaceID+"' failed")).Maybe()
@@ -3,6 +3,8 @@
 package mocks
 
 import (
+	context "context"
+
 	ec2 "github.com/aws/aws-sdk-go/service/ec2"
 	mock "github.com/stretchr/testify/mock"
 )
@@ -12,13 +14,59 @@ type AwsClient struct {
 	mock.Mock
 }
 
-// AssignPrivateIPAddresses provides a mock function with given fields: request
-func (_m *AwsClient) AssignPrivateIPAddresses(request *ec2.AssignPrivateIpAddressesInput) (*ec2.AssignPrivateIpAddressesOutput, error) {
-	ret := _m.Called(request)
+// AllocateAddress provides a mock function with given fields: ctx, request
+func (_m *AwsClient) AllocateAddress(ctx context.Context, request *ec2.AllocateAddressInput) (*ec2.AllocateAddressOutput, error) {
+	ret := _m.Called(ctx, request)
+
+	var r0 *ec2.AllocateAddressOutput
+	if rf, ok := ret.Get(0).(func(context.Context, *ec2.AllocateAddressInput) *ec2.AllocateAddressOutput); ok {
+		r0 = rf(ctx, request)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*ec2.AllocateAddressOutput)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *ec2.AllocateAddressInput) error); ok {
+		r1 = rf(ctx, request)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// AssignIPv6Addresses provides a mock function with given fields: ctx, request
+func (_m *AwsClient) AssignIPv6Addresses(ctx context.Context, request *ec2.AssignIpv6AddressesInput) (*ec2.AssignIpv6AddressesOutput, error) {
+	ret := _m.Called(ctx, request)
+
+	var r0 *ec2.AssignIpv6AddressesOutput
+	if rf, ok := ret.Get(0).(func(context.Context, *ec2.AssignIpv6AddressesInput) *ec2.AssignIpv6AddressesOutput); ok {
+		r0 = rf(ctx, request)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*ec2.AssignIpv6AddressesOutput)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *ec2.AssignIpv6AddressesInput) error); ok {
+		r1 = rf(ctx, request)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// AssignPrivateIPAddresses provides a mock function with given fields: ctx, request
+func (_m *AwsClient) AssignPrivateIPAddresses(ctx context.Context, request *ec2.AssignPrivateIpAddressesInput) (*ec2.AssignPrivateIpAddressesOutput, error) {
+	ret := _m.Called(ctx, request)
 
 	var r0 *ec2.AssignPrivateIpAddressesOutput
-	if rf, ok := ret.Get(0).(func(*ec2.AssignPrivateIpAddressesInput) *ec2.AssignPrivateIpAddressesOutput); ok {
-		r0 = rf(request)
+	if rf, ok := ret.Get(0).(func(context.Context, *ec2.AssignPrivateIpAddressesInput) *ec2.AssignPrivateIpAddressesOutput); ok {
+		r0 = rf(ctx, request)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*ec2.AssignPrivateIpAddressesOutput)
@@ -26,8 +74,54 @@ func (_m *AwsClient) AssignPrivateIPAddresses(request *ec2.AssignPrivateIpAddres
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(*ec2.AssignPrivateIpAddressesInput) error); ok {
-		r1 = rf(request)
+	if rf, ok := ret.Get(1).(func(context.Context, *ec2.AssignPrivateIpAddressesInput) error); ok {
+		r1 = rf(ctx, request)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// AssociateAddress provides a mock function with given fields: ctx, request
+func (_m *AwsClient) AssociateAddress(ctx context.Context, request *ec2.AssociateAddressInput) (*ec2.AssociateAddressOutput, error) {
+	ret := _m.Called(ctx, request)
+
+	var r0 *ec2.AssociateAddressOutput
+	if rf, ok := ret.Get(0).(func(context.Context, *ec2.AssociateAddressInput) *ec2.AssociateAddressOutput); ok {
+		r0 = rf(ctx, request)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*ec2.AssociateAddressOutput)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *ec2.AssociateAddressInput) error); ok {
+		r1 = rf(ctx, request)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CreateTags provides a mock function with given fields: ctx, request
+func (_m *AwsClient) CreateTags(ctx context.Context, request *ec2.CreateTagsInput) (*ec2.CreateTagsOutput, error) {
+	ret := _m.Called(ctx, request)
+
+	var r0 *ec2.CreateTagsOutput
+	if rf, ok := ret.Get(0).(func(context.Context, *ec2.CreateTagsInput) *ec2.CreateTagsOutput); ok {
+		r0 = rf(ctx, request)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*ec2.CreateTagsOutput)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *ec2.CreateTagsInput) error); ok {
+		r1 = rf(ctx, request)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -35,13 +129,59 @@ func (_m *AwsClient) AssignPrivateIPAddresses(request *ec2.AssignPrivateIpAddres
 	return r0, r1
 }
 
-// DescribeInstances provides a mock function with given fields: request
-func (_m *AwsClient) DescribeInstances(request *ec2.DescribeInstancesInput) (*ec2.DescribeInstancesOutput, error) {
-	ret := _m.Called(request)
+// DescribeAddresses provides a mock function with given fields: ctx, request
+func (_m *AwsClient) DescribeAddresses(ctx context.Context, request *ec2.DescribeAddressesInput) (*ec2.DescribeAddressesOutput, error) {
+	ret := _m.Called(ctx, request)
+
+	var r0 *ec2.DescribeAddressesOutput
+	if rf, ok := ret.Get(0).(func(context.Context, *ec2.DescribeAddressesInput) *ec2.DescribeAddressesOutput); ok {
+		r0 = rf(ctx, request)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*ec2.DescribeAddressesOutput)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *ec2.DescribeAddressesInput) error); ok {
+		r1 = rf(ctx, request)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DescribeInstanceTypes provides a mock function with given fields: ctx, request
+func (_m *AwsClient) DescribeInstanceTypes(ctx context.Context, request *ec2.DescribeInstanceTypesInput) (*ec2.DescribeInstanceTypesOutput, error) {
+	ret := _m.Called(ctx, request)
+
+	var r0 *ec2.DescribeInstanceTypesOutput
+	if rf, ok := ret.Get(0).(func(context.Context, *ec2.DescribeInstanceTypesInput) *ec2.DescribeInstanceTypesOutput); ok {
+		r0 = rf(ctx, request)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*ec2.DescribeInstanceTypesOutput)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *ec2.DescribeInstanceTypesInput) error); ok {
+		r1 = rf(ctx, request)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DescribeInstances provides a mock function with given fields: ctx, request
+func (_m *AwsClient) DescribeInstances(ctx context.Context, request *ec2.DescribeInstancesInput) (*ec2.DescribeInstancesOutput, error) {
+	ret := _m.Called(ctx, request)
 
 	var r0 *ec2.DescribeInstancesOutput
-	if rf, ok := ret.Get(0).(func(*ec2.DescribeInstancesInput) *ec2.DescribeInstancesOutput); ok {
-		r0 = rf(request)
+	if rf, ok := ret.Get(0).(func(context.Context, *ec2.DescribeInstancesInput) *ec2.DescribeInstancesOutput); ok {
+		r0 = rf(ctx, request)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*ec2.DescribeInstancesOutput)
@@ -49,8 +189,8 @@ func (_m *AwsClient) DescribeInstances(request *ec2.DescribeInstancesInput) (*ec
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(*ec2.DescribeInstancesInput) error); ok {
-		r1 = rf(request)
+	if rf, ok := ret.Get(1).(func(context.Context, *ec2.DescribeInstancesInput) error); ok {
+		r1 = rf(ctx, request)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -58,13 +198,13 @@ func (_m *AwsClient) DescribeInstances(request *ec2.DescribeInstancesInput) (*ec
 	return r0, r1
 }
 
-// DescribeNetworkInterfaces provides a mock function with given fields: request
-func (_m *AwsClient) DescribeNetworkInterfaces(request *ec2.DescribeNetworkInterfacesInput) (*ec2.DescribeNetworkInterfacesOutput, error) {
-	ret := _m.Called(request)
+// DescribeNetworkInterfaces provides a mock function with given fields: ctx, request
+func (_m *AwsClient) DescribeNetworkInterfaces(ctx context.Context, request *ec2.DescribeNetworkInterfacesInput) (*ec2.DescribeNetworkInterfacesOutput, error) {
+	ret := _m.Called(ctx, request)
 
 	var r0 *ec2.DescribeNetworkInterfacesOutput
-	if rf, ok := ret.Get(0).(func(*ec2.DescribeNetworkInterfacesInput) *ec2.DescribeNetworkInterfacesOutput); ok {
-		r0 = rf(request)
+	if rf, ok := ret.Get(0).(func(context.Context, *ec2.DescribeNetworkInterfacesInput) *ec2.DescribeNetworkInterfacesOutput); ok {
+		r0 = rf(ctx, request)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*ec2.DescribeNetworkInterfacesOutput)
@@ -72,8 +212,8 @@ func (_m *AwsClient) DescribeNetworkInterfaces(request *ec2.DescribeNetworkInter
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(*ec2.DescribeNetworkInterfacesInput) error); ok {
-		r1 = rf(request)
+	if rf, ok := ret.Get(1).(func(context.Context, *ec2.DescribeNetworkInterfacesInput) error); ok {
+		r1 = rf(ctx, request)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -81,13 +221,13 @@ func (_m *AwsClient) DescribeNetworkInterfaces(request *ec2.DescribeNetworkInter
 	return r0, r1
 }
 
-// DescribeSubnets provides a mock function with given fields: request
-func (_m *AwsClient) DescribeSubnets(request *ec2.DescribeSubnetsInput) (*ec2.DescribeSubnetsOutput, error) {
-	ret := _m.Called(request)
+// DescribeSubnets provides a mock function with given fields: ctx, request
+func (_m *AwsClient) DescribeSubnets(ctx context.Context, request *ec2.DescribeSubnetsInput) (*ec2.DescribeSubnetsOutput, error) {
+	ret := _m.Called(ctx, request)
 
 	var r0 *ec2.DescribeSubnetsOutput
-	if rf, ok := ret.Get(0).(func(*ec2.DescribeSubnetsInput) *ec2.DescribeSubnetsOutput); ok {
-		r0 = rf(request)
+	if rf, ok := ret.Get(0).(func(context.Context, *ec2.DescribeSubnetsInput) *ec2.DescribeSubnetsOutput); ok {
+		r0 = rf(ctx, request)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*ec2.DescribeSubnetsOutput)
@@ -95,8 +235,31 @@ func (_m *AwsClient) DescribeSubnets(request *ec2.DescribeSubnetsInput) (*ec2.De
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(*ec2.DescribeSubnetsInput) error); ok {
-		r1 = rf(request)
+	if rf, ok := ret.Get(1).(func(context.Context, *ec2.DescribeSubnetsInput) error); ok {
+		r1 = rf(ctx, request)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DisassociateAddress provides a mock function with given fields: ctx, request
+func (_m *AwsClient) DisassociateAddress(ctx context.Context, request *ec2.DisassociateAddressInput) (*ec2.DisassociateAddressOutput, error) {
+	ret := _m.Called(ctx, request)
+
+	var r0 *ec2.DisassociateAddressOutput
+	if rf, ok := ret.Get(0).(func(context.Context, *ec2.DisassociateAddressInput) *ec2.DisassociateAddressOutput); ok {
+		r0 = rf(ctx, request)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*ec2.DisassociateAddressOutput)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *ec2.DisassociateAddressInput) error); ok {
+		r1 = rf(ctx, request)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -118,13 +281,59 @@ func (_m *AwsClient) GetRegion() string {
 	return r0
 }
 
-// UnassignPrivateIPAddresses provides a mock function with given fields: request
-func (_m *AwsClient) UnassignPrivateIPAddresses(request *ec2.UnassignPrivateIpAddressesInput) (*ec2.UnassignPrivateIpAddressesOutput, error) {
-	ret := _m.Called(request)
+// ReleaseAddress provides a mock function with given fields: ctx, request
+func (_m *AwsClient) ReleaseAddress(ctx context.Context, request *ec2.ReleaseAddressInput) (*ec2.ReleaseAddressOutput, error) {
+	ret := _m.Called(ctx, request)
+
+	var r0 *ec2.ReleaseAddressOutput
+	if rf, ok := ret.Get(0).(func(context.Context, *ec2.ReleaseAddressInput) *ec2.ReleaseAddressOutput); ok {
+		r0 = rf(ctx, request)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*ec2.ReleaseAddressOutput)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *ec2.ReleaseAddressInput) error); ok {
+		r1 = rf(ctx, request)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UnassignIPv6Addresses provides a mock function with given fields: ctx, request
+func (_m *AwsClient) UnassignIPv6Addresses(ctx context.Context, request *ec2.UnassignIpv6AddressesInput) (*ec2.UnassignIpv6AddressesOutput, error) {
+	ret := _m.Called(ctx, request)
+
+	var r0 *ec2.UnassignIpv6AddressesOutput
+	if rf, ok := ret.Get(0).(func(context.Context, *ec2.UnassignIpv6AddressesInput) *ec2.UnassignIpv6AddressesOutput); ok {
+		r0 = rf(ctx, request)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*ec2.UnassignIpv6AddressesOutput)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *ec2.UnassignIpv6AddressesInput) error); ok {
+		r1 = rf(ctx, request)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UnassignPrivateIPAddresses provides a mock function with given fields: ctx, request
+func (_m *AwsClient) UnassignPrivateIPAddresses(ctx context.Context, request *ec2.UnassignPrivateIpAddressesInput) (*ec2.UnassignPrivateIpAddressesOutput, error) {
+	ret := _m.Called(ctx, request)
 
 	var r0 *ec2.UnassignPrivateIpAddressesOutput
-	if rf, ok := ret.Get(0).(func(*ec2.UnassignPrivateIpAddressesInput) *ec2.UnassignPrivateIpAddressesOutput); ok {
-		r0 = rf(request)
+	if rf, ok := ret.Get(0).(func(context.Context, *ec2.UnassignPrivateIpAddressesInput) *ec2.UnassignPrivateIpAddressesOutput); ok {
+		r0 = rf(ctx, request)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*ec2.UnassignPrivateIpAddressesOutput)
@@ -132,8 +341,8 @@ func (_m *AwsClient) UnassignPrivateIPAddresses(request *ec2.UnassignPrivateIpAd
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(*ec2.UnassignPrivateIpAddressesInput) error); ok {
-		r1 = rf(request)
+	if rf, ok := ret.Get(1).(func(context.Context, *ec2.UnassignPrivateIpAddressesInput) error); ok {
+		r1 = rf(ctx, request)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -3,9 +3,10 @@
 package mocks
 
 import (
-	net "net"
-
+	cloudprovider "github.com/klenkes74/aws-egressip-operator/pkg/cloudprovider"
 	mock "github.com/stretchr/testify/mock"
+
+	net "net"
 )
 
 // CloudInstance is an autogenerated mock type for the CloudInstance type
@@ -83,6 +84,22 @@ func (_m *CloudInstance) NetworkInterface() string {
 	return r0
 }
 
+// NetworkInterfaces provides a mock function with given fields:
+func (_m *CloudInstance) NetworkInterfaces() []cloudprovider.CloudNetworkInterface {
+	ret := _m.Called()
+
+	var r0 []cloudprovider.CloudNetworkInterface
+	if rf, ok := ret.Get(0).(func() []cloudprovider.CloudNetworkInterface); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]cloudprovider.CloudNetworkInterface)
+		}
+	}
+
+	return r0
+}
+
 // PrimaryIP provides a mock function with given fields:
 func (_m *CloudInstance) PrimaryIP() *net.IP {
 	ret := _m.Called()
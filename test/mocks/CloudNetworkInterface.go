@@ -0,0 +1,116 @@
+// Code generated by mockery v1.0.0. DO NOT EDIT.
+
+package mocks
+
+import (
+	net "net"
+
+	mock "github.com/stretchr/testify/mock"
+)
+
+// CloudNetworkInterface is an autogenerated mock type for the CloudNetworkInterface type
+type CloudNetworkInterface struct {
+	mock.Mock
+}
+
+// DeviceIndex provides a mock function with given fields:
+func (_m *CloudNetworkInterface) DeviceIndex() int {
+	ret := _m.Called()
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func() int); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	return r0
+}
+
+// ID provides a mock function with given fields:
+func (_m *CloudNetworkInterface) ID() string {
+	ret := _m.Called()
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func() string); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	return r0
+}
+
+// IPCapacity provides a mock function with given fields:
+func (_m *CloudNetworkInterface) IPCapacity() int {
+	ret := _m.Called()
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func() int); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	return r0
+}
+
+// IPCount provides a mock function with given fields:
+func (_m *CloudNetworkInterface) IPCount() int {
+	ret := _m.Called()
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func() int); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	return r0
+}
+
+// Network provides a mock function with given fields:
+func (_m *CloudNetworkInterface) Network() string {
+	ret := _m.Called()
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func() string); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	return r0
+}
+
+// PrimaryIP provides a mock function with given fields:
+func (_m *CloudNetworkInterface) PrimaryIP() *net.IP {
+	ret := _m.Called()
+
+	var r0 *net.IP
+	if rf, ok := ret.Get(0).(func() *net.IP); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*net.IP)
+		}
+	}
+
+	return r0
+}
+
+// SecondaryIps provides a mock function with given fields:
+func (_m *CloudNetworkInterface) SecondaryIps() []*net.IP {
+	ret := _m.Called()
+
+	var r0 []*net.IP
+	if rf, ok := ret.Get(0).(func() []*net.IP); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*net.IP)
+		}
+	}
+
+	return r0
+}
@@ -3,6 +3,8 @@
 package mocks
 
 import (
+	context "context"
+
 	cloudprovider "github.com/klenkes74/aws-egressip-operator/pkg/cloudprovider"
 	mock "github.com/stretchr/testify/mock"
 
@@ -14,13 +16,13 @@ type CloudProvider struct {
 	mock.Mock
 }
 
-// AddRandomIPs provides a mock function with given fields:
-func (_m *CloudProvider) AddRandomIPs() ([]string, []*net.IP, error) {
-	ret := _m.Called()
+// AddRandomIPs provides a mock function with given fields: ctx, request
+func (_m *CloudProvider) AddRandomIPs(ctx context.Context, request cloudprovider.IPRequest) ([]string, []*net.IP, error) {
+	ret := _m.Called(ctx, request)
 
 	var r0 []string
-	if rf, ok := ret.Get(0).(func() []string); ok {
-		r0 = rf()
+	if rf, ok := ret.Get(0).(func(context.Context, cloudprovider.IPRequest) []string); ok {
+		r0 = rf(ctx, request)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]string)
@@ -28,8 +30,8 @@ func (_m *CloudProvider) AddRandomIPs() ([]string, []*net.IP, error) {
 	}
 
 	var r1 []*net.IP
-	if rf, ok := ret.Get(1).(func() []*net.IP); ok {
-		r1 = rf()
+	if rf, ok := ret.Get(1).(func(context.Context, cloudprovider.IPRequest) []*net.IP); ok {
+		r1 = rf(ctx, request)
 	} else {
 		if ret.Get(1) != nil {
 			r1 = ret.Get(1).([]*net.IP)
@@ -37,8 +39,8 @@ func (_m *CloudProvider) AddRandomIPs() ([]string, []*net.IP, error) {
 	}
 
 	var r2 error
-	if rf, ok := ret.Get(2).(func() error); ok {
-		r2 = rf()
+	if rf, ok := ret.Get(2).(func(context.Context, cloudprovider.IPRequest) error); ok {
+		r2 = rf(ctx, request)
 	} else {
 		r2 = ret.Error(2)
 	}
@@ -46,13 +48,13 @@ func (_m *CloudProvider) AddRandomIPs() ([]string, []*net.IP, error) {
 	return r0, r1, r2
 }
 
-// AddSpecifiedIPs provides a mock function with given fields: ips
-func (_m *CloudProvider) AddSpecifiedIPs(ips []*net.IP) ([]string, error) {
-	ret := _m.Called(ips)
+// AddSpecifiedIPs provides a mock function with given fields: ctx, request, ips
+func (_m *CloudProvider) AddSpecifiedIPs(ctx context.Context, request cloudprovider.IPRequest, ips []*net.IP) ([]string, error) {
+	ret := _m.Called(ctx, request, ips)
 
 	var r0 []string
-	if rf, ok := ret.Get(0).(func([]*net.IP) []string); ok {
-		r0 = rf(ips)
+	if rf, ok := ret.Get(0).(func(context.Context, cloudprovider.IPRequest, []*net.IP) []string); ok {
+		r0 = rf(ctx, request, ips)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]string)
@@ -60,8 +62,31 @@ func (_m *CloudProvider) AddSpecifiedIPs(ips []*net.IP) ([]string, error) {
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func([]*net.IP) error); ok {
-		r1 = rf(ips)
+	if rf, ok := ret.Get(1).(func(context.Context, cloudprovider.IPRequest, []*net.IP) error); ok {
+		r1 = rf(ctx, request, ips)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// AssociatePublicIP provides a mock function with given fields: ctx, request, ip
+func (_m *CloudProvider) AssociatePublicIP(ctx context.Context, request cloudprovider.IPRequest, ip *net.IP) (*net.IP, error) {
+	ret := _m.Called(ctx, request, ip)
+
+	var r0 *net.IP
+	if rf, ok := ret.Get(0).(func(context.Context, cloudprovider.IPRequest, *net.IP) *net.IP); ok {
+		r0 = rf(ctx, request, ip)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*net.IP)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, cloudprovider.IPRequest, *net.IP) error); ok {
+		r1 = rf(ctx, request, ip)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -90,13 +115,43 @@ func (_m *CloudProvider) ClusterTag() (string, string) {
 	return r0, r1
 }
 
-// Instance provides a mock function with given fields: instanceID
-func (_m *CloudProvider) Instance(instanceID string) (*cloudprovider.CloudInstance, error) {
-	ret := _m.Called(instanceID)
+// FailoverIP provides a mock function with given fields: ctx, request, ip
+func (_m *CloudProvider) FailoverIP(ctx context.Context, request cloudprovider.IPRequest, ip *net.IP) (string, *net.IP, error) {
+	ret := _m.Called(ctx, request, ip)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(context.Context, cloudprovider.IPRequest, *net.IP) string); ok {
+		r0 = rf(ctx, request, ip)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 *net.IP
+	if rf, ok := ret.Get(1).(func(context.Context, cloudprovider.IPRequest, *net.IP) *net.IP); ok {
+		r1 = rf(ctx, request, ip)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*net.IP)
+		}
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, cloudprovider.IPRequest, *net.IP) error); ok {
+		r2 = rf(ctx, request, ip)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// Instance provides a mock function with given fields: ctx, instanceID
+func (_m *CloudProvider) Instance(ctx context.Context, instanceID string) (*cloudprovider.CloudInstance, error) {
+	ret := _m.Called(ctx, instanceID)
 
 	var r0 *cloudprovider.CloudInstance
-	if rf, ok := ret.Get(0).(func(string) *cloudprovider.CloudInstance); ok {
-		r0 = rf(instanceID)
+	if rf, ok := ret.Get(0).(func(context.Context, string) *cloudprovider.CloudInstance); ok {
+		r0 = rf(ctx, instanceID)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*cloudprovider.CloudInstance)
@@ -104,8 +159,8 @@ func (_m *CloudProvider) Instance(instanceID string) (*cloudprovider.CloudInstan
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(string) error); ok {
-		r1 = rf(instanceID)
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, instanceID)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -113,13 +168,13 @@ func (_m *CloudProvider) Instance(instanceID string) (*cloudprovider.CloudInstan
 	return r0, r1
 }
 
-// InstanceByHostName provides a mock function with given fields: hostname
-func (_m *CloudProvider) InstanceByHostName(hostname string) (*cloudprovider.CloudInstance, error) {
-	ret := _m.Called(hostname)
+// InstanceByHostName provides a mock function with given fields: ctx, hostname
+func (_m *CloudProvider) InstanceByHostName(ctx context.Context, hostname string) (*cloudprovider.CloudInstance, error) {
+	ret := _m.Called(ctx, hostname)
 
 	var r0 *cloudprovider.CloudInstance
-	if rf, ok := ret.Get(0).(func(string) *cloudprovider.CloudInstance); ok {
-		r0 = rf(hostname)
+	if rf, ok := ret.Get(0).(func(context.Context, string) *cloudprovider.CloudInstance); ok {
+		r0 = rf(ctx, hostname)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*cloudprovider.CloudInstance)
@@ -127,8 +182,29 @@ func (_m *CloudProvider) InstanceByHostName(hostname string) (*cloudprovider.Clo
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(string) error); ok {
-		r1 = rf(hostname)
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, hostname)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// InstanceGone provides a mock function with given fields: ctx, hostname
+func (_m *CloudProvider) InstanceGone(ctx context.Context, hostname string) (bool, error) {
+	ret := _m.Called(ctx, hostname)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(context.Context, string) bool); ok {
+		r0 = rf(ctx, hostname)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, hostname)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -136,20 +212,71 @@ func (_m *CloudProvider) InstanceByHostName(hostname string) (*cloudprovider.Clo
 	return r0, r1
 }
 
-// RemoveIP provides a mock function with given fields: ip
-func (_m *CloudProvider) RemoveIP(ip *net.IP) (string, error) {
-	ret := _m.Called(ip)
+// MoveIP provides a mock function with given fields: ctx, request, ip
+func (_m *CloudProvider) MoveIP(ctx context.Context, request cloudprovider.IPRequest, ip *net.IP) (string, error) {
+	ret := _m.Called(ctx, request, ip)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(context.Context, cloudprovider.IPRequest, *net.IP) string); ok {
+		r0 = rf(ctx, request, ip)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, cloudprovider.IPRequest, *net.IP) error); ok {
+		r1 = rf(ctx, request, ip)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ReclaimIP provides a mock function with given fields: ctx, request, ip
+func (_m *CloudProvider) ReclaimIP(ctx context.Context, request cloudprovider.IPRequest, ip *net.IP) (string, *net.IP, error) {
+	ret := _m.Called(ctx, request, ip)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(context.Context, cloudprovider.IPRequest, *net.IP) string); ok {
+		r0 = rf(ctx, request, ip)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 *net.IP
+	if rf, ok := ret.Get(1).(func(context.Context, cloudprovider.IPRequest, *net.IP) *net.IP); ok {
+		r1 = rf(ctx, request, ip)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*net.IP)
+		}
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, cloudprovider.IPRequest, *net.IP) error); ok {
+		r2 = rf(ctx, request, ip)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// RemoveIP provides a mock function with given fields: ctx, ip
+func (_m *CloudProvider) RemoveIP(ctx context.Context, ip *net.IP) (string, error) {
+	ret := _m.Called(ctx, ip)
 
 	var r0 string
-	if rf, ok := ret.Get(0).(func(*net.IP) string); ok {
-		r0 = rf(ip)
+	if rf, ok := ret.Get(0).(func(context.Context, *net.IP) string); ok {
+		r0 = rf(ctx, ip)
 	} else {
 		r0 = ret.Get(0).(string)
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(*net.IP) error); ok {
-		r1 = rf(ip)
+	if rf, ok := ret.Get(1).(func(context.Context, *net.IP) error); ok {
+		r1 = rf(ctx, ip)
 	} else {
 		r1 = ret.Error(1)
 	}
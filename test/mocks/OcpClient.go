@@ -33,6 +33,27 @@ func (_m *OcpClient) Get(ctx context.Context, key types.NamespacedName, obj runt
 	return r0
 }
 
+// List provides a mock function with given fields: ctx, list, opts
+func (_m *OcpClient) List(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, list)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, runtime.Object, ...client.ListOption) error); ok {
+		r0 = rf(ctx, list, opts...)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // Update provides a mock function with given fields: ctx, obj, opts
 func (_m *OcpClient) Update(ctx context.Context, obj runtime.Object, opts ...client.UpdateOption) error {
 	_va := make([]interface{}, len(opts))
@@ -53,3 +74,17 @@ func (_m *OcpClient) Update(ctx context.Context, obj runtime.Object, opts ...cli
 
 	return r0
 }
+
+// UpdateStatus provides a mock function with given fields: ctx, obj
+func (_m *OcpClient) UpdateStatus(ctx context.Context, obj runtime.Object) error {
+	ret := _m.Called(ctx, obj)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, runtime.Object) error); ok {
+		r0 = rf(ctx, obj)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
@@ -0,0 +1,43 @@
+// Code generated by mockery v1.0.0. DO NOT EDIT.
+
+package mocks
+
+import (
+	cloudprovider "github.com/klenkes74/aws-egressip-operator/pkg/cloudprovider"
+	mock "github.com/stretchr/testify/mock"
+)
+
+// PlacementStrategy is an autogenerated mock type for the PlacementStrategy type
+type PlacementStrategy struct {
+	mock.Mock
+}
+
+// Name provides a mock function with given fields:
+func (_m *PlacementStrategy) Name() string {
+	ret := _m.Called()
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func() string); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	return r0
+}
+
+// Order provides a mock function with given fields: request, network, candidates
+func (_m *PlacementStrategy) Order(request cloudprovider.IPRequest, network string, candidates []cloudprovider.PlacementCandidate) []cloudprovider.PlacementCandidate {
+	ret := _m.Called(request, network, candidates)
+
+	var r0 []cloudprovider.PlacementCandidate
+	if rf, ok := ret.Get(0).(func(cloudprovider.IPRequest, string, []cloudprovider.PlacementCandidate) []cloudprovider.PlacementCandidate); ok {
+		r0 = rf(request, network, candidates)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]cloudprovider.PlacementCandidate)
+		}
+	}
+
+	return r0
+}
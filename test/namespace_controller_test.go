@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"github.com/klenkes74/aws-egressip-operator/pkg/controller/namespace"
+	"github.com/klenkes74/aws-egressip-operator/pkg/openshift"
+	"github.com/klenkes74/aws-egressip-operator/test/mocks"
+	"github.com/redhat-cop/egressip-ipam-operator/pkg/controller/egressipam"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"net"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"testing"
+)
+
+// mockNamespaceStore -- the api server returns the namespace and keeps it when it is saved.
+func mockNamespaceStore(mockOcp *mocks.OcpClient, stored *corev1.Namespace) {
+	mockOcp.On("Get", mock.Anything, types.NamespacedName{Name: stored.Name}, mock.AnythingOfType("*v1.Namespace")).
+		Run(func(args mock.Arguments) {
+			*args.Get(2).(*corev1.Namespace) = *stored.DeepCopy()
+		}).
+		Return(nil)
+	mockOcp.On("Update", mock.Anything, mock.AnythingOfType("*v1.Namespace")).
+		Run(func(args mock.Arguments) {
+			*stored = *args.Get(1).(*corev1.Namespace).DeepCopy()
+		}).
+		Return(nil)
+}
+
+// reconcileNamespace -- reconciles the namespace with a handler working on the mocked cloud and api server.
+func reconcileNamespace(cloud *mocks.CloudProvider, mockOcp *mocks.OcpClient, name string) error {
+	r := namespace.NewReconciler(*openshift.NewEgressIPHandler(cloud, mockOcp), record.NewFakeRecorder(10))
+
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Name: name}})
+	return err
+}
+
+func TestReconcileNamespaceSavesIPsKeptByPartialAssignment(t *testing.T) {
+	defer withEnvironment(map[string]string{"IP_ASSIGNMENT_MODE": "partial"})()
+
+	cloud := &mocks.CloudProvider{}
+	mockOcp := &mocks.OcpClient{}
+
+	mockPartialRandomAssignment(cloud)
+	mockCloudInstance(cloud, "vm-1", "host-1")
+	mockCloudInstance(cloud, "vm-2", "host-2")
+	store := map[string][]string{}
+	mockHostSubnetStore(mockOcp, store)
+
+	stored := defaultNamespace()
+	mockNamespaceStore(mockOcp, stored)
+	netNamespace := mockNetNamespace(mockOcp, stored.Name)
+
+	err := reconcileNamespace(cloud, mockOcp, stored.Name)
+
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "no capacity in zone")
+	}
+	assert.Equal(t, "1.1.1.11,1.1.2.22", stored.Annotations[egressipam.NamespaceAssociationAnnotation])
+	assert.Contains(t, stored.Finalizers, "egressip-ipam-operator.redhat-cop.io/namespace-handler")
+	assert.Empty(t, stored.Annotations[openshift.IntentAnnotation])
+	assert.Equal(t, "1.1.1.11,1.1.2.22", netNamespace.Annotations[egressipam.NamespaceAssociationAnnotation])
+	assert.Equal(t, []string{"1.1.1.11"}, store["host-1"])
+	assert.Equal(t, []string{"1.1.2.22"}, store["host-2"])
+	cloud.AssertNotCalled(t, "RemoveIP", mock.Anything, mock.Anything)
+}
+
+func TestReconcileNamespaceSavesNoIPsWithoutKeptIPs(t *testing.T) {
+	defer withEnvironment(map[string]string{"IP_ASSIGNMENT_MODE": "partial"})()
+
+	cloud := &mocks.CloudProvider{}
+	mockOcp := &mocks.OcpClient{}
+
+	cloud.On("AddRandomIPs", mock.Anything, mock.Anything).
+		Return([]string{"", ""}, []*net.IP{nil, nil}, errors.New("no capacity in zone")).
+		Once()
+
+	stored := defaultNamespace()
+	mockNamespaceStore(mockOcp, stored)
+	mockNetNamespace(mockOcp, stored.Name)
+
+	err := reconcileNamespace(cloud, mockOcp, stored.Name)
+
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "no capacity in zone")
+	}
+	assert.NotContains(t, stored.Annotations, egressipam.NamespaceAssociationAnnotation)
+	assert.Empty(t, stored.Annotations[openshift.IntentAnnotation])
+	mockOcp.AssertNotCalled(t, "Update", mock.Anything, mock.AnythingOfType("*v1.NetNamespace"))
+}
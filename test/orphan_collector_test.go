@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/klenkes74/aws-egressip-operator/pkg/cloudprovider"
+	"github.com/klenkes74/aws-egressip-operator/pkg/openshift"
+	"github.com/klenkes74/aws-egressip-operator/test/mocks"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+	"time"
+)
+
+// createCloudWithOrphans -- the mock cloud carrying 1.1.1.4 (seeded) on vm-1 and the additional IPs.
+func createCloudWithOrphans(t *testing.T, ips ...string) cloudprovider.CloudProvider {
+	cloud := createMockCloudProvider(t)
+
+	_, err := cloud.AddSpecifiedIPs(context.TODO(), cloudprovider.IPRequest{}, defaultIPs(ips...))
+	if err != nil {
+		t.Fatalf("can't add the ips to the mock cloud: %v", err)
+	}
+
+	return cloud
+}
+
+func secondaryIPsOfCloud(t *testing.T, cloud cloudprovider.CloudProvider) []string {
+	nodes, err := cloud.(cloudprovider.EgressNodeLister).EgressNodes(context.TODO())
+	if err != nil {
+		t.Fatalf("can't list the egress nodes of the mock cloud: %v", err)
+	}
+
+	result := make([]string, 0)
+	for _, node := range nodes {
+		for _, ip := range (*node).SecondaryIps() {
+			result = append(result, ip.String())
+		}
+	}
+	return result
+}
+
+func TestFindOrphanedIPsReturnsUnreferencedSecondaryIPs(t *testing.T) {
+	cloud := createCloudWithOrphans(t, "1.1.1.5", "1.1.2.5")
+	mockOcp := &mocks.OcpClient{}
+
+	hostSubnet := defaultHostSubnet("ip-1-1-1-34.my-local.inf", "1.1.1.34")
+	hostSubnet.Annotations[openshift.IPToNamespaceAnnotation+"1.1.1.5"] = "default-test"
+	mockEgressIPSources(mockOcp,
+		map[string]string{"default-test": "1.1.1.4"},
+		map[string][]string{},
+		hostSubnet,
+	)
+
+	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
+	orphans, err := service.FindOrphanedIPs(context.TODO())
+
+	assert.Nil(t, err)
+	assert.Equal(t, []openshift.OrphanedIP{
+		{IP: "1.1.2.5", Instance: "vm-2", HostName: "ip-1-1-2-75.my-local.inf"},
+	}, orphans)
+}
+
+func TestFindOrphanedIPsNeedsEgressNodeLister(t *testing.T) {
+	cloud := &mocks.CloudProvider{}
+	mockOcp := &mocks.OcpClient{}
+
+	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
+	_, err := service.FindOrphanedIPs(context.TODO())
+
+	assert.NotNil(t, err)
+}
+
+func TestOrphanCollectorReportsOnlyInReportMode(t *testing.T) {
+	cloud := createCloudWithOrphans(t, "1.1.2.5")
+	mockOcp := &mocks.OcpClient{}
+	mockEgressIPSources(mockOcp, map[string]string{}, map[string][]string{})
+
+	handler := *openshift.NewEgressIPHandler(cloud, mockOcp)
+	collector := openshift.NewOrphanCollector(handler, openshift.OrphanCollectorReport, time.Minute, 0, nil)
+	due, err := collector.Collect(context.TODO())
+
+	assert.Nil(t, err)
+	assert.Len(t, due, 2)
+	assert.ElementsMatch(t, []string{"1.1.1.4", "1.1.2.5"}, secondaryIPsOfCloud(t, cloud))
+}
+
+func TestOrphanCollectorRemovesDueIPsExceptExcluded(t *testing.T) {
+	cloud := createCloudWithOrphans(t, "1.1.1.5", "1.1.2.5")
+	mockOcp := &mocks.OcpClient{}
+	mockEgressIPSources(mockOcp,
+		map[string]string{"default-test": "1.1.1.4"},
+		map[string][]string{"default-test": {"1.1.1.4"}},
+	)
+
+	exclusions, err := openshift.ParseIPExclusions("1.1.2.0/28")
+	assert.Nil(t, err)
+
+	handler := *openshift.NewEgressIPHandler(cloud, mockOcp)
+	collector := openshift.NewOrphanCollector(handler, openshift.OrphanCollectorRemove, time.Minute, 0, exclusions)
+	due, err := collector.Collect(context.TODO())
+
+	assert.Nil(t, err)
+	assert.Equal(t, []openshift.OrphanedIP{
+		{IP: "1.1.1.5", Instance: "vm-1", HostName: "ip-1-1-1-34.my-local.inf"},
+	}, due)
+	assert.ElementsMatch(t, []string{"1.1.1.4", "1.1.2.5"}, secondaryIPsOfCloud(t, cloud))
+}
+
+func TestOrphanCollectorWaitsForGracePeriod(t *testing.T) {
+	cloud := createCloudWithOrphans(t, "1.1.2.5")
+	mockOcp := &mocks.OcpClient{}
+	mockEgressIPSources(mockOcp, map[string]string{"default-test": "1.1.1.4"}, map[string][]string{})
+
+	handler := *openshift.NewEgressIPHandler(cloud, mockOcp)
+	collector := openshift.NewOrphanCollector(handler, openshift.OrphanCollectorRemove, time.Minute, time.Hour, nil)
+
+	for i := 0; i < 2; i++ {
+		due, err := collector.Collect(context.TODO())
+
+		assert.Nil(t, err)
+		assert.Empty(t, due)
+	}
+	assert.ElementsMatch(t, []string{"1.1.1.4", "1.1.2.5"}, secondaryIPsOfCloud(t, cloud))
+}
+
+func TestParseIPExclusions(t *testing.T) {
+	exclusions, err := openshift.ParseIPExclusions(" 10.0.1.5, 10.0.2.0/28,,fd00::1 ")
+
+	assert.Nil(t, err)
+	if assert.Len(t, exclusions, 3) {
+		assert.True(t, exclusions[0].Contains(net.ParseIP("10.0.1.5")))
+		assert.False(t, exclusions[0].Contains(net.ParseIP("10.0.1.6")))
+		assert.True(t, exclusions[1].Contains(net.ParseIP("10.0.2.15")))
+		assert.False(t, exclusions[1].Contains(net.ParseIP("10.0.2.16")))
+		assert.True(t, exclusions[2].Contains(net.ParseIP("fd00::1")))
+	}
+
+	_, err = openshift.ParseIPExclusions("10.0.1.500")
+	assert.NotNil(t, err)
+
+	mode, err := openshift.ParseOrphanCollectorMode(" Remove ")
+	assert.Nil(t, err)
+	assert.Equal(t, openshift.OrphanCollectorRemove, mode)
+
+	mode, err = openshift.ParseOrphanCollectorMode("delete")
+	assert.NotNil(t, err)
+	assert.Equal(t, openshift.OrphanCollectorReport, mode)
+}
+
+func TestAwsEgressNodesSkipsInstancesNotSelected(t *testing.T) {
+	original := instances
+	defer func() { instances = original }()
+
+	disabled := createInstance("vm-1", "1.1.1.34", "nice-a", "ip-1-1-1-34.my-local.inf", "subnet-1")
+	disabled.Tags = append(disabled.Tags, &ec2.Tag{Key: aws.String("egress-disabled"), Value: aws.String("true")})
+	instances = map[string]*ec2.Instance{
+		"vm-1": disabled,
+		"vm-2": createInstance("vm-2", "1.1.1.93", "nice-a", "ip-1-1-1-93.my-local.inf", "subnet-1", "1.1.1.11"),
+	}
+
+	mockAws := &mocks.AwsClient{}
+	mockDefaultInstanceAwsCalls(mockAws)
+	mockDefaultSubnetAwsCalls(mockAws)
+
+	nodeSelector, _ := cloudprovider.ParseTagSelector("!egress-disabled")
+	service := createAwsCloudProvider(mockAws, func(config *cloudprovider.AwsConfig) {
+		config.NodeSelector = nodeSelector
+	})
+
+	nodes, err := cloudprovider.CloudProvider(service).(cloudprovider.EgressNodeLister).EgressNodes(context.TODO())
+
+	assert.Nil(t, err)
+	if assert.Len(t, nodes, 1) {
+		assert.Equal(t, "vm-2", (*nodes[0]).ID())
+		assert.Equal(t, defaultIPs("1.1.1.11"), (*nodes[0]).SecondaryIps())
+	}
+}
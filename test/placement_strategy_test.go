@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"github.com/klenkes74/aws-egressip-operator/pkg/cloudprovider"
+	"github.com/klenkes74/aws-egressip-operator/test/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"testing"
+)
+
+var placementCandidates = []cloudprovider.PlacementCandidate{
+	{InstanceID: "vm-2", InterfaceID: "eni-2", InstanceType: "m5.xlarge", IPCount: 4, IPCapacity: 15},
+	{InstanceID: "vm-1", InterfaceID: "eni-1", InstanceType: "m5.large", IPCount: 3, IPCapacity: 10},
+	{InstanceID: "vm-3", InterfaceID: "eni-3", InstanceType: "m5.large", IPCount: 5, IPCapacity: 10},
+}
+
+func interfaceIDs(candidates []cloudprovider.PlacementCandidate) []string {
+	result := make([]string, len(candidates))
+	for i, candidate := range candidates {
+		result[i] = candidate.InterfaceID
+	}
+	return result
+}
+
+func TestPlacementStrategyByName(t *testing.T) {
+	for _, name := range []string{
+		cloudprovider.LeastLoadedPlacement,
+		cloudprovider.RoundRobinPlacement,
+		cloudprovider.NamespaceHashPlacement,
+		cloudprovider.WeightedPlacement,
+	} {
+		strategy, err := cloudprovider.NewPlacementStrategy(name)
+
+		assert.Nil(t, err)
+		assert.Equal(t, name, strategy.Name())
+	}
+
+	strategy, err := cloudprovider.NewPlacementStrategy("")
+	assert.Nil(t, err)
+	assert.Equal(t, cloudprovider.LeastLoadedPlacement, strategy.Name())
+
+	_, err = cloudprovider.NewPlacementStrategy("random")
+	assert.NotNil(t, err)
+}
+
+func TestLeastLoadedPlacement(t *testing.T) {
+	strategy := &cloudprovider.LeastLoadedStrategy{}
+
+	result := strategy.Order(cloudprovider.IPRequest{}, "subnet-1", placementCandidates)
+
+	assert.Equal(t, []string{"eni-1", "eni-2", "eni-3"}, interfaceIDs(result))
+	assert.Equal(t, "eni-2", placementCandidates[0].InterfaceID, "the candidates of the caller must not be reordered")
+}
+
+func TestRoundRobinPlacement(t *testing.T) {
+	strategy := &cloudprovider.RoundRobinStrategy{}
+
+	first := strategy.Order(cloudprovider.IPRequest{}, "subnet-1", placementCandidates)
+	second := strategy.Order(cloudprovider.IPRequest{}, "subnet-1", placementCandidates)
+	other := strategy.Order(cloudprovider.IPRequest{}, "subnet-2", placementCandidates)
+	third := strategy.Order(cloudprovider.IPRequest{}, "subnet-1", placementCandidates)
+	fourth := strategy.Order(cloudprovider.IPRequest{}, "subnet-1", placementCandidates)
+
+	assert.Equal(t, []string{"eni-1", "eni-2", "eni-3"}, interfaceIDs(first))
+	assert.Equal(t, []string{"eni-2", "eni-3", "eni-1"}, interfaceIDs(second))
+	assert.Equal(t, []string{"eni-1", "eni-2", "eni-3"}, interfaceIDs(other))
+	assert.Equal(t, []string{"eni-3", "eni-1", "eni-2"}, interfaceIDs(third))
+	assert.Equal(t, []string{"eni-1", "eni-2", "eni-3"}, interfaceIDs(fourth))
+}
+
+func TestNamespaceHashPlacementIsStable(t *testing.T) {
+	strategy := &cloudprovider.NamespaceHashStrategy{}
+	request := cloudprovider.IPRequest{Namespace: "my-namespace"}
+
+	result := strategy.Order(request, "subnet-1", placementCandidates)
+	assert.Len(t, result, 3)
+
+	// the order of the input and the load of the interfaces must not change the placement
+	reversed := []cloudprovider.PlacementCandidate{placementCandidates[2], placementCandidates[1], placementCandidates[0]}
+	reversed[0].IPCount = 9
+	assert.Equal(t, interfaceIDs(result), interfaceIDs(strategy.Order(request, "subnet-1", reversed)))
+
+	// removing an interface not chosen keeps the namespace on its interface
+	remaining := make([]cloudprovider.PlacementCandidate, 0)
+	for _, candidate := range placementCandidates {
+		if candidate.InterfaceID != result[2].InterfaceID {
+			remaining = append(remaining, candidate)
+		}
+	}
+	assert.Equal(t, result[0].InterfaceID, strategy.Order(request, "subnet-1", remaining)[0].InterfaceID)
+}
+
+func TestNamespaceHashPlacementWithoutNamespace(t *testing.T) {
+	strategy := &cloudprovider.NamespaceHashStrategy{}
+
+	result := strategy.Order(cloudprovider.IPRequest{}, "subnet-1", placementCandidates)
+
+	assert.Equal(t, []string{"eni-1", "eni-2", "eni-3"}, interfaceIDs(result))
+}
+
+func TestWeightedPlacement(t *testing.T) {
+	strategy := &cloudprovider.WeightedStrategy{}
+
+	result := strategy.Order(cloudprovider.IPRequest{}, "subnet-1", placementCandidates)
+
+	// eni-2: 5/15, eni-1: 4/10, eni-3: 6/10
+	assert.Equal(t, []string{"eni-2", "eni-1", "eni-3"}, interfaceIDs(result))
+}
+
+func TestWeightedPlacementWithUnknownCapacity(t *testing.T) {
+	strategy := &cloudprovider.WeightedStrategy{}
+	candidates := []cloudprovider.PlacementCandidate{
+		{InstanceID: "vm-1", InterfaceID: "eni-1", IPCount: 4},
+		{InstanceID: "vm-2", InterfaceID: "eni-2", IPCount: 6, IPCapacity: 20},
+	}
+
+	result := strategy.Order(cloudprovider.IPRequest{}, "subnet-1", candidates)
+
+	// eni-2: 7/20, eni-1 weighted like the smallest known capacity: 5/20
+	assert.Equal(t, []string{"eni-1", "eni-2"}, interfaceIDs(result))
+}
+
+func TestAwsProviderUsesPlacementStrategy(t *testing.T) {
+	defer useMultiInterfaceInstance()()
+
+	mockAws := &mocks.AwsClient{}
+	mockDefaultInstanceAwsCalls(mockAws)
+	mockDefaultSubnetAwsCalls(mockAws)
+
+	request := cloudprovider.IPRequest{Namespace: "my-namespace"}
+
+	placement := &mocks.PlacementStrategy{}
+	placement.On("Name").Return("mocked")
+	placement.On("Order", request, "subnet-1", mock.Anything).
+		Return(func(_ cloudprovider.IPRequest, _ string, candidates []cloudprovider.PlacementCandidate) []cloudprovider.PlacementCandidate {
+			// prefer the secondary interface even though it carries more IPs
+			result := make([]cloudprovider.PlacementCandidate, 0, len(candidates))
+			for _, candidate := range candidates {
+				if candidate.InterfaceID == "eni-1b" {
+					result = append([]cloudprovider.PlacementCandidate{candidate}, result...)
+				} else {
+					result = append(result, candidate)
+				}
+			}
+			return result
+		})
+
+	service := createAwsCloudProvider(mockAws, func(config *cloudprovider.AwsConfig) {
+		config.Placement = placement
+	})
+
+	mockAddSpecifiedIPSuccessfully(mockAws, "eni-1b", "1.1.1.12").Once()
+
+	result, err := service.AddSpecifiedIPs(context.TODO(), request, defaultIPs("1.1.1.12"))
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"vm-1"}, result)
+
+	mockAws.AssertExpectations(t)
+	placement.AssertExpectations(t)
+}
+
+func TestMockCloudUsesConfiguredPlacement(t *testing.T) {
+	config, err := cloudprovider.ParseMockConfig([]byte(mockCloudConfig))
+	assert.Nil(t, err)
+
+	config.Placement = "unknown"
+	_, err = cloudprovider.NewMockCloudProvider(config)
+	assert.NotNil(t, err)
+
+	config.Placement = cloudprovider.RoundRobinPlacement
+	service, err := cloudprovider.NewMockCloudProvider(config)
+	assert.Nil(t, err)
+
+	instances, _, err := service.AddRandomIPs(context.TODO(), cloudprovider.IPRequest{Namespace: "my-namespace"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"vm-1", "vm-2"}, instances)
+}
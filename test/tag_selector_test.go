@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/klenkes74/aws-egressip-operator/pkg/cloudprovider"
+	"github.com/klenkes74/aws-egressip-operator/test/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net"
+	"testing"
+)
+
+func TestTagSelectorMatches(t *testing.T) {
+	tags := map[string]string{
+		"ClusterNode":                 "WorkerNode",
+		"egress":                      "true",
+		"kubernetes.io/cluster/nicer": "shared",
+	}
+
+	cases := map[string]bool{
+		"":                                      true,
+		"ClusterNode":                           true,
+		"!ClusterNode":                          false,
+		"!egress-disabled":                      true,
+		"ClusterNode=WorkerNode":                true,
+		"ClusterNode=InfraNode":                 false,
+		"ClusterNode=InfraNode|WorkerNode":      true,
+		"ClusterNode!=InfraNode":                true,
+		"ClusterNode!=InfraNode|WorkerNode":     false,
+		"missing!=value":                        true,
+		"ClusterNode=WorkerNode,egress=true":    true,
+		"ClusterNode=WorkerNode,egress=false":   false,
+		"ClusterNode=InfraNode || egress=true":  true,
+		"ClusterNode=InfraNode || egress=false": false,
+		"kubernetes.io/cluster/nicer=owned|shared, !egress-disabled": true,
+	}
+
+	for selector, expected := range cases {
+		parsed, err := cloudprovider.ParseTagSelector(selector)
+		assert.Nil(t, err, "selector '%s' should be valid", selector)
+		assert.Equal(t, expected, parsed.Matches(tags), "selector '%s'", selector)
+	}
+}
+
+func TestTagSelectorRejectsInvalidSyntax(t *testing.T) {
+	for _, selector := range []string{",", "a=b,", "a || ", "!a=b", "=value", "!"} {
+		_, err := cloudprovider.ParseTagSelector(selector)
+		assert.NotNil(t, err, "selector '%s' should be invalid", selector)
+	}
+}
+
+func TestNodeAndSubnetSelectorsLimitPlacement(t *testing.T) {
+	original := instances
+	defer func() { instances = original }()
+
+	disabled := createInstance("vm-1", "1.1.1.34", "nice-a", "ip-1-1-1-34.my-local.inf", "subnet-1")
+	disabled.Tags = append(disabled.Tags, &ec2.Tag{Key: aws.String("egress-disabled"), Value: aws.String("true")})
+	instances = map[string]*ec2.Instance{
+		"vm-1": disabled,
+		"vm-2": createInstance("vm-2", "1.1.1.93", "nice-a", "ip-1-1-1-93.my-local.inf", "subnet-1"),
+		"vm-3": createInstance("vm-3", "1.1.2.75", "nice-b", "ip-1-1-2-75.my-local.inf", "subnet-2"),
+	}
+
+	mockAws := &mocks.AwsClient{}
+	mockDefaultInstanceAwsCalls(mockAws)
+
+	sharedSubnet := createSubnet("subnet-1", "1.1.1.0/24", int64(50), "nice-a", "niceA", false)
+	sharedSubnet.Tags = []*ec2.Tag{{Key: aws.String("kubernetes.io/cluster/nicer"), Value: aws.String("shared")}}
+	mockAws.On("DescribeSubnets", mock.Anything, &ec2.DescribeSubnetsInput{
+		Filters: []*ec2.Filter{
+			createFilter("tag-key", []string{"kubernetes.io/cluster/nicer"}),
+		},
+	}).Return(&ec2.DescribeSubnetsOutput{
+		Subnets: append([]*ec2.Subnet{sharedSubnet}, subnets[1:]...),
+	}, nil).Maybe()
+
+	nodeSelector, _ := cloudprovider.ParseTagSelector("ClusterNode=WorkerNode,!egress-disabled")
+	subnetSelector, _ := cloudprovider.ParseTagSelector("kubernetes.io/cluster/nicer=shared")
+
+	service := createAwsCloudProvider(mockAws, func(config *cloudprovider.AwsConfig) {
+		config.NodeSelector = nodeSelector
+		config.SubnetSelector = subnetSelector
+	})
+
+	mockAddRandomIPSuccessfully(mockAws, "vm-2", "1.1.1.11").Once()
+
+	instanceIDs, ips, err := service.AddRandomIPs(context.TODO(), cloudprovider.IPRequest{})
+
+	ip := net.ParseIP("1.1.1.11")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"vm-2"}, instanceIDs)
+	assert.Equal(t, []*net.IP{&ip}, ips)
+
+	mockAws.AssertExpectations(t)
+}
+
+func TestDefaultSubnetSelectorUsesSharedSubnets(t *testing.T) {
+	mockAws := &mocks.AwsClient{}
+	mockDefaultInstanceAwsCalls(mockAws)
+
+	sharedSubnet := createSubnet("subnet-1", "1.1.1.0/24", int64(50), "nice-a", "niceA", false)
+	sharedSubnet.Tags = []*ec2.Tag{{Key: aws.String("kubernetes.io/cluster/nicer"), Value: aws.String("shared")}}
+	mockAws.On("DescribeSubnets", mock.Anything, &ec2.DescribeSubnetsInput{
+		Filters: []*ec2.Filter{
+			createFilter("tag-key", []string{"kubernetes.io/cluster/nicer"}),
+		},
+	}).Return(&ec2.DescribeSubnetsOutput{
+		Subnets: []*ec2.Subnet{sharedSubnet},
+	}, nil).Maybe()
+
+	service := createAwsCloudProvider(mockAws)
+
+	mockAws.On("AssignPrivateIPAddresses", mock.Anything, mock.Anything).
+		Return(&ec2.AssignPrivateIpAddressesOutput{
+			AssignedPrivateIpAddresses: []*ec2.AssignedPrivateIpAddress{{PrivateIpAddress: aws.String("1.1.1.11")}},
+		}, nil).
+		Once()
+
+	_, ips, err := service.AddRandomIPs(context.TODO(), cloudprovider.IPRequest{})
+
+	ip := net.ParseIP("1.1.1.11")
+	assert.Nil(t, err)
+	assert.Equal(t, []*net.IP{&ip}, ips)
+
+	mockAws.AssertExpectations(t)
+}
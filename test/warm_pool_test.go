@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"github.com/klenkes74/aws-egressip-operator/pkg/cloudprovider"
+	"github.com/klenkes74/aws-egressip-operator/test/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestWarmPoolRefillsEverySubnet(t *testing.T) {
+	pool := cloudprovider.NewWarmPool(createMockCloudProvider(t), 1, time.Minute)
+
+	err := pool.Refill(context.TODO())
+
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, defaultIPs("1.1.1.5", "1.1.2.4"), pool.Unclaimed())
+}
+
+func TestWarmPoolHandsOutUnclaimedIPs(t *testing.T) {
+	pool := cloudprovider.NewWarmPool(createMockCloudProvider(t), 1, time.Minute)
+	assert.Nil(t, pool.Refill(context.TODO()))
+
+	instanceIDs, ips, err := pool.AddRandomIPs(context.TODO(), cloudprovider.IPRequest{Namespace: "my-namespace"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"vm-1", "vm-2"}, instanceIDs)
+	assert.Equal(t, defaultIPs("1.1.1.5", "1.1.2.4"), ips)
+	assert.Empty(t, pool.Unclaimed())
+
+	// the interfaces of both subnets are full now
+	err = pool.Refill(context.TODO())
+	assert.NotNil(t, err)
+	assert.Empty(t, pool.Unclaimed())
+
+	_, _, err = pool.AddRandomIPs(context.TODO(), cloudprovider.IPRequest{})
+	assert.NotNil(t, err)
+}
+
+func TestWarmPoolHandsOutIPsOfSelectedZones(t *testing.T) {
+	pool := cloudprovider.NewWarmPool(createMockCloudProvider(t), 1, time.Minute)
+	assert.Nil(t, pool.Refill(context.TODO()))
+
+	instanceIDs, ips, err := pool.AddRandomIPs(context.TODO(), cloudprovider.IPRequest{Zones: []string{"nice-b"}})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"vm-2"}, instanceIDs)
+	assert.Equal(t, defaultIPs("1.1.2.4"), ips)
+	assert.Equal(t, defaultIPs("1.1.1.5"), pool.Unclaimed())
+}
+
+func TestWarmPoolPassesIPv6RequestsThrough(t *testing.T) {
+	request := cloudprovider.IPRequest{Families: []cloudprovider.IPFamily{cloudprovider.IPv6}}
+
+	cloud := &mocks.CloudProvider{}
+	cloud.On("AddRandomIPs", mock.Anything, request).Return([]string{"vm-1"}, defaultIPs("2001:db8:1::4"), nil).Once()
+
+	pool := cloudprovider.NewWarmPool(cloud, 1, time.Minute)
+	instanceIDs, ips, err := pool.AddRandomIPs(context.TODO(), request)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"vm-1"}, instanceIDs)
+	assert.Equal(t, defaultIPs("2001:db8:1::4"), ips)
+
+	cloud.AssertExpectations(t)
+}
+
+func TestWarmPoolDrainRemovesUnclaimedIPs(t *testing.T) {
+	cloud := createMockCloudProvider(t)
+	pool := cloudprovider.NewWarmPool(cloud, 1, time.Minute)
+	assert.Nil(t, pool.Refill(context.TODO()))
+
+	pool.Drain(context.TODO())
+
+	assert.Empty(t, pool.Unclaimed())
+
+	instance, err := cloud.Instance(context.TODO(), "vm-1")
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, defaultIPs("1.1.1.4"), (*instance).SecondaryIps())
+
+	ip := net.ParseIP("1.1.2.4")
+	_, err = cloud.RemoveIP(context.TODO(), &ip)
+	assert.NotNil(t, err)
+}
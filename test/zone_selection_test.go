@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/klenkes74/aws-egressip-operator/pkg/cloudprovider"
+	"github.com/klenkes74/aws-egressip-operator/pkg/openshift"
+	"github.com/klenkes74/aws-egressip-operator/test/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net"
+	"testing"
+)
+
+func TestSelectZones(t *testing.T) {
+	available := []string{"nice-c", "nice-a", "nice-b", "nice-a"}
+
+	zones, err := cloudprovider.IPRequest{}.SelectZones(available)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"nice-a", "nice-b", "nice-c"}, zones)
+
+	zones, err = cloudprovider.IPRequest{ZoneCount: 2}.SelectZones(available)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"nice-a", "nice-b"}, zones)
+
+	zones, err = cloudprovider.IPRequest{Zones: []string{"nice-c", "nice-a"}, ZoneCount: 1}.SelectZones(available)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"nice-c"}, zones)
+
+	_, err = cloudprovider.IPRequest{Zones: []string{"nice-d"}}.SelectZones(available)
+	assert.NotNil(t, err)
+
+	_, err = cloudprovider.IPRequest{Zones: []string{"nice-b"}, ZoneCount: 2}.SelectZones(available)
+	assert.NotNil(t, err)
+}
+
+func TestFailoverZones(t *testing.T) {
+	available := []string{"nice-c", "nice-a", "nice-b", "nice-a"}
+
+	assert.Equal(t, []string{"nice-b", "nice-c"}, cloudprovider.IPRequest{}.FailoverZones(available, "nice-a"))
+	assert.Equal(t, []string{"nice-c", "nice-b"},
+		cloudprovider.IPRequest{Zones: []string{"nice-a", "nice-c", "nice-d"}}.FailoverZones(available, "nice-a"))
+}
+
+func TestParseZones(t *testing.T) {
+	assert.Equal(t, []string{"nice-b", "nice-a"}, cloudprovider.ParseZones(" nice-b,nice-a,,nice-b"))
+	assert.Nil(t, cloudprovider.ParseZones(""))
+}
+
+func TestAddRandomIPsInPreferredZones(t *testing.T) {
+	original := instances
+	defer func() { instances = original }()
+	instances = map[string]*ec2.Instance{
+		"vm-1": createInstance("vm-1", "1.1.1.34", "nice-a", "ip-1-1-1-34.my-local.inf", "subnet-1"),
+		"vm-3": createInstance("vm-3", "1.1.2.75", "nice-b", "ip-1-1-2-75.my-local.inf", "subnet-2"),
+		"vm-5": createInstance("vm-5", "1.1.3.21", "nice-c", "ip-1-1-3-21.my-local.inf", "subnet-3"),
+	}
+
+	mockAws := &mocks.AwsClient{}
+	service := createAwsCloudProviderMock(mockAws)
+
+	mockAddRandomIPSuccessfully(mockAws, "vm-3", "1.1.2.22")
+	mockAddRandomIPSuccessfully(mockAws, "vm-5", "1.1.3.33")
+
+	instanceIDs, ips, err := service.AddRandomIPs(context.TODO(), cloudprovider.IPRequest{Zones: []string{"nice-c", "nice-b"}})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"vm-5", "vm-3"}, instanceIDs)
+	assert.Equal(t, defaultIPs("1.1.3.33", "1.1.2.22"), ips)
+}
+
+func TestAddRandomIPsInUnknownZone(t *testing.T) {
+	mockAws := &mocks.AwsClient{}
+	service := createAwsCloudProviderMock(mockAws)
+
+	_, _, err := service.AddRandomIPs(context.TODO(), cloudprovider.IPRequest{Zones: []string{"nice-x"}})
+
+	assert.NotNil(t, err)
+	mockAws.AssertNotCalled(t, "AssignPrivateIPAddresses", mock.Anything, mock.Anything)
+}
+
+func TestMockCloudAddRandomIPsInZoneCount(t *testing.T) {
+	service := createMockCloudProvider(t)
+
+	instances, ips, err := service.AddRandomIPs(context.TODO(), cloudprovider.IPRequest{ZoneCount: 1})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"vm-1"}, instances)
+	assert.Equal(t, defaultIPs("1.1.1.5"), ips)
+}
+
+func TestHandlerPassesZonesToCloudProvider(t *testing.T) {
+	cloud := &mocks.CloudProvider{}
+	cloud.On("AddRandomIPs", mock.Anything, cloudprovider.IPRequest{
+		Namespace: "default-namespace",
+		Zones:     []string{"nice-b", "nice-a"},
+		ZoneCount: 1,
+	}).Return([]string{}, []*net.IP{}, nil).Once()
+
+	mockOcp := &mocks.OcpClient{}
+	mockSaveNamespaces(mockOcp)
+	service := *openshift.NewEgressIPHandler(cloud, mockOcp)
+
+	namespace := defaultNamespace()
+	namespace.Annotations[openshift.ZonesAnnotation] = "nice-b,nice-a"
+	namespace.Annotations[openshift.ZoneCountAnnotation] = "1"
+	_, err := service.AddIPsToInfrastructure(context.TODO(), namespace)
+
+	assert.Nil(t, err)
+	cloud.AssertExpectations(t)
+
+	namespace.Annotations[openshift.ZoneCountAnnotation] = "none"
+	_, err = service.AddIPsToInfrastructure(context.TODO(), namespace)
+
+	assert.NotNil(t, err)
+}